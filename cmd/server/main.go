@@ -1,52 +1,630 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"github.com/pandharkardeep/social-graph/internal/audit"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/backup"
+	"github.com/pandharkardeep/social-graph/internal/chaos"
+	"github.com/pandharkardeep/social-graph/internal/cluster"
+	"github.com/pandharkardeep/social-graph/internal/config"
+	"github.com/pandharkardeep/social-graph/internal/debugsrv"
 	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/exclusions"
+	"github.com/pandharkardeep/social-graph/internal/feedback"
+	"github.com/pandharkardeep/social-graph/internal/flags"
 	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/invalidate"
+	"github.com/pandharkardeep/social-graph/internal/identity"
+	"github.com/pandharkardeep/social-graph/internal/idmap"
+	"github.com/pandharkardeep/social-graph/internal/journal"
+	"github.com/pandharkardeep/social-graph/internal/logging"
+	"github.com/pandharkardeep/social-graph/internal/membudget"
 	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/middleware"
 	"github.com/pandharkardeep/social-graph/internal/pymk"
+	"github.com/pandharkardeep/social-graph/internal/raftstore"
+	"github.com/pandharkardeep/social-graph/internal/replica"
+	"github.com/pandharkardeep/social-graph/internal/scheduler"
 	"github.com/pandharkardeep/social-graph/internal/server"
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+	"github.com/pandharkardeep/social-graph/internal/snapshot"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+	"github.com/pandharkardeep/social-graph/internal/topics"
+	"github.com/pandharkardeep/social-graph/internal/tracing"
+	"github.com/pandharkardeep/social-graph/internal/users"
 )
 
 func main() {
-	// --- Core stores ---
-	g := graph.NewMemGraph()
-	e := embeds.NewMemEmbeds()
-
-	// --- PYMK service with sensible defaults ---
-	svc := pymk.NewService(g, e, pymk.PYMKConfig{
-		MaxExpandPerNeighbor: 200,   // fan-out cap per neighbor
-		MaxCandidates:        20000, // hard-ish cap
-		WCommon:              1.00,
-		WJaccard:             0.60,
-		WAA:                  0.80,
-		WCosine:              1.00,
-		CacheSize:            100_000,        // LRU entries
-		CacheTTL:             2 * time.Minute, // short TTL to stay fresh
+	// --- Config: defaults < file (-config / SG_CONFIG) < env < flags ---
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil { fatal("config", err) }
+
+	// --- Logging ---
+	var level slog.LevelVar // changes on config reload
+	lv, _ := logging.ParseLevel(cfg.Log.Level) // validated by config
+	level.Set(lv)
+	slog.SetDefault(logging.New(os.Stdout, &level, logging.Sampling{First: cfg.Log.SampleFirst, Thereafter: cfg.Log.SampleThereafter}))
+
+	// --- Tracing (no-op unless OTEL_EXPORTER_OTLP_ENDPOINT is set) ---
+	shutdown, err := tracing.Init(context.Background(), "social-graph")
+	if err != nil { fatal("tracing", err) }
+
+	// Stop on SIGINT/SIGTERM so buffered spans get flushed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// --- Tenants: each gets its own graph, embeds and PYMK service ---
+	reg := tenant.NewRegistry(cfg.PYMK)
+	reg.AutoCreate = cfg.Tenants.AutoCreate
+	reg.Shards = cfg.Store.Shards
+	reg.FrozenReads = cfg.Store.FrozenReads > 0
+	reg.LoadWorkers = cfg.Store.LoadWorkers
+	for _, g := range cfg.Tenants.Graphs {
+		if g = strings.TrimSpace(g); g != "" { reg.Graphs = append(reg.Graphs, g) }
+	}
+	reg.Flags, _ = flags.New(cfg.Flags) // validated by config
+	locals := localTenants{reg}
+	metrics.RegisterShardOccupancy(func(report func(shard, out, in, edges int)) {
+		for _, name := range reg.Names() {
+			t, err := reg.Get(name)
+			if err != nil { continue }
+			for _, st := range t.Local.MemStats() { report(st.Shard, st.FollowingUsers, st.FollowerUsers, st.Edges) }
+		}
 	})
 
+	// --- Hot/cold tiering: spill cold users to disk near the ceiling or when idle ---
+	if st := cfg.Store; st.MemoryLimit > 0 || st.ColdAfter > 0 {
+		mb := membudget.New(st.MemoryLimit, st.SpillDir, time.Second, st.ColdAfter)
+		reg.Use(func(t *tenant.Tenant) {
+			if err := mb.Add(t.Local); err != nil { fatal("spill "+t.Name, err) }
+		})
+		reg.OnDrop(func(t *tenant.Tenant) { mb.Remove(t.Local) })
+		metrics.RegisterTierOccupancy(func(report func(hotUsers, coldUsers int, hotBytes, coldBytes, fileBytes int64)) {
+			for _, g := range mb.Graphs() {
+				var hu, cu int
+				var hb int64
+				for _, s := range g.MemStats() { hu += s.ResidentUsers; cu += s.SpilledUsers; hb += s.EstBytes }
+				size, live := g.SpillFileStats()
+				report(hu, cu, hb, live, size)
+			}
+		})
+		go mb.Run(ctx)
+	}
+
+	// --- Scheduler: periodic jobs, none overlapping itself; started below ---
+	jobs := scheduler.New()
+
+	// --- Frozen views: PYMK reads neighbors without shard locks ---
+	if every := cfg.Store.FrozenReads; every > 0 {
+		jobs.Add("freeze", every, false, func(ctx context.Context) error {
+			for _, name := range reg.Names() {
+				if tn, err := reg.Get(name); err == nil { tn.Local.Freeze() }
+			}
+			return ctx.Err()
+		})
+	}
+
+	// --- Epoch churn: users whose cached suggestions go stale soonest ---
+	if ch := cfg.Churn; ch.Track > 0 {
+		reg.Use(func(t *tenant.Tenant) {
+			t.Churn = &tenant.Churn{HeavyHitters: sketch.NewHeavyHitters(ch.Track, ch.Decay), Min: ch.MinChanges, TTL: ch.HotCacheTTL}
+			changes := metrics.EpochChanges.WithLabelValues(t.Name)
+			t.Local.OnTouch(func(u uint64) { t.Churn.Observe(u); changes.Inc() })
+		})
+		metrics.RegisterChurn(func(report func(tenant string, hotUsers int, topChanges uint32)) {
+			for _, name := range reg.Names() {
+				tn, err := reg.Get(name)
+				if err != nil || tn.Churn == nil { continue }
+				var top uint32
+				if t := tn.Churn.Top(1); len(t) > 0 { top = t[0].Count }
+				report(name, len(tn.Churn.HotUsers()), top)
+			}
+		})
+	}
+
+	// --- Hot keys: track most-queried users, keep their PYMK cached ---
+	if hk := cfg.HotKeys; hk.Track > 0 {
+		reg.Use(func(t *tenant.Tenant) { t.Hot = sketch.NewHeavyHitters(hk.Track, hk.Decay) })
+		if hk.Warm > 0 { jobs.Add("warm_hot", hk.WarmInterval, false, func(ctx context.Context) error { return warmHot(ctx, reg, hk) }) }
+	}
+
+	// --- Integrity: periodically check both halves of every edge agree ---
+	if ic := cfg.Integrity; ic.Interval > 0 {
+		jobs.Add("integrity", ic.Interval, false, func(context.Context) error { return checkIntegrity(reg, ic) })
+	}
+	// --- Communities: periodic label propagation for community-scoped PYMK ---
+	if cc := cfg.Community; cc.Interval > 0 {
+		jobs.Add("communities", cc.Interval, true, func(ctx context.Context) error { return detectCommunities(ctx, reg, cc) })
+	}
+	if ic := cfg.Interactions; ic.HalfLife > 0 {
+		decay := decayWeights(reg, ic)
+		jobs.Add("decay_weights", ic.DecayInterval, false, func(context.Context) error { decay(); return nil })
+	}
+	// --- Snapshots, embedding retraining and /top rankings ---
+	sj := cfg.Scheduler
+	var snaps *snapshot.Writer // set once the journal exists
+	if sj.Snapshots > 0 {
+		jobs.Add("snapshots", sj.Snapshots, false, func(ctx context.Context) error { return writeSnapshots(ctx, reg, snaps) })
+	}
+	if sj.Embeddings > 0 {
+		jobs.Add("embeddings", sj.Embeddings, false, func(ctx context.Context) error { return trainEmbeddings(ctx, reg, sj.EmbeddingDim) })
+	}
+	if sj.Ranks > 0 {
+		// A missed run still leaves requests to rescan, just later.
+		reg.Use(func(t *tenant.Tenant) { t.Top.SetEvery(2 * sj.Ranks) })
+		jobs.Add("ranks", sj.Ranks, true, func(context.Context) error { refreshRanks(reg); return nil })
+	}
+
+	// --- Cluster mode: this node owns a hash range of user IDs ---
+	var cl *cluster.Cluster
+	if cfg.Cluster.Enabled {
+		if cl, err = cluster.New(cfg.Cluster); err != nil { fatal("cluster", err) }
+		reg.Use(func(t *tenant.Tenant) {
+			t.G, t.E = cl.Store(t.Name, t.Local), cl.Embeds(t.Name, t.E)
+		})
+		slog.Info("cluster mode", "self", cl.Self.ID, "peers", len(cl.Ring.Nodes()))
+	}
+
+	// --- Raft mode: every node replicates the full graph ---
+	var rn *raftstore.Node
+	if cfg.Raft.Enabled {
+		if rn, err = raftstore.New(cfg.Raft); err != nil { fatal("raft", err) }
+		reg.Use(func(t *tenant.Tenant) { t.G = rn.Store(t.Name, t.Local) })
+		slog.Info("raft mode", "node_id", cfg.Raft.NodeID, "bind", cfg.Raft.BindAddr)
+	}
+
+	// --- Mutation journal: records every successful follow/unfollow ---
+	jrnl := journal.New(cfg.Journal.Capacity, cfg.Journal.Retention)
+	reg.Use(func(t *tenant.Tenant) {
+		js := journal.Wrap(t.G, jrnl, t.Name)
+		t.G = js
+		t.OnReplace(js.Replaced)
+	})
+	// --- Dense IDs: every user gets a stable uint32 index on first follow ---
+	if im := cfg.IDMap; im.Enabled {
+		reg.Use(func(t *tenant.Tenant) {
+			t.IDs = idmap.New()
+			if im.Dir != "" {
+				if t.IDs, err = idmap.Open(filepath.Join(im.Dir, t.Name+".ids")); err != nil { fatal("idmap "+t.Name, err) }
+			}
+			t.G = idmap.Wrap(t.G, t.IDs)
+		})
+		reg.OnDrop(func(t *tenant.Tenant) {
+			t.IDs.Close()
+			if im.Dir != "" && t.Ephemeral() { _ = os.Remove(filepath.Join(im.Dir, t.Name+".ids")) }
+		})
+		defer func() {
+			for _, name := range reg.Names() {
+				if tn, err := reg.Get(name); err == nil { tn.IDs.Close() }
+			}
+		}()
+	}
+	// Deltas replay the journal onto the local graph, which only holds
+	// every journaled write (and nothing else) on a single node.
+	if cfg.Cluster.Enabled || cfg.Raft.Enabled || cfg.Replication.Role == "replica" {
+		snaps = snapshot.NewWriter(sj.SnapshotDir, nil, 0)
+	} else {
+		snaps = snapshot.NewWriter(sj.SnapshotDir, jrnl, sj.MaxDeltas)
+	}
+
+	// --- Invalidation: followers of a changed user see it before the TTL ---
+	if iv := cfg.Invalidation; iv.Enabled {
+		bus := invalidate.NewLocal(iv.Buffer)
+		reg.Use(func(t *tenant.Tenant) { t.G = invalidate.Wrap(t.G, bus, t.Name) })
+		bus.Subscribe(func(e invalidate.Event) {
+			t, err := reg.Get(e.Tenant)
+			if err != nil { return }
+			if _, err := t.InvalidateFollowers(ctx, e.Users, iv.Fanout); err != nil {
+				slog.Warn("invalidation failed", "tenant", e.Tenant, "err", err)
+			}
+		})
+		go bus.Run(ctx)
+	}
+
+	// --- Audit log: who changed what, kept on disk for investigations ---
+	var audlog *audit.Log
+	if cfg.Audit.Path != "" {
+		if audlog, err = audit.Open(cfg.Audit.Path); err != nil { fatal("audit", err) }
+		defer audlog.Close()
+		reg.Use(func(t *tenant.Tenant) { t.G = audit.Wrap(t.G, audlog, t.Name) })
+	}
+	// Chaos wraps outermost, so injected failures never reach the
+	// journal or the audit log.
+	if cfg.Chaos.Enabled {
+		slog.Warn("chaos: fault injection enabled", "environment", cfg.Server.Environment, "routes", len(cfg.Chaos.Routes), "store", len(cfg.Chaos.Store))
+		reg.Use(func(t *tenant.Tenant) { t.G = chaos.Store(cfg.Chaos, t.G) })
+	}
+
+	// --- PYMK feedback and exclusions, per user ---
+	fb := feedback.New()
+	if cfg.Feedback.Path != "" {
+		if fb, err = feedback.Open(cfg.Feedback.Path); err != nil { fatal("feedback", err) }
+		defer fb.Close()
+	}
+	excl := exclusions.New(cfg.Exclusions.MaxPerUser)
+	if cfg.Exclusions.Path != "" {
+		if excl, err = exclusions.Open(cfg.Exclusions.Path, cfg.Exclusions.MaxPerUser); err != nil { fatal("exclusions", err) }
+		defer excl.Close()
+	}
+	vend, err := users.NewIDs(cfg.UserIDs.Node)
+	if err != nil { fatal("user ids", err) }
+	idents := identity.New()
+	if cfg.Identities.Path != "" {
+		if idents, err = identity.Open(cfg.Identities.Path); err != nil { fatal("identities", err) }
+		defer idents.Close()
+	}
+
+	// --- User→topic follows, beside the user graph ---
+	reg.Topics = topics.New(cfg.Topics.MaxPerUser)
+	if cfg.Topics.Path != "" {
+		if reg.Topics, err = topics.Open(cfg.Topics.Path, cfg.Topics.MaxPerUser); err != nil { fatal("topics", err) }
+		defer reg.Topics.Close()
+	}
+
+	reg.SetProfiles(cfg.Profiles())
+	names := append([]string{tenant.Default}, cfg.Tenants.Names...)
+	for name := range cfg.Tenants.PYMK { names = append(names, name) }
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" { continue }
+		pc, err := cfg.TenantPYMK(name)
+		if err != nil { fatal("tenant "+name, err) }
+		t, err := reg.Create(name, &pc)
+		if err != nil { fatal("tenant "+name, err) }
+		if t.Graph != "" { // overrides for a named graph, which its tenant may have created already
+			if err := t.SetProfiles(pc, cfg.Profiles()); err != nil { fatal("tenant "+name, err) }
+			t.Svc.SetConfig(pc)
+		}
+	}
+	if rn != nil {
+		if err := rn.Start(locals); err != nil { fatal("raft", err) }
+		defer rn.Shutdown()
+	}
+
+	// --- Config reload: SIGHUP or a change to the config file ---
+	var current atomic.Pointer[config.Config]
+	current.Store(cfg)
+	reloads := make(chan struct{}, 1)
+	poke := func() { select { case reloads <- struct{}{}: default: } }
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				poke()
+			case <-reloads:
+				reloadConfig(&current, reg, &level)
+			}
+		}
+	}()
+	go cfg.Watch(ctx, poke)
+
+	if sj.RestoreSnapshots { restoreSnapshots(reg, sj.SnapshotDir) }
+
+	// --- Backups: periodic snapshots to object storage ---
+	var bk *backup.Backup
+	if cfg.Backup.Provider != "" {
+		if bk, err = backup.New(cfg.Backup, locals); err != nil { fatal("backup", err) }
+		if cfg.Backup.RestoreOnBoot {
+			key, err := bk.Restore(ctx)
+			if err != nil { fatal("backup restore", err) }
+			slog.Info("restored from backup", "key", key)
+		}
+		jobs.Add("backup", cfg.Backup.Interval, false, func(ctx context.Context) error { _, err := bk.Once(ctx); return err })
+	}
+	if cfg.IDMap.Enabled { assignRestored(reg) }
+	go jobs.Run(ctx)
+
+	// --- Async replication: primary streams its journal over gRPC ---
+	switch cfg.Replication.Role {
+	case "primary":
+		p := replica.NewPrimary(cfg.Replication, jrnl, locals)
+		go func() { fatal("replication", p.Serve()) }()
+		defer p.Stop()
+	case "replica":
+		go replica.NewReplica(cfg.Replication, locals).Run(ctx)
+		slog.Info("read-only replica", "primary", cfg.Replication.Primary)
+	}
+
+	// --- Auth: keys from config and/or a JWT secret ---
+	var authn *auth.Authenticator
+	if keys := cfg.AuthKeys(); len(keys) > 0 || cfg.Auth.JWTSecret != "" {
+		var err error
+		if authn, err = auth.New([]byte(cfg.Auth.JWTSecret), keys...); err != nil { fatal("auth", err) }
+	} else {
+		slog.Warn("no auth keys or JWT secret configured, all endpoints are unauthenticated")
+	}
+
 	// --- HTTP server & routes ---
 	mux := http.NewServeMux()
-	server.AttachRoutes(mux, svc, g, e)
+	deps := server.Deps{Tenants: reg, Auth: authn, Config: current.Load, Audit: audlog, Feedback: fb, Exclusions: excl, Identities: idents, UserIDs: vend, Jobs: jobs, Journal: jrnl}
+	server.AttachRoutes(mux, deps)
+	if rn != nil {
+		mux.Handle("/internal/raft/apply", rn.Handler())
+		mux.HandleFunc("/admin/raft", authn.Require(auth.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(rn.Status())
+		}))
+	}
+	if bk != nil {
+		mux.HandleFunc("/admin/backup", authn.Require(auth.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+			key, err := bk.Once(r.Context())
+			if err != nil { http.Error(w, err.Error(), 502); return }
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"key": key})
+		}))
+	}
+	if cl != nil {
+		mux.Handle("/internal/", cl.Handler(func(name string) (*graph.MemGraph, embeds.Store, error) {
+			t, err := reg.Get(name)
+			if err != nil { return nil, nil, err }
+			return t.Local, t.E.(*cluster.Embeds).Local(), nil
+		}))
+	}
 
-	addr := getenv("ADDR", ":8080")
+	sc := cfg.Server
+	var h http.Handler = metrics.HTTPMetricsMiddleware(chaos.Middleware(cfg.Chaos, mux), reg.Has)
+	h = middleware.Compress(cfg.Compression, h)
+	if cl != nil { h = cl.Forward(h) }
+	h = logging.AccessLog(sc.SlowRequest, h)
+	h = tracing.Middleware(h)
+	h = tenant.Middleware(h)
+	if cfg.Replication.Role == "replica" { h = replica.ReadOnly(h) }
+	h = middleware.CORS(cfg.CORS, h) // outermost: preflights skip auth
 	srv := &http.Server{
-		Addr:              addr,
-		Handler:           metrics.HTTPMetricsMiddleware(mux),
-		ReadHeaderTimeout: 5 * time.Second,
+		Addr:              sc.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: sc.ReadHeaderTimeout,
+		ReadTimeout:       sc.ReadTimeout,
+		WriteTimeout:      sc.WriteTimeout,
+		IdleTimeout:       sc.IdleTimeout,
+	}
+
+	// --- Optional admin listener: pprof, expvar, /debug/runtime ---
+	if sc.AdminAddr != "" {
+		dbg := authn.Require(auth.ScopeAdmin, debugsrv.Handler().ServeHTTP)
+		go func() {
+			slog.Info("debug endpoints listening", "addr", sc.AdminAddr)
+			fatal("admin listener", http.ListenAndServe(sc.AdminAddr, dbg))
+		}()
+	}
+
+	// --- Optional gRPC listener: streaming PYMK ---
+	if sc.GRPCAddr != "" {
+		gs := server.NewGRPC(deps)
+		ln, err := net.Listen("tcp", sc.GRPCAddr)
+		if err != nil { fatal("grpc listener", err) }
+		go func() {
+			slog.Info("grpc listening", "addr", sc.GRPCAddr)
+			fatal("grpc listener", gs.Serve(ln))
+		}()
+		defer gs.GracefulStop()
+	}
+
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), sc.ShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+
+	slog.Info("social-graph listening", "addr", sc.Addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fatal("listen", err)
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = shutdown(sctx)
+}
+
+// warmHot precomputes default-size PYMK for each tenant's hottest users
+// so their requests hit the cache, those with epoch churn first.
+func warmHot(ctx context.Context, reg *tenant.Registry, hk config.HotKeys) error {
+	for _, name := range reg.Names() {
+		tn, err := reg.Get(name)
+		if err != nil || tn.Hot == nil { continue }
+		hits := tn.Hot.Top(hk.Warm)
+		ids := make([]uint64, len(hits))
+		for i, h := range hits { ids[i] = h.User }
+		// Churning users' caches go stale soonest: refresh them first.
+		slices.SortStableFunc(ids, func(a, b uint64) int {
+			switch ha, hb := tn.Churn.Hot(a), tn.Churn.Hot(b); {
+			case ha && !hb:
+				return -1
+			case hb && !ha:
+				return 1
+			}
+			return 0
+		})
+		tn.Svc.Warm(ctx, ids, 0)
+	}
+	return ctx.Err()
+}
+
+// detectCommunities re-runs community detection on every tenant.
+func detectCommunities(ctx context.Context, reg *tenant.Registry, cc config.Community) error {
+	var errs []error
+	for _, name := range reg.Names() {
+		tn, err := reg.Get(name)
+		if err != nil { continue }
+		if _, err := tn.DetectCommunities(ctx, cc.Rounds); err != nil {
+			if ctx.Err() != nil { return ctx.Err() }
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decayWeights returns a job halving every tenant's interaction weights
+// each half-life, applying the decay for the time actually passed since
+// its last run.
+func decayWeights(reg *tenant.Registry, ic config.Interactions) func() {
+	last := time.Now()
+	return func() {
+		now := time.Now()
+		factor := math.Exp2(-float64(now.Sub(last)) / float64(ic.HalfLife))
+		last = now
+		for _, name := range reg.Names() {
+			tn, err := reg.Get(name)
+			if err != nil { continue }
+			kept, dropped := tn.Weights.Decay(factor, ic.MinWeight)
+			slog.Debug("interaction weights decayed", "tenant", name, "factor", factor, "kept", kept, "dropped", dropped)
+		}
+	}
+}
+
+// checkIntegrity runs an integrity check over every tenant.
+func checkIntegrity(reg *tenant.Registry, ic config.Integrity) error {
+	var errs []error
+	for _, name := range reg.Names() {
+		tn, err := reg.Get(name)
+		if err != nil { continue }
+		if _, err := tn.CheckIntegrity(ic.Repair); err != nil { errs = append(errs, fmt.Errorf("%s: %w", name, err)) }
+	}
+	return errors.Join(errs...)
+}
+
+// writeSnapshots extends every tenant's snapshot chain (see
+// snapshot.Writer).
+func writeSnapshots(ctx context.Context, reg *tenant.Registry, w *snapshot.Writer) error {
+	for _, name := range reg.Names() {
+		if err := ctx.Err(); err != nil { return err }
+		tn, err := reg.Get(name)
+		if err != nil || tn.Ephemeral() { continue }
+		start := time.Now()
+		res, err := w.Write(name, tn.Local)
+		if err != nil { return fmt.Errorf("%s: %w", name, err) }
+		if res.Kind == "none" { continue }
+		slog.Info("snapshot written", "tenant", name, "kind", res.Kind, "path", res.Path, "bytes", res.Bytes, "events", res.Events, "took_ms", time.Since(start).Milliseconds())
+	}
+	return nil
+}
+
+// restoreSnapshots loads every tenant's snapshot chain from dir, exiting
+// on any that fails verification.
+func restoreSnapshots(reg *tenant.Registry, dir string) {
+	for _, name := range reg.Names() {
+		tn, err := reg.Get(name)
+		if err != nil { continue }
+		start := time.Now()
+		res, err := snapshot.Restore(dir, name, tn.Local)
+		if errors.Is(err, os.ErrNotExist) { slog.Info("no snapshot to restore", "tenant", name); continue }
+		if err != nil { fatal("snapshot restore "+name, err) }
+		slog.Info("restored from snapshot", "tenant", name, "deltas", res.Deltas, "events", res.Events, "took_ms", time.Since(start).Milliseconds())
+	}
+}
+
+// assignRestored maps the users of graphs restored from snapshots or
+// backups, which arrive without going through the idmap wrapper.
+func assignRestored(reg *tenant.Registry) {
+	for _, name := range reg.Names() {
+		tn, err := reg.Get(name)
+		if err != nil { continue }
+		before := tn.IDs.Len()
+		if err := tn.IDs.AssignAll(tn.Local.EachEdge); err != nil { fatal("idmap "+name, err) }
+		slog.Info("dense ids", "tenant", name, "users", tn.IDs.Len(), "assigned", tn.IDs.Len()-before)
+	}
+}
+
+// trainEmbeddings replaces the embeddings of every tenant's connected
+// users with ones derived from the graph (see embeds.Train).
+func trainEmbeddings(ctx context.Context, reg *tenant.Registry, dim int) error {
+	for _, name := range reg.Names() {
+		tn, err := reg.Get(name)
+		if err != nil || tn.Graph != "" { continue } // named graphs share their tenant's embeddings
+		n, err := embeds.Train(ctx, tn.Local.EachEdge, dim, tn.E.Put)
+		if err != nil { return fmt.Errorf("%s: %w", name, err) }
+		slog.Info("embeddings retrained", "tenant", name, "users", n, "dim", dim)
+	}
+	return nil
+}
+
+// refreshRanks rescans every tenant's /top rankings.
+func refreshRanks(reg *tenant.Registry) {
+	for _, name := range reg.Names() {
+		if tn, err := reg.Get(name); err == nil { tn.Top.Refresh() }
+	}
+}
+
+// reloadConfig re-reads file, env and flags, logs every difference and
+// applies the ones that are safe to change live (see config.Diff). An
+// invalid new config is rejected whole.
+func reloadConfig(current *atomic.Pointer[config.Config], reg *tenant.Registry, level *slog.LevelVar) {
+	old := current.Load()
+	next, err := config.Load(os.Args[1:])
+	if err != nil { slog.Error("config reload failed, keeping current config", "err", err); return }
+	changes := config.Diff(old, next)
+	pymkChanged, flagsChanged := false, false
+	for _, c := range changes {
+		if !c.Reloadable {
+			slog.Warn("config changed, restart to apply", "path", c.Path, "old", c.Old, "new", c.New)
+			continue
+		}
+		slog.Info("config changed", "path", c.Path, "old", c.Old, "new", c.New)
+		if strings.HasPrefix(c.Path, "pymk.") || c.Path == "tenants.pymk" || c.Path == "pymk_profiles" { pymkChanged = true }
+		if c.Path == "flags" { flagsChanged = true }
 	}
 
-	log.Printf("social-graph listening on %s", addr)
-	log.Fatal(srv.ListenAndServe())
+	pcs := make(map[*tenant.Tenant]pymk.PYMKConfig)
+	if pymkChanged {
+		for _, name := range reg.Names() {
+			t, err := reg.Get(name)
+			if err != nil { continue }
+			pc, err := next.TenantPYMK(name)
+			if err == nil { err = t.SetProfiles(pc, next.Profiles()) }
+			if err != nil { slog.Error("config reload failed, keeping current config", "tenant", name, "err", err); return }
+			pcs[t] = pc
+		}
+	}
+	lv, _ := logging.ParseLevel(next.Log.Level)
+	level.Set(lv)
+	if flagsChanged { _ = reg.Flags.Replace(next.Flags) } // validated by Load
+	if pymkChanged { reg.SetDefaults(next.PYMK); reg.SetProfiles(next.Profiles()) }
+	for t, pc := range pcs { t.Svc.SetConfig(pc) }
+	current.Store(old.WithReloadable(next))
+	slog.Info("config reloaded", "changes", len(changes))
+}
+
+// localTenants exposes each tenant's node-local graph to replication
+// (Raft FSM, replica streams), creating tenants first seen in the log.
+type localTenants struct{ reg *tenant.Registry }
+
+func (lt localTenants) Local(name string) (*graph.MemGraph, error) {
+	if name == "" { name = tenant.Default }
+	t, err := lt.reg.Create(name, nil)
+	if err != nil { return nil, err }
+	return t.Local, nil
 }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// Names leaves out ephemeral graphs, which are not backed up.
+func (lt localTenants) Names() []string {
+	var out []string
+	for _, name := range lt.reg.Names() {
+		if t, err := lt.reg.Get(name); err == nil && !t.Ephemeral() { out = append(out, name) }
 	}
-	return def
+	return out
+}
+
+func fatal(what string, err error) {
+	slog.Error(fmt.Sprintf("%s: %v", what, err))
+	os.Exit(1)
 }
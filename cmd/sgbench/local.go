@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/pandharkardeep/social-graph/internal/config"
+	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/pymk"
+)
+
+// runLocal benchmarks PYMK in process, without the server or HTTP, on a
+// generated graph: each of the users follows degree others drawn from the
+// same Zipf distribution as the traffic. It reports time and allocations
+// per computed request (the cache is off), sequential and with the
+// default parallel expansion.
+func runLocal(o options, degree int, w io.Writer) {
+	g := graph.NewMemGraph()
+	rng := rand.New(rand.NewSource(o.seed))
+	z := rand.NewZipf(rng, o.zipf, 1, o.users-1)
+	ctx := context.Background()
+	for u := uint64(1); u <= o.users; u++ {
+		for i := 0; i < degree; i++ {
+			if v := z.Uint64() + 1; v != u { g.Follow(ctx, u, v) }
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "pymk\tops\tns/op\tB/op\tallocs/op\t")
+	for _, par := range []struct {
+		name    string
+		workers int
+	}{{"sequential", 1}, {"parallel", 0}} {
+		cfg := config.Defaults().PYMK
+		cfg.CacheSize, cfg.Parallelism, cfg.K = 0, par.workers, o.k
+		svc := pymk.NewService(g, embeds.NewMemEmbeds(), cfg)
+		users := rand.New(rand.NewSource(o.seed))
+		uz := rand.NewZipf(users, o.zipf, 1, o.users-1)
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.PYMK(ctx, uz.Uint64()+1, pymk.Query{}); err != nil { b.Fatal(err) }
+			}
+		})
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t\n", par.name, r.N, r.NsPerOp(), r.AllocedBytesPerOp(), r.AllocsPerOp())
+	}
+	tw.Flush()
+}
@@ -0,0 +1,222 @@
+// Command sgbench drives mixed traffic against a running server and
+// reports throughput and latency percentiles per operation.
+//
+//	sgbench -addr http://localhost:8080 -key $KEY -users 100000 -c 32 -d 30s
+//
+// Users are drawn from a Zipf distribution (-zipf s > 1), so a few hot
+// users take most of the traffic as in production. -mix sets the relative
+// weights of follow, pymk and followers requests.
+//
+//	sgbench -local -users 100000 -degree 50
+//
+// instead benchmarks PYMK in process on a generated graph and reports
+// time, bytes and allocations per computed request.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+type options struct {
+	addr     string
+	tenant   string
+	key      string
+	users    uint64
+	zipf     float64
+	conc     int
+	duration time.Duration
+	rate     int
+	mix      [3]int // follow, pymk, followers
+	k        int
+	seed     int64
+}
+
+var opNames = [3]string{"follow", "pymk", "followers"}
+
+func main() {
+	var o options
+	var mix string
+	var local bool
+	var degree int
+	flag.StringVar(&o.addr, "addr", "http://localhost:8080", "server base URL")
+	flag.StringVar(&o.tenant, "tenant", "", "tenant (X-Tenant)")
+	flag.StringVar(&o.key, "key", os.Getenv("SG_API_KEY"), "API key with read and write scope (or SG_API_KEY)")
+	flag.Uint64Var(&o.users, "users", 100_000, "user ID space [1, users]")
+	flag.Float64Var(&o.zipf, "zipf", 1.1, "Zipf skew s (> 1); larger is more skewed")
+	flag.IntVar(&o.conc, "c", 16, "concurrent workers")
+	flag.DurationVar(&o.duration, "d", 30*time.Second, "test duration")
+	flag.IntVar(&o.rate, "rate", 0, "total requests per second; 0 = as fast as possible")
+	flag.StringVar(&mix, "mix", "20,30,50", "weights for follow,pymk,followers")
+	flag.IntVar(&o.k, "k", 20, "PYMK k")
+	flag.Int64Var(&o.seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.BoolVar(&local, "local", false, "benchmark PYMK in process on a generated graph instead of driving a server")
+	flag.IntVar(&degree, "degree", 50, "-local: users each user follows")
+	flag.Parse()
+
+	if err := parseMix(mix, &o.mix); err != nil { fail(err) }
+	if o.zipf <= 1 || o.users < 2 || o.conc <= 0 { fail(errors.New("need -zipf > 1, -users >= 2, -c > 0")) }
+	if local {
+		runLocal(o, degree, os.Stdout)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+
+	res := run(ctx, o)
+	res.print(os.Stdout)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sgbench:", err)
+	os.Exit(2)
+}
+
+func parseMix(s string, mix *[3]int) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 { return fmt.Errorf("bad -mix %q: want three weights", s) }
+	sum := 0
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 { return fmt.Errorf("bad -mix %q", s) }
+		mix[i] = n
+		sum += n
+	}
+	if sum == 0 { return fmt.Errorf("bad -mix %q: all zero", s) }
+	return nil
+}
+
+// sample is one worker's record for one operation.
+type sample struct {
+	lat    []time.Duration
+	errors int
+}
+
+type result struct {
+	elapsed time.Duration
+	ops     [3]sample
+}
+
+func run(ctx context.Context, o options) *result {
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: o.conc},
+	}
+	var tick <-chan time.Time
+	if o.rate > 0 {
+		t := time.NewTicker(time.Second / time.Duration(o.rate))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	per := make([]*result, o.conc)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range per {
+		per[i] = &result{}
+		wg.Add(1)
+		go func(w int, res *result) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(o.seed + int64(w)))
+			z := rand.NewZipf(rng, o.zipf, 1, o.users-1)
+			user := func() uint64 { return z.Uint64() + 1 }
+			total := o.mix[0] + o.mix[1] + o.mix[2]
+			for ctx.Err() == nil {
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-ctx.Done():
+						return
+					}
+				}
+				op, n := 0, rng.Intn(total)
+				for n >= o.mix[op] { n -= o.mix[op]; op++ }
+				t0 := time.Now()
+				err := do(ctx, client, o, op, user)
+				if ctx.Err() != nil { return } // cut off by the deadline; don't count
+				s := &res.ops[op]
+				if err != nil { s.errors++; continue }
+				s.lat = append(s.lat, time.Since(t0))
+			}
+		}(i, per[i])
+	}
+	wg.Wait()
+
+	out := &result{elapsed: time.Since(start)}
+	for _, r := range per {
+		for i := range out.ops {
+			out.ops[i].lat = append(out.ops[i].lat, r.ops[i].lat...)
+			out.ops[i].errors += r.ops[i].errors
+		}
+	}
+	return out
+}
+
+func do(ctx context.Context, client *http.Client, o options, op int, user func() uint64) error {
+	base := strings.TrimRight(o.addr, "/")
+	var req *http.Request
+	var err error
+	switch op {
+	case 0:
+		src, dst := user(), user()
+		if src == dst { dst = src%o.users + 1 }
+		body := fmt.Sprintf(`{"src":%d,"dst":%d}`, src, dst)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, base+"/follow", bytes.NewBufferString(body))
+	case 1:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/pymk?user_id=%d&k=%d", base, user(), o.k), nil)
+	default:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/followers?user_id=%d", base, user()), nil)
+	}
+	if err != nil { return err }
+	if o.key != "" { req.Header.Set("X-API-Key", o.key) }
+	if o.tenant != "" { req.Header.Set("X-Tenant", o.tenant) }
+	resp, err := client.Do(req)
+	if err != nil { return err }
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 { return fmt.Errorf("%s", resp.Status) }
+	return nil
+}
+
+func (r *result) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tok\terrors\treq/s\tp50\tp90\tp99\tp99.9\tmax\t")
+	var all []time.Duration
+	errs := 0
+	for i, s := range r.ops {
+		all = append(all, s.lat...)
+		errs += s.errors
+		row(tw, opNames[i], s.lat, s.errors, r.elapsed)
+	}
+	row(tw, "total", all, errs, r.elapsed)
+	tw.Flush()
+}
+
+func row(w io.Writer, name string, lat []time.Duration, errs int, el time.Duration) {
+	slices.Sort(lat)
+	pct := func(p float64) time.Duration {
+		if len(lat) == 0 { return 0 }
+		return lat[min(len(lat)-1, int(p*float64(len(lat))))].Round(time.Microsecond)
+	}
+	rps := float64(len(lat)) / el.Seconds()
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.0f\t%v\t%v\t%v\t%v\t%v\t\n", name, len(lat), errs, rps,
+		pct(0.50), pct(0.90), pct(0.99), pct(0.999), pct(1))
+}
@@ -0,0 +1,43 @@
+// Command sggen writes a synthetic edge list as src,dst CSV, ready for
+// sgload:
+//
+//	sggen -model ba -n 100000 -m 10 | gzip > ba.csv.gz
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/gen"
+)
+
+func main() {
+	var p gen.Params
+	flag.StringVar(&p.Model, "model", gen.BarabasiAlbert, "ba (Barabási–Albert) | er (Erdős–Rényi) | ws (Watts–Strogatz)")
+	flag.IntVar(&p.N, "n", 10_000, "users")
+	flag.IntVar(&p.M, "m", 5, "ba: edges per new user")
+	flag.Float64Var(&p.P, "p", 0.001, "er: edge probability")
+	flag.IntVar(&p.K, "k", 10, "ws: lattice neighbors per user (even)")
+	flag.Float64Var(&p.Beta, "beta", 0.1, "ws: rewiring probability")
+	flag.Int64Var(&p.Seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	w := bufio.NewWriterSize(os.Stdout, 1<<20)
+	buf := make([]byte, 0, 48)
+	err := gen.Generate(p, func(u, v uint64) {
+		buf = strconv.AppendUint(buf[:0], u, 10)
+		buf = append(buf, ',')
+		buf = strconv.AppendUint(buf, v, 10)
+		buf = append(buf, '\n')
+		w.Write(buf)
+	})
+	if err == nil { err = w.Flush() }
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sggen:", err)
+		os.Exit(1)
+	}
+}
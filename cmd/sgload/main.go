@@ -0,0 +1,280 @@
+// Command sgload streams an edge file into a running server through
+// POST /edges/import.
+//
+//	sgload -addr http://localhost:8080 -key $KEY edges.csv.gz
+//
+// CSV files hold "src,dst" per line (a non-numeric header line and lines
+// starting with # are skipped); NDJSON files hold {"src":1,"dst":2} per
+// line. The format follows the extension (.csv, .ndjson, .jsonl, each
+// optionally .gz) unless -format is given.
+//
+// With -replace, the file replaces the tenant's graph instead: it is
+// staged through /admin/bulk_load (admin scope) and swapped in once all
+// of it is in; on any failure the staged load is dropped and the live
+// graph is left as it was.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	addr        string
+	tenant      string
+	key         string
+	format      string
+	batch       int
+	concurrency int
+	retries     int
+	progress    time.Duration
+	replace     bool
+}
+
+// path is where batches go.
+func (o options) path() string {
+	if o.replace { return "/admin/bulk_load" }
+	return "/edges/import"
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.addr, "addr", "http://localhost:8080", "server base URL")
+	flag.StringVar(&o.tenant, "tenant", "", "tenant to load into (X-Tenant)")
+	flag.StringVar(&o.key, "key", os.Getenv("SG_API_KEY"), "API key with write scope (or SG_API_KEY)")
+	flag.StringVar(&o.format, "format", "", "csv | ndjson (default: from the file extension)")
+	flag.IntVar(&o.batch, "batch", 5000, "edges per request (server max 50000)")
+	flag.IntVar(&o.concurrency, "concurrency", 4, "requests in flight")
+	flag.IntVar(&o.retries, "retries", 5, "attempts per batch on network errors, 429 and 5xx")
+	flag.DurationVar(&o.progress, "progress", 2*time.Second, "progress report interval; 0 disables")
+	flag.BoolVar(&o.replace, "replace", false, "replace the tenant's graph with the file, swapped in at the end (admin key)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: sgload [flags] FILE (- for stdin)\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || o.batch <= 0 || o.concurrency <= 0 { flag.Usage(); os.Exit(2) }
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, flag.Arg(0), o); err != nil {
+		slog.Error("sgload", "err", err)
+		os.Exit(1)
+	}
+}
+
+// counters are shared between the reader, the senders and the reporter.
+type counters struct {
+	read, sent, added, skipped, retried atomic.Int64
+}
+
+func run(ctx context.Context, path string, o options) error {
+	r, format, closeFn, err := open(path, o.format)
+	if err != nil { return err }
+	defer closeFn()
+
+	var c counters
+	start := time.Now()
+	batches := make(chan [][2]uint64, o.concurrency)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	client := &http.Client{Timeout: time.Minute}
+	if o.replace {
+		if _, _, err := request(ctx, client, o, http.MethodPost, "/admin/bulk_load?begin=true", nil); err != nil { return fmt.Errorf("begin bulk load: %w", err) }
+	}
+	for i := 0; i < o.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				if err := send(ctx, client, o, b, &c); err != nil { cancel(err); return }
+			}
+		}()
+	}
+
+	if o.progress > 0 {
+		t := time.NewTicker(o.progress)
+		defer t.Stop()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					report(&c, start, false)
+				}
+			}
+		}()
+	}
+
+	err = parse(ctx, r, format, o.batch, &c, batches)
+	close(batches)
+	wg.Wait()
+	report(&c, start, true)
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) { err = cause }
+	if err == nil { err = ctx.Err() }
+	if !o.replace { return err }
+	// The staged load must not outlive a failed run, even an interrupted one.
+	fin := context.WithoutCancel(ctx)
+	if err != nil {
+		if _, _, aerr := request(fin, client, o, http.MethodDelete, "/admin/bulk_load", nil); aerr != nil { slog.Warn("abort bulk load", "err", aerr) }
+		return err
+	}
+	if _, _, err := request(fin, client, o, http.MethodPost, "/admin/bulk_load?commit=true", nil); err != nil { return fmt.Errorf("commit bulk load: %w", err) }
+	slog.Info("bulk load committed")
+	return nil
+}
+
+// open returns the decompressed input and its format.
+func open(path, format string) (io.Reader, string, func(), error) {
+	var f io.ReadCloser = os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil { return nil, "", nil, err }
+	}
+	name := strings.TrimSuffix(path, ".gz")
+	br := bufio.NewReaderSize(f, 1<<20)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil { f.Close(); return nil, "", nil, err }
+		r = zr
+	}
+	if format == "" {
+		switch {
+		case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"):
+			format = "ndjson"
+		default:
+			format = "csv"
+		}
+	}
+	if format != "csv" && format != "ndjson" { f.Close(); return nil, "", nil, fmt.Errorf("unknown format %q", format) }
+	return r, format, func() { f.Close() }, nil
+}
+
+// parse reads edges from r and hands them out in batches of n.
+func parse(ctx context.Context, r io.Reader, format string, n int, c *counters, out chan<- [][2]uint64) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	batch := make([][2]uint64, 0, n)
+	flush := func() bool {
+		if len(batch) == 0 { return true }
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return false
+		}
+		batch = make([][2]uint64, 0, n)
+		return true
+	}
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' { continue }
+		var e [2]uint64
+		var err error
+		if format == "ndjson" {
+			var rec struct{ Src, Dst uint64 }
+			err = json.Unmarshal([]byte(text), &rec)
+			e = [2]uint64{rec.Src, rec.Dst}
+		} else {
+			e, err = parseCSV(text)
+			if err != nil && line == 1 { continue } // header
+		}
+		if err != nil { return fmt.Errorf("line %d: %w", line, err) }
+		c.read.Add(1)
+		if batch = append(batch, e); len(batch) == n && !flush() { return ctx.Err() }
+	}
+	if err := sc.Err(); err != nil { return err }
+	if !flush() { return ctx.Err() }
+	return nil
+}
+
+func parseCSV(text string) ([2]uint64, error) {
+	a, b, ok := strings.Cut(text, ",")
+	if !ok { return [2]uint64{}, errors.New("want src,dst") }
+	u, err := strconv.ParseUint(strings.TrimSpace(a), 10, 64)
+	if err != nil { return [2]uint64{}, err }
+	v, err := strconv.ParseUint(strings.TrimSpace(b), 10, 64)
+	if err != nil { return [2]uint64{}, err }
+	return [2]uint64{u, v}, nil
+}
+
+// send posts one batch, retrying with exponential backoff. Imports are
+// idempotent, so a retry after a lost response is harmless.
+func send(ctx context.Context, client *http.Client, o options, batch [][2]uint64, c *counters) error {
+	body, err := json.Marshal(map[string]any{"edges": batch})
+	if err != nil { return err }
+	backoff := 200 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		res, retry, err := request(ctx, client, o, http.MethodPost, o.path(), body)
+		if err == nil {
+			c.sent.Add(int64(len(batch)))
+			c.added.Add(int64(res.Added))
+			c.skipped.Add(int64(res.Skipped))
+			return nil
+		}
+		if !retry || attempt >= o.retries || ctx.Err() != nil { return err }
+		c.retried.Add(1)
+		slog.Warn("batch failed, retrying", "attempt", attempt, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > 10*time.Second { backoff = 10 * time.Second }
+	}
+}
+
+type importResult struct {
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"`
+}
+
+func request(ctx context.Context, client *http.Client, o options, method, path string, body []byte) (importResult, bool, error) {
+	var res importResult
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(o.addr, "/")+path, bytes.NewReader(body))
+	if err != nil { return res, false, err }
+	req.Header.Set("Content-Type", "application/json")
+	if o.key != "" { req.Header.Set("X-API-Key", o.key) }
+	if o.tenant != "" { req.Header.Set("X-Tenant", o.tenant) }
+	resp, err := client.Do(req)
+	if err != nil { return res, true, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return res, retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return res, false, json.NewDecoder(resp.Body).Decode(&res)
+}
+
+func report(c *counters, start time.Time, final bool) {
+	el := time.Since(start)
+	sent := c.sent.Load()
+	rate := float64(sent) / el.Seconds()
+	msg := "progress"
+	if final { msg = "done" }
+	slog.Info(msg, "read", c.read.Load(), "sent", sent, "added", c.added.Load(), "skipped", c.skipped.Load(),
+		"retries", c.retried.Load(), "edges_per_sec", int64(rate), "elapsed", el.Round(time.Millisecond))
+}
@@ -0,0 +1,250 @@
+// Command sgreplay replays a recorded mutation log against a running
+// server, in order and at the recorded pace (or faster), to reproduce a
+// graph state or a sequence of writes locally.
+//
+//	sgreplay -addr http://localhost:8080 -key $KEY -speed 10 audit.jsonl.gz
+//
+// The log is JSON lines, optionally gzipped: mutation journal events
+// ({seq,time,tenant,op,src,dst,source}) or audit log records, whose
+// follow source is in detail. follow, unfollow, block, unblock, mute and
+// unmute are replayed; other ops (status, merge) are skipped and counted.
+// Each event goes to its own tenant unless -into is given.
+//
+// Events are sent one at a time, each once the previous has been
+// answered, so the server sees them in the recorded order. With -speed
+// 0 they are sent as fast as that allows.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	addr     string
+	key      string
+	tenant   string
+	into     string
+	speed    float64
+	maxGap   time.Duration
+	from, to uint64
+	strict   bool
+	retries  int
+	progress time.Duration
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.addr, "addr", "http://localhost:8080", "server base URL")
+	flag.StringVar(&o.key, "key", os.Getenv("SG_API_KEY"), "API key with write scope (or SG_API_KEY)")
+	flag.StringVar(&o.tenant, "tenant", "", "replay only this tenant's events")
+	flag.StringVar(&o.into, "into", "", "send every event to this tenant instead of its own")
+	flag.Float64Var(&o.speed, "speed", 1, "pace relative to the recording: 1 = original, 10 = ten times faster, 0 = no waiting")
+	flag.DurationVar(&o.maxGap, "max-gap", 0, "wait at most this long between two events; 0 = no cap")
+	flag.Uint64Var(&o.from, "from", 0, "skip journal events with a lower seq")
+	flag.Uint64Var(&o.to, "to", 0, "stop after the journal event with this seq; 0 = read to the end")
+	flag.BoolVar(&o.strict, "strict", false, "stop at the first event the server rejects")
+	flag.IntVar(&o.retries, "retries", 5, "attempts per event on network errors, 429 and 5xx")
+	flag.DurationVar(&o.progress, "progress", 2*time.Second, "progress report interval; 0 disables")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: sgreplay [flags] FILE (- for stdin)\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || o.speed < 0 || o.maxGap < 0 { flag.Usage(); os.Exit(2) }
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, flag.Arg(0), o); err != nil {
+		slog.Error("sgreplay", "err", err)
+		os.Exit(1)
+	}
+}
+
+// event is a journal event or an audit record.
+type event struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant"`
+	Op     string    `json:"op"`
+	Src    uint64    `json:"src"`
+	Dst    uint64    `json:"dst"`
+	Source string    `json:"source"`
+	Detail string    `json:"detail"` // audit: a follow's source
+}
+
+// request is the route and body replaying e, or "" for ops not replayed.
+func (e event) request() (string, any) {
+	switch e.Op {
+	case "follow":
+		src := e.Source
+		if src == "" { src = e.Detail }
+		return "/follow", map[string]any{"src": e.Src, "dst": e.Dst, "source": src}
+	case "unfollow":
+		return "/unfollow", map[string]any{"src": e.Src, "dst": e.Dst}
+	case "block", "unblock", "mute", "unmute":
+		return "/" + e.Op, map[string]any{"viewer": e.Src, "target": e.Dst}
+	}
+	return "", nil
+}
+
+type counters struct {
+	read, sent, skipped, rejected, retried int64
+	lag                                    time.Duration // how far the last event was sent behind its schedule
+}
+
+func run(ctx context.Context, path string, o options) error {
+	r, closeFn, err := open(path)
+	if err != nil { return err }
+	defer closeFn()
+
+	var c counters
+	start := time.Now()
+	last := start
+	client := &http.Client{Timeout: time.Minute}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	var first, prev time.Time // recording times: of the first event sent, and of the one before
+	var due time.Time         // when the current event is to be sent
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' { continue }
+		var e event
+		if err := json.Unmarshal([]byte(text), &e); err != nil { return fmt.Errorf("line %d: %w", line, err) }
+		c.read++
+		if e.Seq != 0 && e.Seq < o.from { continue }
+		if o.to != 0 && e.Seq > o.to { break }
+		if o.tenant != "" && e.Tenant != o.tenant { continue }
+		route, body := e.request()
+		if route == "" { c.skipped++; continue }
+
+		if o.speed > 0 && !e.Time.IsZero() {
+			switch {
+			case first.IsZero():
+				first, prev, due = e.Time, e.Time, time.Now()
+			case e.Time.After(prev): // clock steps back between nodes are sent at once
+				gap := time.Duration(float64(e.Time.Sub(prev)) / o.speed)
+				if o.maxGap > 0 && gap > o.maxGap { gap = o.maxGap }
+				due, prev = due.Add(gap), e.Time
+			}
+			if err := sleepUntil(ctx, due); err != nil { return err }
+			c.lag = time.Since(due)
+		}
+		tenant := e.Tenant
+		if o.into != "" { tenant = o.into }
+		if err := send(ctx, client, o, tenant, route, body, &c); err != nil {
+			if ctx.Err() != nil { return ctx.Err() }
+			var rej rejected
+			if !errors.As(err, &rej) || o.strict { return fmt.Errorf("line %d (seq %d, %s %d %d): %w", line, e.Seq, e.Op, e.Src, e.Dst, err) }
+			c.rejected++
+			slog.Warn("event rejected", "line", line, "seq", e.Seq, "op", e.Op, "src", e.Src, "dst", e.Dst, "err", err)
+		} else {
+			c.sent++
+		}
+		if o.progress > 0 && time.Since(last) >= o.progress {
+			last = time.Now()
+			report(&c, start, first, prev, false)
+		}
+	}
+	if err := sc.Err(); err != nil { return err }
+	report(&c, start, first, prev, true)
+	return nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 { return ctx.Err() }
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// open returns the decompressed input.
+func open(path string) (io.Reader, func(), error) {
+	var f io.ReadCloser = os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil { return nil, nil, err }
+	}
+	br := bufio.NewReaderSize(f, 1<<20)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil { f.Close(); return nil, nil, err }
+		r = zr
+	}
+	return r, func() { f.Close() }, nil
+}
+
+// rejected is a 4xx answer: retrying will not help.
+type rejected struct{ error }
+
+// send posts one event, retrying with exponential backoff. Every replayed
+// op is idempotent, so a retry after a lost response is harmless.
+func send(ctx context.Context, client *http.Client, o options, tenant, route string, body any, c *counters) error {
+	b, err := json.Marshal(body)
+	if err != nil { return err }
+	backoff := 200 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := post(ctx, client, o, tenant, route, b)
+		var rej rejected
+		if err == nil || errors.As(err, &rej) || attempt >= o.retries || ctx.Err() != nil { return err }
+		c.retried++
+		slog.Warn("event failed, retrying", "attempt", attempt, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > 10*time.Second { backoff = 10 * time.Second }
+	}
+}
+
+func post(ctx context.Context, client *http.Client, o options, tenant, route string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(o.addr, "/")+route, bytes.NewReader(body))
+	if err != nil { return err }
+	req.Header.Set("Content-Type", "application/json")
+	if o.key != "" { req.Header.Set("X-API-Key", o.key) }
+	if tenant != "" { req.Header.Set("X-Tenant", tenant) }
+	resp, err := client.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 { return err }
+	return rejected{err}
+}
+
+func report(c *counters, start, first, prev time.Time, final bool) {
+	msg := "progress"
+	if final { msg = "done" }
+	args := []any{"read", c.read, "sent", c.sent, "skipped", c.skipped, "rejected", c.rejected, "retries", c.retried,
+		"elapsed", time.Since(start).Round(time.Millisecond)}
+	if !first.IsZero() { args = append(args, "recorded", prev.Sub(first).Round(time.Millisecond), "lag", c.lag.Round(time.Millisecond)) }
+	slog.Info(msg, args...)
+}
@@ -0,0 +1,78 @@
+// Command sgreshard rewrites a graph snapshot for a new shard count and
+// reports how evenly the edges spread, under the old id % n placement and
+// under the splitmix64 hash:
+//
+//	sgreshard -in data/snapshots/default.sgs -out default.sgs -shards 256
+//
+// The server rebalances any snapshot on restore by itself, whatever shard
+// count wrote it, so running sgreshard is optional; it previews the skew
+// before store.shards is changed and leaves a file whose sections match.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+func main() {
+	in := flag.String("in", "", "snapshot to read")
+	out := flag.String("out", "", "where to write the resharded snapshot; empty only reports")
+	shards := flag.Int("shards", graph.DefaultShards, "new shard count, a power of two")
+	legacy := flag.Int("legacy", 64, "shard count to report id % n placement for; 0 skips it")
+	flag.Parse()
+	if *in == "" { fail(fmt.Errorf("-in is required")) }
+	if err := graph.ValidShards(*shards); err != nil { fail(err) }
+
+	g := graph.NewMemGraphShards(*shards)
+	f, err := os.Open(*in)
+	if err != nil { fail(err) }
+	err = g.ReadSnapshot(bufio.NewReaderSize(f, 1<<20))
+	f.Close()
+	if err != nil { fail(fmt.Errorf("%s: %w", *in, err)) }
+
+	if *legacy > 0 {
+		edges := make([]int, *legacy)
+		g.EachEdge(func(u, _ uint64) bool { edges[u%uint64(*legacy)]++; return true })
+		report(fmt.Sprintf("id %% %d", *legacy), edges)
+	}
+	edges := make([]int, 0, *shards)
+	for _, st := range g.MemStats() { edges = append(edges, st.Edges) }
+	report(fmt.Sprintf("splitmix64, %d shards", *shards), edges)
+
+	if *out == "" { return }
+	if err := write(*out, g); err != nil { fail(err) }
+	fmt.Println("wrote", *out)
+}
+
+// report prints the spread of edges over shards; max/mean is what a hot
+// shard costs in lock contention and memory imbalance.
+func report(name string, edges []int) {
+	total := 0
+	for _, n := range edges { total += n }
+	mean := float64(total) / float64(len(edges))
+	skew := 0.0
+	if mean > 0 { skew = float64(slices.Max(edges)) / mean }
+	fmt.Printf("%-24s edges=%d min=%d max=%d mean=%.1f max/mean=%.2f\n", name, total, slices.Min(edges), slices.Max(edges), mean, skew)
+}
+
+// write replaces path with g's snapshot through a synced temporary file.
+func write(path string, g *graph.MemGraph) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil { return err }
+	defer os.Remove(f.Name())
+	if err := g.WriteSnapshot(f); err != nil { f.Close(); return err }
+	if err := f.Sync(); err != nil { f.Close(); return err }
+	if err := f.Close(); err != nil { return err }
+	return os.Rename(f.Name(), path)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sgreshard:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,218 @@
+// Package attrs stores small typed attributes per user (country,
+// language, account age, verification, topics) that PYMK and the read
+// APIs filter and boost on.
+package attrs
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxTopics bounds a user's topics, MaxInterests their interest tags.
+const (
+	MaxTopics    = 32
+	MaxInterests = 64
+)
+
+var (
+	validCountry  = regexp.MustCompile(`^[A-Z]{2}$`)
+	validLanguage = regexp.MustCompile(`^[a-z]{2,3}$`)
+	validTopic    = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+)
+
+// Attrs are one user's attributes; zero values mean unknown.
+type Attrs struct {
+	Country  string    `json:"country,omitempty"`  // ISO 3166-1 alpha-2, e.g. "DE"
+	Language string    `json:"language,omitempty"` // ISO 639 code, e.g. "de"
+	Created  time.Time `json:"created,omitempty"`  // account creation, for its age
+	Verified bool      `json:"verified,omitempty"`
+	Topics   []string  `json:"topics,omitempty"` // sorted, no duplicates
+	// Interests are free-form labels weighted by how strongly they apply,
+	// in (0, 1], e.g. {"jazz": 1, "cycling": 0.3}.
+	Interests map[string]float64 `json:"interests,omitempty"`
+}
+
+// MarshalJSON leaves out an unknown creation time.
+func (a Attrs) MarshalJSON() ([]byte, error) {
+	type plain Attrs
+	v := struct {
+		plain
+		Created *time.Time `json:"created,omitempty"`
+	}{plain: plain(a)}
+	if !a.Created.IsZero() { v.Created = &a.Created }
+	return json.Marshal(v)
+}
+
+// Age returns how old the account was at now, or 0 when unknown.
+func (a Attrs) Age(now time.Time) time.Duration {
+	if a.Created.IsZero() { return 0 }
+	return now.Sub(a.Created)
+}
+
+// Locale returns a's locale as a BCP 47 tag such as "de-AT", just the
+// language when the country is unknown, or "" without a language.
+func (a Attrs) Locale() string {
+	if a.Language == "" || a.Country == "" { return a.Language }
+	return a.Language + "-" + a.Country
+}
+
+// SameLocale reports whether a and b are known to share a locale: the
+// same language, in the same country unless either country is unknown.
+// Without both languages it reports ok false.
+func (a Attrs) SameLocale(b Attrs) (same, ok bool) {
+	if a.Language == "" || b.Language == "" { return false, false }
+	if a.Language != b.Language { return false, true }
+	return a.Country == "" || b.Country == "" || a.Country == b.Country, true
+}
+
+// ParseLocale splits a tag such as "de-AT", "de_AT" or "de" into a
+// language and a country, either of which Normalize then checks.
+func ParseLocale(s string) (language, country string) {
+	language, country, _ = strings.Cut(strings.ReplaceAll(s, "_", "-"), "-")
+	return strings.ToLower(language), strings.ToUpper(country)
+}
+
+// HasTopic reports whether t is among a's topics.
+func (a Attrs) HasTopic(t string) bool {
+	_, ok := slices.BinarySearch(a.Topics, t)
+	return ok
+}
+
+// InterestOverlap returns the weighted Jaccard similarity of a's and b's
+// interests: the sum over all labels of the smaller weight divided by the
+// sum of the larger, 0 when either has none.
+func (a Attrs) InterestOverlap(b Attrs) float64 {
+	if len(a.Interests) == 0 || len(b.Interests) == 0 { return 0 }
+	var lo, hi float64
+	for t, x := range a.Interests {
+		y := b.Interests[t]
+		lo += math.Min(x, y)
+		hi += math.Max(x, y)
+	}
+	for t, y := range b.Interests {
+		if _, ok := a.Interests[t]; !ok { hi += y }
+	}
+	return lo / hi
+}
+
+func (a Attrs) empty() bool {
+	return a.Country == "" && a.Language == "" && a.Created.IsZero() && !a.Verified && len(a.Topics) == 0 && len(a.Interests) == 0
+}
+
+// Normalize case-folds a's codes, sorts and dedupes its topics and
+// checks every field.
+func (a *Attrs) Normalize() error {
+	a.Country, a.Language = strings.ToUpper(a.Country), strings.ToLower(a.Language)
+	if a.Country != "" && !validCountry.MatchString(a.Country) { return fmt.Errorf("bad country %q: want ISO 3166-1 alpha-2", a.Country) }
+	if a.Language != "" && !validLanguage.MatchString(a.Language) { return fmt.Errorf("bad language %q: want ISO 639", a.Language) }
+	for i, t := range a.Topics {
+		a.Topics[i] = strings.ToLower(t)
+		if !validTopic.MatchString(a.Topics[i]) { return fmt.Errorf("bad topic %q", t) }
+	}
+	slices.Sort(a.Topics)
+	a.Topics = slices.Compact(a.Topics)
+	if len(a.Topics) > MaxTopics { return fmt.Errorf("at most %d topics", MaxTopics) }
+	if len(a.Topics) == 0 { a.Topics = nil }
+	if len(a.Interests) > MaxInterests { return fmt.Errorf("at most %d interests", MaxInterests) }
+	var in map[string]float64
+	for t, w := range a.Interests {
+		l := strings.ToLower(t)
+		if !validTopic.MatchString(l) { return fmt.Errorf("bad interest %q", t) }
+		if !(w > 0 && w <= 1) { return fmt.Errorf("interest %q: weight must be in (0, 1]", t) }
+		if in == nil { in = make(map[string]float64, len(a.Interests)) }
+		in[l] = math.Max(in[l], w)
+	}
+	a.Interests = in
+	return nil
+}
+
+// Store holds a tenant's user attributes in memory; users without any
+// take no space. Attributes are usually mirrored from the system that
+// owns the accounts, which re-sends them after a restart.
+type Store struct {
+	mu      sync.RWMutex
+	m       map[uint64]Attrs
+	byTopic map[string]map[uint64]struct{}
+}
+
+func New() *Store { return &Store{m: make(map[uint64]Attrs), byTopic: make(map[string]map[uint64]struct{})} }
+
+// Set replaces u's attributes with a, after Normalize.
+func (s *Store) Set(u uint64, a Attrs) error {
+	if err := a.Normalize(); err != nil { return err }
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.put(u, a)
+	return nil
+}
+
+// put stores a as u's attributes and keeps the topic index in step. The
+// caller holds mu.
+func (s *Store) put(u uint64, a Attrs) {
+	for _, t := range s.m[u].Topics {
+		if set := s.byTopic[t]; set != nil {
+			delete(set, u)
+			if len(set) == 0 { delete(s.byTopic, t) }
+		}
+	}
+	if a.empty() { delete(s.m, u); return }
+	s.m[u] = a
+	for _, t := range a.Topics {
+		set := s.byTopic[t]
+		if set == nil { set = make(map[uint64]struct{}); s.byTopic[t] = set }
+		set[u] = struct{}{}
+	}
+}
+
+// Update applies fn to a copy of u's attributes and stores the result,
+// after Normalize, atomically with respect to other changes.
+func (s *Store) Update(u uint64, fn func(a *Attrs)) (Attrs, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	a := s.m[u]
+	a.Topics, a.Interests = slices.Clone(a.Topics), maps.Clone(a.Interests)
+	fn(&a)
+	if err := a.Normalize(); err != nil { return Attrs{}, err }
+	s.put(u, a)
+	return a, nil
+}
+
+// Get returns u's attributes. The Topics slice and Interests map are
+// shared; do not modify them.
+func (s *Store) Get(u uint64) (Attrs, bool) {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	a, ok := s.m[u]
+	return a, ok
+}
+
+// Delete drops all of u's attributes and reports whether it had any.
+func (s *Store) Delete(u uint64) bool {
+	s.mu.Lock(); defer s.mu.Unlock()
+	_, ok := s.m[u]
+	s.put(u, Attrs{})
+	return ok
+}
+
+// WithTopic calls fn for users with topic t, in no particular order,
+// until fn returns false. fn must not call back into s.
+func (s *Store) WithTopic(t string, fn func(u uint64) bool) {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	for u := range s.byTopic[t] { if !fn(u) { return } }
+}
+
+// TopicSize returns how many users have topic t.
+func (s *Store) TopicSize(t string) int {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return len(s.byTopic[t])
+}
+
+// Len returns how many users have attributes.
+func (s *Store) Len() int {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return len(s.m)
+}
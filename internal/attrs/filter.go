@@ -0,0 +1,250 @@
+package attrs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// -------- Filter expressions --------
+// A filter is a conjunction of comparisons between a candidate's fields
+// and literals or the viewer's fields:
+//
+//	country == viewer.country && account_age > 7d && is_suspended == false
+//
+// Fields: country, language, locale, status (strings); account_age (a duration:
+// Go syntax plus d and w); verified, is_suspended (booleans). Strings may
+// be quoted. A comparison with a field the candidate lacks fails; one
+// with a viewer field the viewer lacks is skipped, so a viewer is never
+// left without suggestions for missing data about themselves.
+
+// Subject is what a filter sees of a user.
+type Subject struct {
+	Attrs
+	Status string // active | deactivated | suspended; "" = active
+}
+
+type kind int
+
+const (
+	kString kind = iota
+	kDuration
+	kBool
+)
+
+var fieldKinds = map[string]kind{
+	"country": kString, "language": kString, "locale": kString, "status": kString,
+	"account_age": kDuration, "verified": kBool, "is_verified": kBool, "is_suspended": kBool,
+}
+
+type value struct {
+	s     string
+	d     time.Duration
+	b     bool
+	known bool
+}
+
+type cond struct {
+	field, op string
+	viewer    string // compared with this viewer field, or with lit
+	lit       value
+}
+
+// Filter is a parsed filter expression. A nil *Filter matches everyone.
+type Filter struct {
+	src   string
+	conds []cond
+}
+
+func (f *Filter) String() string {
+	if f == nil { return "" }
+	return f.src
+}
+
+// And returns a filter matching what both f and g match.
+func (f *Filter) And(g *Filter) *Filter {
+	if f == nil { return g }
+	if g == nil { return f }
+	return &Filter{src: "(" + f.src + ") && (" + g.src + ")", conds: append(append([]cond{}, f.conds...), g.conds...)}
+}
+
+// ParseFilter parses src; an empty src gives a nil filter.
+func ParseFilter(src string) (*Filter, error) {
+	toks, err := lex(src)
+	if err != nil { return nil, err }
+	if len(toks) == 0 { return nil, nil }
+	f := &Filter{src: strings.TrimSpace(src)}
+	for i := 0; ; {
+		if len(toks)-i < 3 { return nil, fmt.Errorf("filter: incomplete comparison at %q", strings.Join(toks[i:], " ")) }
+		c, err := parseCond(toks[i], toks[i+1], toks[i+2])
+		if err != nil { return nil, err }
+		f.conds = append(f.conds, c)
+		i += 3
+		if i == len(toks) { return f, nil }
+		if t := toks[i]; t != "&&" && !strings.EqualFold(t, "and") { return nil, fmt.Errorf("filter: want && after a comparison, not %q", t) }
+		i++
+	}
+}
+
+func parseCond(field, op, rhs string) (cond, error) {
+	k, ok := fieldKinds[field]
+	if !ok { return cond{}, fmt.Errorf("filter: unknown field %q", field) }
+	switch op {
+	case "==", "!=":
+	case "<", "<=", ">", ">=":
+		if k != kDuration { return cond{}, fmt.Errorf("filter: %s only supports == and !=", field) }
+	default:
+		return cond{}, fmt.Errorf("filter: unknown operator %q", op)
+	}
+	c := cond{field: field, op: op}
+	if vf, ok := strings.CutPrefix(rhs, "viewer."); ok {
+		if vk, ok := fieldKinds[vf]; !ok || vk != k { return cond{}, fmt.Errorf("filter: cannot compare %s with viewer.%s", field, vf) }
+		c.viewer = vf
+		return c, nil
+	}
+	c.lit.known = true
+	switch k {
+	case kString:
+		c.lit.s = strings.Trim(rhs, `"`)
+		switch field {
+		case "country":
+			c.lit.s = strings.ToUpper(c.lit.s)
+		case "locale":
+			if l, cc := ParseLocale(c.lit.s); cc != "" { c.lit.s = l + "-" + cc } else { c.lit.s = l }
+		default:
+			c.lit.s = strings.ToLower(c.lit.s)
+		}
+	case kDuration:
+		d, err := ParseAge(rhs)
+		if err != nil { return cond{}, fmt.Errorf("filter: %s: %w", field, err) }
+		c.lit.d = d
+	case kBool:
+		b, err := strconv.ParseBool(rhs)
+		if err != nil { return cond{}, fmt.Errorf("filter: %s wants true or false, not %q", field, rhs) }
+		c.lit.b = b
+	}
+	return c, nil
+}
+
+// ParseAge parses a Go duration that may also use d (days) and w (weeks),
+// e.g. "7d" or "2w3d".
+func ParseAge(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for _, u := range []struct {
+		suffix string
+		d      time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		if i := strings.Index(rest, u.suffix); i > 0 {
+			n, err := strconv.ParseFloat(rest[:i], 64)
+			if err != nil { return 0, fmt.Errorf("bad duration %q", s) }
+			total += time.Duration(n * float64(u.d))
+			rest = rest[i+1:]
+		}
+	}
+	if rest == "" { return total, nil }
+	d, err := time.ParseDuration(rest)
+	if err != nil { return 0, fmt.Errorf("bad duration %q", s) }
+	return total + d, nil
+}
+
+func lex(src string) ([]string, error) {
+	var toks []string
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' { j++ }
+			if j == len(rs) { return nil, fmt.Errorf("filter: unterminated string") }
+			toks = append(toks, string(rs[i:j+1]))
+			i = j + 1
+		case strings.ContainsRune("=!<>&", r):
+			j := i + 1
+			for j < len(rs) && strings.ContainsRune("=!<>&", rs[j]) { j++ }
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || strings.ContainsRune("_.-", rs[j])) { j++ }
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("filter: unexpected %q", r)
+		}
+	}
+	return toks, nil
+}
+
+func (s Subject) get(field string, now time.Time) value {
+	switch field {
+	case "country":
+		return value{s: s.Country, known: s.Country != ""}
+	case "language":
+		return value{s: s.Language, known: s.Language != ""}
+	case "locale":
+		return value{s: s.Locale(), known: s.Language != ""}
+	case "status":
+		st := s.Status
+		if st == "" { st = "active" }
+		return value{s: st, known: true}
+	case "account_age":
+		return value{d: s.Age(now), known: !s.Created.IsZero()}
+	case "verified", "is_verified":
+		return value{b: s.Verified, known: true}
+	case "is_suspended":
+		return value{b: s.Status == "suspended", known: true}
+	}
+	return value{}
+}
+
+// Match reports whether candidate c passes f for viewer at time now.
+func (f *Filter) Match(viewer, c Subject, now time.Time) bool { return f.eval(viewer, c, now, false) }
+
+// Holds is Match for rules that reward a condition rather than gate on
+// it: a comparison with a field the viewer lacks fails instead of being
+// skipped.
+func (f *Filter) Holds(viewer, c Subject, now time.Time) bool { return f.eval(viewer, c, now, true) }
+
+func (f *Filter) eval(viewer, c Subject, now time.Time, strict bool) bool {
+	if f == nil { return true }
+	for _, cd := range f.conds {
+		want := cd.lit
+		if cd.viewer != "" {
+			if want = viewer.get(cd.viewer, now); !want.known {
+				if strict { return false }
+				continue
+			}
+		}
+		got := c.get(cd.field, now)
+		if !got.known || !compare(fieldKinds[cd.field], cd.op, got, want) { return false }
+	}
+	return true
+}
+
+func compare(k kind, op string, a, b value) bool {
+	switch k {
+	case kString:
+		return (a.s == b.s) == (op == "==")
+	case kBool:
+		return (a.b == b.b) == (op == "==")
+	}
+	switch op {
+	case "==":
+		return a.d == b.d
+	case "!=":
+		return a.d != b.d
+	case "<":
+		return a.d < b.d
+	case "<=":
+		return a.d <= b.d
+	case ">":
+		return a.d > b.d
+	}
+	return a.d >= b.d
+}
@@ -0,0 +1,141 @@
+// Package audit keeps an append-only log of who changed the graph and
+// when, for abuse investigations and compliance.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+type Record struct {
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant"`
+	Actor  string    `json:"actor"`         // API key ID or JWT subject; "" when auth is off
+	Via    string    `json:"via,omitempty"` // apikey | jwt
+	Op     string    `json:"op"`            // follow | unfollow | block | unblock | mute | unmute | status | merge
+	Src    uint64    `json:"src"`
+	Dst    uint64    `json:"dst,omitempty"`
+	Detail string    `json:"detail,omitempty"` // the new status, or a follow's source
+}
+
+// Log appends records as JSON lines to a file opened O_APPEND; nothing
+// ever rewrites or truncates it. A nil *Log records nothing.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+}
+
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil { return nil, err }
+	return &Log{f: f, path: path}, nil
+}
+
+// Record appends rec, stamping the time and the caller from ctx. A failed
+// write is logged rather than returned: by then the mutation has happened.
+func (l *Log) Record(ctx context.Context, rec Record) {
+	if l == nil { return }
+	if rec.Time.IsZero() { rec.Time = time.Now().UTC() }
+	if p := auth.FromContext(ctx); p != nil { rec.Actor, rec.Via = p.ID, p.Via }
+	b, err := json.Marshal(rec)
+	if err == nil {
+		l.mu.Lock()
+		_, err = l.f.Write(append(b, '\n'))
+		l.mu.Unlock()
+	}
+	if err != nil { slog.ErrorContext(ctx, "audit write failed", "op", rec.Op, "tenant", rec.Tenant, "err", err) }
+}
+
+// Query returns up to limit of tenant's records at or after since that
+// involve user (any user when nil), oldest first, and whether more
+// matched. It scans the whole file; the log is read rarely and written
+// constantly.
+func (l *Log) Query(tenant string, user *uint64, since time.Time, limit int) (out []Record, more bool, err error) {
+	f, err := os.Open(l.path)
+	if err != nil { return nil, false, err }
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 64<<10)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) { return out, false, nil } // a partial last line is a write in progress
+		if err != nil { return out, false, err }
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil { return out, false, fmt.Errorf("audit: corrupt record: %w", err) }
+		if rec.Tenant != tenant || rec.Time.Before(since) || (user != nil && rec.Src != *user && rec.Dst != *user) { continue }
+		if limit > 0 && len(out) == limit { return out, true, nil }
+		out = append(out, rec)
+	}
+}
+
+func (l *Log) Close() error {
+	if l == nil { return nil }
+	l.mu.Lock(); defer l.mu.Unlock()
+	if err := l.f.Sync(); err != nil { l.f.Close(); return err }
+	return l.f.Close()
+}
+
+// -------- Store wrapper --------
+// Store records every edge the wrapped store adds or removes, including
+// those made by bulk imports and merges, with the caller from the
+// request context.
+type Store struct {
+	graph.Store
+	l      *Log
+	tenant string
+}
+
+func Wrap(g graph.Store, l *Log, tenant string) *Store {
+	return &Store{Store: g, l: l, tenant: tenant}
+}
+
+func (s *Store) record(ctx context.Context, op string, u, v uint64) {
+	rec := Record{Tenant: s.tenant, Op: op, Src: u, Dst: v}
+	if op == "follow" { rec.Detail = graph.SourceFrom(ctx) }
+	s.l.Record(ctx, rec)
+}
+
+func (s *Store) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := s.Store.Follow(ctx, u, v)
+	if ok { s.record(ctx, "follow", u, v) }
+	return ok, err
+}
+
+func (s *Store) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := s.Store.Unfollow(ctx, u, v)
+	if ok { s.record(ctx, "unfollow", u, v) }
+	return ok, err
+}
+
+func (s *Store) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := s.Store.FollowIf(ctx, u, v, epoch)
+	if ok { s.record(ctx, "follow", u, v) }
+	return ok, err
+}
+
+func (s *Store) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := s.Store.UnfollowIf(ctx, u, v, epoch)
+	if ok { s.record(ctx, "unfollow", u, v) }
+	return ok, err
+}
+
+func (s *Store) Apply(ctx context.Context, ops []graph.EdgeOp) ([]bool, error) {
+	changed, err := s.Store.Apply(ctx, ops)
+	for i, ok := range changed {
+		if ok { s.record(ctx, ops[i].Op, ops[i].Src, ops[i].Dst) }
+	}
+	return changed, err
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// -------- Scopes --------
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+// rank orders scopes so that admin implies write implies read.
+func (s Scope) rank() int {
+	switch s {
+	case ScopeRead:
+		return 1
+	case ScopeWrite:
+		return 2
+	case ScopeAdmin:
+		return 3
+	}
+	return 0
+}
+
+func ParseScope(s string) (Scope, error) {
+	sc := Scope(strings.ToLower(strings.TrimSpace(s)))
+	if sc.rank() == 0 { return "", fmt.Errorf("unknown scope %q", s) }
+	return sc, nil
+}
+
+// -------- Keys & principals --------
+type Key struct {
+	ID     string  `json:"id"`
+	Secret string  `json:"key,omitempty"`
+	Scopes []Scope `json:"scopes"`
+	Tenant string  `json:"tenant,omitempty"` // the only tenant the key may use; "" = every tenant
+}
+
+// Principal is the authenticated caller attached to the request context.
+type Principal struct {
+	ID     string
+	Via    string // apikey | jwt
+	Scopes []Scope
+	Tenant string // see Key.Tenant
+}
+
+func (p *Principal) Has(want Scope) bool {
+	if p == nil { return false }
+	for _, s := range p.Scopes {
+		if s.rank() >= want.rank() { return true }
+	}
+	return false
+}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the caller, or nil when auth is disabled.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// -------- Authenticator --------
+var (
+	ErrNoCredentials = errors.New("missing credentials")
+	ErrBadKey        = errors.New("invalid api key")
+	ErrBadToken      = errors.New("invalid token")
+	ErrExpired       = errors.New("token expired")
+	ErrDuplicateKey  = errors.New("another key has that secret")
+)
+
+type Authenticator struct {
+	mu        sync.RWMutex
+	keys      map[string]*Key // secret -> key
+	jwtSecret []byte
+}
+
+func New(jwtSecret []byte, keys ...Key) (*Authenticator, error) {
+	a := &Authenticator{keys: make(map[string]*Key), jwtSecret: jwtSecret}
+	for _, k := range keys {
+		if _, err := a.AddKey(k); err != nil { return nil, fmt.Errorf("key %q: %w", k.ID, err) }
+	}
+	return a, nil
+}
+
+// AddKey registers k, generating a secret when none is given, and returns
+// it. A key with k's ID is replaced; one with k's secret and another ID
+// fails the call with ErrDuplicateKey.
+func (a *Authenticator) AddKey(k Key) (Key, error) {
+	if k.Secret == "" { k.Secret = newSecret() }
+	a.mu.Lock(); defer a.mu.Unlock()
+	if old, ok := a.keys[k.Secret]; ok && old.ID != k.ID { return Key{}, ErrDuplicateKey }
+	for sec, old := range a.keys {
+		if old.ID == k.ID { delete(a.keys, sec) }
+	}
+	kk := k
+	a.keys[k.Secret] = &kk
+	return kk, nil
+}
+
+func (a *Authenticator) RemoveKey(id string) bool {
+	a.mu.Lock(); defer a.mu.Unlock()
+	for sec, k := range a.keys {
+		if k.ID == id { delete(a.keys, sec); return true }
+	}
+	return false
+}
+
+// Keys lists registered keys without their secrets.
+func (a *Authenticator) Keys() []Key {
+	a.mu.RLock(); defer a.mu.RUnlock()
+	out := make([]Key, 0, len(a.keys))
+	for _, k := range a.keys {
+		out = append(out, Key{ID: k.ID, Scopes: k.Scopes, Tenant: k.Tenant})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Authenticate resolves the caller from X-API-Key or an Authorization
+// bearer value (a JWT when it has three segments, an API key otherwise).
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	return a.AuthenticateHeader(r.Header)
+}
+
+// AuthenticateHeader is Authenticate for credentials carried outside an
+// HTTP request, e.g. gRPC metadata copied into a header.
+func (a *Authenticator) AuthenticateHeader(hd http.Header) (*Principal, error) {
+	if k := hd.Get("X-API-Key"); k != "" {
+		return a.byKey(k)
+	}
+	h := hd.Get("Authorization")
+	if h == "" { return nil, ErrNoCredentials }
+	tok, ok := strings.CutPrefix(h, "Bearer ")
+	if !ok { return nil, ErrNoCredentials }
+	tok = strings.TrimSpace(tok)
+	if strings.Count(tok, ".") == 2 {
+		return a.byJWT(tok, time.Now())
+	}
+	return a.byKey(tok)
+}
+
+func (a *Authenticator) byKey(secret string) (*Principal, error) {
+	a.mu.RLock(); defer a.mu.RUnlock()
+	for sec, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(sec), []byte(secret)) == 1 {
+			return &Principal{ID: k.ID, Via: "apikey", Scopes: k.Scopes, Tenant: k.Tenant}, nil
+		}
+	}
+	return nil, ErrBadKey
+}
+
+// byJWT verifies an HS256 token. Scopes come from either a space-separated
+// "scope" claim or a "scopes" array.
+func (a *Authenticator) byJWT(tok string, now time.Time) (*Principal, error) {
+	if len(a.jwtSecret) == 0 { return nil, ErrBadToken }
+	parts := strings.Split(tok, ".")
+	var hdr struct{ Alg string `json:"alg"` }
+	if err := decodeSeg(parts[0], &hdr); err != nil || hdr.Alg != "HS256" {
+		return nil, ErrBadToken
+	}
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) { return nil, ErrBadToken }
+
+	var c struct {
+		Sub    string   `json:"sub"`
+		Exp    int64    `json:"exp"`
+		Nbf    int64    `json:"nbf"`
+		Scope  string   `json:"scope"`
+		Scopes []string `json:"scopes"`
+		Tenant string   `json:"tenant"`
+	}
+	if err := decodeSeg(parts[1], &c); err != nil { return nil, ErrBadToken }
+	if c.Exp != 0 && now.Unix() >= c.Exp { return nil, ErrExpired }
+	if c.Nbf != 0 && now.Unix() < c.Nbf { return nil, ErrBadToken }
+	raw := append(strings.Fields(c.Scope), c.Scopes...)
+	p := &Principal{ID: c.Sub, Via: "jwt", Tenant: strings.ToLower(c.Tenant)}
+	for _, s := range raw {
+		if sc, err := ParseScope(s); err == nil { p.Scopes = append(p.Scopes, sc) }
+	}
+	return p, nil
+}
+
+func decodeSeg(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil { return err }
+	return json.Unmarshal(b, v)
+}
+
+// CanUse reports whether p may reach tenant: true unless p's key is
+// bound to another one.
+func (p *Principal) CanUse(tenant string) bool { return p == nil || p.Tenant == "" || p.Tenant == tenant }
+
+// Require wraps next so it only runs for callers holding scope. It is
+// for process-wide routes, so keys bound to a tenant are refused; see
+// RequireIn. A nil Authenticator disables auth entirely.
+func (a *Authenticator) Require(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return a.RequireIn(scope, nil, next)
+}
+
+// RequireIn is Require for routes serving the tenant tenantOf(r), which
+// keys bound to that tenant may use too. A nil tenantOf admits unbound
+// keys only.
+func (a *Authenticator) RequireIn(scope Scope, tenantOf func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	if a == nil { return next }
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues("unauthenticated").Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="social-graph"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized); return
+		}
+		if !p.Has(scope) {
+			metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+			http.Error(w, "insufficient scope", http.StatusForbidden); return
+		}
+		if p.Tenant != "" && (tenantOf == nil || !p.CanUse(tenantOf(r))) {
+			metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+			http.Error(w, "key not valid for this tenant", http.StatusForbidden); return
+		}
+		next(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
+
+// ParseKeys reads "id:secret:scope+scope,id2:secret2:scope:tenant" as
+// used by the API_KEYS environment variable; the optional fourth field
+// binds the key to one tenant.
+func ParseKeys(spec string) ([]Key, error) {
+	var out []Key
+	for _, ent := range strings.Split(spec, ",") {
+		ent = strings.TrimSpace(ent)
+		if ent == "" { continue }
+		f := strings.Split(ent, ":")
+		if len(f) < 3 || len(f) > 4 || f[0] == "" || f[1] == "" || (len(f) == 4 && f[3] == "") {
+			return nil, fmt.Errorf("bad key entry %q (want id:secret:scopes[:tenant])", ent)
+		}
+		k := Key{ID: f[0], Secret: f[1]}
+		if len(f) == 4 { k.Tenant = strings.ToLower(f[3]) }
+		for _, s := range strings.Split(f[2], "+") {
+			sc, err := ParseScope(s)
+			if err != nil { return nil, err }
+			k.Scopes = append(k.Scopes, sc)
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func newSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "sg_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,211 @@
+// Package backup periodically uploads gzip-compressed snapshots of every
+// tenant's graph to object storage, keeps the newest N, and can restore
+// the newest one at startup.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+type Config struct {
+	Provider      string        `yaml:"provider"` // "" (off) | s3 | gcs | file
+	Bucket        string        `yaml:"bucket"`   // bucket name, or directory for file
+	Prefix        string        `yaml:"prefix"`
+	Endpoint      string        `yaml:"endpoint"` // S3-compatible endpoint; defaults per provider
+	Region        string        `yaml:"region"`
+	AccessKey     string        `yaml:"access_key" env:"BACKUP_ACCESS_KEY"`
+	SecretKey     string        `yaml:"secret_key" env:"BACKUP_SECRET_KEY" secret:"true"`
+	Interval      time.Duration `yaml:"interval"`
+	Retain        int           `yaml:"retain"` // generations kept
+	RestoreOnBoot bool          `yaml:"restore_on_boot"`
+}
+
+func DefaultConfig() Config {
+	return Config{Prefix: "social-graph/", Region: "us-east-1", Interval: time.Hour, Retain: 7}
+}
+
+func (c Config) Validate() error {
+	switch c.Provider {
+	case "":
+		return nil
+	case "s3", "gcs":
+		if c.AccessKey == "" || c.SecretKey == "" { return errors.New("access_key and secret_key are required") }
+	case "file":
+	default:
+		return fmt.Errorf("unknown provider %q", c.Provider)
+	}
+	var errs []error
+	if c.Bucket == "" { errs = append(errs, errors.New("bucket is required")) }
+	if c.Interval <= 0 { errs = append(errs, errors.New("interval must be > 0")) }
+	if c.Retain < 1 { errs = append(errs, errors.New("retain must be >= 1")) }
+	return errors.Join(errs...)
+}
+
+// Bucket is the minimal object-store surface backups need.
+type Bucket interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Tenants gives backups access to each tenant's node-local graph.
+type Tenants interface {
+	Local(tenant string) (*graph.MemGraph, error)
+	Names() []string
+}
+
+type Backup struct {
+	cfg     Config
+	bucket  Bucket
+	tenants Tenants
+}
+
+func New(cfg Config, tenants Tenants) (*Backup, error) {
+	var b Bucket
+	switch cfg.Provider {
+	case "s3":
+		b = newS3(cfg, "https://s3."+cfg.Region+".amazonaws.com")
+	case "gcs":
+		// GCS speaks the S3 XML API with HMAC keys.
+		b = newS3(cfg, "https://storage.googleapis.com")
+	case "file":
+		b = dirBucket(cfg.Bucket)
+	default:
+		return nil, fmt.Errorf("backup: unknown provider %q", cfg.Provider)
+	}
+	return &Backup{cfg: cfg, bucket: b, tenants: tenants}, nil
+}
+
+// Once uploads one snapshot and prunes old generations. Keys embed a UTC
+// timestamp, so lexical order is chronological.
+func (b *Backup) Once(ctx context.Context) (string, error) {
+	start := time.Now()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := b.write(zw); err != nil { metrics.Backups.WithLabelValues("error").Inc(); return "", err }
+	if err := zw.Close(); err != nil { metrics.Backups.WithLabelValues("error").Inc(); return "", err }
+	key := b.cfg.Prefix + "snapshot-" + start.UTC().Format("20060102T150405.000Z") + ".sgb.gz"
+	if err := b.bucket.Put(ctx, key, buf.Bytes()); err != nil {
+		metrics.Backups.WithLabelValues("error").Inc()
+		return "", err
+	}
+	metrics.Backups.WithLabelValues("ok").Inc()
+	metrics.BackupLastSuccess.SetToCurrentTime()
+	slog.Info("backup uploaded", "key", key, "bytes", buf.Len(), "took_ms", time.Since(start).Milliseconds())
+	if err := b.prune(ctx); err != nil { slog.Warn("backup prune failed", "err", err) }
+	return key, nil
+}
+
+// Restore loads the newest backup into the local graphs. It returns ""
+// when the bucket holds none.
+func (b *Backup) Restore(ctx context.Context) (string, error) {
+	keys, err := b.list(ctx)
+	if err != nil || len(keys) == 0 { return "", err }
+	key := keys[len(keys)-1]
+	rc, err := b.bucket.Get(ctx, key)
+	if err != nil { return "", err }
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil { return "", fmt.Errorf("backup %s: %w", key, err) }
+	if err := b.read(zr); err != nil { return "", fmt.Errorf("backup %s: %w", key, err) }
+	return key, nil
+}
+
+func (b *Backup) list(ctx context.Context) ([]string, error) {
+	all, err := b.bucket.List(ctx, b.cfg.Prefix)
+	if err != nil { return nil, err }
+	var keys []string
+	for _, k := range all {
+		if strings.HasPrefix(k[len(b.cfg.Prefix):], "snapshot-") && strings.HasSuffix(k, ".sgb.gz") { keys = append(keys, k) }
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (b *Backup) prune(ctx context.Context) error {
+	keys, err := b.list(ctx)
+	if err != nil { return err }
+	var errs []error
+	for len(keys) > b.cfg.Retain {
+		if err := b.bucket.Delete(ctx, keys[0]); err != nil { errs = append(errs, err) }
+		keys = keys[1:]
+	}
+	return errors.Join(errs...)
+}
+
+// -------- Archive format --------
+// uvarint(tenants), then per tenant uvarint(len) name uvarint(len) graph
+// snapshot, all inside a gzip stream.
+
+func (b *Backup) write(w io.Writer) error {
+	var tmp [binary.MaxVarintLen64]byte
+	putBytes := func(p []byte) error {
+		n := binary.PutUvarint(tmp[:], uint64(len(p)))
+		if _, err := w.Write(tmp[:n]); err != nil { return err }
+		_, err := w.Write(p)
+		return err
+	}
+	names := b.tenants.Names()
+	n := binary.PutUvarint(tmp[:], uint64(len(names)))
+	if _, err := w.Write(tmp[:n]); err != nil { return err }
+	for _, name := range names {
+		g, err := b.tenants.Local(name)
+		if err != nil { return err }
+		var gb bytes.Buffer
+		if err := g.WriteSnapshot(&gb); err != nil { return err }
+		if err := putBytes([]byte(name)); err != nil { return err }
+		if err := putBytes(gb.Bytes()); err != nil { return err }
+	}
+	return nil
+}
+
+// maxName bounds a tenant name in the archive; anything longer is a
+// corrupt length, not a name.
+const maxName = 1 << 10
+
+func (b *Backup) read(r io.Reader) error {
+	br := bufio.NewReader(r)
+	// Decode every tenant into a staging graph before touching any, so a
+	// truncated or corrupt backup is refused rather than half restored.
+	// Snapshots stream through a LimitedReader: a bad length fails the
+	// decode instead of sizing an allocation.
+	count, err := binary.ReadUvarint(br)
+	if err != nil { return fmt.Errorf("backup: truncated: %w", err) }
+	type staged struct{ g, fresh *graph.MemGraph }
+	var all []staged
+	for i := uint64(0); i < count; i++ {
+		n, err := binary.ReadUvarint(br)
+		if err != nil { return fmt.Errorf("backup: truncated at tenant %d of %d: %w", i+1, count, err) }
+		if n > maxName { return fmt.Errorf("backup: tenant %d of %d: name of %d bytes", i+1, count, n) }
+		name := make([]byte, n)
+		if _, err := io.ReadFull(br, name); err != nil { return fmt.Errorf("backup: truncated at tenant %d of %d: %w", i+1, count, err) }
+		size, err := binary.ReadUvarint(br)
+		if err != nil { return fmt.Errorf("backup: truncated in tenant %q: %w", name, err) }
+		if size > math.MaxInt64 { return fmt.Errorf("backup: tenant %q: bad length", name) }
+		g, err := b.tenants.Local(string(name))
+		if err != nil { return err }
+		fresh := graph.NewMemGraphShards(g.Shards())
+		if err := fresh.ReadSnapshot(io.LimitReader(br, int64(size))); err != nil { return fmt.Errorf("backup: tenant %q: %w", name, err) }
+		all = append(all, staged{g, fresh})
+	}
+	for _, t := range all {
+		if err := t.g.Replace(t.fresh); err != nil { return err }
+	}
+	return nil
+}
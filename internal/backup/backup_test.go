@@ -0,0 +1,122 @@
+package backup_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/backup"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+type tenants map[string]*graph.MemGraph
+
+func (t tenants) Local(name string) (*graph.MemGraph, error) { return t[name], nil }
+
+func (t tenants) Names() []string {
+	var out []string
+	for name := range t { out = append(out, name) }
+	slices.Sort(out)
+	return out
+}
+
+func newTenants(t *testing.T, edges map[string][][2]uint64) tenants {
+	t.Helper()
+	ts := tenants{"a": graph.NewMemGraph(), "b": graph.NewMemGraph()}
+	for name, es := range edges {
+		for _, e := range es {
+			if _, err := ts[name].Follow(context.Background(), e[0], e[1]); err != nil { t.Fatal(err) }
+		}
+	}
+	return ts
+}
+
+// state reports which of the edges either side of a test holds, per
+// tenant.
+func state(t *testing.T, ts tenants) map[string]bool {
+	t.Helper()
+	out := make(map[string]bool)
+	for name, g := range ts {
+		for _, e := range [][2]uint64{{1, 2}, {2, 3}, {3, 4}, {9, 10}} {
+			ok, err := g.HasEdge(context.Background(), e[0], e[1])
+			if err != nil { t.Fatal(err) }
+			out[fmt.Sprintf("%s:%d->%d", name, e[0], e[1])] = ok
+		}
+	}
+	return out
+}
+
+// TestRestore uploads a backup of two tenants, damages it, and checks
+// that Restore either installs both or leaves both as they were.
+func TestRestore(t *testing.T) {
+	header := func(name string, size uint64) []byte {
+		b := binary.AppendUvarint(nil, 1)
+		b = binary.AppendUvarint(b, uint64(len(name)))
+		b = append(b, name...)
+		return binary.AppendUvarint(b, size)
+	}
+	tests := []struct {
+		name    string
+		damage  func([]byte) []byte // the uncompressed archive; nil keeps it
+		wantErr bool
+	}{
+		{"intact", nil, false},
+		{"truncated in the last tenant", func(b []byte) []byte { return b[:len(b)-3] }, true},
+		{"truncated in the first tenant", func(b []byte) []byte { return b[:12] }, true},
+		{"flipped byte", func(b []byte) []byte { b[len(b)-40] ^= 0xff; return b }, true},
+		{"missing tenant", func(b []byte) []byte { b[0]++; return b }, true},
+		{"oversized name", func([]byte) []byte { return binary.AppendUvarint([]byte{1}, 1<<40) }, true},
+		{"oversized snapshot", func([]byte) []byte { return append(header("a", 1<<62), "SGS"...) }, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			cfg := backup.Config{Provider: "file", Bucket: dir, Retain: 1}
+			src := newTenants(t, map[string][][2]uint64{"a": {{1, 2}, {2, 3}}, "b": {{3, 4}}})
+			b, err := backup.New(cfg, src)
+			if err != nil { t.Fatal(err) }
+			key, err := b.Once(ctx)
+			if err != nil { t.Fatal(err) }
+			if tc.damage != nil { damage(t, filepath.Join(dir, key), tc.damage) }
+
+			dst := newTenants(t, map[string][][2]uint64{"a": {{9, 10}}})
+			before := state(t, dst)
+			r, err := backup.New(cfg, dst)
+			if err != nil { t.Fatal(err) }
+			got, err := r.Restore(ctx)
+			if tc.wantErr {
+				if err == nil { t.Fatal("damaged backup restored") }
+				if after := state(t, dst); !maps.Equal(after, before) { t.Fatalf("failed restore changed the graphs: %v, was %v", after, before) }
+				return
+			}
+			if err != nil { t.Fatal(err) }
+			if got != key { t.Fatalf("restored %q, want %q", got, key) }
+			if after, want := state(t, dst), state(t, src); !maps.Equal(after, want) { t.Fatalf("restored %v, want %v", after, want) }
+		})
+	}
+}
+
+// damage rewrites the gzip file at path with f applied to its contents.
+func damage(t *testing.T, path string, f func([]byte) []byte) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil { t.Fatal(err) }
+	data, err := io.ReadAll(zr)
+	if err != nil { t.Fatal(err) }
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(f(data)); err != nil { t.Fatal(err) }
+	if err := zw.Close(); err != nil { t.Fatal(err) }
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil { t.Fatal(err) }
+}
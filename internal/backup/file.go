@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirBucket stores objects as files under a local directory; keys may
+// contain slashes.
+type dirBucket string
+
+func (d dirBucket) path(key string) string { return filepath.Join(string(d), filepath.FromSlash(key)) }
+
+func (d dirBucket) Put(_ context.Context, key string, data []byte) error {
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { return err }
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil { return err }
+	return os.Rename(tmp, p)
+}
+
+func (d dirBucket) Get(_ context.Context, key string) (io.ReadCloser, error) { return os.Open(d.path(key)) }
+
+func (d dirBucket) List(_ context.Context, prefix string) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(string(d), func(p string, e os.DirEntry, err error) error {
+		if err != nil || e.IsDir() { return err }
+		rel, err := filepath.Rel(string(d), p)
+		if err != nil { return err }
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) { out = append(out, key) }
+		return nil
+	})
+	if os.IsNotExist(err) { return nil, nil }
+	return out, err
+}
+
+func (d dirBucket) Delete(_ context.Context, key string) error { return os.Remove(d.path(key)) }
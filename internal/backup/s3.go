@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Bucket talks to S3 (or any S3-compatible store such as GCS with HMAC
+// keys) with path-style requests signed by AWS Signature Version 4.
+type s3Bucket struct {
+	endpoint, bucket, region string
+	access, secret           string
+	client                   *http.Client
+}
+
+func newS3(cfg Config, defaultEndpoint string) *s3Bucket {
+	ep := cfg.Endpoint
+	if ep == "" { ep = defaultEndpoint }
+	region := cfg.Region
+	if cfg.Provider == "gcs" && cfg.Endpoint == "" { region = "auto" }
+	return &s3Bucket{
+		endpoint: strings.TrimRight(ep, "/"), bucket: cfg.Bucket, region: region,
+		access: cfg.AccessKey, secret: cfg.SecretKey,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (s *s3Bucket) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data)
+	if err != nil { return err }
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3Bucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil { return nil, err }
+	return resp.Body, nil
+}
+
+func (s *s3Bucket) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil { return err }
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3Bucket) List(ctx context.Context, prefix string) ([]string, error) {
+	var out []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" { q.Set("continuation-token", token) }
+		resp, err := s.do(ctx, http.MethodGet, "", q, nil)
+		if err != nil { return nil, err }
+		var res struct {
+			Contents []struct{ Key string }
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil { return nil, err }
+		for _, c := range res.Contents { out = append(out, c.Key) }
+		if !res.IsTruncated || res.NextContinuationToken == "" { return out, nil }
+		token = res.NextContinuationToken
+	}
+}
+
+func (s *s3Bucket) do(ctx context.Context, method, key string, q url.Values, body []byte) (*http.Response, error) {
+	path := "/" + s.bucket
+	if key != "" { path += "/" + key }
+	u := s.endpoint + escapePath(path)
+	if len(q) > 0 { u += "?" + canonicalQuery(q) }
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil { return nil, err }
+	s.sign(req, body, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil { return nil, err }
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("backup: %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// sign adds SigV4 headers; see the AWS "Signature Version 4 signing
+// process" reference for the canonical request layout.
+func (s *s3Bucket) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payload + "\nx-amz-date:" + amzDate + "\n",
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	cr := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(cr[:])
+
+	k := hmacSHA256([]byte("AWS4"+s.secret), day)
+	k = hmacSHA256(k, s.region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.access+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+// escapePath URI-encodes each path segment the way SigV4 expects.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts { parts[i] = uriEncode(s) }
+	return strings.Join(parts, "/")
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q { keys = append(keys, k) }
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range q[k] {
+			if b.Len() > 0 { b.WriteByte('&') }
+			b.WriteString(uriEncode(k) + "=" + uriEncode(v))
+		}
+	}
+	return b.String()
+}
+
+// uriEncode escapes everything except RFC 3986 unreserved characters.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,103 @@
+// Package block keeps per-tenant block and mute lists and answers which
+// users a viewer should not see.
+package block
+
+import "sync"
+
+type set map[uint64]struct{}
+
+// Store records blocks (hidden in both directions) and mutes (hidden
+// only from the muting viewer).
+type Store struct {
+	mu        sync.RWMutex
+	blocked   map[uint64]set // viewer -> users they blocked
+	blockedBy map[uint64]set // user -> viewers who blocked them
+	muted     map[uint64]set // viewer -> users they muted
+}
+
+func New() *Store {
+	return &Store{blocked: make(map[uint64]set), blockedBy: make(map[uint64]set), muted: make(map[uint64]set)}
+}
+
+func add(m map[uint64]set, k, v uint64) bool {
+	s, ok := m[k]
+	if !ok { s = make(set); m[k] = s }
+	if _, dup := s[v]; dup { return false }
+	s[v] = struct{}{}
+	return true
+}
+
+func del(m map[uint64]set, k, v uint64) bool {
+	s, ok := m[k]
+	if !ok { return false }
+	if _, ok := s[v]; !ok { return false }
+	delete(s, v)
+	if len(s) == 0 { delete(m, k) }
+	return true
+}
+
+func (s *Store) Block(viewer, target uint64) bool {
+	if viewer == target { return false }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if !add(s.blocked, viewer, target) { return false }
+	add(s.blockedBy, target, viewer)
+	return true
+}
+
+func (s *Store) Unblock(viewer, target uint64) bool {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if !del(s.blocked, viewer, target) { return false }
+	del(s.blockedBy, target, viewer)
+	return true
+}
+
+func (s *Store) Mute(viewer, target uint64) bool {
+	if viewer == target { return false }
+	s.mu.Lock(); defer s.mu.Unlock()
+	return add(s.muted, viewer, target)
+}
+
+func (s *Store) Unmute(viewer, target uint64) bool {
+	s.mu.Lock(); defer s.mu.Unlock()
+	return del(s.muted, viewer, target)
+}
+
+func list(s set) []uint64 {
+	out := make([]uint64, 0, len(s))
+	for x := range s { out = append(out, x) }
+	return out
+}
+
+func (s *Store) Blocked(viewer uint64) []uint64 {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return list(s.blocked[viewer])
+}
+
+func (s *Store) Muted(viewer uint64) []uint64 {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return list(s.muted[viewer])
+}
+
+// Hidden returns everyone viewer blocked, muted or was blocked by, or nil
+// when there is no one.
+func (s *Store) Hidden(viewer uint64) map[uint64]struct{} {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	n := len(s.blocked[viewer]) + len(s.blockedBy[viewer]) + len(s.muted[viewer])
+	if n == 0 { return nil }
+	out := make(map[uint64]struct{}, n)
+	for _, m := range []set{s.blocked[viewer], s.blockedBy[viewer], s.muted[viewer]} {
+		for x := range m { out[x] = struct{}{} }
+	}
+	return out
+}
+
+// Filter drops users hidden from viewer, reusing ids' backing array.
+func (s *Store) Filter(viewer uint64, ids []uint64) []uint64 {
+	hidden := s.Hidden(viewer)
+	if hidden == nil { return ids }
+	out := ids[:0]
+	for _, x := range ids {
+		if _, ok := hidden[x]; !ok { out = append(out, x) }
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+// Package chaos injects latency, errors and dropped responses into HTTP
+// routes and graph.Store calls, for resilience testing of clients (their
+// retries, backoff and breakers) in test and staging deployments. It is
+// off unless configured, and config validation refuses it outside those
+// environments.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+type Config struct {
+	Enabled bool   `yaml:"enabled"`
+	Routes  []Rule `yaml:"routes"` // first match wins
+	Store   []Rule `yaml:"store"`  // first match wins
+}
+
+// Rule injects faults into the calls it matches. Of each call, a
+// latency_rate fraction is delayed, and independently an error_rate
+// fraction fails and a drop_rate fraction is dropped.
+type Rule struct {
+	Match       string        `yaml:"match"`        // route path prefix, or Store method name (HasEdge); "*" = every call
+	Latency     time.Duration `yaml:"latency"`      // added delay
+	Jitter      time.Duration `yaml:"jitter"`       // up to this much more, uniformly
+	LatencyRate float64       `yaml:"latency_rate"`
+	ErrorRate   float64       `yaml:"error_rate"`   // routes answer Status; Store calls fail with graph.ErrUnavailable
+	DropRate    float64       `yaml:"drop_rate"`    // routes close the connection unanswered; Store writes are applied, then reported failed
+	Status      int           `yaml:"status"`       // for route errors; default 503
+}
+
+// Validate checks every rule.
+func (c Config) Validate() error {
+	for _, set := range []struct {
+		name  string
+		rules []Rule
+	}{{"routes", c.Routes}, {"store", c.Store}} {
+		for i, r := range set.rules {
+			if r.Match == "" { return fmt.Errorf("%s[%d]: match is required", set.name, i) }
+			for _, p := range []float64{r.LatencyRate, r.ErrorRate, r.DropRate} {
+				if p < 0 || p > 1 { return fmt.Errorf("%s[%d]: rates must be in [0, 1]", set.name, i) }
+			}
+			if r.ErrorRate+r.DropRate > 1 { return fmt.Errorf("%s[%d]: error_rate + drop_rate must be <= 1", set.name, i) }
+			if r.Latency < 0 || r.Jitter < 0 { return fmt.Errorf("%s[%d]: latency and jitter must be >= 0", set.name, i) }
+			if r.Status != 0 && (r.Status < 400 || r.Status > 599) { return fmt.Errorf("%s[%d]: status must be 4xx or 5xx", set.name, i) }
+		}
+	}
+	return nil
+}
+
+type fault int
+
+const (
+	none fault = iota
+	fail
+	drop
+)
+
+// roll decides one call's fault and delays it if picked, returning early
+// when ctx is done.
+func (r *Rule) roll(ctx context.Context, layer string) (fault, error) {
+	if r.LatencyRate > 0 && rand.Float64() < r.LatencyRate {
+		d := r.Latency
+		if r.Jitter > 0 { d += rand.N(r.Jitter) }
+		metrics.ChaosInjected.WithLabelValues(layer, r.Match, "latency").Inc()
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return none, ctx.Err()
+		}
+	}
+	switch x := rand.Float64(); {
+	case x < r.ErrorRate:
+		metrics.ChaosInjected.WithLabelValues(layer, r.Match, "error").Inc()
+		return fail, nil
+	case x < r.ErrorRate+r.DropRate:
+		metrics.ChaosInjected.WithLabelValues(layer, r.Match, "drop").Inc()
+		return drop, nil
+	}
+	return none, nil
+}
+
+// Middleware injects the route rules' faults before next runs. A dropped
+// request is aborted (http.ErrAbortHandler): the client sees the
+// connection close with no response, and next never runs.
+func Middleware(c Config, next http.Handler) http.Handler {
+	if !c.Enabled || len(c.Routes) == 0 { return next }
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := matchRoute(c.Routes, r.URL.Path)
+		if rule == nil { next.ServeHTTP(w, r); return }
+		f, err := rule.roll(r.Context(), "http")
+		if err != nil { return } // the client went away
+		switch f {
+		case fail:
+			status := rule.Status
+			if status == 0 { status = http.StatusServiceUnavailable }
+			http.Error(w, "chaos: injected fault", status)
+		case drop:
+			panic(http.ErrAbortHandler)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func matchRoute(rules []Rule, path string) *Rule {
+	for i := range rules {
+		if m := rules[i].Match; m == "*" || strings.HasPrefix(path, m) { return &rules[i] }
+	}
+	return nil
+}
+
+func matchMethod(rules []Rule, method string) *Rule {
+	for i := range rules {
+		if m := rules[i].Match; m == "*" || m == method { return &rules[i] }
+	}
+	return nil
+}
+
+// ErrInjected is wrapped, with graph.ErrUnavailable, by every injected
+// Store failure.
+var ErrInjected = fmt.Errorf("%w: chaos: injected fault", graph.ErrUnavailable)
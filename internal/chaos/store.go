@@ -0,0 +1,159 @@
+package chaos
+
+import (
+	"context"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Store wraps g so its calls suffer c's store rules, matched by method
+// name. Failed calls return ErrInjected without reaching g. A dropped
+// write reaches g and is then reported failed, as if its acknowledgement
+// were lost; a dropped read just fails. Views opened through the wrapper
+// suffer the same rules as the Store.
+func Store(c Config, g graph.Store) graph.Store {
+	if !c.Enabled || len(c.Store) == 0 { return g }
+	return &store{reader: &reader{r: g, rules: c.Store}, s: g}
+}
+
+type reader struct {
+	r     graph.Reader
+	rules []Rule
+}
+
+// before runs ahead of a read: any fault fails it.
+func (c *reader) before(ctx context.Context, method string) error {
+	rule := matchMethod(c.rules, method)
+	if rule == nil { return nil }
+	f, err := rule.roll(ctx, "store")
+	if err != nil { return err }
+	if f != none { return ErrInjected }
+	return nil
+}
+
+// write runs one write under method's rule.
+func (c *reader) write(ctx context.Context, method string, do func() error) error {
+	rule := matchMethod(c.rules, method)
+	if rule == nil { return do() }
+	f, err := rule.roll(ctx, "store")
+	if err != nil { return err }
+	switch f {
+	case fail:
+		return ErrInjected
+	case drop:
+		if err := do(); err != nil { return err }
+		return ErrInjected
+	}
+	return do()
+}
+
+func (c *reader) Following(ctx context.Context, u uint64) ([]uint64, error) {
+	if err := c.before(ctx, "Following"); err != nil { return nil, err }
+	return c.r.Following(ctx, u)
+}
+
+func (c *reader) Followers(ctx context.Context, u uint64) ([]uint64, error) {
+	if err := c.before(ctx, "Followers"); err != nil { return nil, err }
+	return c.r.Followers(ctx, u)
+}
+
+func (c *reader) ForEachFollowing(ctx context.Context, u uint64, fn func(v uint64) bool) error {
+	if err := c.before(ctx, "ForEachFollowing"); err != nil { return err }
+	return c.r.ForEachFollowing(ctx, u, fn)
+}
+
+func (c *reader) ForEachFollowers(ctx context.Context, u uint64, fn func(v uint64) bool) error {
+	if err := c.before(ctx, "ForEachFollowers"); err != nil { return err }
+	return c.r.ForEachFollowers(ctx, u, fn)
+}
+
+func (c *reader) FollowingSet(ctx context.Context, u uint64) (graph.Set, error) {
+	if err := c.before(ctx, "FollowingSet"); err != nil { return graph.Set{}, err }
+	return c.r.FollowingSet(ctx, u)
+}
+
+func (c *reader) FollowersSet(ctx context.Context, u uint64) (graph.Set, error) {
+	if err := c.before(ctx, "FollowersSet"); err != nil { return graph.Set{}, err }
+	return c.r.FollowersSet(ctx, u)
+}
+
+func (c *reader) HasEdge(ctx context.Context, u, v uint64) (bool, error) {
+	if err := c.before(ctx, "HasEdge"); err != nil { return false, err }
+	return c.r.HasEdge(ctx, u, v)
+}
+
+func (c *reader) DegreeOut(ctx context.Context, u uint64) (int, error) {
+	if err := c.before(ctx, "DegreeOut"); err != nil { return 0, err }
+	return c.r.DegreeOut(ctx, u)
+}
+
+func (c *reader) DegreeIn(ctx context.Context, u uint64) (int, error) {
+	if err := c.before(ctx, "DegreeIn"); err != nil { return 0, err }
+	return c.r.DegreeIn(ctx, u)
+}
+
+func (c *reader) Degrees(ctx context.Context, users []uint64) ([]graph.DegreeUser, error) {
+	if err := c.before(ctx, "Degrees"); err != nil { return nil, err }
+	return c.r.Degrees(ctx, users)
+}
+
+func (c *reader) Friends(ctx context.Context, u uint64) ([]uint64, error) {
+	if err := c.before(ctx, "Friends"); err != nil { return nil, err }
+	return c.r.Friends(ctx, u)
+}
+
+func (c *reader) AreFriends(ctx context.Context, u, v uint64) (bool, error) {
+	if err := c.before(ctx, "AreFriends"); err != nil { return false, err }
+	return c.r.AreFriends(ctx, u, v)
+}
+
+func (c *reader) UserEpoch(ctx context.Context, u uint64) (uint64, error) {
+	if err := c.before(ctx, "UserEpoch"); err != nil { return 0, err }
+	return c.r.UserEpoch(ctx, u)
+}
+
+type store struct {
+	*reader
+	s graph.Store
+}
+
+func (c *store) Follow(ctx context.Context, u, v uint64) (ok bool, err error) {
+	err = c.write(ctx, "Follow", func() (err error) { ok, err = c.s.Follow(ctx, u, v); return })
+	return ok, err
+}
+
+func (c *store) Unfollow(ctx context.Context, u, v uint64) (ok bool, err error) {
+	err = c.write(ctx, "Unfollow", func() (err error) { ok, err = c.s.Unfollow(ctx, u, v); return })
+	return ok, err
+}
+
+func (c *store) FollowIf(ctx context.Context, u, v, epoch uint64) (ok bool, err error) {
+	err = c.write(ctx, "FollowIf", func() (err error) { ok, err = c.s.FollowIf(ctx, u, v, epoch); return })
+	return ok, err
+}
+
+func (c *store) UnfollowIf(ctx context.Context, u, v, epoch uint64) (ok bool, err error) {
+	err = c.write(ctx, "UnfollowIf", func() (err error) { ok, err = c.s.UnfollowIf(ctx, u, v, epoch); return })
+	return ok, err
+}
+
+func (c *store) Apply(ctx context.Context, ops []graph.EdgeOp) (changed []bool, err error) {
+	err = c.write(ctx, "Apply", func() (err error) { changed, err = c.s.Apply(ctx, ops); return })
+	return changed, err
+}
+
+func (c *store) TouchUsers(ctx context.Context, users ...uint64) error {
+	return c.write(ctx, "TouchUsers", func() error { return c.s.TouchUsers(ctx, users...) })
+}
+
+func (c *store) View() graph.View {
+	v := c.s.View()
+	return &view{reader: &reader{r: v, rules: c.rules}, v: v}
+}
+
+type view struct {
+	*reader
+	v graph.View
+}
+
+func (c *view) Close() { c.v.Close() }
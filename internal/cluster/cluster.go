@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+const (
+	TokenHeader     = "X-Cluster-Token"
+	ForwardedHeader = "X-SG-Forwarded" // set on forwarded requests to stop loops
+	tenantHeader    = "X-Tenant"
+)
+
+type Cluster struct {
+	Self    Node
+	Ring    *Ring
+	token   string
+	timeout time.Duration
+	hc      *http.Client
+	proxies map[string]*httputil.ReverseProxy
+}
+
+func New(cfg Config) (*Cluster, error) {
+	if err := cfg.Validate(); err != nil { return nil, err }
+	nodes, _ := ParsePeers(cfg.Peers)
+	c := &Cluster{
+		Ring:    NewRing(nodes, cfg.VNodes),
+		token:   cfg.Token,
+		timeout: cfg.Timeout,
+		hc:      &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 64, IdleConnTimeout: 90 * time.Second}},
+		proxies: make(map[string]*httputil.ReverseProxy),
+	}
+	if c.timeout <= 0 { c.timeout = 2 * time.Second }
+	for _, n := range nodes {
+		if n.ID == cfg.Self { c.Self = n }
+		target, err := url.Parse(n.URL)
+		if err != nil { return nil, fmt.Errorf("peer %s: %w", n.ID, err) }
+		c.proxies[n.ID] = httputil.NewSingleHostReverseProxy(target)
+	}
+	return c, nil
+}
+
+func (c *Cluster) Owns(u uint64) bool { return c.Ring.Owner(u).ID == c.Self.ID }
+
+// call performs an internal RPC against node for tenant and decodes the
+// JSON response into out (when non-nil). Unreachable peers and server
+// errors wrap graph.ErrUnavailable and 409s graph.ErrEpochChanged; if ctx
+// ended first, its error is returned instead.
+func (c *Cluster) call(ctx context.Context, node Node, tenant, method, path string, q url.Values, in, out any) (err error) {
+	defer func() {
+		res := "ok"
+		if err != nil { res = "error" }
+		metrics.ClusterRPC.WithLabelValues(node.ID, path, res).Inc()
+	}()
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	u := node.URL + path
+	if len(q) > 0 { u += "?" + q.Encode() }
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil { return err }
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil { return err }
+	req.Header.Set(TokenHeader, c.token)
+	req.Header.Set(tenantHeader, tenant)
+	if in != nil { req.Header.Set("Content-Type", "application/json") }
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		if perr := parent.Err(); perr != nil { return perr }
+		return fmt.Errorf("%w: %s %s: %v", graph.ErrUnavailable, node.ID, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("%s %s: %s: %s", node.ID, path, resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode >= 500 { err = fmt.Errorf("%w: %v", graph.ErrUnavailable, err) }
+		if resp.StatusCode == http.StatusConflict { err = fmt.Errorf("%w: %v", graph.ErrEpochChanged, err) }
+		return err
+	}
+	if out == nil { return nil }
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// userKeys maps user-keyed routes to the query parameter naming the user
+// whose owner should serve them.
+var userKeys = map[string]string{
+	"/pymk":      "user_id",
+	"/following": "user_id",
+	"/followers": "user_id",
+	"/friends":   "user_id",
+}
+
+// Forward proxies user-keyed requests to the owning node so that node's
+// local data and PYMK cache serve them. Requests already forwarded once
+// are always handled locally.
+func (c *Cluster) Forward(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		param, ok := userKeys[r.URL.Path]
+		if !ok || r.Header.Get(ForwardedHeader) != "" { next.ServeHTTP(w, r); return }
+		var u uint64
+		if _, err := fmt.Sscan(r.URL.Query().Get(param), &u); err != nil { next.ServeHTTP(w, r); return }
+		owner := c.Ring.Owner(u)
+		if owner.ID == c.Self.ID { next.ServeHTTP(w, r); return }
+
+		metrics.ClusterForwards.WithLabelValues(owner.ID).Inc()
+		r2 := r.Clone(r.Context())
+		r2.Header.Set(ForwardedHeader, c.Self.ID)
+		otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r2.Header))
+		c.proxies[owner.ID].ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,208 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Resolve returns this node's local graph and embeddings for a tenant.
+type Resolve func(tenant string) (*graph.MemGraph, embeds.Store, error)
+
+// Handler serves the /internal/ peer RPCs. Every call must carry the
+// shared cluster token.
+func (c *Cluster) Handler(resolve Resolve) http.Handler {
+	mux := http.NewServeMux()
+	h := &internalHandler{c: c, resolve: resolve}
+	mux.HandleFunc("/internal/graph/following", h.wrap(h.following))
+	mux.HandleFunc("/internal/graph/followers", h.wrap(h.followers))
+	mux.HandleFunc("/internal/graph/has_edge", h.wrap(h.hasEdge))
+	mux.HandleFunc("/internal/graph/friends", h.wrap(h.friends))
+	mux.HandleFunc("/internal/graph/degree", h.wrap(h.degree))
+	mux.HandleFunc("/internal/graph/degrees", h.wrap(h.degrees))
+	mux.HandleFunc("/internal/graph/epoch", h.wrap(h.epoch))
+	mux.HandleFunc("/internal/graph/touch", h.wrap(h.touch))
+	mux.HandleFunc("/internal/graph/follow", h.wrap(h.follow))
+	mux.HandleFunc("/internal/graph/unfollow", h.wrap(h.unfollow))
+	mux.HandleFunc("/internal/graph/in", h.wrap(h.in))
+	mux.HandleFunc("/internal/embeds", h.wrap(h.embeds))
+	return mux
+}
+
+type internalHandler struct {
+	c       *Cluster
+	resolve Resolve
+}
+
+type rpc func(st *Store, e *Embeds, w http.ResponseWriter, r *http.Request)
+
+func (h *internalHandler) wrap(f rpc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(h.c.token)) != 1 {
+			http.Error(w, "bad cluster token", http.StatusUnauthorized); return
+		}
+		name := r.Header.Get(tenantHeader)
+		g, e, err := h.resolve(name)
+		if err != nil { http.Error(w, err.Error(), 404); return }
+		f(h.c.Store(name, g), h.c.Embeds(name, e), w, r)
+	}
+}
+
+func qid(r *http.Request, k string) (uint64, bool) {
+	v, err := strconv.ParseUint(r.URL.Query().Get(k), 10, 64)
+	return v, err == nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (h *internalHandler) following(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok := qid(r, "u")
+	if !ok { http.Error(w, "bad u", 400); return }
+	out, err := st.local.Following(r.Context(), u)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, out)
+}
+
+func (h *internalHandler) followers(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok := qid(r, "u")
+	if !ok { http.Error(w, "bad u", 400); return }
+	out, err := st.local.Followers(r.Context(), u)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, out)
+}
+
+func (h *internalHandler) hasEdge(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok1 := qid(r, "u")
+	v, ok2 := qid(r, "v")
+	if !ok1 || !ok2 { http.Error(w, "bad ids", 400); return }
+	has, err := st.local.HasEdge(r.Context(), u, v)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, okResp{has})
+}
+
+// friends lists u's reciprocal follows, or with v reports whether u and v
+// are friends.
+func (h *internalHandler) friends(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok := qid(r, "u")
+	if !ok { http.Error(w, "bad u", 400); return }
+	if r.URL.Query().Has("v") {
+		v, ok := qid(r, "v")
+		if !ok { http.Error(w, "bad v", 400); return }
+		are, err := st.local.AreFriends(r.Context(), u, v)
+		if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+		writeJSON(w, okResp{are}); return
+	}
+	out, err := st.local.Friends(r.Context(), u)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, out)
+}
+
+func (h *internalHandler) degree(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok := qid(r, "u")
+	if !ok { http.Error(w, "bad u", 400); return }
+	deg := st.local.DegreeOut
+	if r.URL.Query().Get("dir") == "in" { deg = st.local.DegreeIn }
+	n, err := deg(r.Context(), u)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, n)
+}
+
+// degrees answers for the users this node owns, as a peer grouped them.
+func (h *internalHandler) degrees(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var users []uint64
+	if err := json.NewDecoder(r.Body).Decode(&users); err != nil { http.Error(w, err.Error(), 400); return }
+	out, err := st.local.Degrees(r.Context(), users)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, out)
+}
+
+func (h *internalHandler) epoch(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok := qid(r, "u")
+	if !ok { http.Error(w, "bad u", 400); return }
+	e, err := st.local.UserEpoch(r.Context(), u)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, e)
+}
+
+func (h *internalHandler) touch(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	u, ok := qid(r, "u")
+	if !ok { http.Error(w, "bad u", 400); return }
+	st.local.TouchUsers(r.Context(), u)
+	writeJSON(w, okResp{true})
+}
+
+func decodeEdge(w http.ResponseWriter, r *http.Request) (edgeReq, bool) {
+	var e edgeReq
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return e, false }
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil { http.Error(w, err.Error(), 400); return e, false }
+	return e, true
+}
+
+func edgeStatus(err error) int {
+	if errors.Is(err, graph.ErrEpochChanged) { return http.StatusConflict }
+	return http.StatusServiceUnavailable
+}
+
+// follow/unfollow run the full two-sided operation on the owner of u.
+func (h *internalHandler) follow(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	e, ok := decodeEdge(w, r)
+	if !ok { return }
+	var err error
+	if e.Epoch != nil {
+		ok, err = st.FollowIf(r.Context(), e.U, e.V, *e.Epoch)
+	} else {
+		ok, err = st.Follow(r.Context(), e.U, e.V)
+	}
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, okResp{ok})
+}
+
+func (h *internalHandler) unfollow(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	e, ok := decodeEdge(w, r)
+	if !ok { return }
+	var err error
+	if e.Epoch != nil {
+		ok, err = st.UnfollowIf(r.Context(), e.U, e.V, *e.Epoch)
+	} else {
+		ok, err = st.Unfollow(r.Context(), e.U, e.V)
+	}
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, okResp{ok})
+}
+
+// in applies the followers-side half of an edge on the owner of v.
+func (h *internalHandler) in(st *Store, _ *Embeds, w http.ResponseWriter, r *http.Request) {
+	e, ok := decodeEdge(w, r)
+	if !ok { return }
+	apply := st.local.AddIn
+	if r.URL.Query().Get("op") == "remove" { apply = st.local.RemoveIn }
+	changed, err := apply(e.V, e.U)
+	if err != nil { http.Error(w, err.Error(), edgeStatus(err)); return }
+	writeJSON(w, okResp{changed})
+}
+
+func (h *internalHandler) embeds(_ *Store, e *Embeds, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u, ok := qid(r, "u")
+		if !ok { http.Error(w, "bad u", 400); return }
+		v, _ := e.local.Get(u)
+		writeJSON(w, v)
+	case http.MethodPut:
+		var body embedReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		e.local.Put(body.U, body.Vec)
+		writeJSON(w, okResp{true})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
@@ -0,0 +1,98 @@
+// Package cluster implements a sharded deployment: each node owns a
+// consistent-hash range of user IDs, user-keyed requests are forwarded to
+// the owner, and graph/embedding lookups for non-owned users go to peers.
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Enabled bool          `yaml:"enabled"`
+	Self    string        `yaml:"self"`   // this node's id
+	Peers   []string      `yaml:"peers"`  // id=http://host:port, including self
+	VNodes  int           `yaml:"vnodes"` // virtual nodes per peer
+	Token   string        `yaml:"token" secret:"true"` // shared secret for /internal calls
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{VNodes: 128, Timeout: 2 * time.Second}
+}
+
+type Node struct {
+	ID  string
+	URL string
+}
+
+func ParsePeers(specs []string) ([]Node, error) {
+	var out []Node
+	seen := make(map[string]bool)
+	for _, sp := range specs {
+		id, url, ok := strings.Cut(strings.TrimSpace(sp), "=")
+		if !ok || id == "" || url == "" { return nil, fmt.Errorf("bad peer %q (want id=url)", sp) }
+		if seen[id] { return nil, fmt.Errorf("duplicate peer id %q", id) }
+		seen[id] = true
+		out = append(out, Node{ID: id, URL: strings.TrimRight(url, "/")})
+	}
+	return out, nil
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled { return nil }
+	nodes, err := ParsePeers(c.Peers)
+	if err != nil { return err }
+	for _, n := range nodes {
+		if n.ID == c.Self { return nil }
+	}
+	return fmt.Errorf("self %q is not among peers", c.Self)
+}
+
+// -------- Consistent hash ring --------
+type point struct {
+	hash uint64
+	node int
+}
+
+type Ring struct {
+	nodes  []Node
+	points []point
+}
+
+func NewRing(nodes []Node, vnodes int) *Ring {
+	if vnodes <= 0 { vnodes = 128 }
+	r := &Ring{nodes: nodes}
+	for i, n := range nodes {
+		for v := 0; v < vnodes; v++ {
+			h := fnv.New64a()
+			h.Write([]byte(n.ID + "#" + strconv.Itoa(v)))
+			r.points = append(r.points, point{hash: h.Sum64(), node: i})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return r
+}
+
+func hashUser(u uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], u)
+	h := fnv.New64a()
+	h.Write(b[:])
+	return h.Sum64()
+}
+
+// Owner returns the node responsible for user u.
+func (r *Ring) Owner(u uint64) Node {
+	hu := hashUser(u)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hu })
+	if i == len(r.points) { i = 0 }
+	return r.nodes[r.points[i].node]
+}
+
+func (r *Ring) Nodes() []Node { return r.nodes }
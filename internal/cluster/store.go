@@ -0,0 +1,278 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Store is the cluster-wide view of one tenant's graph. Users owned by
+// this node are served from local; the rest are fetched from their owner.
+// A failed peer call is returned as an error wrapping graph.ErrUnavailable.
+type Store struct {
+	c      *Cluster
+	tenant string
+	local  *graph.MemGraph
+}
+
+func (c *Cluster) Store(tenant string, local *graph.MemGraph) *Store {
+	return &Store{c: c, tenant: tenant, local: local}
+}
+
+func (s *Store) Local() *graph.MemGraph { return s.local }
+
+func (s *Store) remote(ctx context.Context, u uint64, method, path string, q url.Values, in, out any) error {
+	owner := s.c.Ring.Owner(u)
+	err := s.c.call(ctx, owner, s.tenant, method, path, q, in, out)
+	if err != nil && ctx.Err() == nil && !errors.Is(err, graph.ErrEpochChanged) { slog.Warn("cluster rpc failed", "peer", owner.ID, "path", path, "err", err) }
+	return err
+}
+
+func uq(kv ...string) url.Values {
+	q := url.Values{}
+	for i := 0; i+1 < len(kv); i += 2 { q.Set(kv[i], kv[i+1]) }
+	return q
+}
+
+func id(u uint64) string { return strconv.FormatUint(u, 10) }
+
+type edgeReq struct {
+	U     uint64  `json:"u"`
+	V     uint64  `json:"v"`
+	Epoch *uint64 `json:"epoch,omitempty"` // conditional follow/unfollow
+}
+
+type okResp struct {
+	OK bool `json:"ok"`
+}
+
+// Follow and Unfollow update u's side first. If v's side then fails, the
+// edge is half-applied; the error says so and a retry completes it, since
+// both half-edge updates are idempotent.
+func (s *Store) Follow(ctx context.Context, u, v uint64) (bool, error) { return s.follow(ctx, u, v, nil) }
+func (s *Store) Unfollow(ctx context.Context, u, v uint64) (bool, error) { return s.unfollow(ctx, u, v, nil) }
+
+// FollowIf and UnfollowIf check u's epoch on u's owner, the only node
+// whose epoch for u moves with u's following set.
+func (s *Store) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	return s.follow(ctx, u, v, &epoch)
+}
+func (s *Store) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	return s.unfollow(ctx, u, v, &epoch)
+}
+
+func (s *Store) follow(ctx context.Context, u, v uint64, epoch *uint64) (bool, error) {
+	if !s.c.Owns(u) {
+		var res okResp
+		err := s.remote(ctx, u, http.MethodPost, "/internal/graph/follow", nil, edgeReq{u, v, epoch}, &res)
+		return res.OK, err
+	}
+	ok, err := false, error(nil)
+	if epoch != nil {
+		ok, err = s.local.AddOutIf(u, v, *epoch)
+	} else {
+		ok, err = s.local.AddOut(u, v)
+	}
+	if !ok { return false, err }
+	return true, s.addIn(ctx, v, u)
+}
+
+func (s *Store) unfollow(ctx context.Context, u, v uint64, epoch *uint64) (bool, error) {
+	if !s.c.Owns(u) {
+		var res okResp
+		err := s.remote(ctx, u, http.MethodPost, "/internal/graph/unfollow", nil, edgeReq{u, v, epoch}, &res)
+		return res.OK, err
+	}
+	ok, err := false, error(nil)
+	if epoch != nil {
+		ok, err = s.local.RemoveOutIf(u, v, *epoch)
+	} else {
+		ok, err = s.local.RemoveOut(u, v)
+	}
+	if !ok { return false, err }
+	return true, s.removeIn(ctx, v, u)
+}
+
+// Apply is atomic only within one node's memory, so every user in ops must
+// be owned by this node; other transactions are unsupported.
+func (s *Store) Apply(ctx context.Context, ops []graph.EdgeOp) ([]bool, error) {
+	for _, op := range ops {
+		if !s.c.Owns(op.Src) || !s.c.Owns(op.Dst) {
+			return nil, fmt.Errorf("%w: transaction spans cluster nodes (user %d or %d)", errors.ErrUnsupported, op.Src, op.Dst)
+		}
+	}
+	return s.local.Apply(ctx, ops)
+}
+
+func (s *Store) addIn(ctx context.Context, v, u uint64) error {
+	if s.c.Owns(v) { _, err := s.local.AddIn(v, u); return err }
+	return s.remote(ctx, v, http.MethodPost, "/internal/graph/in", uq("op", "add"), edgeReq{u, v, nil}, nil)
+}
+
+func (s *Store) removeIn(ctx context.Context, v, u uint64) error {
+	if s.c.Owns(v) { _, err := s.local.RemoveIn(v, u); return err }
+	return s.remote(ctx, v, http.MethodPost, "/internal/graph/in", uq("op", "remove"), edgeReq{u, v, nil}, nil)
+}
+
+func (s *Store) Following(ctx context.Context, u uint64) ([]uint64, error) {
+	if s.c.Owns(u) { return s.local.Following(ctx, u) }
+	var out []uint64
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/following", uq("u", id(u)), nil, &out)
+	return out, err
+}
+
+func (s *Store) Followers(ctx context.Context, u uint64) ([]uint64, error) {
+	if s.c.Owns(u) { return s.local.Followers(ctx, u) }
+	var out []uint64
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/followers", uq("u", id(u)), nil, &out)
+	return out, err
+}
+
+// Remote sets arrive as one slice anyway, so the iterators only avoid the
+// copy for locally owned users.
+func (s *Store) ForEachFollowing(ctx context.Context, u uint64, fn func(v uint64) bool) error {
+	if s.c.Owns(u) { return s.local.ForEachFollowing(ctx, u, fn) }
+	vs, err := s.Following(ctx, u)
+	for _, v := range vs { if !fn(v) { break } }
+	return err
+}
+
+func (s *Store) ForEachFollowers(ctx context.Context, u uint64, fn func(v uint64) bool) error {
+	if s.c.Owns(u) { return s.local.ForEachFollowers(ctx, u, fn) }
+	vs, err := s.Followers(ctx, u)
+	for _, v := range vs { if !fn(v) { break } }
+	return err
+}
+
+func (s *Store) FollowingSet(ctx context.Context, u uint64) (graph.Set, error) {
+	if s.c.Owns(u) { return s.local.FollowingSet(ctx, u) }
+	vs, err := s.Following(ctx, u)
+	return graph.SetOf(vs), err
+}
+
+func (s *Store) FollowersSet(ctx context.Context, u uint64) (graph.Set, error) {
+	if s.c.Owns(u) { return s.local.FollowersSet(ctx, u) }
+	vs, err := s.Followers(ctx, u)
+	return graph.SetOf(vs), err
+}
+
+func (s *Store) HasEdge(ctx context.Context, u, v uint64) (bool, error) {
+	if s.c.Owns(u) { return s.local.HasEdge(ctx, u, v) }
+	var res okResp
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/has_edge", uq("u", id(u), "v", id(v)), nil, &res)
+	return res.OK, err
+}
+
+func (s *Store) DegreeOut(ctx context.Context, u uint64) (int, error) {
+	if s.c.Owns(u) { return s.local.DegreeOut(ctx, u) }
+	var n int
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/degree", uq("u", id(u), "dir", "out"), nil, &n)
+	return n, err
+}
+
+func (s *Store) DegreeIn(ctx context.Context, u uint64) (int, error) {
+	if s.c.Owns(u) { return s.local.DegreeIn(ctx, u) }
+	var n int
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/degree", uq("u", id(u), "dir", "in"), nil, &n)
+	return n, err
+}
+
+// Degrees asks each owner once, for all of its users.
+func (s *Store) Degrees(ctx context.Context, users []uint64) ([]graph.DegreeUser, error) {
+	out := make([]graph.DegreeUser, len(users))
+	byOwner := make(map[string][]int)
+	for i, u := range users { byOwner[s.c.Ring.Owner(u).ID] = append(byOwner[s.c.Ring.Owner(u).ID], i) }
+	for _, idx := range byOwner {
+		batch := make([]uint64, len(idx))
+		for j, i := range idx { batch[j] = users[i] }
+		var got []graph.DegreeUser
+		var err error
+		if s.c.Owns(batch[0]) {
+			got, err = s.local.Degrees(ctx, batch)
+		} else {
+			err = s.remote(ctx, batch[0], http.MethodPost, "/internal/graph/degrees", nil, batch, &got)
+		}
+		if err != nil { return nil, err }
+		if len(got) != len(idx) { return nil, fmt.Errorf("%w: peer answered %d degrees for %d users", graph.ErrUnavailable, len(got), len(idx)) }
+		for j, i := range idx { out[i] = got[j] }
+	}
+	return out, nil
+}
+
+// u's following and follower sets both live on u's owner.
+func (s *Store) Friends(ctx context.Context, u uint64) ([]uint64, error) {
+	if s.c.Owns(u) { return s.local.Friends(ctx, u) }
+	var out []uint64
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/friends", uq("u", id(u)), nil, &out)
+	return out, err
+}
+
+func (s *Store) AreFriends(ctx context.Context, u, v uint64) (bool, error) {
+	if s.c.Owns(u) { return s.local.AreFriends(ctx, u, v) }
+	var res okResp
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/friends", uq("u", id(u), "v", id(v)), nil, &res)
+	return res.OK, err
+}
+
+// TouchUsers touches every user it can and returns the failures joined.
+func (s *Store) TouchUsers(ctx context.Context, users ...uint64) error {
+	var errs []error
+	for _, u := range users {
+		if s.c.Owns(u) { s.local.TouchUsers(ctx, u); continue }
+		if err := s.remote(ctx, u, http.MethodPost, "/internal/graph/touch", uq("u", id(u)), nil, nil); err != nil { errs = append(errs, err) }
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Store) UserEpoch(ctx context.Context, u uint64) (uint64, error) {
+	if s.c.Owns(u) { return s.local.UserEpoch(ctx, u) }
+	var e uint64
+	err := s.remote(ctx, u, http.MethodGet, "/internal/graph/epoch", uq("u", id(u)), nil, &e)
+	return e, err
+}
+
+// View pins each user's reads on first use (graph.RepeatableView): peers
+// cannot offer a point-in-time snapshot across nodes.
+func (s *Store) View() graph.View { return graph.RepeatableView(s) }
+
+// -------- Embeddings --------
+// Embeds routes embedding reads and writes to the owning node.
+type Embeds struct {
+	c      *Cluster
+	tenant string
+	local  embeds.Store
+}
+
+func (c *Cluster) Embeds(tenant string, local embeds.Store) *Embeds {
+	return &Embeds{c: c, tenant: tenant, local: local}
+}
+
+func (e *Embeds) Local() embeds.Store { return e.local }
+
+type embedReq struct {
+	U   uint64    `json:"u"`
+	Vec []float32 `json:"vector"`
+}
+
+func (e *Embeds) Get(u uint64) ([]float32, bool) {
+	if e.c.Owns(u) { return e.local.Get(u) }
+	var vec []float32
+	if err := e.c.call(context.Background(), e.c.Ring.Owner(u), e.tenant, http.MethodGet, "/internal/embeds", uq("u", id(u)), nil, &vec); err != nil {
+		return nil, false
+	}
+	return vec, len(vec) > 0
+}
+
+func (e *Embeds) Put(u uint64, vec []float32) {
+	if e.c.Owns(u) { e.local.Put(u, vec); return }
+	if err := e.c.call(context.Background(), e.c.Ring.Owner(u), e.tenant, http.MethodPut, "/internal/embeds", nil, embedReq{u, vec}, nil); err != nil {
+		slog.Warn("cluster embed put failed", "user_id", u, "err", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package community groups users into densely connected communities by
+// label propagation, for community-scoped PYMK.
+package community
+
+import (
+	"context"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Labels is one detection's result. It is never modified after Detect
+// returns, so readers share it freely.
+type Labels struct {
+	of     map[uint64]uint64 // user -> community, named by one of its members
+	sizes  map[uint64]int
+	At     time.Time
+	Took   time.Duration
+	Rounds int // passes run before convergence or the limit
+}
+
+// Of returns u's community. Users with no edges belong to none. A nil
+// *Labels knows no communities.
+func (l *Labels) Of(u uint64) (uint64, bool) {
+	if l == nil { return 0, false }
+	c, ok := l.of[u]
+	return c, ok
+}
+
+func (l *Labels) Size(c uint64) int {
+	if l == nil { return 0 }
+	return l.sizes[c]
+}
+
+// Count returns the number of communities.
+func (l *Labels) Count() int {
+	if l == nil { return 0 }
+	return len(l.sizes)
+}
+
+type Community struct {
+	ID   uint64 `json:"id"`
+	Size int    `json:"size"`
+}
+
+// Largest returns the n biggest communities, biggest first.
+func (l *Labels) Largest(n int) []Community {
+	if l == nil { return nil }
+	out := make([]Community, 0, len(l.sizes))
+	for c, sz := range l.sizes { out = append(out, Community{c, sz}) }
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Size != out[j].Size { return out[i].Size > out[j].Size }
+		return out[i].ID < out[j].ID
+	})
+	if len(out) > n { out = out[:n] }
+	return out
+}
+
+// converged is the fraction of users changing label in a pass below which
+// propagation stops.
+const converged = 0.001
+
+// Detect runs label propagation over g, ignoring edge direction: every
+// user starts in a community of its own and, in up to rounds passes over
+// the users in random order, joins the community most common among its
+// neighbors, staying put on a tie it is part of. Dense groups settle on
+// one label within a few passes. It reads g a user at a time, so it runs
+// alongside writes and sees them partially.
+func Detect(ctx context.Context, g *graph.MemGraph, rounds int) (*Labels, error) {
+	start := time.Now()
+	of := make(map[uint64]uint64)
+	err := g.EachEdge(func(u, v uint64) bool {
+		of[u], of[v] = u, v
+		return ctx.Err() == nil
+	})
+	if err != nil { return nil, err }
+	if err := ctx.Err(); err != nil { return nil, err }
+	users := make([]uint64, 0, len(of))
+	for u := range of { users = append(users, u) }
+
+	l := &Labels{of: of}
+	count := make(map[uint64]int)
+	for l.Rounds < rounds {
+		l.Rounds++
+		rand.Shuffle(len(users), func(i, j int) { users[i], users[j] = users[j], users[i] })
+		changed := 0
+		for i, u := range users {
+			if i%1024 == 0 && ctx.Err() != nil { return nil, ctx.Err() }
+			clear(count)
+			tally := func(v uint64) bool {
+				if c, ok := of[v]; ok { count[c]++ }
+				return true
+			}
+			if err := g.ForEachFollowing(ctx, u, tally); err != nil { return nil, err }
+			if err := g.ForEachFollowers(ctx, u, tally); err != nil { return nil, err }
+			cur := of[u]
+			best, bestN := cur, count[cur]
+			for c, n := range count {
+				if n > bestN || (n == bestN && best != cur && c < best) { best, bestN = c, n }
+			}
+			if best != cur { of[u] = best; changed++ }
+		}
+		if float64(changed) < converged*float64(len(users)) { break }
+	}
+	l.sizes = make(map[uint64]int)
+	for _, c := range of { l.sizes[c]++ }
+	l.At, l.Took = time.Now(), time.Since(start)
+	return l, nil
+}
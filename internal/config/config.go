@@ -0,0 +1,532 @@
+// Package config loads server configuration from (in increasing
+// precedence) built-in defaults, a YAML or TOML file, environment
+// variables and command-line flags, then validates it.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/backup"
+	"github.com/pandharkardeep/social-graph/internal/chaos"
+	"github.com/pandharkardeep/social-graph/internal/cluster"
+	"github.com/pandharkardeep/social-graph/internal/flags"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/logging"
+	"github.com/pandharkardeep/social-graph/internal/middleware"
+	"github.com/pandharkardeep/social-graph/internal/pymk"
+	"github.com/pandharkardeep/social-graph/internal/raftstore"
+	"github.com/pandharkardeep/social-graph/internal/replica"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+	"github.com/pandharkardeep/social-graph/internal/users"
+)
+
+// Fields are addressed by their yaml path: `pymk.w_common` in files and as
+// the -pymk.w_common flag. The env tag names the overriding variable;
+// untagged fields use SG_<PATH>, e.g. SG_PYMK_W_COMMON.
+type Config struct {
+	Server       Server                       `yaml:"server"`
+	CORS         middleware.CORSConfig        `yaml:"cors"`
+	Compression  middleware.CompressionConfig `yaml:"compression"`
+	Log          Log                          `yaml:"log"`
+	Store        Store                        `yaml:"store"`
+	PYMK         pymk.PYMKConfig              `yaml:"pymk"`
+	Auth         Auth                         `yaml:"auth"`
+	Tenants      Tenants                      `yaml:"tenants"`
+	Cluster      cluster.Config               `yaml:"cluster"`
+	Raft         raftstore.Config             `yaml:"raft"`
+	Journal      Journal                      `yaml:"journal"`
+	Audit        Audit                        `yaml:"audit"`
+	IDMap        IDMap                        `yaml:"idmap"`
+	Feedback     Feedback                     `yaml:"feedback"`
+	Exclusions   Exclusions                   `yaml:"exclusions"`
+	Identities   Identities                   `yaml:"identities"`
+	UserIDs      UserIDs                      `yaml:"user_ids"`
+	Topics       Topics                       `yaml:"topics"`
+	Interactions Interactions                 `yaml:"interactions"`
+	Integrity    Integrity                    `yaml:"integrity"`
+	Community    Community                    `yaml:"community"`
+	Replication  replica.Config               `yaml:"replication"`
+	Backup       backup.Config                `yaml:"backup"`
+	HotKeys      HotKeys                      `yaml:"hot_keys"`
+	Churn        Churn                        `yaml:"churn"`
+	Scheduler    Scheduler                    `yaml:"scheduler"`
+	Invalidation Invalidation                 `yaml:"invalidation"`
+	Privacy      Privacy                      `yaml:"privacy"`
+	Chaos        chaos.Config                 `yaml:"chaos"`
+	Flags        map[string]float64           `yaml:"flags"` // feature -> percent of users it is on for
+
+	// PYMKProfiles are named PYMK variants for product surfaces, each
+	// given as overrides on top of a tenant's PYMK config and picked with
+	// /pymk?profile=.
+	PYMKProfiles map[string]yaml.Node `yaml:"pymk_profiles"`
+
+	File string `yaml:"-"` // the file loaded, if any; set by Load
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" env:"ADDR"`
+	AdminAddr         string        `yaml:"admin_addr" env:"ADMIN_ADDR"`
+	GRPCAddr          string        `yaml:"grpc_addr" env:"GRPC_ADDR"` // streaming PYMK over gRPC; "" disables
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	SlowRequest       time.Duration `yaml:"slow_request" env:"SLOW_REQUEST"`
+	ConfigWatch       time.Duration `yaml:"config_watch" env:"CONFIG_WATCH"` // poll the config file this often for reloads; 0 = SIGHUP only
+	Environment       string        `yaml:"environment" env:"ENVIRONMENT"`   // production, staging, test, ...; gates chaos
+}
+
+type Log struct {
+	Level            string `yaml:"level" env:"LOG_LEVEL"`
+	SampleFirst      int    `yaml:"sample_first" env:"LOG_SAMPLE_FIRST"`
+	SampleThereafter int    `yaml:"sample_thereafter" env:"LOG_SAMPLE_THEREAFTER"`
+}
+
+type Store struct {
+	Backend     string        `yaml:"backend" env:"STORE_BACKEND"`     // memory
+	MemoryLimit int64         `yaml:"memory_limit" env:"MEMORY_LIMIT"` // heap bytes; 0 = no ceiling
+	ColdAfter   time.Duration `yaml:"cold_after"`                       // demote users idle this long to disk; 0 = off
+	SpillDir    string        `yaml:"spill_dir"`
+	Shards      int           `yaml:"shards"` // per tenant graph; a power of two up to 4096
+	FrozenReads time.Duration `yaml:"frozen_reads"` // republish lock-free shard views for PYMK this often; 0 = off
+	LoadWorkers int           `yaml:"load_workers"` // goroutines writing each import batch; 0 = GOMAXPROCS
+}
+
+type Auth struct {
+	Keys      []KeyConfig `yaml:"keys"`
+	KeySpec   string      `yaml:"key_spec" env:"API_KEYS" secret:"true"` // id:secret:scope+scope,...
+	JWTSecret string      `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+}
+
+type KeyConfig struct {
+	ID     string   `yaml:"id"`
+	Key    string   `yaml:"key" secret:"true"`
+	Scopes []string `yaml:"scopes"`
+	Tenant string   `yaml:"tenant"` // the only tenant the key may use; "" = every tenant
+}
+
+type Journal struct {
+	Capacity  int           `yaml:"capacity"`  // most recent mutations kept in memory
+	Retention time.Duration `yaml:"retention"` // drop mutations older than this, even under capacity; 0 = keep until capacity
+}
+
+type Audit struct {
+	Path string `yaml:"path"` // append-only audit log of mutations; "" disables
+}
+
+// IDMap assigns every user a dense uint32 index; see package idmap.
+type IDMap struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"` // <tenant>.ids per tenant; "" keeps mappings in memory only
+}
+
+type Feedback struct {
+	Path string `yaml:"path"` // PYMK suggestion feedback, replayed at start; "" keeps it in memory only
+}
+
+// Exclusions are the per-user sets of users PYMK never suggests.
+type Exclusions struct {
+	Path       string `yaml:"path"`         // replayed at start; "" keeps them in memory only
+	MaxPerUser int    `yaml:"max_per_user"` // 0 = unbounded
+}
+
+// Identities are the string user IDs registered through /identities.
+type Identities struct {
+	Path string `yaml:"path"` // replayed at start; "" keeps them in memory only
+}
+
+// UserIDs configures the IDs POST /users vends (see users.IDs).
+type UserIDs struct {
+	Node int `yaml:"node"` // 0..1023, distinct for every node serving POST /users
+}
+
+// Topics is the user→topic follow graph.
+type Topics struct {
+	Path       string `yaml:"path"`         // replayed at start; "" keeps it in memory only
+	MaxPerUser int    `yaml:"max_per_user"` // topics one user may follow; 0 = unbounded
+}
+
+var validInteraction = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Interactions turn engagement events into interaction weights.
+type Interactions struct {
+	Weights       map[string]float64 `yaml:"weights"`        // added per event, by type
+	HalfLife      time.Duration      `yaml:"half_life"`      // weights halve this often; 0 = they never decay
+	DecayInterval time.Duration      `yaml:"decay_interval"` // how often decay runs
+	MinWeight     float64            `yaml:"min_weight"`     // decayed weights below this are dropped
+}
+
+// Integrity schedules checks that both halves of every edge agree.
+type Integrity struct {
+	Interval time.Duration `yaml:"interval"` // 0 = only on demand via /admin/integrity
+	Repair   bool          `yaml:"repair"`   // fix what scheduled checks find
+}
+
+// Community schedules community detection for community-scoped PYMK.
+type Community struct {
+	Interval time.Duration `yaml:"interval"` // 0 = only on demand via /admin/communities
+	Rounds   int           `yaml:"rounds"`   // label propagation passes at most
+}
+
+// HotKeys tracks each tenant's most-queried users and keeps their PYMK
+// results warm.
+type HotKeys struct {
+	Track        int           `yaml:"track"` // heavy hitters kept per tenant; 0 disables
+	Decay        time.Duration `yaml:"decay"` // counts halve this often
+	Warm         int           `yaml:"warm"`  // hottest users precomputed each round
+	WarmInterval time.Duration `yaml:"warm_interval"`
+}
+
+// Churn tracks each tenant's users whose epochs change most, i.e. whose
+// cached suggestions go stale soonest.
+type Churn struct {
+	Track       int           `yaml:"track"`         // users tracked per tenant; 0 disables
+	Decay       time.Duration `yaml:"decay"`         // counts halve this often
+	MinChanges  uint32        `yaml:"min_changes"`   // changes within the window that make a user hot
+	HotCacheTTL time.Duration `yaml:"hot_cache_ttl"` // PYMK cache TTL for hot users; 0 keeps pymk.cache_ttl
+}
+
+// Scheduler configures the in-process jobs that have no block of their
+// own; backup, community, integrity, hot_keys and interactions set the
+// intervals of theirs.
+type Scheduler struct {
+	Snapshots        time.Duration `yaml:"snapshots"`         // write each tenant's graph to snapshot_dir; 0 = off
+	SnapshotDir      string        `yaml:"snapshot_dir"`
+	MaxDeltas        int           `yaml:"max_deltas"`        // delta snapshots between full ones; 0 = full only
+	RestoreSnapshots bool          `yaml:"restore_snapshots"` // load snapshot_dir's chains at startup
+	Embeddings       time.Duration `yaml:"embeddings"`        // retrain graph embeddings; 0 = off
+	EmbeddingDim     int           `yaml:"embedding_dim"`
+	Ranks            time.Duration `yaml:"ranks"`             // refresh /top ahead of requests; 0 = on demand
+}
+
+// Invalidation drops cached PYMK results of the followers of users whose
+// following changed, which the requester's epoch alone does not catch.
+type Invalidation struct {
+	Enabled bool `yaml:"enabled"`
+	Fanout  int  `yaml:"fanout"` // followers invalidated per mutated user at most; 0 = all
+	Buffer  int  `yaml:"buffer"` // events queued for delivery; more are dropped
+}
+
+// Privacy sets how list reads answer a viewer a user's privacy setting
+// shuts out.
+type Privacy struct {
+	Hidden string `yaml:"hidden" env:"PRIVACY_HIDDEN"` // count: 200 with the list's size only | forbid: 403
+}
+
+type Tenants struct {
+	Names      []string `yaml:"names" env:"TENANTS"`
+	AutoCreate bool     `yaml:"auto_create" env:"TENANT_AUTOCREATE"`
+	Graphs     []string `yaml:"graphs" env:"TENANT_GRAPHS"` // named graphs every tenant gets besides its main one
+	// PYMK holds per-tenant overrides, applied on top of the top-level pymk
+	// block; only the keys present change.
+	PYMK map[string]yaml.Node `yaml:"pymk"`
+}
+
+func Defaults() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   10 * time.Second,
+			SlowRequest:       500 * time.Millisecond,
+		},
+		CORS:         middleware.DefaultCORS(),
+		Compression:  middleware.DefaultCompression(),
+		Log:          Log{Level: "info", SampleFirst: 100, SampleThereafter: 100},
+		Store:        Store{Backend: "memory", SpillDir: "data/spill", Shards: graph.DefaultShards},
+		Cluster:      cluster.DefaultConfig(),
+		Raft:         raftstore.DefaultConfig(),
+		Journal:      Journal{Capacity: 100_000},
+		Replication:  replica.DefaultConfig(),
+		Backup:       backup.DefaultConfig(),
+		Exclusions:   Exclusions{MaxPerUser: 10_000},
+		Topics:       Topics{MaxPerUser: 1000},
+		Interactions: Interactions{Weights: map[string]float64{"like": 1, "reply": 3, "share": 5}, HalfLife: 30 * 24 * time.Hour, DecayInterval: time.Hour, MinWeight: 0.01},
+		Community:    Community{Rounds: 10},
+		HotKeys:      HotKeys{Track: 100, Decay: time.Minute, Warm: 50, WarmInterval: 30 * time.Second},
+		Churn:        Churn{Decay: time.Minute, MinChanges: 10, HotCacheTTL: 5 * time.Second},
+		Scheduler:    Scheduler{SnapshotDir: "data/snapshots", MaxDeltas: 24, EmbeddingDim: 64},
+		Invalidation: Invalidation{Enabled: true, Fanout: 10_000, Buffer: 10_000},
+		Privacy:      Privacy{Hidden: "count"},
+		PYMK: pymk.PYMKConfig{
+			MaxExpandPerNeighbor: 200,   // fan-out cap per neighbor
+			MaxCandidates:        20000, // candidate table size; 0 = unbounded
+			WCommon:              1.00,
+			WJaccard:             0.60,
+			WAA:                  0.80,
+			WCosine:              1.00,
+			WInterest:            0.50,
+			WTopics:              0.50,
+			TopicFanout:          100,
+			RecencyHalfLife:      7 * 24 * time.Hour,
+			CacheSize:            100_000,         // LRU entries
+			CacheTTL:             2 * time.Minute, // short TTL to stay fresh
+			K:                    20,
+			CommunityBoost:       0.5,
+			CrossLocale:          0.2,
+			ConversionWindow:     24 * time.Hour,
+		},
+	}
+}
+
+// Load builds the effective config for args (usually os.Args[1:]). The file
+// comes from -config or SG_CONFIG; its format is picked by extension.
+func Load(args []string) (*Config, error) {
+	c := Defaults()
+	fs := newFlagSet(&c)
+	if err := fs.Parse(args); err != nil { return nil, err }
+
+	path := os.Getenv("SG_CONFIG")
+	if f := fs.Lookup("config"); f != nil && f.Value.String() != "" { path = f.Value.String() }
+	if path != "" {
+		if err := loadFile(&c, path); err != nil { return nil, err }
+		c.File = path
+	}
+	if err := applyEnv(&c, os.LookupEnv); err != nil { return nil, err }
+	// Flags win over file and env: re-apply only the ones set explicitly.
+	if err := applyFlags(fs, &c); err != nil { return nil, err }
+	if err := c.Validate(); err != nil { return nil, err }
+	return &c, nil
+}
+
+func loadFile(c *Config, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil { return err }
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// Round-trip TOML through YAML so a single set of tags applies.
+		var m map[string]any
+		if err := toml.Unmarshal(b, &m); err != nil { return fmt.Errorf("%s: %w", path, err) }
+		if b, err = yaml.Marshal(m); err != nil { return err }
+	default:
+		return fmt.Errorf("%s: unsupported config format (want .yaml or .toml)", path)
+	}
+	dec := yaml.NewDecoder(strings.NewReader(string(b)))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks ranges and cross-field constraints.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(f string, a ...any) { errs = append(errs, fmt.Errorf(f, a...)) }
+
+	if c.Server.Addr == "" { bad("server.addr is required") }
+	if c.Server.ConfigWatch < 0 { bad("server.config_watch must be >= 0") }
+	if c.Chaos.Enabled {
+		if e := c.Server.Environment; e != "test" && e != "staging" { bad("chaos.enabled needs server.environment test or staging, not %q", e) }
+		if err := c.Chaos.Validate(); err != nil { bad("chaos: %v", err) }
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil { bad("log.level: %v", err) }
+	if c.Compression.MinSize < 0 { bad("compression.min_size must be >= 0") }
+	if c.Compression.Level < 0 || c.Compression.Level > 9 { bad("compression.level must be in 0..9") }
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		bad("cors: allow_credentials cannot be combined with origin \"*\"")
+	}
+	if c.Log.SampleFirst < 0 || c.Log.SampleThereafter < 0 { bad("log sampling values must be >= 0") }
+	switch c.Store.Backend {
+	case "memory":
+	default:
+		bad("store.backend: unknown backend %q", c.Store.Backend)
+	}
+	if err := graph.ValidShards(c.Store.Shards); err != nil { bad("store.shards: %v", err) }
+	if c.Store.FrozenReads < 0 { bad("store.frozen_reads must be >= 0") }
+	if c.Store.LoadWorkers < 0 { bad("store.load_workers must be >= 0") }
+	if c.Store.MemoryLimit < 0 { bad("store.memory_limit must be >= 0") }
+	if c.Store.ColdAfter < 0 || (c.Store.ColdAfter > 0 && c.Store.ColdAfter < time.Second) { bad("store.cold_after must be 0 or >= 1s") }
+	if (c.Store.MemoryLimit > 0 || c.Store.ColdAfter > 0) && c.Store.SpillDir == "" { bad("store.spill_dir is required with a memory limit or cold_after") }
+	if err := ValidatePYMK(c.PYMK); err != nil { bad("pymk: %v", err) }
+	if _, err := flags.New(c.Flags); err != nil { bad("%v", err) }
+	for _, k := range c.Auth.Keys {
+		if k.ID == "" || k.Key == "" || len(k.Scopes) == 0 { bad("auth.keys: id, key and scopes are required") }
+		for _, s := range k.Scopes {
+			if _, err := auth.ParseScope(s); err != nil { bad("auth.keys[%s]: %v", k.ID, err) }
+		}
+		if k.Tenant != "" && !tenant.ValidName(strings.ToLower(k.Tenant)) { bad("auth.keys[%s]: bad tenant %q", k.ID, k.Tenant) }
+	}
+	if spec, err := auth.ParseKeys(c.Auth.KeySpec); err != nil {
+		bad("auth.key_spec: %v", err)
+	} else {
+		for _, k := range spec {
+			if k.Tenant != "" && !tenant.ValidName(k.Tenant) { bad("auth.key_spec[%s]: bad tenant %q", k.ID, k.Tenant) }
+		}
+	}
+	if _, err := auth.New(nil, c.AuthKeys()...); err != nil { bad("auth: %v", err) }
+	for _, n := range c.Tenants.Names {
+		if n = strings.TrimSpace(n); n != "" && !tenant.ValidName(n) { bad("tenants.names: bad name %q", n) }
+	}
+	for _, g := range c.Tenants.Graphs {
+		if g = strings.TrimSpace(g); g == tenant.Default || (g != "" && !tenant.ValidName(g)) { bad("tenants.graphs: bad name %q", g) }
+	}
+	if err := c.Cluster.Validate(); err != nil { bad("cluster: %v", err) }
+	if c.Cluster.Enabled && c.Cluster.Token == "" { bad("cluster.token is required when cluster mode is enabled") }
+	if err := c.Raft.Validate(); err != nil { bad("raft: %v", err) }
+	if c.Cluster.Enabled && c.Raft.Enabled { bad("cluster and raft modes are mutually exclusive") }
+	if c.Journal.Capacity <= 0 { bad("journal.capacity must be > 0") }
+	if c.Journal.Retention < 0 { bad("journal.retention must be >= 0") }
+	if ch := c.Churn; ch.Track < 0 || ch.Decay < 0 || ch.HotCacheTTL < 0 || (ch.Track > 0 && ch.MinChanges == 0) {
+		bad("churn: need track >= 0, decay >= 0, hot_cache_ttl >= 0 and, when tracking, min_changes > 0")
+	}
+	if c.Exclusions.MaxPerUser < 0 { bad("exclusions.max_per_user must be >= 0") }
+	if c.UserIDs.Node < 0 || c.UserIDs.Node > users.MaxNode { bad("user_ids.node must be in 0..%d", users.MaxNode) }
+	if c.Topics.MaxPerUser < 0 { bad("topics.max_per_user must be >= 0") }
+	for t, w := range c.Interactions.Weights {
+		if !validInteraction.MatchString(t) { bad("interactions.weights: bad type %q", t) }
+		if !(w > 0) || math.IsInf(w, 0) { bad("interactions.weights.%s must be > 0", t) }
+	}
+	if ic := c.Interactions; ic.HalfLife < 0 || ic.DecayInterval <= 0 || ic.MinWeight < 0 {
+		bad("interactions: need half_life >= 0, decay_interval > 0 and min_weight >= 0")
+	}
+	if c.Integrity.Interval < 0 { bad("integrity.interval must be >= 0") }
+	if c.Community.Interval < 0 || c.Community.Rounds <= 0 { bad("community: need interval >= 0 and rounds > 0") }
+	if c.Community.Interval > 0 && c.Cluster.Enabled { bad("community detection needs the whole graph on one node; not available in cluster mode") }
+	if c.Integrity.Interval > 0 && c.Cluster.Enabled { bad("integrity checks need the whole graph on one node; not available in cluster mode") }
+	if err := c.Replication.Validate(); err != nil { bad("replication: %v", err) }
+	if c.Replication.Role != "" && (c.Cluster.Enabled || c.Raft.Enabled) {
+		bad("replication cannot be combined with cluster or raft mode")
+	}
+	if c.Server.GRPCAddr != "" && c.Replication.Role == "primary" && c.Server.GRPCAddr == c.Replication.GRPCAddr {
+		bad("server.grpc_addr must differ from replication.grpc_addr")
+	}
+	if err := c.Backup.Validate(); err != nil { bad("backup: %v", err) }
+	if c.Backup.RestoreOnBoot && (c.Raft.Enabled || c.Replication.Role == "replica") {
+		bad("backup.restore_on_boot cannot be used with raft or on a replica (they sync from peers)")
+	}
+	if hk := c.HotKeys; hk.Track < 0 || hk.Warm < 0 || hk.Warm > hk.Track {
+		bad("hot_keys: need 0 <= warm <= track")
+	} else if hk.Track > 0 && (hk.Decay <= 0 || (hk.Warm > 0 && hk.WarmInterval <= 0)) {
+		bad("hot_keys: decay and warm_interval must be > 0")
+	}
+	if sc := c.Scheduler; sc.Snapshots < 0 || sc.Embeddings < 0 || sc.Ranks < 0 {
+		bad("scheduler: intervals must be >= 0")
+	} else if (sc.Snapshots > 0 || sc.RestoreSnapshots) && sc.SnapshotDir == "" {
+		bad("scheduler.snapshot_dir is required with scheduler.snapshots or restore_snapshots")
+	} else if sc.MaxDeltas < 0 {
+		bad("scheduler.max_deltas must be >= 0")
+	} else if sc.RestoreSnapshots && (c.Backup.RestoreOnBoot || c.Raft.Enabled || c.Replication.Role == "replica") {
+		bad("scheduler.restore_snapshots cannot be combined with backup.restore_on_boot, raft or a replica")
+	} else if sc.EmbeddingDim <= 0 || sc.EmbeddingDim > 1024 {
+		bad("scheduler.embedding_dim must be 1-1024")
+	}
+	if c.Scheduler.Embeddings > 0 && c.Cluster.Enabled { bad("embedding retraining needs the whole graph on one node; not available in cluster mode") }
+	if iv := c.Invalidation; iv.Enabled && (iv.Fanout < 0 || iv.Buffer <= 0) {
+		bad("invalidation: need fanout >= 0 and buffer > 0")
+	}
+	if h := c.Privacy.Hidden; h != "count" && h != "forbid" { bad("privacy.hidden must be count or forbid, got %q", h) }
+	for n := range c.Tenants.PYMK {
+		if _, err := c.TenantPYMK(n); err != nil { bad("tenants.pymk.%s: %v", n, err) }
+	}
+	for n := range c.PYMKProfiles {
+		if !tenant.ValidName(n) { bad("pymk_profiles: bad name %q", n); continue }
+		ts := append([]string{tenant.Default}, c.Tenants.Names...)
+		for t := range c.Tenants.PYMK { ts = append(ts, t) }
+		for _, t := range ts {
+			base, err := c.TenantPYMK(strings.TrimSpace(t))
+			if err != nil { continue } // reported above
+			if _, err := c.ProfilePYMK(base, n); err != nil { bad("pymk_profiles.%s: %v", n, err); break }
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func ValidatePYMK(p pymk.PYMKConfig) error {
+	var errs []error
+	if p.MaxExpandPerNeighbor < 0 { errs = append(errs, errors.New("max_expand_per_neighbor must be >= 0")) }
+	if p.MaxCandidates < 0 { errs = append(errs, errors.New("max_candidates must be >= 0")) }
+	if p.WCommon < 0 || p.WJaccard < 0 || p.WAA < 0 || p.WCosine < 0 || p.WInterest < 0 || p.WTopics < 0 { errs = append(errs, errors.New("weights must be >= 0")) }
+	if p.CacheSize < 0 { errs = append(errs, errors.New("cache_size must be >= 0")) }
+	if p.CacheTTL < 0 { errs = append(errs, errors.New("cache_ttl must be >= 0")) }
+	if p.Timeout < 0 { errs = append(errs, errors.New("timeout must be >= 0")) }
+	if p.K < 0 { errs = append(errs, errors.New("k must be >= 0")) }
+	if p.MaxPerMutual < 0 { errs = append(errs, errors.New("max_per_mutual must be >= 0")) }
+	if p.TopicFanout < 0 { errs = append(errs, errors.New("topic_fanout must be >= 0")) }
+	if p.ApproxSamples < 0 { errs = append(errs, errors.New("approx_samples must be >= 0")) }
+	if p.RecencyBoost < 0 || p.RecencyHalfLife < 0 { errs = append(errs, errors.New("recency_boost and recency_half_life must be >= 0")) }
+	if err := pymk.ValidCommunity(p.Community); err != nil { errs = append(errs, err) }
+	if p.CommunityBoost < 0 { errs = append(errs, errors.New("community_boost must be >= 0")) }
+	if err := pymk.ValidCrossLocale(p.CrossLocale); err != nil { errs = append(errs, err) }
+	if err := pymk.ValidEdgeWeights(p.EdgeWeights); err != nil { errs = append(errs, err) }
+	if _, err := attrs.ParseFilter(p.Filter); err != nil { errs = append(errs, err) }
+	if err := pymk.ValidBoosts(p.Boosts); err != nil { errs = append(errs, err) }
+	if p.ConversionWindow < 0 { errs = append(errs, errors.New("conversion_window must be >= 0")) }
+	if p.Parallelism < 0 { errs = append(errs, errors.New("parallelism must be >= 0")) }
+	if err := pymk.ValidNormalization(p.Normalization); err != nil { errs = append(errs, err) }
+	return errors.Join(errs...)
+}
+
+// TenantPYMK returns the PYMK config for tenant name: the top-level block
+// with that tenant's overrides applied.
+func (c *Config) TenantPYMK(name string) (pymk.PYMKConfig, error) {
+	p := c.PYMK
+	n, ok := c.Tenants.PYMK[name]
+	if tn, g := tenant.Split(name); !ok && g != "" { n, ok = c.Tenants.PYMK[tn] } // a graph without overrides of its own takes its tenant's
+	if ok {
+		if err := n.Decode(&p); err != nil { return p, err }
+		if err := ValidatePYMK(p); err != nil { return p, err }
+	}
+	return p, nil
+}
+
+// ProfilePYMK returns the config of PYMK profile name for a tenant whose
+// own config is base: base with the profile's overrides applied.
+func (c *Config) ProfilePYMK(base pymk.PYMKConfig, name string) (pymk.PYMKConfig, error) {
+	n, ok := c.PYMKProfiles[name]
+	if !ok { return base, fmt.Errorf("unknown pymk profile %q", name) }
+	if err := n.Decode(&base); err != nil { return base, err }
+	return base, ValidatePYMK(base)
+}
+
+// Profiles returns every PYMK profile in the form the tenant registry
+// takes.
+func (c *Config) Profiles() map[string]tenant.Profile {
+	out := make(map[string]tenant.Profile, len(c.PYMKProfiles))
+	for n := range c.PYMKProfiles {
+		out[n] = func(base pymk.PYMKConfig) (pymk.PYMKConfig, error) { return c.ProfilePYMK(base, n) }
+	}
+	return out
+}
+
+// AuthKeys merges keys from the file and from the compact key spec.
+func (c *Config) AuthKeys() []auth.Key {
+	var out []auth.Key
+	for _, k := range c.Auth.Keys {
+		ak := auth.Key{ID: k.ID, Secret: k.Key, Tenant: strings.ToLower(k.Tenant)}
+		for _, s := range k.Scopes {
+			sc, _ := auth.ParseScope(s)
+			ak.Scopes = append(ak.Scopes, sc)
+		}
+		out = append(out, ak)
+	}
+	spec, _ := auth.ParseKeys(c.Auth.KeySpec)
+	return append(out, spec...)
+}
+
+// Redacted returns the config as YAML with secrets masked, for /admin/config.
+func (c *Config) Redacted() ([]byte, error) {
+	cp := *c
+	cp.Auth.Keys = append([]KeyConfig(nil), c.Auth.Keys...)
+	redact(&cp)
+	return yaml.Marshal(&cp)
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field is one settable leaf of Config.
+type field struct {
+	path   string // yaml path, e.g. pymk.w_common
+	env    string // env tag, or SG_<PATH> when untagged
+	secret bool
+	v      reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields walks c's struct tree and returns every scalar (or []string) leaf.
+func fields(c *Config) []field {
+	var out []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+			if name == "-" || !sf.IsExported() { continue }
+			if name == "" { name = strings.ToLower(sf.Name) }
+			path := name
+			if prefix != "" { path = prefix + "." + name }
+			fv := v.Field(i)
+			switch {
+			case fv.Kind() == reflect.Struct && fv.Type() != durationType:
+				walk(fv, path)
+			case settable(fv.Type()):
+				env := sf.Tag.Get("env")
+				if env == "" { env = "SG_" + strings.ToUpper(strings.ReplaceAll(path, ".", "_")) }
+				out = append(out, field{path: path, env: env, secret: sf.Tag.Get("secret") == "true", v: fv})
+			}
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return out
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Int64, reflect.Float64, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// set parses s into the leaf according to its type.
+func (f field) set(s string) error {
+	v := f.v
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil { return err }
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil { return err }
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil { return err }
+		v.SetFloat(n)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil { return err }
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		var parts []string
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" { parts = append(parts, p) }
+		}
+		v.Set(reflect.ValueOf(parts))
+	}
+	return nil
+}
+
+func applyEnv(c *Config, lookup func(string) (string, bool)) error {
+	for _, f := range fields(c) {
+		if s, ok := lookup(f.env); ok && s != "" {
+			if err := f.set(s); err != nil { return fmt.Errorf("%s: %w", f.env, err) }
+		}
+	}
+	return nil
+}
+
+// -------- Flags --------
+// rawFlag only records the string; values are applied after file and env.
+type rawFlag struct {
+	val    string
+	isBool bool
+}
+
+func (r *rawFlag) String() string     { return r.val }
+func (r *rawFlag) Set(s string) error { r.val = s; return nil }
+func (r *rawFlag) IsBoolFlag() bool   { return r.isBool }
+
+func newFlagSet(c *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("social-graph", flag.ContinueOnError)
+	fs.String("config", "", "path to a YAML or TOML config file (env SG_CONFIG)")
+	for _, f := range fields(c) {
+		usage := "config " + f.path + " (env " + f.env + ")"
+		fs.Var(&rawFlag{isBool: f.v.Kind() == reflect.Bool}, f.path, usage)
+	}
+	return fs
+}
+
+func applyFlags(fs *flag.FlagSet, c *Config) error {
+	byPath := make(map[string]field)
+	for _, f := range fields(c) { byPath[f.path] = f }
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		f, ok := byPath[fl.Name]
+		if !ok || err != nil { return }
+		if e := f.set(fl.Value.String()); e != nil { err = fmt.Errorf("-%s: %w", fl.Name, e) }
+	})
+	return err
+}
+
+// -------- Redaction --------
+const mask = "********"
+
+func redact(c *Config) {
+	for _, f := range fields(c) {
+		if f.secret && f.v.Kind() == reflect.String && f.v.String() != "" { f.v.SetString(mask) }
+	}
+	for i := range c.Auth.Keys {
+		if c.Auth.Keys[i].Key != "" { c.Auth.Keys[i].Key = mask }
+	}
+}
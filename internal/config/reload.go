@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reloadable lists the path prefixes a running server applies on reload;
+// anything else needs a restart.
+var reloadable = []string{"pymk.", "pymk_profiles", "tenants.pymk", "log.level", "flags"}
+
+// Change is one differing setting between two configs.
+type Change struct {
+	Path       string
+	Old, New   string // "***" for secrets
+	Reloadable bool
+}
+
+// Diff lists the settings that differ between old and next.
+func Diff(old, next *Config) []Change {
+	var out []Change
+	add := func(path, a, b string, secret bool) {
+		if a == b { return }
+		if secret { a, b = "***", "***" }
+		c := Change{Path: path, Old: a, New: b}
+		for _, p := range reloadable { if strings.HasPrefix(path, p) { c.Reloadable = true } }
+		out = append(out, c)
+	}
+	of, nf := fields(old), fields(next)
+	for i := range of {
+		add(of[i].path, fmt.Sprint(of[i].v.Interface()), fmt.Sprint(nf[i].v.Interface()), of[i].secret)
+	}
+	// Leaves the walker skips.
+	add("tenants.pymk", yamlString(old.Tenants.PYMK), yamlString(next.Tenants.PYMK), false)
+	add("pymk.boosts", yamlString(old.PYMK.Boosts), yamlString(next.PYMK.Boosts), false)
+	add("pymk_profiles", yamlString(old.PYMKProfiles), yamlString(next.PYMKProfiles), false)
+	add("interactions.weights", yamlString(old.Interactions.Weights), yamlString(next.Interactions.Weights), false)
+	add("flags", yamlString(old.Flags), yamlString(next.Flags), false)
+	add("auth.keys", yamlString(old.Auth.Keys), yamlString(next.Auth.Keys), true)
+	return out
+}
+
+func yamlString(v any) string {
+	b, _ := yaml.Marshal(v)
+	return strings.TrimSpace(string(b))
+}
+
+// WithReloadable returns a copy of c with next's reloadable settings.
+func (c *Config) WithReloadable(next *Config) *Config {
+	cp := *c
+	cp.PYMK = next.PYMK
+	cp.Tenants.PYMK = next.Tenants.PYMK
+	cp.PYMKProfiles = next.PYMKProfiles
+	cp.Log.Level = next.Log.Level
+	cp.Flags = next.Flags
+	return &cp
+}
+
+// Watch calls fn whenever the modification time of c.File changes,
+// checking every c.Server.ConfigWatch, until ctx is done. It returns at
+// once when there is no file or polling is off.
+func (c *Config) Watch(ctx context.Context, fn func()) {
+	if c.File == "" || c.Server.ConfigWatch <= 0 { return }
+	mtime := func() time.Time {
+		fi, err := os.Stat(c.File)
+		if err != nil { return time.Time{} }
+		return fi.ModTime()
+	}
+	last := mtime()
+	t := time.NewTicker(c.Server.ConfigWatch)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if m := mtime(); !m.Equal(last) && !m.IsZero() {
+				last = m
+				fn()
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package debugsrv serves profiling and runtime introspection endpoints,
+// meant for a separate, non-public admin listener.
+package debugsrv
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+var started = time.Now()
+
+// Handler exposes /debug/pprof/*, /debug/vars (expvar) and /debug/runtime.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/runtime", getRuntime)
+	return mux
+}
+
+type runtimeStats struct {
+	Uptime     string  `json:"uptime"`
+	GoVersion  string  `json:"go_version"`
+	NumCPU     int     `json:"num_cpu"`
+	GOMAXPROCS int     `json:"gomaxprocs"`
+	Goroutines int     `json:"goroutines"`
+	Heap       heap    `json:"heap"`
+	GC         gcStats `json:"gc"`
+}
+
+type heap struct {
+	AllocBytes   uint64 `json:"alloc_bytes"`
+	SysBytes     uint64 `json:"sys_bytes"`
+	InuseBytes   uint64 `json:"inuse_bytes"`
+	IdleBytes    uint64 `json:"idle_bytes"`
+	ObjectsLive  uint64 `json:"objects_live"`
+	TotalAllocs  uint64 `json:"total_allocs"`
+	TotalAlloced uint64 `json:"total_alloc_bytes"`
+}
+
+type gcStats struct {
+	NumGC        uint32    `json:"num_gc"`
+	LastGC       time.Time `json:"last_gc"`
+	PauseTotal   string    `json:"pause_total"`
+	RecentPauses []string  `json:"recent_pauses"`
+	NextGCBytes  uint64    `json:"next_gc_bytes"`
+	CPUFraction  float64   `json:"cpu_fraction"`
+}
+
+func getRuntime(w http.ResponseWriter, r *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	var gs debug.GCStats
+	debug.ReadGCStats(&gs)
+
+	recent := make([]string, 0, 10)
+	for i := 0; i < len(gs.Pause) && i < 10; i++ {
+		recent = append(recent, gs.Pause[i].String())
+	}
+	out := runtimeStats{
+		Uptime:     time.Since(started).Round(time.Second).String(),
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Heap: heap{
+			AllocBytes:   ms.HeapAlloc,
+			SysBytes:     ms.HeapSys,
+			InuseBytes:   ms.HeapInuse,
+			IdleBytes:    ms.HeapIdle,
+			ObjectsLive:  ms.HeapObjects,
+			TotalAllocs:  ms.Mallocs,
+			TotalAlloced: ms.TotalAlloc,
+		},
+		GC: gcStats{
+			NumGC:        ms.NumGC,
+			LastGC:       gs.LastGC,
+			PauseTotal:   gs.PauseTotal.String(),
+			RecentPauses: recent,
+			NextGCBytes:  ms.NextGC,
+			CPUFraction:  ms.GCCPUFraction,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,51 @@
+package embeds
+
+import (
+	"context"
+	"math"
+
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+// nnz is how many coordinates each user's random index vector sets.
+const nnz = 4
+
+// Train derives graph embeddings by random indexing: every user gets a
+// fixed sparse random ±1 vector of dim coordinates, and a user's
+// embedding is the normalized sum of the vectors of everyone they follow
+// and everyone following them. Users with overlapping neighborhoods end
+// up with a high cosine, which is what PYMK's cosine feature reads. edges
+// walks every edge once; put receives each embedding. It returns how
+// many users got one.
+func Train(ctx context.Context, edges func(fn func(u, v uint64) bool) error, dim int, put func(u uint64, vec []float32)) (int, error) {
+	acc := make(map[uint64][]float32)
+	add := func(u, x uint64) {
+		vec := acc[u]
+		if vec == nil { vec = make([]float32, dim); acc[u] = vec }
+		h := sketch.Hash(x)
+		for i := 0; i < nnz; i++ {
+			sign := float32(1)
+			if h&1 == 1 { sign = -1 }
+			vec[(h>>1)%uint64(dim)] += sign
+			h = sketch.Hash(h + uint64(i) + 1)
+		}
+	}
+	n := 0
+	err := edges(func(u, v uint64) bool {
+		if n++; n%65536 == 0 && ctx.Err() != nil { return false }
+		add(u, v)
+		add(v, u)
+		return true
+	})
+	if err != nil { return 0, err }
+	if err := ctx.Err(); err != nil { return 0, err }
+	for u, vec := range acc {
+		var norm float64
+		for _, x := range vec { norm += float64(x) * float64(x) }
+		if norm == 0 { continue }
+		inv := float32(1 / math.Sqrt(norm))
+		for i := range vec { vec[i] *= inv }
+		put(u, vec)
+	}
+	return len(acc), nil
+}
@@ -0,0 +1,152 @@
+// Package exclusions keeps per-user sets of users never to suggest, managed
+// by clients instead of being passed with every PYMK request.
+package exclusions
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// ErrTooMany is returned by changes that would grow a user's set past the
+// store's limit.
+var ErrTooMany = errors.New("too many exclusions")
+
+type key struct {
+	tenant string
+	user   uint64
+}
+
+// change is one line of the file: Set replaces the user's set with Add,
+// otherwise Add and Remove are applied to it.
+type change struct {
+	Tenant string   `json:"tenant"`
+	User   uint64   `json:"user_id"`
+	Set    bool     `json:"set,omitempty"`
+	Add    []uint64 `json:"add,omitempty"`
+	Remove []uint64 `json:"remove,omitempty"`
+}
+
+// Store holds every tenant's exclusion sets. With a path every change is
+// appended to a JSON-lines file and replayed by Open.
+type Store struct {
+	mu   sync.RWMutex
+	sets map[key]map[uint64]struct{}
+	max  int      // per user; 0 = unbounded
+	f    *os.File // nil when not persisted
+}
+
+// New returns a Store kept only in memory, allowing max exclusions per
+// user (0 = unbounded).
+func New(max int) *Store { return &Store{sets: make(map[key]map[uint64]struct{}), max: max} }
+
+// Open replays the exclusions file at path, creating it if needed, and
+// appends later changes to it. The limit applies to new changes only.
+func Open(path string, max int) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil { return nil, err }
+	s := New(max)
+	br := bufio.NewReaderSize(f, 64<<10)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 { slog.Warn("exclusions: dropping partial last line", "path", path) }
+			break
+		}
+		if err != nil { f.Close(); return nil, err }
+		var c change
+		if err := json.Unmarshal(line, &c); err != nil { f.Close(); return nil, fmt.Errorf("exclusions: %s:%d: %w", path, n, err) }
+		s.apply(c)
+	}
+	s.f = f
+	return s, nil
+}
+
+func (s *Store) apply(c change) {
+	k := key{c.Tenant, c.User}
+	m := s.sets[k]
+	if c.Set || m == nil { m = make(map[uint64]struct{}, len(c.Add)) }
+	for _, x := range c.Add {
+		if x != c.User { m[x] = struct{}{} }
+	}
+	for _, x := range c.Remove { delete(m, x) }
+	if len(m) == 0 { delete(s.sets, k); return }
+	s.sets[k] = m
+}
+
+// size returns how big c would leave its user's set. s.mu must be held.
+func (s *Store) size(c change) int {
+	m := s.sets[key{c.Tenant, c.User}]
+	if c.Set { m = nil }
+	gone := make(map[uint64]bool, len(c.Remove))
+	for _, x := range c.Remove { gone[x] = true }
+	n := 0
+	for x := range m {
+		if !gone[x] { n++ }
+	}
+	added := make(map[uint64]bool, len(c.Add))
+	for _, x := range c.Add {
+		if _, had := m[x]; had || added[x] || gone[x] || x == c.User { continue }
+		added[x] = true
+		n++
+	}
+	return n
+}
+
+func (s *Store) commit(c change) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if n := s.size(c); s.max > 0 && n > s.max { return fmt.Errorf("%w: %d, limit %d", ErrTooMany, n, s.max) }
+	if s.f != nil {
+		b, err := json.Marshal(c)
+		if err != nil { return err }
+		if _, err := s.f.Write(append(b, '\n')); err != nil { return err }
+	}
+	s.apply(c)
+	return nil
+}
+
+// Replace sets user's exclusions to ids; an empty ids clears them.
+func (s *Store) Replace(tenant string, user uint64, ids []uint64) error {
+	return s.commit(change{Tenant: tenant, User: user, Set: true, Add: ids})
+}
+
+// Update adds and then removes ids from user's exclusions.
+func (s *Store) Update(tenant string, user uint64, add, remove []uint64) error {
+	return s.commit(change{Tenant: tenant, User: user, Add: add, Remove: remove})
+}
+
+// List returns user's exclusions, sorted.
+func (s *Store) List(tenant string, user uint64) []uint64 {
+	s.mu.RLock()
+	m := s.sets[key{tenant, user}]
+	out := make([]uint64, 0, len(m))
+	for x := range m { out = append(out, x) }
+	s.mu.RUnlock()
+	slices.Sort(out)
+	return out
+}
+
+// Excluded returns a copy of user's exclusions, or nil when there are none.
+func (s *Store) Excluded(tenant string, user uint64) map[uint64]struct{} {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	m := s.sets[key{tenant, user}]
+	if len(m) == 0 { return nil }
+	out := make(map[uint64]struct{}, len(m))
+	for x := range m { out[x] = struct{}{} }
+	return out
+}
+
+func (s *Store) Close() error {
+	if s == nil || s.f == nil { return nil }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if err := s.f.Sync(); err != nil { s.f.Close(); return err }
+	return s.f.Close()
+}
@@ -0,0 +1,146 @@
+// Package feedback records what users did with their PYMK suggestions:
+// accepted, rejected or hid them. Hidden candidates are never suggested
+// again; accepts and rejects are exported as training data.
+package feedback
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	Accept = "accept"
+	Reject = "reject"
+	Hide   = "hide"
+)
+
+// ValidAction reports whether a is one of Accept, Reject and Hide.
+func ValidAction(a string) bool { return a == Accept || a == Reject || a == Hide }
+
+type Event struct {
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant"`
+	User      uint64    `json:"user_id"`
+	Candidate uint64    `json:"candidate_id"`
+	Action    string    `json:"action"`
+	Rank      int       `json:"rank,omitempty"` // 1-based rank it was last shown at, when known
+}
+
+type key struct {
+	tenant string
+	user   uint64
+}
+
+// Store keeps each user's latest action per candidate. With a path it is
+// persisted as an append-only JSON-lines file, replayed by Open; the
+// latest line for a pair wins.
+type Store struct {
+	mu    sync.RWMutex
+	users map[key]map[uint64]Event
+	f     *os.File // nil when not persisted
+}
+
+// New returns a Store kept only in memory.
+func New() *Store { return &Store{users: make(map[key]map[uint64]Event)} }
+
+// Open replays the feedback file at path, creating it if needed, and
+// appends later feedback to it.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil { return nil, err }
+	s := New()
+	br := bufio.NewReaderSize(f, 64<<10)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A partial last line is a write cut short by a crash.
+			if len(line) > 0 { slog.Warn("feedback: dropping partial last line", "path", path) }
+			break
+		}
+		if err != nil { f.Close(); return nil, err }
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil { f.Close(); return nil, fmt.Errorf("feedback: %s:%d: %w", path, n, err) }
+		s.set(ev)
+	}
+	s.f = f
+	return s, nil
+}
+
+func (s *Store) set(ev Event) {
+	k := key{ev.Tenant, ev.User}
+	m := s.users[k]
+	if m == nil { m = make(map[uint64]Event); s.users[k] = m }
+	m[ev.Candidate] = ev
+}
+
+// Record stores ev, replacing the user's earlier action on the same
+// candidate, and appends it to the file when persisted.
+func (s *Store) Record(ev Event) error {
+	if ev.Time.IsZero() { ev.Time = time.Now().UTC() }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.f != nil {
+		b, err := json.Marshal(ev)
+		if err != nil { return err }
+		if _, err := s.f.Write(append(b, '\n')); err != nil { return err }
+	}
+	s.set(ev)
+	return nil
+}
+
+// Hidden returns the candidates user hid, or nil when there are none.
+func (s *Store) Hidden(tenant string, user uint64) map[uint64]struct{} {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	var out map[uint64]struct{}
+	for c, ev := range s.users[key{tenant, user}] {
+		if ev.Action != Hide { continue }
+		if out == nil { out = make(map[uint64]struct{}) }
+		out[c] = struct{}{}
+	}
+	return out
+}
+
+// User returns user's feedback, newest first.
+func (s *Store) User(tenant string, user uint64) []Event {
+	s.mu.RLock()
+	out := make([]Event, 0, len(s.users[key{tenant, user}]))
+	for _, ev := range s.users[key{tenant, user}] { out = append(out, ev) }
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out
+}
+
+// Each calls fn with tenant's latest accept and reject of every pair, in
+// no particular order, until fn returns false. Hides are left out: they
+// say the user never wants to see the candidate, not whether they would
+// connect.
+func (s *Store) Each(tenant string, fn func(Event) bool) {
+	s.mu.RLock()
+	var evs []Event
+	for k, m := range s.users {
+		if k.tenant != tenant { continue }
+		for _, ev := range m {
+			if ev.Action != Hide { evs = append(evs, ev) }
+		}
+	}
+	s.mu.RUnlock()
+	for _, ev := range evs {
+		if !fn(ev) { return }
+	}
+}
+
+func (s *Store) Close() error {
+	if s == nil || s.f == nil { return nil }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if err := s.f.Sync(); err != nil { s.f.Close(); return err }
+	return s.f.Close()
+}
@@ -0,0 +1,78 @@
+// Package flags gates features behind percentage rollouts. A flag at p
+// percent is on for a stable p% of users: each user hashes into one of
+// 10,000 buckets per flag, so raising p only ever adds users, and two
+// flags at the same percentage select different users.
+package flags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"sync"
+
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+type Set struct {
+	mu  sync.RWMutex
+	pct map[string]float64 // flag -> percent of users, 0..100
+}
+
+// New returns a set with the given rollouts; unknown flags are off.
+func New(pct map[string]float64) (*Set, error) {
+	s := &Set{pct: make(map[string]float64)}
+	return s, s.Replace(pct)
+}
+
+func validate(name string, pct float64) error {
+	if name == "" { return fmt.Errorf("flags: empty name") }
+	if pct < 0 || pct > 100 { return fmt.Errorf("flags: %s: percent must be in 0..100", name) }
+	return nil
+}
+
+// Enabled reports whether name is on for user. A nil Set has every flag off.
+func (s *Set) Enabled(name string, user uint64) bool {
+	if s == nil { return false }
+	s.mu.RLock()
+	p := s.pct[name]
+	s.mu.RUnlock()
+	switch {
+	case p <= 0:
+		return false
+	case p >= 100:
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return float64(sketch.Hash(user^h.Sum64())%10_000) < p*100
+}
+
+// Set changes one flag's rollout.
+func (s *Set) Set(name string, pct float64) error {
+	if err := validate(name, pct); err != nil { return err }
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.pct[name] = pct
+	return nil
+}
+
+func (s *Set) Delete(name string) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	delete(s.pct, name)
+}
+
+// Replace swaps in a whole new set of rollouts, all or nothing.
+func (s *Set) Replace(pct map[string]float64) error {
+	for n, p := range pct {
+		if err := validate(n, p); err != nil { return err }
+	}
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.pct = maps.Clone(pct)
+	if s.pct == nil { s.pct = make(map[string]float64) }
+	return nil
+}
+
+// All returns a copy of every rollout.
+func (s *Set) All() map[string]float64 {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return maps.Clone(s.pct)
+}
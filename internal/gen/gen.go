@@ -0,0 +1,138 @@
+// Package gen generates synthetic follow graphs for benchmarks and demos.
+// Users are numbered 1..N.
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Models.
+const (
+	BarabasiAlbert = "ba" // preferential attachment: power-law in-degrees
+	ErdosRenyi     = "er" // every directed edge independently with probability P
+	WattsStrogatz  = "ws" // ring lattice with rewiring: clustered, small-world
+)
+
+type Params struct {
+	Model string
+	N     int     // users
+	M     int     // ba: edges each new user adds
+	P     float64 // er: edge probability
+	K     int     // ws: lattice neighbors per user (even)
+	Beta  float64 // ws: rewiring probability
+	Seed  int64
+}
+
+func (p Params) validate() error {
+	if p.N < 2 { return errors.New("gen: need at least 2 users") }
+	switch p.Model {
+	case BarabasiAlbert:
+		if p.M < 1 || p.M >= p.N { return errors.New("gen: ba needs 1 <= M < N") }
+	case ErdosRenyi:
+		if p.P <= 0 || p.P > 1 { return errors.New("gen: er needs 0 < P <= 1") }
+	case WattsStrogatz:
+		if p.K < 2 || p.K%2 != 0 || p.K >= p.N { return errors.New("gen: ws needs even 2 <= K < N") }
+		if p.Beta < 0 || p.Beta > 1 { return errors.New("gen: ws needs 0 <= Beta <= 1") }
+	default:
+		return fmt.Errorf("gen: unknown model %q (ba, er, ws)", p.Model)
+	}
+	return nil
+}
+
+// Generate calls emit for each edge u->v. Edges are never self-loops but
+// may repeat; stores ignore duplicates.
+func Generate(p Params, emit func(u, v uint64)) error {
+	if err := p.validate(); err != nil { return err }
+	rng := rand.New(rand.NewSource(p.Seed))
+	switch p.Model {
+	case BarabasiAlbert:
+		barabasiAlbert(rng, p.N, p.M, emit)
+	case ErdosRenyi:
+		erdosRenyi(rng, p.N, p.P, emit)
+	case WattsStrogatz:
+		wattsStrogatz(rng, p.N, p.K, p.Beta, emit)
+	}
+	return nil
+}
+
+// Populate generates p into g and returns how many edges were new. It
+// stops adding at the first store error.
+func Populate(ctx context.Context, g graph.Store, p Params) (int, error) {
+	added := 0
+	var ferr error
+	err := Generate(p, func(u, v uint64) {
+		if ferr != nil { return }
+		ok, err := g.Follow(ctx, u, v)
+		if ok { added++ }
+		ferr = err
+	})
+	if err == nil { err = ferr }
+	return added, err
+}
+
+// barabasiAlbert starts from a directed cycle of m+1 users; each later user
+// follows m distinct earlier users picked proportionally to their degree.
+// Drawing uniformly from the list of all edge endpoints is exactly
+// degree-proportional sampling.
+func barabasiAlbert(rng *rand.Rand, n, m int, emit func(u, v uint64)) {
+	ends := make([]uint64, 0, 2*n*m)
+	seed := m + 1
+	for i := 1; i <= seed; i++ {
+		u, v := uint64(i), uint64(i%seed+1)
+		emit(u, v)
+		ends = append(ends, u, v)
+	}
+	picked := make(map[uint64]struct{}, m)
+	for i := seed + 1; i <= n; i++ {
+		u := uint64(i)
+		clear(picked)
+		for len(picked) < m {
+			v := ends[rng.Intn(len(ends))]
+			if _, dup := picked[v]; dup { continue }
+			picked[v] = struct{}{}
+			emit(u, v)
+		}
+		for v := range picked { ends = append(ends, u, v) }
+	}
+}
+
+// erdosRenyi walks the n*(n-1) possible edges with geometric skips
+// (Batagelj & Brandes), so the cost is proportional to the edges emitted.
+func erdosRenyi(rng *rand.Rand, n int, p float64, emit func(u, v uint64)) {
+	total := int64(n) * int64(n-1)
+	lq := math.Log(1 - p)
+	for i := int64(-1); ; {
+		if p < 1 {
+			i += 1 + int64(math.Log(1-rng.Float64())/lq)
+		} else {
+			i++
+		}
+		if i >= total { return }
+		u, j := i/int64(n-1), i%int64(n-1)
+		if j >= u { j++ } // skip the self-loop slot
+		emit(uint64(u+1), uint64(j+1))
+	}
+}
+
+// wattsStrogatz links each user to its k/2 successors on a ring, rewiring
+// each link's far end to a random user with probability beta. Links are
+// mutual follows, as in the undirected model.
+func wattsStrogatz(rng *rand.Rand, n, k int, beta float64, emit func(u, v uint64)) {
+	for i := 0; i < n; i++ {
+		for d := 1; d <= k/2; d++ {
+			j := (i + d) % n
+			if rng.Float64() < beta {
+				for j = rng.Intn(n); j == i; j = rng.Intn(n) {}
+			}
+			u, v := uint64(i+1), uint64(j+1)
+			emit(u, v)
+			emit(v, u)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// -------- Lock contention sampling --------
+// Request paths take shard locks through lock/rLock, which time one in
+// lockSampleEvery acquisitions and scale the wait up, so
+// sg_shard_lock_wait_seconds_total estimates total wait per shard at the
+// cost of one atomic add on the other acquisitions.
+
+const lockSampleEvery = 64
+
+func (s *shard) initWaitMetrics(i int) {
+	id := strconv.Itoa(i)
+	s.waitR = metrics.ShardLockWait.WithLabelValues(id, "read")
+	s.waitW = metrics.ShardLockWait.WithLabelValues(id, "write")
+}
+
+func (s *shard) lock() {
+	if s.ops.Add(1)%lockSampleEvery != 0 { s.mu.Lock(); return }
+	t := time.Now()
+	s.mu.Lock()
+	s.waitW.Add(time.Since(t).Seconds() * lockSampleEvery)
+}
+
+func (s *shard) rLock() {
+	if s.ops.Add(1)%lockSampleEvery != 0 { s.mu.RLock(); return }
+	t := time.Now()
+	s.mu.RLock()
+	s.waitR.Add(time.Since(t).Seconds() * lockSampleEvery)
+}
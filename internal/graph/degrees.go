@@ -0,0 +1,133 @@
+package graph
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// -------- Degree indexes --------
+// Each shard keeps its users bucketed by log2 of their in- and out-degree,
+// updated on every edge change, so threshold queries only walk the top
+// buckets instead of every user.
+
+// degIndex maps bucket b to the users whose degree n has bits.Len(n) == b,
+// i.e. lies in [2^(b-1), 2^b), with that exact degree. Users of degree 0
+// are absent. Spilled users stay indexed.
+type degIndex [65]map[uint64]int
+
+func (d *degIndex) set(u uint64, before, after int) {
+	if before > 0 { delete(d[bits.Len(uint(before))], u) }
+	if after > 0 {
+		b := bits.Len(uint(after))
+		if d[b] == nil { d[b] = make(map[uint64]int) }
+		d[b][u] = after
+	}
+}
+
+func (d *degIndex) degree(u uint64) int {
+	for _, m := range d {
+		if n, ok := m[u]; ok { return n }
+	}
+	return 0
+}
+
+// link adds v to u's following (out) or followers set and reports whether
+// it was new, recording the change in the open views vs; unlink removes
+// it. s.mu must be held for writing.
+func (s *shard) link(out bool, u, v uint64, vs []*memView) bool {
+	m, bit, d := s.followers, sharedIn, &s.inDeg
+	if out { m, bit, d = s.following, sharedOut, &s.outDeg }
+	if m[u].Has(v) { return false }
+	for _, w := range vs { w.record(out, u, v, true) }
+	set := s.writable(m, u, bit)
+	set.Add(v)
+	d.set(u, len(set)-1, len(set))
+	return true
+}
+
+func (s *shard) unlink(out bool, u, v uint64, vs []*memView) bool {
+	m, bit, d := s.followers, sharedIn, &s.inDeg
+	if out { m, bit, d = s.following, sharedOut, &s.outDeg }
+	if !m[u].Has(v) { return false }
+	for _, w := range vs { w.record(out, u, v, false) }
+	set := s.writable(m, u, bit)
+	set.Del(v)
+	d.set(u, len(set)+1, len(set))
+	if len(set) == 0 { delete(m, u) }
+	return true
+}
+
+type DegreeUser struct {
+	User      uint64 `json:"user_id"`
+	Followers int    `json:"followers"`
+	Following int    `json:"following"`
+}
+
+// UsersByDegree returns up to limit users with at least minIn followers
+// and minOut followees, by the thresholded degree (followers when both
+// are set) descending, ties on the lower ID. At least one threshold must
+// be positive.
+func (g *MemGraph) UsersByDegree(minIn, minOut, limit int) []DegreeUser {
+	if minIn <= 0 && minOut <= 0 { return nil }
+	var out []DegreeUser
+	for _, s := range g.ss {
+		s.mu.RLock()
+		idx, min := &s.inDeg, minIn
+		if minIn <= 0 { idx, min = &s.outDeg, minOut }
+		for b := bits.Len(uint(min)); b < len(idx); b++ {
+			for u, n := range idx[b] {
+				if n < min { continue }
+				du := DegreeUser{User: u}
+				if idx == &s.inDeg {
+					du.Followers, du.Following = n, s.outDeg.degree(u)
+				} else {
+					du.Followers, du.Following = s.inDeg.degree(u), n
+				}
+				if du.Followers >= minIn && du.Following >= minOut { out = append(out, du) }
+			}
+		}
+		s.mu.RUnlock()
+	}
+	key := func(d DegreeUser) int {
+		if minIn > 0 { return d.Followers }
+		return d.Following
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := key(out[i]), key(out[j]); a != b { return a > b }
+		return out[i].User < out[j].User
+	})
+	if limit > 0 && len(out) > limit { out = out[:limit] }
+	return out
+}
+
+// DegreeBucket counts users whose degree lies in [Min, Max].
+type DegreeBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Users int `json:"users"`
+}
+
+// DegreeHistogram returns the in- and out-degree distributions in
+// power-of-two buckets ([1,1], [2,3], [4,7], ...) straight from the
+// degree indexes, up to the highest non-empty bucket. Users with no edges
+// in a direction are not counted in it.
+func (g *MemGraph) DegreeHistogram() (in, out []DegreeBucket) {
+	var ni, no [65]int
+	for _, s := range g.ss {
+		s.mu.RLock()
+		for b := range s.inDeg { ni[b] += len(s.inDeg[b]) }
+		for b := range s.outDeg { no[b] += len(s.outDeg[b]) }
+		s.mu.RUnlock()
+	}
+	return histogram(ni[:]), histogram(no[:])
+}
+
+func histogram(n []int) []DegreeBucket {
+	top := 0
+	for b := range n { if n[b] > 0 { top = b } }
+	out := make([]DegreeBucket, 0, top)
+	for b := 1; b <= top; b++ {
+		out = append(out, DegreeBucket{Min: 1 << (b - 1), Max: 1<<b - 1, Users: n[b]})
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package graph
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// -------- Frozen read views --------
+// Freeze has every shard publish an immutable copy of its maps behind an
+// atomic pointer. The sets themselves are not copied: after a freeze,
+// the first write to each set copies it (like a Set view, see writable),
+// so the published sets never change. Readers of the views take no lock
+// at all; the price is staleness of up to the freeze interval, one outer
+// map copy per shard per freeze, and one set copy per set written to
+// between freezes.
+type frozenShard struct {
+	following map[uint64]uint64Set
+	followers map[uint64]uint64Set
+	at        time.Time
+}
+
+// Freeze publishes a fresh frozen view of every shard. Each shard is read
+// locked only while its maps are copied.
+func (g *MemGraph) Freeze() {
+	for _, s := range g.ss {
+		s.mu.RLock()
+		f := &frozenShard{following: maps.Clone(s.following), followers: maps.Clone(s.followers), at: time.Now()}
+		s.amu.Lock()
+		s.fresh = make(map[uint64]uint8)
+		s.frz.Store(f)
+		s.amu.Unlock()
+		s.mu.RUnlock()
+	}
+}
+
+// FrozenAge is how old the oldest shard view is; 0 before any Freeze.
+func (g *MemGraph) FrozenAge() time.Duration {
+	var oldest time.Time
+	for _, s := range g.ss {
+		f := s.frz.Load()
+		if f == nil { return 0 }
+		if oldest.IsZero() || f.at.Before(oldest) { oldest = f.at }
+	}
+	return time.Since(oldest)
+}
+
+// frozen returns u's set from its shard's view; false when there is no
+// view or u is not in it.
+func (g *MemGraph) frozen(u uint64, out bool) (uint64Set, bool) {
+	f := g.ss[g.h(u)].frz.Load()
+	if f == nil { return nil, false }
+	m := f.followers
+	if out { m = f.following }
+	set, ok := m[u]
+	return set, ok
+}
+
+// FrozenReads returns s with its neighbor reads served from local's frozen
+// views, without locking. Users missing from the views (no view yet, new
+// since the last freeze, spilled to disk, or kept by another node in
+// cluster mode) and everything else go to s. Pair it with a periodic
+// local.Freeze and use it only where slightly stale reads are fine, such
+// as expanding PYMK candidates.
+func FrozenReads(s Store, local *MemGraph) Store { return &frozenStore{Store: s, g: local} }
+
+type frozenStore struct {
+	Store
+	g *MemGraph
+}
+
+func (f *frozenStore) ForEachFollowing(ctx context.Context, u uint64, fn func(v uint64) bool) error {
+	set, ok := f.g.frozen(u, true)
+	if !ok { return f.Store.ForEachFollowing(ctx, u, fn) }
+	for v := range set { if !fn(v) { break } }
+	return nil
+}
+
+func (f *frozenStore) ForEachFollowers(ctx context.Context, u uint64, fn func(v uint64) bool) error {
+	set, ok := f.g.frozen(u, false)
+	if !ok { return f.Store.ForEachFollowers(ctx, u, fn) }
+	for v := range set { if !fn(v) { break } }
+	return nil
+}
+
+func (f *frozenStore) FollowingSet(ctx context.Context, u uint64) (Set, error) {
+	if set, ok := f.g.frozen(u, true); ok { return Set{set}, nil }
+	return f.Store.FollowingSet(ctx, u)
+}
+
+func (f *frozenStore) FollowersSet(ctx context.Context, u uint64) (Set, error) {
+	if set, ok := f.g.frozen(u, false); ok { return Set{set}, nil }
+	return f.Store.FollowersSet(ctx, u)
+}
+
+func (f *frozenStore) HasEdge(ctx context.Context, u, v uint64) (bool, error) {
+	if set, ok := f.g.frozen(u, true); ok { return set.Has(v), nil }
+	return f.Store.HasEdge(ctx, u, v)
+}
+
+func (f *frozenStore) DegreeOut(ctx context.Context, u uint64) (int, error) {
+	if set, ok := f.g.frozen(u, true); ok { return len(set), nil }
+	return f.Store.DegreeOut(ctx, u)
+}
+
+func (f *frozenStore) DegreeIn(ctx context.Context, u uint64) (int, error) {
+	if set, ok := f.g.frozen(u, false); ok { return len(set), nil }
+	return f.Store.DegreeIn(ctx, u)
+}
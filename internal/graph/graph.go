@@ -1,6 +1,15 @@
 package graph
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 // -------- Basic set --------
 type void struct{}
@@ -19,160 +28,445 @@ func ToSet(list []uint64) uint64Set {
 	return s
 }
 
+// Set is a read-only view of a user's neighbor set. The view is stable:
+// writes after it was taken copy the underlying set instead of changing
+// it in place, so holders need no lock.
+type Set struct{ m uint64Set }
+
+// SetOf builds a Set from list.
+func SetOf(list []uint64) Set { return Set{ToSet(list)} }
+
+func (s Set) Has(x uint64) bool { return s.m.Has(x) }
+func (s Set) Len() int          { return len(s.m) }
+
+// Each calls fn for each member, stopping early when fn returns false.
+func (s Set) Each(fn func(v uint64) bool) {
+	for v := range s.m { if !fn(v) { return } }
+}
+
 // -------- Graph interface --------
+// Every method takes the caller's context and can fail, so remote and
+// persistent backends report errors instead of panicking or swallowing
+// them. Failures of the backend itself wrap ErrUnavailable; a done ctx
+// yields ctx.Err(). MemGraph only fails when spilling is enabled and a
+// spilled user cannot be read back (see spill.go).
 type Store interface {
-	Follow(u, v uint64) bool
-	Unfollow(u, v uint64) bool
-	Following(u uint64) []uint64
-	Followers(u uint64) []uint64
-	HasEdge(u, v uint64) bool
-	DegreeOut(u uint64) int
-	DegreeIn(u uint64) int
-	TouchUsers(users ...uint64) // increments users' epoch for cache invalidation
-	UserEpoch(u uint64) uint64
+	Reader
+	Follow(ctx context.Context, u, v uint64) (bool, error)
+	Unfollow(ctx context.Context, u, v uint64) (bool, error)
+	// FollowIf and UnfollowIf write only if u's epoch still equals epoch,
+	// and fail with ErrEpochChanged otherwise: optimistic concurrency for
+	// clients that read u's state first.
+	FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error)
+	UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error)
+	// Apply performs ops in order as one atomic step: all are applied or,
+	// when the transaction is rejected, none. changed[i] reports whether
+	// ops[i] altered the graph. See tx.go.
+	Apply(ctx context.Context, ops []EdgeOp) (changed []bool, err error)
+	TouchUsers(ctx context.Context, users ...uint64) error // increments users' epoch for cache invalidation
+	// View opens a consistent read-only snapshot for a computation that
+	// makes many reads; see view.go for what each backend guarantees. The
+	// caller must Close it.
+	View() View
+}
+
+// Reader is the read half of Store, which Views implement as well.
+type Reader interface {
+	Following(ctx context.Context, u uint64) ([]uint64, error)
+	Followers(ctx context.Context, u uint64) ([]uint64, error)
+	// ForEachFollowing/ForEachFollowers call fn for each neighbor without
+	// copying the set, stopping early when fn returns false. fn may run
+	// under a shard read lock, so it must not call back into the Store.
+	ForEachFollowing(ctx context.Context, u uint64, fn func(v uint64) bool) error
+	ForEachFollowers(ctx context.Context, u uint64, fn func(v uint64) bool) error
+	// FollowingSet/FollowersSet return u's current sets as stable views,
+	// without copying them for locally stored users.
+	FollowingSet(ctx context.Context, u uint64) (Set, error)
+	FollowersSet(ctx context.Context, u uint64) (Set, error)
+	HasEdge(ctx context.Context, u, v uint64) (bool, error)
+	DegreeOut(ctx context.Context, u uint64) (int, error)
+	DegreeIn(ctx context.Context, u uint64) (int, error)
+	// Degrees returns the in- and out-degree of each of users, in order,
+	// in one call: per shard locally, per owner in cluster mode.
+	Degrees(ctx context.Context, users []uint64) ([]DegreeUser, error)
+	Friends(ctx context.Context, u uint64) ([]uint64, error)   // users u follows who follow u back
+	AreFriends(ctx context.Context, u, v uint64) (bool, error) // u and v follow each other
+	UserEpoch(ctx context.Context, u uint64) (uint64, error)
 }
 
+// ErrEpochChanged is returned by conditional writes whose expected epoch
+// is stale.
+var ErrEpochChanged = errors.New("graph: epoch changed")
+
+// ErrUnavailable is wrapped by errors from a backend that could not be
+// reached or did not answer, such as a down cluster peer.
+var ErrUnavailable = errors.New("graph: store unavailable")
+
 // -------- Sharded in-memory graph --------
-const shards = 64
+// DefaultShards is the shard count of NewMemGraph. Shard counts are powers
+// of two up to MaxShards; users are placed by a splitmix64 hash of their
+// ID, so sequential, strided or timestamp-prefixed ID schemes spread
+// evenly.
+const (
+	DefaultShards = 64
+	MaxShards     = 4096
+)
 
 type shard struct {
 	mu        sync.RWMutex
 	following map[uint64]uint64Set // u -> set(dst)
 	followers map[uint64]uint64Set // v -> set(src)
+	outDeg    degIndex             // see degrees.go
+	inDeg     degIndex
+
+	ops          atomic.Uint32 // lock acquisitions, for sampling (contention.go)
+	waitR, waitW prometheus.Counter
+
+	// Users whose sets were handed out as a Set view (sharedOut/sharedIn
+	// bits); the next write to such a set copies it first.
+	shared map[uint64]uint8
+
+	// The published frozen view, and the users whose sets were copied
+	// since it was (fresh, guarded like shared); see frozen.go.
+	frz   atomic.Pointer[frozenShard]
+	fresh map[uint64]uint8
+
+	// Only with spilling enabled (see spill.go).
+	spilled map[uint64]spillRef // users whose sets live in the spill file
+	amu     sync.Mutex          // guards access and shared; taken under mu.RLock
+	access  map[uint64]uint32   // user -> accessTick of last access
+}
+
+const (
+	sharedOut uint8 = 1 << iota
+	sharedIn
+)
+
+// writable returns u's set in m (the shard's following or followers map,
+// matching bit) ready for mutation: created when absent, copied first when
+// a view of it is outstanding or it may be in the frozen view. s.mu must
+// be held for writing.
+func (s *shard) writable(m map[uint64]uint64Set, u uint64, bit uint8) uint64Set {
+	set, ok := m[u]
+	frozen := s.frz.Load() != nil
+	if ok && s.shared[u]&bit == 0 && (!frozen || s.fresh[u]&bit != 0) { return set }
+	if ok {
+		set = maps.Clone(set)
+	} else {
+		set = make(uint64Set)
+	}
+	m[u] = set
+	if f := s.shared[u] &^ bit; f != 0 { s.shared[u] = f } else { delete(s.shared, u) }
+	if frozen { s.fresh[u] |= bit }
+	return set
 }
 
 type MemGraph struct {
-	ss     [shards]*shard
-	epochs sync.Map // user -> uint64 epoch for cache invalidation
+	ss      []*shard
+	mask    uint64 // len(ss)-1
+	epochs  sync.Map // user -> uint64 epoch for cache invalidation
+	sp      *spillFile
+	onTouch func(u uint64) // see OnTouch
+
+	vmu   sync.Mutex                  // serializes opening and closing views
+	views atomic.Pointer[[]*memView] // open Views, replaced on change; see view.go
 }
 
-func NewMemGraph() *MemGraph {
-	g := &MemGraph{}
-	for i := 0; i < shards; i++ {
+func NewMemGraph() *MemGraph { return NewMemGraphShards(DefaultShards) }
+
+// NewMemGraphShards returns a graph of n shards; n must pass ValidShards.
+func NewMemGraphShards(n int) *MemGraph {
+	if err := ValidShards(n); err != nil { panic(err) }
+	g := &MemGraph{ss: make([]*shard, n), mask: uint64(n - 1)}
+	for i := 0; i < n; i++ {
 		g.ss[i] = &shard{
 			following: make(map[uint64]uint64Set),
 			followers: make(map[uint64]uint64Set),
+			shared:    make(map[uint64]uint8),
 		}
+		g.ss[i].initWaitMetrics(i)
 	}
 	return g
 }
 
-func h(u uint64) int { return int(u % shards) }
+// ValidShards reports whether n can be a shard count.
+func ValidShards(n int) error {
+	if n < 1 || n > MaxShards || n&(n-1) != 0 { return fmt.Errorf("graph: %d shards: want a power of two in 1..%d", n, MaxShards) }
+	return nil
+}
 
-func (g *MemGraph) Follow(u, v uint64) bool {
-	if u == v { return false }
-	su := g.ss[h(u)]
-	sv := g.ss[h(v)]
+// Shards is g's shard count.
+func (g *MemGraph) Shards() int { return len(g.ss) }
 
-	// Lock order by shard index to avoid deadlock.
-	a, b := su, sv
-	if su != sv && h(u) > h(v) { a, b = sv, su }
-	a.mu.Lock()
-	if b != a { b.mu.Lock() }
-
-	fset, ok := su.following[u]
-	if !ok {
-		fset = make(uint64Set)
-		su.following[u] = fset
-	}
-	if fset.Has(v) {
-		if b != a { b.mu.Unlock() }
-		a.mu.Unlock()
-		return false
-	}
-	fset.Add(v)
+// h is the index of u's shard.
+func (g *MemGraph) h(u uint64) int { return int(mix(u) & g.mask) }
 
-	rset, ok := sv.followers[v]
-	if !ok {
-		rset = make(uint64Set)
-		sv.followers[v] = rset
-	}
-	rset.Add(u)
+// ShardOf is the index of u's shard, for callers partitioning work by
+// shard.
+func (g *MemGraph) ShardOf(u uint64) int { return g.h(u) }
+
+// stripes is the lock striping of the per-edge side stores (sources,
+// times, weights), independent of the graph's shard count.
+const stripes = 64
+
+func stripe(u uint64) int { return int(mix(u) & (stripes - 1)) }
+
+// mix is the splitmix64 finalizer: every input bit affects every output
+// bit, so any ID pattern spreads evenly over the shards.
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
 
-	if b != a { b.mu.Unlock() }
-	a.mu.Unlock()
+func (g *MemGraph) Follow(_ context.Context, u, v uint64) (bool, error) { return g.follow(u, v, nil) }
+func (g *MemGraph) Unfollow(_ context.Context, u, v uint64) (bool, error) { return g.unfollow(u, v, nil) }
 
-	g.TouchUsers(u, v)
-	return true
+func (g *MemGraph) FollowIf(_ context.Context, u, v, epoch uint64) (bool, error) {
+	return g.follow(u, v, &epoch)
+}
+func (g *MemGraph) UnfollowIf(_ context.Context, u, v, epoch uint64) (bool, error) {
+	return g.unfollow(u, v, &epoch)
 }
 
-func (g *MemGraph) Unfollow(u, v uint64) bool {
-	su := g.ss[h(u)]
-	sv := g.ss[h(v)]
+// lockPair write-locks the shards of u and v, in shard order to avoid
+// deadlock, with both users resident. When a user cannot be paged in,
+// nothing is left locked.
+func (g *MemGraph) lockPair(u, v uint64) (su, sv *shard, unlock func(), err error) {
+	su, sv = g.ss[g.h(u)], g.ss[g.h(v)]
 	a, b := su, sv
-	if su != sv && h(u) > h(v) { a, b = sv, su }
-	a.mu.Lock()
-	if b != a { b.mu.Lock() }
-
-	fset, ok := su.following[u]
-	if ok && fset.Has(v) {
-		fset.Del(v)
-		if len(fset) == 0 {
-			delete(su.following, u)
-		}
-		if rset, ok := sv.followers[v]; ok {
-			rset.Del(u)
-			if len(rset) == 0 {
-				delete(sv.followers, v)
-			}
-		}
+	if su != sv && g.h(u) > g.h(v) { a, b = sv, su }
+	a.lock()
+	if b != a { b.lock() }
+	unlock = func() {
 		if b != a { b.mu.Unlock() }
 		a.mu.Unlock()
-
-		g.TouchUsers(u, v)
-		return true
 	}
+	if err = g.fault(su, u); err == nil { err = g.fault(sv, v) }
+	if err != nil { unlock(); return nil, nil, nil, err }
+	return su, sv, unlock, nil
+}
+
+// Epochs are bumped before the shard locks are released, so a
+// conditional write that saw the old epoch under the lock also saw the
+// old sets.
+func (g *MemGraph) follow(u, v uint64, epoch *uint64) (bool, error) {
+	if u == v { return false, nil }
+	su, sv, unlock, err := g.lockPair(u, v)
+	if err != nil { return false, err }
+	defer unlock()
+	if epoch != nil && g.epoch(u) != *epoch { return false, ErrEpochChanged }
+	vs := g.openViews()
+	if !su.link(true, u, v, vs) { return false, nil }
+	sv.link(false, v, u, vs)
+	g.touch(u, v)
+	return true, nil
+}
 
-	if b != a { b.mu.Unlock() }
-	a.mu.Unlock()
-	return false
+func (g *MemGraph) unfollow(u, v uint64, epoch *uint64) (bool, error) {
+	su, sv, unlock, err := g.lockPair(u, v)
+	if err != nil { return false, err }
+	defer unlock()
+	if epoch != nil && g.epoch(u) != *epoch { return false, ErrEpochChanged }
+	vs := g.openViews()
+	if !su.unlink(true, u, v, vs) { return false, nil }
+	sv.unlink(false, v, u, vs)
+	g.touch(u, v)
+	return true, nil
 }
 
-func (g *MemGraph) Following(u uint64) []uint64 {
-	s := g.ss[h(u)]
-	s.mu.RLock(); defer s.mu.RUnlock()
+func (g *MemGraph) Following(_ context.Context, u uint64) ([]uint64, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return nil, err }
+	defer s.mu.RUnlock()
 	fset := s.following[u]
 	out := make([]uint64, 0, len(fset))
 	for v := range fset { out = append(out, v) }
-	return out
+	return out, nil
 }
 
-func (g *MemGraph) Followers(u uint64) []uint64 {
-	s := g.ss[h(u)]
-	s.mu.RLock(); defer s.mu.RUnlock()
+func (g *MemGraph) Followers(_ context.Context, u uint64) ([]uint64, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return nil, err }
+	defer s.mu.RUnlock()
 	rset := s.followers[u]
 	out := make([]uint64, 0, len(rset))
 	for v := range rset { out = append(out, v) }
-	return out
+	return out, nil
+}
+
+func (g *MemGraph) ForEachFollowing(_ context.Context, u uint64, fn func(v uint64) bool) error {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return err }
+	defer s.mu.RUnlock()
+	for v := range s.following[u] { if !fn(v) { break } }
+	return nil
+}
+
+func (g *MemGraph) ForEachFollowers(_ context.Context, u uint64, fn func(v uint64) bool) error {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return err }
+	defer s.mu.RUnlock()
+	for v := range s.followers[u] { if !fn(v) { break } }
+	return nil
 }
 
-func (g *MemGraph) HasEdge(u, v uint64) bool {
-	s := g.ss[h(u)]
-	s.mu.RLock(); defer s.mu.RUnlock()
-	if fset, ok := s.following[u]; ok {
-		return fset.Has(v)
+func (g *MemGraph) FollowingSet(_ context.Context, u uint64) (Set, error) { return g.view(u, sharedOut) }
+func (g *MemGraph) FollowersSet(_ context.Context, u uint64) (Set, error) { return g.view(u, sharedIn) }
+
+// view hands out u's set without copying and marks it shared, so the next
+// write copies it instead of mutating what the caller holds.
+func (g *MemGraph) view(u uint64, bit uint8) (Set, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return Set{}, err }
+	defer s.mu.RUnlock()
+	m := s.following
+	if bit == sharedIn { m = s.followers }
+	set := m[u]
+	if len(set) == 0 { return Set{}, nil }
+	s.amu.Lock()
+	s.shared[u] |= bit
+	s.amu.Unlock()
+	return Set{set}, nil
+}
+
+func (g *MemGraph) HasEdge(_ context.Context, u, v uint64) (bool, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return false, err }
+	defer s.mu.RUnlock()
+	return s.following[u].Has(v), nil
+}
+func (g *MemGraph) DegreeOut(_ context.Context, u uint64) (int, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return 0, err }
+	defer s.mu.RUnlock()
+	return len(s.following[u]), nil
+}
+func (g *MemGraph) DegreeIn(_ context.Context, u uint64) (int, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return 0, err }
+	defer s.mu.RUnlock()
+	return len(s.followers[u]), nil
+}
+
+// Degrees takes each shard's read lock once for all of its users. Spilled
+// users are answered from the degree index without faulting them in.
+func (g *MemGraph) Degrees(_ context.Context, users []uint64) ([]DegreeUser, error) {
+	out := make([]DegreeUser, len(users))
+	byShard := make([][]int, len(g.ss))
+	for i, u := range users {
+		out[i].User = u
+		byShard[g.h(u)] = append(byShard[g.h(u)], i)
+	}
+	for sh, idx := range byShard {
+		if len(idx) == 0 { continue }
+		s := g.ss[sh]
+		s.rLock()
+		for _, i := range idx {
+			u := out[i].User
+			if _, spilled := s.spilled[u]; spilled {
+				out[i].Followers, out[i].Following = s.inDeg.degree(u), s.outDeg.degree(u)
+				continue
+			}
+			out[i].Followers, out[i].Following = len(s.followers[u]), len(s.following[u])
+		}
+		s.mu.RUnlock()
 	}
-	return false
+	return out, nil
 }
-func (g *MemGraph) DegreeOut(u uint64) int {
-	s := g.ss[h(u)]
-	s.mu.RLock(); defer s.mu.RUnlock()
-	return len(s.following[u])
+
+// Both of u's sets live in u's shard, so reciprocity is a single-lock
+// intersection.
+func (g *MemGraph) Friends(_ context.Context, u uint64) ([]uint64, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return nil, err }
+	defer s.mu.RUnlock()
+	a, b := s.following[u], s.followers[u]
+	if len(a) > len(b) { a, b = b, a }
+	out := make([]uint64, 0, len(a))
+	for v := range a { if b.Has(v) { out = append(out, v) } }
+	return out, nil
 }
-func (g *MemGraph) DegreeIn(u uint64) int {
-	s := g.ss[h(u)]
-	s.mu.RLock(); defer s.mu.RUnlock()
-	return len(s.followers[u])
+func (g *MemGraph) AreFriends(_ context.Context, u, v uint64) (bool, error) {
+	s := g.ss[g.h(u)]
+	if err := g.rlock(s, u); err != nil { return false, err }
+	defer s.mu.RUnlock()
+	return s.following[u].Has(v) && s.followers[u].Has(v), nil
+}
+
+// -------- Half-edge primitives --------
+// In cluster mode u's following set and v's followers set may live on
+// different nodes, so each side is updated separately. Each call touches
+// only the user whose set changed.
+
+func (g *MemGraph) AddOut(u, v uint64) (bool, error) { return g.addOut(u, v, nil) }
+func (g *MemGraph) RemoveOut(u, v uint64) (bool, error) { return g.removeOut(u, v, nil) }
+
+// AddOutIf and RemoveOutIf change u's side only if u's epoch is still
+// epoch, failing with ErrEpochChanged otherwise.
+func (g *MemGraph) AddOutIf(u, v, epoch uint64) (bool, error) { return g.addOut(u, v, &epoch) }
+func (g *MemGraph) RemoveOutIf(u, v, epoch uint64) (bool, error) { return g.removeOut(u, v, &epoch) }
+
+func (g *MemGraph) addOut(u, v uint64, epoch *uint64) (bool, error) {
+	if u == v { return false, nil }
+	s := g.ss[g.h(u)]
+	s.lock(); defer s.mu.Unlock()
+	if err := g.fault(s, u); err != nil { return false, err }
+	if epoch != nil && g.epoch(u) != *epoch { return false, ErrEpochChanged }
+	if !s.link(true, u, v, g.openViews()) { return false, nil }
+	g.touch(u)
+	return true, nil
+}
+
+func (g *MemGraph) AddIn(v, u uint64) (bool, error) {
+	if u == v { return false, nil }
+	s := g.ss[g.h(v)]
+	s.lock(); defer s.mu.Unlock()
+	if err := g.fault(s, v); err != nil { return false, err }
+	if !s.link(false, v, u, g.openViews()) { return false, nil }
+	g.touch(v)
+	return true, nil
+}
+
+func (g *MemGraph) removeOut(u, v uint64, epoch *uint64) (bool, error) {
+	s := g.ss[g.h(u)]
+	s.lock(); defer s.mu.Unlock()
+	if err := g.fault(s, u); err != nil { return false, err }
+	if epoch != nil && g.epoch(u) != *epoch { return false, ErrEpochChanged }
+	if !s.unlink(true, u, v, g.openViews()) { return false, nil }
+	g.touch(u)
+	return true, nil
+}
+
+func (g *MemGraph) RemoveIn(v, u uint64) (bool, error) {
+	s := g.ss[g.h(v)]
+	s.lock(); defer s.mu.Unlock()
+	if err := g.fault(s, v); err != nil { return false, err }
+	if !s.unlink(false, v, u, g.openViews()) { return false, nil }
+	g.touch(v)
+	return true, nil
 }
 
 // Cache invalidation epochs per user
-func (g *MemGraph) TouchUsers(users ...uint64) {
+func (g *MemGraph) TouchUsers(_ context.Context, users ...uint64) error {
+	g.touch(users...)
+	return nil
+}
+func (g *MemGraph) UserEpoch(_ context.Context, u uint64) (uint64, error) { return g.epoch(u), nil }
+
+// OnTouch has fn called with every user whose epoch changes, after the
+// change. It must be set before g is in use, and fn must be quick.
+func (g *MemGraph) OnTouch(fn func(u uint64)) { g.onTouch = fn }
+
+func (g *MemGraph) touch(users ...uint64) {
 	for _, u := range users {
-		cur := g.UserEpoch(u)
+		cur := g.epoch(u)
 		g.epochs.Store(u, cur+1)
+		if g.onTouch != nil { g.onTouch(u) }
 	}
 }
-func (g *MemGraph) UserEpoch(u uint64) uint64 {
+func (g *MemGraph) epoch(u uint64) uint64 {
 	if v, ok := g.epochs.Load(u); ok {
 		return v.(uint64)
 	}
@@ -0,0 +1,318 @@
+// Package graphtest is a conformance suite for graph.Store
+// implementations. A backend's tests call it with a factory returning an
+// empty store:
+//
+//	func TestStore(t *testing.T) {
+//		graphtest.TestStore(t, func() graph.Store { return graph.NewMemGraph() })
+//	}
+package graphtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// TestStore runs every check against fresh stores from newStore.
+func TestStore(t *testing.T, newStore func() graph.Store) {
+	for _, c := range []struct {
+		name string
+		fn   func(*testing.T, store)
+	}{
+		{"FollowUnfollow", testFollowUnfollow},
+		{"SelfLoop", testSelfLoop},
+		{"Reads", testReads},
+		{"ForEachStopsEarly", testForEachStop},
+		{"SetViewsAreStable", testSetViews},
+		{"ViewsAreRepeatable", testViews},
+		{"Friends", testFriends},
+		{"Epochs", testEpochs},
+		{"ConditionalWrites", testConditional},
+		{"Transactions", testTransactions},
+		{"ExtremeIDs", testExtremeIDs},
+		{"Concurrent", testConcurrent},
+	} {
+		t.Run(c.name, func(t *testing.T) { c.fn(t, store{t, newStore()}) })
+	}
+}
+
+// store calls through to a graph.Store, failing the test on any error,
+// which keeps the checks below about results.
+type store struct {
+	t *testing.T
+	g graph.Store
+}
+
+func (s store) ok(err error) {
+	s.t.Helper()
+	if err != nil { s.t.Errorf("unexpected error: %v", err) }
+}
+
+var ctx = context.Background()
+
+func (s store) Follow(u, v uint64) bool           { ok, err := s.g.Follow(ctx, u, v); s.ok(err); return ok }
+func (s store) Unfollow(u, v uint64) bool         { ok, err := s.g.Unfollow(ctx, u, v); s.ok(err); return ok }
+func (s store) Following(u uint64) []uint64       { vs, err := s.g.Following(ctx, u); s.ok(err); return vs }
+func (s store) Followers(u uint64) []uint64       { vs, err := s.g.Followers(ctx, u); s.ok(err); return vs }
+func (s store) FollowingSet(u uint64) graph.Set   { vs, err := s.g.FollowingSet(ctx, u); s.ok(err); return vs }
+func (s store) FollowersSet(u uint64) graph.Set   { vs, err := s.g.FollowersSet(ctx, u); s.ok(err); return vs }
+func (s store) HasEdge(u, v uint64) bool          { ok, err := s.g.HasEdge(ctx, u, v); s.ok(err); return ok }
+func (s store) DegreeOut(u uint64) int            { n, err := s.g.DegreeOut(ctx, u); s.ok(err); return n }
+func (s store) DegreeIn(u uint64) int             { n, err := s.g.DegreeIn(ctx, u); s.ok(err); return n }
+func (s store) Degrees(us ...uint64) []graph.DegreeUser { ds, err := s.g.Degrees(ctx, us); s.ok(err); return ds }
+func (s store) Friends(u uint64) []uint64         { vs, err := s.g.Friends(ctx, u); s.ok(err); return vs }
+func (s store) AreFriends(u, v uint64) bool       { ok, err := s.g.AreFriends(ctx, u, v); s.ok(err); return ok }
+func (s store) TouchUsers(users ...uint64)        { s.ok(s.g.TouchUsers(ctx, users...)) }
+func (s store) UserEpoch(u uint64) uint64         { e, err := s.g.UserEpoch(ctx, u); s.ok(err); return e }
+
+// Conditional writes return their error, which the checks inspect.
+func (s store) FollowIf(u, v, e uint64) (bool, error)   { return s.g.FollowIf(ctx, u, v, e) }
+func (s store) UnfollowIf(u, v, e uint64) (bool, error) { return s.g.UnfollowIf(ctx, u, v, e) }
+
+func (s store) Apply(ops ...graph.EdgeOp) ([]bool, error)  { return s.g.Apply(ctx, ops) }
+
+func (s store) ForEachFollowing(u uint64, fn func(v uint64) bool) { s.ok(s.g.ForEachFollowing(ctx, u, fn)) }
+func (s store) ForEachFollowers(u uint64, fn func(v uint64) bool) { s.ok(s.g.ForEachFollowers(ctx, u, fn)) }
+
+func sorted(ids []uint64) []uint64 {
+	out := slices.Clone(ids)
+	slices.Sort(out)
+	return out
+}
+
+func collect(each func(u uint64, fn func(v uint64) bool), u uint64) []uint64 {
+	var out []uint64
+	each(u, func(v uint64) bool { out = append(out, v); return true })
+	return sorted(out)
+}
+
+func setIDs(s graph.Set) []uint64 {
+	var out []uint64
+	s.Each(func(v uint64) bool { out = append(out, v); return true })
+	return sorted(out)
+}
+
+func expectIDs(t *testing.T, what string, got, want []uint64) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 { return }
+	if !slices.Equal(sorted(got), sorted(want)) { t.Errorf("%s = %v, want %v", what, sorted(got), sorted(want)) }
+}
+
+func testFollowUnfollow(t *testing.T, g store) {
+	if !g.Follow(1, 2) { t.Fatal("first Follow(1,2) = false") }
+	if g.Follow(1, 2) { t.Error("repeated Follow(1,2) = true") }
+	if !g.HasEdge(1, 2) { t.Error("HasEdge(1,2) = false after Follow") }
+	if g.HasEdge(2, 1) { t.Error("HasEdge(2,1) = true; edges are directed") }
+	if !g.Unfollow(1, 2) { t.Error("Unfollow(1,2) = false") }
+	if g.Unfollow(1, 2) { t.Error("repeated Unfollow(1,2) = true") }
+	if g.Unfollow(3, 4) { t.Error("Unfollow of a missing edge = true") }
+	if g.HasEdge(1, 2) { t.Error("HasEdge(1,2) = true after Unfollow") }
+	expectIDs(t, "Following(1)", g.Following(1), nil)
+	expectIDs(t, "Followers(2)", g.Followers(2), nil)
+	if g.DegreeOut(1) != 0 || g.DegreeIn(2) != 0 { t.Error("degrees not zero after Unfollow") }
+}
+
+func testSelfLoop(t *testing.T, g store) {
+	if g.Follow(7, 7) { t.Error("Follow(7,7) = true; self-follows must be rejected") }
+	if g.HasEdge(7, 7) || g.DegreeOut(7) != 0 { t.Error("self-loop stored") }
+}
+
+func testReads(t *testing.T, g store) {
+	for _, v := range []uint64{2, 3, 4} { g.Follow(1, v) }
+	g.Follow(5, 3)
+	expectIDs(t, "Following(1)", g.Following(1), []uint64{2, 3, 4})
+	expectIDs(t, "Followers(3)", g.Followers(3), []uint64{1, 5})
+	expectIDs(t, "ForEachFollowing(1)", collect(g.ForEachFollowing, 1), []uint64{2, 3, 4})
+	expectIDs(t, "ForEachFollowers(3)", collect(g.ForEachFollowers, 3), []uint64{1, 5})
+	expectIDs(t, "FollowingSet(1)", setIDs(g.FollowingSet(1)), []uint64{2, 3, 4})
+	expectIDs(t, "FollowersSet(3)", setIDs(g.FollowersSet(3)), []uint64{1, 5})
+	if d := g.DegreeOut(1); d != 3 { t.Errorf("DegreeOut(1) = %d, want 3", d) }
+	if d := g.DegreeIn(3); d != 2 { t.Errorf("DegreeIn(3) = %d, want 2", d) }
+	if s := g.FollowingSet(1); s.Len() != 3 || !s.Has(4) || s.Has(5) { t.Error("FollowingSet(1) Len/Has wrong") }
+	want := []graph.DegreeUser{{User: 3, Followers: 2}, {User: 1, Following: 3}, {User: 99}, {User: 3, Followers: 2}}
+	if got := g.Degrees(3, 1, 99, 3); !slices.Equal(got, want) { t.Errorf("Degrees(3,1,99,3) = %v, want %v", got, want) }
+
+	// Unknown users read as empty, never nil-panicking.
+	expectIDs(t, "Following(99)", g.Following(99), nil)
+	if g.FollowersSet(99).Len() != 0 || g.DegreeIn(99) != 0 { t.Error("unknown user not empty") }
+	g.ForEachFollowing(99, func(uint64) bool { t.Error("ForEachFollowing(99) yielded"); return false })
+}
+
+func testForEachStop(t *testing.T, g store) {
+	for v := uint64(2); v < 12; v++ { g.Follow(1, v); g.Follow(v, 1) }
+	for name, each := range map[string]func(uint64, func(uint64) bool){
+		"ForEachFollowing": g.ForEachFollowing, "ForEachFollowers": g.ForEachFollowers,
+	} {
+		n := 0
+		each(1, func(uint64) bool { n++; return n < 3 })
+		if n != 3 { t.Errorf("%s called fn %d times after it returned false at 3", name, n) }
+	}
+	n := 0
+	g.FollowingSet(1).Each(func(uint64) bool { n++; return false })
+	if n != 1 { t.Errorf("Set.Each called fn %d times after false", n) }
+}
+
+func testSetViews(t *testing.T, g store) {
+	g.Follow(1, 2); g.Follow(1, 3); g.Follow(4, 2)
+	out, in := g.FollowingSet(1), g.FollowersSet(2)
+	g.Follow(1, 5); g.Unfollow(1, 2); g.Follow(6, 2)
+	expectIDs(t, "old FollowingSet(1)", setIDs(out), []uint64{2, 3})
+	expectIDs(t, "old FollowersSet(2)", setIDs(in), []uint64{1, 4})
+	expectIDs(t, "new FollowingSet(1)", setIDs(g.FollowingSet(1)), []uint64{3, 5})
+	expectIDs(t, "new FollowersSet(2)", setIDs(g.FollowersSet(2)), []uint64{4, 6})
+}
+
+// testViews checks what every backend's View promises: reads made once
+// through it keep their answers whatever is written afterwards.
+func testViews(t *testing.T, g store) {
+	g.Follow(1, 2); g.Follow(1, 3); g.Follow(2, 1)
+	v := g.g.View()
+	defer v.Close()
+	out, err := v.Following(ctx, 1)
+	g.ok(err)
+	expectIDs(t, "view Following(1)", out, []uint64{2, 3})
+	deg, err := v.DegreeOut(ctx, 1)
+	g.ok(err)
+	friends, err := v.Friends(ctx, 1)
+	g.ok(err)
+	g.Follow(1, 4); g.Unfollow(1, 2); g.Unfollow(2, 1)
+	out, err = v.Following(ctx, 1)
+	g.ok(err)
+	expectIDs(t, "view Following(1) after writes", out, []uint64{2, 3})
+	if d, err := v.DegreeOut(ctx, 1); err != nil || d != deg { t.Errorf("view DegreeOut(1) = %d, %v; want %d", d, err, deg) }
+	if has, err := v.HasEdge(ctx, 1, 4); err != nil || has { t.Errorf("view HasEdge(1,4) = %v, %v after the view was read", has, err) }
+	again, err := v.Friends(ctx, 1)
+	g.ok(err)
+	expectIDs(t, "view Friends(1) after writes", again, friends)
+	expectIDs(t, "live Following(1)", g.Following(1), []uint64{3, 4})
+}
+
+func testFriends(t *testing.T, g store) {
+	g.Follow(1, 2); g.Follow(2, 1) // mutual
+	g.Follow(1, 3)                 // one-way out
+	g.Follow(4, 1)                 // one-way in
+	expectIDs(t, "Friends(1)", g.Friends(1), []uint64{2})
+	if !g.AreFriends(1, 2) || !g.AreFriends(2, 1) { t.Error("AreFriends(1,2) = false") }
+	if g.AreFriends(1, 3) || g.AreFriends(1, 4) { t.Error("AreFriends true for a one-way edge") }
+	g.Unfollow(2, 1)
+	if g.AreFriends(1, 2) { t.Error("AreFriends(1,2) = true after unfollow") }
+}
+
+func testEpochs(t *testing.T, g store) {
+	e1, e2, e3 := g.UserEpoch(1), g.UserEpoch(2), g.UserEpoch(3)
+	g.Follow(1, 2)
+	if g.UserEpoch(1) == e1 || g.UserEpoch(2) == e2 { t.Error("Follow did not change both users' epochs") }
+	if g.UserEpoch(3) != e3 { t.Error("Follow(1,2) changed user 3's epoch") }
+
+	e1, e2 = g.UserEpoch(1), g.UserEpoch(2)
+	g.Follow(1, 2) // no-op
+	g.Unfollow(2, 1)
+	if g.UserEpoch(1) != e1 || g.UserEpoch(2) != e2 { t.Error("no-op writes changed epochs") }
+
+	g.Unfollow(1, 2)
+	if g.UserEpoch(1) == e1 || g.UserEpoch(2) == e2 { t.Error("Unfollow did not change both users' epochs") }
+
+	e3 = g.UserEpoch(3)
+	g.TouchUsers(3)
+	if g.UserEpoch(3) == e3 { t.Error("TouchUsers(3) did not change its epoch") }
+}
+
+// testConditional skips backends that answer ErrUnsupported.
+func testConditional(t *testing.T, g store) {
+	e := g.UserEpoch(1)
+	ok, err := g.FollowIf(1, 2, e)
+	if errors.Is(err, errors.ErrUnsupported) { t.Skip(err) }
+	if !ok || err != nil { t.Fatalf("FollowIf(1,2,current) = %v, %v", ok, err) }
+
+	ok, err = g.FollowIf(1, 3, e)
+	if !errors.Is(err, graph.ErrEpochChanged) { t.Errorf("FollowIf with stale epoch: err = %v, want ErrEpochChanged", err) }
+	if ok || g.HasEdge(1, 3) { t.Error("FollowIf with stale epoch wrote the edge") }
+
+	ok, err = g.UnfollowIf(1, 2, e)
+	if !errors.Is(err, graph.ErrEpochChanged) || !g.HasEdge(1, 2) { t.Errorf("UnfollowIf with stale epoch: err = %v", err) }
+
+	e = g.UserEpoch(1)
+	g.Follow(3, 1) // a new follower also advances 1's epoch
+	if _, err = g.UnfollowIf(1, 2, e); !errors.Is(err, graph.ErrEpochChanged) { t.Errorf("UnfollowIf after a new follower: err = %v", err) }
+	if ok, err = g.UnfollowIf(1, 2, g.UserEpoch(1)); !ok || err != nil || g.HasEdge(1, 2) { t.Errorf("UnfollowIf(1,2,current) = %v, %v", ok, err) }
+}
+
+func testTransactions(t *testing.T, g store) {
+	g.Follow(1, 2)
+	changed, err := g.Apply(
+		graph.EdgeOp{Op: "unfollow", Src: 1, Dst: 2},
+		graph.EdgeOp{Op: "follow", Src: 1, Dst: 3},
+		graph.EdgeOp{Op: "follow", Src: 1, Dst: 3},
+		graph.EdgeOp{Op: "follow", Src: 4, Dst: 4},
+	)
+	if err != nil { t.Fatalf("Apply: %v", err) }
+	if want := []bool{true, true, false, false}; !slices.Equal(changed, want) { t.Errorf("Apply changed = %v, want %v", changed, want) }
+	expectIDs(t, "Following(1)", g.Following(1), []uint64{3})
+	expectIDs(t, "Followers(3)", g.Followers(3), []uint64{1})
+
+	if _, err := g.Apply(graph.EdgeOp{Op: "follow", Src: 5, Dst: 6}, graph.EdgeOp{Op: "wave", Src: 5, Dst: 7}); !errors.Is(err, graph.ErrBadTx) {
+		t.Errorf("Apply with a bad op: err = %v, want ErrBadTx", err)
+	}
+	if g.HasEdge(5, 6) { t.Error("rejected transaction applied its first op") }
+
+	stale := g.UserEpoch(1)
+	g.Follow(1, 8)
+	_, err = g.Apply(graph.EdgeOp{Op: "follow", Src: 9, Dst: 1}, graph.EdgeOp{Op: "unfollow", Src: 1, Dst: 3, ExpectedEpoch: &stale})
+	if errors.Is(err, errors.ErrUnsupported) { return }
+	if !errors.Is(err, graph.ErrEpochChanged) { t.Errorf("Apply with a stale epoch: err = %v, want ErrEpochChanged", err) }
+	if g.HasEdge(9, 1) || !g.HasEdge(1, 3) { t.Error("Apply with a stale epoch wrote some ops") }
+}
+
+func testExtremeIDs(t *testing.T, g store) {
+	lo, hi := uint64(0), uint64(math.MaxUint64)
+	if !g.Follow(lo, hi) || !g.Follow(hi, lo) { t.Fatal("Follow with IDs 0 and MaxUint64 failed") }
+	if !g.HasEdge(lo, hi) || !g.AreFriends(hi, lo) { t.Error("edges between 0 and MaxUint64 lost") }
+	expectIDs(t, "Following(max)", g.Following(hi), []uint64{lo})
+}
+
+// testConcurrent races writers on overlapping users and checks the two
+// sides of every edge still agree.
+func testConcurrent(t *testing.T, g store) {
+	const workers, users, rounds = 8, 64, 2000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			x := uint64(w)*0x9e3779b97f4a7c15 + 1
+			for i := 0; i < rounds; i++ {
+				x ^= x << 13; x ^= x >> 7; x ^= x << 17
+				u, v := x%users, (x>>32)%users
+				switch i % 4 {
+				case 0, 1:
+					g.Follow(u, v)
+				case 2:
+					g.Unfollow(u, v)
+				default:
+					g.FollowingSet(u).Len()
+					g.ForEachFollowers(v, func(uint64) bool { return true })
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	in := make(map[uint64][]uint64)
+	for u := uint64(0); u < users; u++ {
+		out := g.Following(u)
+		if len(out) != g.DegreeOut(u) { t.Errorf("DegreeOut(%d) = %d, Following has %d", u, g.DegreeOut(u), len(out)) }
+		for _, v := range out {
+			if !g.HasEdge(u, v) { t.Errorf("HasEdge(%d,%d) = false for a listed edge", u, v) }
+			in[v] = append(in[v], u)
+		}
+	}
+	for v := uint64(0); v < users; v++ {
+		expectIDs(t, fmt.Sprintf("Followers(%d)", v), g.Followers(v), in[v])
+	}
+}
@@ -0,0 +1,114 @@
+package graph
+
+import "time"
+
+// -------- Integrity checking --------
+// Every edge is stored twice, in following[u] and followers[v], usually on
+// different shards. A bug, a crash mid-write or a bad snapshot can leave
+// one half without the other; CheckIntegrity finds such half-edges.
+
+// Asymmetry is a half-edge whose other half is missing: Missing "in"
+// means following[Src] holds Dst but followers[Dst] lacks Src, "out" the
+// reverse.
+type Asymmetry struct {
+	Src     uint64 `json:"src"`
+	Dst     uint64 `json:"dst"`
+	Missing string `json:"missing"`
+}
+
+type IntegrityReport struct {
+	HalfEdges  int           `json:"half_edges"` // checked, both directions
+	MissingIn  int           `json:"missing_in"`
+	MissingOut int           `json:"missing_out"`
+	Repaired   int           `json:"repaired"`
+	Sample     []Asymmetry   `json:"sample"` // first few found
+	Took       time.Duration `json:"-"`
+}
+
+// integritySample bounds IntegrityReport.Sample.
+const integritySample = 100
+
+// CheckIntegrity verifies that the two halves of every edge agree. With
+// repair set, following is taken as authoritative, as it is the half
+// written first: a missing followers entry is added and an orphaned one
+// removed, touching both users.
+//
+// Shards are scanned one at a time under their read lock, so a check
+// never holds two shard locks at once; a suspect edge is then re-checked
+// under both shards' write locks, which drops ones that were just being
+// written (and pages in a spilled user whose half was not in memory).
+// Only resident users' sets are scanned; a spilled user's edges are still
+// checked from the other side. A user that cannot be paged in ends the
+// check with the report so far and the error.
+func (g *MemGraph) CheckIntegrity(repair bool) (IntegrityReport, error) {
+	start := time.Now()
+	var rep IntegrityReport
+	type half struct{ u, v uint64 }
+	for _, out := range []bool{true, false} {
+		for _, s := range g.ss {
+			// Collect the shard's half-edges by the shard holding the
+			// other half.
+			far := make([][]half, len(g.ss))
+			s.mu.RLock()
+			m := s.followers
+			if out { m = s.following }
+			for u, set := range m {
+				for v := range set { far[g.h(v)] = append(far[g.h(v)], half{u, v}) }
+			}
+			s.mu.RUnlock()
+
+			for i, hs := range far {
+				if len(hs) == 0 { continue }
+				rep.HalfEdges += len(hs)
+				o := g.ss[i]
+				var suspects []half
+				o.mu.RLock()
+				for _, e := range hs {
+					if !o.has(!out, e.v, e.u) { suspects = append(suspects, e) }
+				}
+				o.mu.RUnlock()
+				for _, e := range suspects {
+					src, dst := e.u, e.v
+					if !out { src, dst = e.v, e.u }
+					found, err := g.confirmAsymmetry(src, dst, out, repair)
+					if err != nil { rep.Took = time.Since(start); return rep, err }
+					if found {
+						if out { rep.MissingIn++ } else { rep.MissingOut++ }
+						if repair { rep.Repaired++ }
+						if len(rep.Sample) < integritySample {
+							miss := "in"
+							if !out { miss = "out" }
+							rep.Sample = append(rep.Sample, Asymmetry{src, dst, miss})
+						}
+					}
+				}
+			}
+		}
+	}
+	rep.Took = time.Since(start)
+	return rep, nil
+}
+
+// has reports whether u's following (out) or followers set holds v.
+// s.mu must be held.
+func (s *shard) has(out bool, u, v uint64) bool {
+	if out { return s.following[u].Has(v) }
+	return s.followers[u].Has(v)
+}
+
+// confirmAsymmetry re-checks edge src->dst under both shards' locks: with
+// outPresent, following[src] holds dst but followers[dst] lacks src;
+// otherwise followers[dst] holds src but following[src] lacks dst.
+func (g *MemGraph) confirmAsymmetry(src, dst uint64, outPresent, repair bool) (bool, error) {
+	su, sv, unlock, err := g.lockPair(src, dst)
+	if err != nil { return false, err }
+	defer unlock()
+	hasOut, hasIn := su.following[src].Has(dst), sv.followers[dst].Has(src)
+	if hasOut == hasIn || hasOut != outPresent { return false, nil }
+	if repair {
+		vs := g.openViews()
+		if hasOut { sv.link(false, dst, src, vs) } else { sv.unlink(false, dst, src, vs) }
+		g.touch(src, dst)
+	}
+	return true, nil
+}
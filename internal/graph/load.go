@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// -------- Parallel bulk loading --------
+// LoadEdges adds many follows as one step, like Apply: every shard the
+// edges touch is write-locked, in shard order, for the whole batch, so
+// readers (and Views) never see it half-applied. Inside the batch the
+// edges are partitioned by shard and the shards written concurrently,
+// each by one of up to workers goroutines that owns it outright: first
+// the following halves, partitioned by source shard, then the followers
+// halves of the edges that were new, by destination shard. No two
+// goroutines ever touch the same shard, so the writers never contend.
+//
+// Meant for imports into graphs without journaling or other wrappers,
+// such as a staged bulk load (see tenant.Load): it bypasses any Store
+// wrapping g. Self-loops are skipped. It returns how many edges were new;
+// when a spilled user cannot be paged in, nothing is loaded.
+func (g *MemGraph) LoadEdges(edges [][2]uint64, workers int) (int, error) {
+	if workers < 1 { workers = 1 }
+	bySrc := make([][]int, len(g.ss))
+	locked := make([]bool, len(g.ss))
+	for i, e := range edges {
+		if e[0] == e[1] { continue }
+		su, sv := g.h(e[0]), g.h(e[1])
+		bySrc[su] = append(bySrc[su], i)
+		locked[su], locked[sv] = true, true
+	}
+	for i, s := range g.ss {
+		if locked[i] { s.lock() }
+	}
+	defer func() {
+		for i := len(g.ss) - 1; i >= 0; i-- {
+			if locked[i] { g.ss[i].mu.Unlock() }
+		}
+	}()
+	if g.sp != nil {
+		for _, idx := range bySrc {
+			for _, i := range idx {
+				u, v := edges[i][0], edges[i][1]
+				if err := g.fault(g.ss[g.h(u)], u); err != nil { return 0, err }
+				if err := g.fault(g.ss[g.h(v)], v); err != nil { return 0, err }
+			}
+		}
+	}
+	vs := g.openViews()
+	added := make([]bool, len(edges))
+	eachShard(bySrc, workers, func(sh int, idx []int) {
+		s := g.ss[sh]
+		for _, i := range idx { added[i] = s.link(true, edges[i][0], edges[i][1], vs) }
+	})
+	byDst := make([][]int, len(g.ss))
+	n := 0
+	var touched []uint64
+	for i, ok := range added {
+		if !ok { continue }
+		n++
+		v := edges[i][1]
+		byDst[g.h(v)] = append(byDst[g.h(v)], i)
+		touched = append(touched, edges[i][0], v)
+	}
+	eachShard(byDst, workers, func(sh int, idx []int) {
+		s := g.ss[sh]
+		for _, i := range idx { s.link(false, edges[i][1], edges[i][0], vs) }
+	})
+	g.touch(touched...)
+	return n, nil
+}
+
+// eachShard calls fn for every shard with work in parts, from up to
+// workers goroutines, each taking whole shards.
+func eachShard(parts [][]int, workers int, fn func(sh int, idx []int)) {
+	busy := 0
+	for _, p := range parts {
+		if len(p) > 0 { busy++ }
+	}
+	workers = min(workers, busy)
+	if workers <= 1 {
+		for sh, p := range parts {
+			if len(p) > 0 { fn(sh, p) }
+		}
+		return
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				sh := int(next.Add(1) - 1)
+				if sh >= len(parts) { return }
+				if len(parts[sh]) > 0 { fn(sh, parts[sh]) }
+			}
+		}()
+	}
+	wg.Wait()
+}
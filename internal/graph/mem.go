@@ -0,0 +1,72 @@
+package graph
+
+import "runtime"
+
+// -------- Memory introspection --------
+
+// Rough per-entry costs of Go maps (key, value, tophash and bucket
+// overhead at typical load); good enough to spot bloat, not exact.
+const (
+	outerEntryBytes = 8 + 8 + 32 // uint64 -> map pointer, plus the set header
+	setEntryBytes   = 8 + 4       // uint64 key, zero-size value, overhead
+)
+
+type ShardStats struct {
+	Shard          int   `json:"shard"`
+	FollowingUsers int   `json:"following_users"`
+	FollowerUsers  int   `json:"follower_users"`
+	Edges          int   `json:"edges"`
+	ResidentUsers  int   `json:"resident_users"` // with a set in memory (hot)
+	SpilledUsers   int   `json:"spilled_users"`  // with their sets in the spill file (cold)
+	EstBytes       int64 `json:"est_bytes"`
+}
+
+// MemStats reports map sizes and estimated live bytes per shard.
+func (g *MemGraph) MemStats() []ShardStats {
+	out := make([]ShardStats, len(g.ss))
+	for i, s := range g.ss {
+		s.mu.RLock()
+		st := ShardStats{Shard: i, FollowingUsers: len(s.following), FollowerUsers: len(s.followers), SpilledUsers: len(s.spilled)}
+		in := 0
+		st.ResidentUsers = len(s.following)
+		for _, set := range s.following { st.Edges += len(set) }
+		for u, set := range s.followers {
+			in += len(set)
+			if _, ok := s.following[u]; !ok { st.ResidentUsers++ }
+		}
+		s.mu.RUnlock()
+		st.EstBytes = int64(st.FollowingUsers+st.FollowerUsers)*outerEntryBytes + int64(st.Edges+in)*setEntryBytes
+		out[i] = st
+	}
+	return out
+}
+
+// Compact rebuilds every shard's maps at their current size. Go maps never
+// release buckets after deletions, so after mass unfollows this is the
+// only way to return that memory. Each shard is write-locked only while
+// it is copied.
+func (g *MemGraph) Compact() {
+	for _, s := range g.ss {
+		s.lock()
+		s.following = compactMap(s.following)
+		s.followers = compactMap(s.followers)
+		s.shared = make(map[uint64]uint8) // every set is a fresh copy now
+		if s.spilled != nil {
+			sp := make(map[uint64]spillRef, len(s.spilled))
+			for u, r := range s.spilled { sp[u] = r }
+			s.spilled = sp
+		}
+		s.mu.Unlock()
+	}
+	runtime.GC()
+}
+
+func compactMap(m map[uint64]uint64Set) map[uint64]uint64Set {
+	out := make(map[uint64]uint64Set, len(m))
+	for u, set := range m {
+		c := make(uint64Set, len(set))
+		for v := range set { c.Add(v) }
+		out[u] = c
+	}
+	return out
+}
@@ -0,0 +1,12 @@
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/graph/graphtest"
+)
+
+func TestMemGraph(t *testing.T) {
+	graphtest.TestStore(t, func() graph.Store { return graph.NewMemGraph() })
+}
@@ -0,0 +1,281 @@
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// -------- Snapshot format --------
+// magic "SGS2", then uvarint(version) uvarint(sections), then one section
+// per shard:
+//
+//	uvarint(users) uvarint(edges) uvarint(len) payload crc32c(payload)
+//
+// where the payload holds one record per user with outgoing edges,
+// uvarint(user) uvarint(n) n×uvarint(dst), and the CRC is 4 bytes little
+// endian. A trailer closes the file: "SGSE", the total users and edges as
+// 8-byte little-endian integers and the crc32c of those 16 bytes.
+// Follower sets are derived on restore.
+//
+// Version 1 files ("SGS1", the records alone) are still read, but only a
+// record cut off mid-way can be detected in them.
+var (
+	snapMagic   = [4]byte{'S', 'G', 'S', '2'}
+	snapMagicV1 = [4]byte{'S', 'G', 'S', '1'}
+	snapTrailer = [4]byte{'S', 'G', 'S', 'E'}
+	crcTable    = crc32.MakeTable(crc32.Castagnoli)
+)
+
+const snapVersion = 2
+
+var (
+	ErrBadSnapshot     = errors.New("graph: not a snapshot")
+	ErrCorruptSnapshot = errors.New("graph: corrupt snapshot")
+)
+
+// WriteSnapshot streams all edges to w, one shard at a time under its read
+// lock. Concurrent writes to other shards may or may not be included.
+func (g *MemGraph) WriteSnapshot(w io.Writer) error {
+	bw := bufio.NewWriterSize(w, 1<<16)
+	if _, err := bw.Write(snapMagic[:]); err != nil { return err }
+	var buf [binary.MaxVarintLen64]byte
+	put := func(w io.Writer, x uint64) error {
+		n := binary.PutUvarint(buf[:], x)
+		_, err := w.Write(buf[:n])
+		return err
+	}
+	if err := put(bw, snapVersion); err != nil { return err }
+	if err := put(bw, uint64(len(g.ss))); err != nil { return err }
+	var payload bytes.Buffer
+	var totalUsers, totalEdges uint64
+	for _, s := range g.ss {
+		payload.Reset()
+		var users, edges uint64
+		record := func(u uint64, n int, each func(fn func(v uint64))) {
+			users++
+			edges += uint64(n)
+			put(&payload, u)
+			put(&payload, uint64(n))
+			each(func(v uint64) { put(&payload, v) })
+		}
+		s.mu.RLock()
+		for u, fset := range s.following {
+			record(u, len(fset), func(fn func(v uint64)) { for v := range fset { fn(v) } })
+		}
+		for u, ref := range s.spilled {
+			outs, err := g.spilledOut(ref)
+			if err != nil { s.mu.RUnlock(); return err }
+			if len(outs) == 0 { continue }
+			record(u, len(outs), func(fn func(v uint64)) { for _, v := range outs { fn(v) } })
+		}
+		s.mu.RUnlock()
+		totalUsers += users
+		totalEdges += edges
+		for _, x := range []uint64{users, edges, uint64(payload.Len())} {
+			if err := put(bw, x); err != nil { return err }
+		}
+		if _, err := bw.Write(payload.Bytes()); err != nil { return err }
+		if err := binary.Write(bw, binary.LittleEndian, crc32.Checksum(payload.Bytes(), crcTable)); err != nil { return err }
+	}
+	var tr [16]byte
+	binary.LittleEndian.PutUint64(tr[:8], totalUsers)
+	binary.LittleEndian.PutUint64(tr[8:], totalEdges)
+	if _, err := bw.Write(snapTrailer[:]); err != nil { return err }
+	if _, err := bw.Write(tr[:]); err != nil { return err }
+	if err := binary.Write(bw, binary.LittleEndian, crc32.Checksum(tr[:], crcTable)); err != nil { return err }
+	return bw.Flush()
+}
+
+// ReadSnapshot replaces g's contents with the snapshot in r. Every
+// restored user's epoch is bumped so cached results are invalidated.
+// The whole file is verified before anything is replaced: a truncated or
+// corrupt one fails with ErrCorruptSnapshot and leaves g as it was.
+func (g *MemGraph) ReadSnapshot(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 1<<16)
+	var m [4]byte
+	if _, err := io.ReadFull(br, m[:]); err != nil { return ErrBadSnapshot }
+	fresh := NewMemGraphShards(len(g.ss)) // any snapshot, whatever its section count
+	var err error
+	switch m {
+	case snapMagic:
+		err = readSnapshotV2(br, fresh)
+	case snapMagicV1:
+		if err = readRecords(br, fresh, nil); err != nil { err = corrupt("%v", err) }
+	default:
+		return ErrBadSnapshot
+	}
+	if err != nil { return err }
+	g.swap(fresh)
+	return nil
+}
+
+func corrupt(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrCorruptSnapshot}, args...)...)
+}
+
+// truncated reports a read error, io.EOF included, as a corrupt snapshot.
+func truncated(where string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF { return corrupt("%s: truncated", where) }
+	return fmt.Errorf("graph: snapshot: %s: %w", where, err)
+}
+
+func readSnapshotV2(br *bufio.Reader, fresh *MemGraph) error {
+	version, err := binary.ReadUvarint(br)
+	if err != nil { return truncated("header", err) }
+	if version != snapVersion { return fmt.Errorf("graph: snapshot version %d not supported", version) }
+	sections, err := binary.ReadUvarint(br)
+	if err != nil { return truncated("header", err) }
+	var totalUsers, totalEdges uint64
+	for i := uint64(0); i < sections; i++ {
+		where := fmt.Sprintf("section %d of %d", i+1, sections)
+		var hdr [3]uint64 // users, edges, len
+		for j := range hdr {
+			if hdr[j], err = binary.ReadUvarint(br); err != nil { return truncated(where, err) }
+		}
+		crc := crc32.New(crcTable)
+		lr := &io.LimitedReader{R: br, N: int64(hdr[2])}
+		if hdr[2] > 1<<62 { return corrupt("%s: bad length", where) }
+		var counts [2]uint64
+		if err := readRecords(bufio.NewReader(io.TeeReader(lr, crc)), fresh, &counts); err != nil {
+			return corrupt("%s: %v", where, err)
+		}
+		if lr.N > 0 { return corrupt("%s: truncated", where) }
+		var sum uint32
+		if err := binary.Read(br, binary.LittleEndian, &sum); err != nil { return truncated(where, err) }
+		if sum != crc.Sum32() { return corrupt("%s: checksum mismatch", where) }
+		if counts != [2]uint64{hdr[0], hdr[1]} {
+			return corrupt("%s: holds %d users and %d edges, header says %d and %d", where, counts[0], counts[1], hdr[0], hdr[1])
+		}
+		totalUsers += counts[0]
+		totalEdges += counts[1]
+	}
+	var m [4]byte
+	if _, err := io.ReadFull(br, m[:]); err != nil { return truncated("trailer", err) }
+	if m != snapTrailer { return corrupt("trailer missing") }
+	var tr [16]byte
+	var sum uint32
+	if _, err := io.ReadFull(br, tr[:]); err != nil { return truncated("trailer", err) }
+	if err := binary.Read(br, binary.LittleEndian, &sum); err != nil { return truncated("trailer", err) }
+	if sum != crc32.Checksum(tr[:], crcTable) { return corrupt("trailer checksum mismatch") }
+	if u, e := binary.LittleEndian.Uint64(tr[:8]), binary.LittleEndian.Uint64(tr[8:]); u != totalUsers || e != totalEdges {
+		return corrupt("holds %d users and %d edges, trailer says %d and %d", totalUsers, totalEdges, u, e)
+	}
+	if _, err := br.ReadByte(); err != io.EOF { return corrupt("data after the trailer") }
+	return nil
+}
+
+func errCutShort(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF { return errors.New("record cut short") }
+	return err
+}
+
+// readRecords adds the user records in r to fresh until r ends, counting
+// users and edges into counts when given.
+func readRecords(r *bufio.Reader, fresh *MemGraph, counts *[2]uint64) error {
+	for {
+		u, err := binary.ReadUvarint(r)
+		if err == io.EOF { return nil }
+		if err != nil { return errCutShort(err) }
+		n, err := binary.ReadUvarint(r)
+		if err != nil { return errCutShort(err) }
+		for i := uint64(0); i < n; i++ {
+			v, err := binary.ReadUvarint(r)
+			if err != nil { return errCutShort(err) }
+			fresh.addEdgeUnlocked(u, v)
+		}
+		if counts != nil { counts[0]++; counts[1] += n }
+	}
+}
+
+// addEdgeUnlocked inserts u->v without locking or epoch bumps; only for
+// graphs not yet visible to other goroutines.
+func (g *MemGraph) addEdgeUnlocked(u, v uint64) {
+	g.ss[g.h(u)].link(true, u, v, nil)
+	g.ss[g.h(v)].link(false, v, u, nil)
+}
+
+// Replace installs fresh's contents into g in one step, as ReadSnapshot
+// does with a restored file: readers see all of the old graph or all of
+// the new one. fresh must have g's shard count and must not be used
+// afterwards.
+func (g *MemGraph) Replace(fresh *MemGraph) error {
+	if len(fresh.ss) != len(g.ss) { return fmt.Errorf("graph: replace: %d shards into %d", len(fresh.ss), len(g.ss)) }
+	g.swap(fresh)
+	return nil
+}
+
+// swap installs fresh's shard contents into g with every shard write
+// locked at once, and bumps the epoch of every user present before or
+// after. Open views are detached onto the replaced maps (see view.go).
+func (g *MemGraph) swap(fresh *MemGraph) {
+	touched := make([]uint64, 0, 1024)
+	g.vmu.Lock() // no view opens or closes meanwhile
+	for _, s := range g.ss { s.mu.Lock() }
+	vs := g.openViews()
+	var old []shardMaps
+	if len(vs) > 0 { old = make([]shardMaps, len(g.ss)) }
+	for i, s := range g.ss {
+		f := fresh.ss[i]
+		if old != nil { old[i] = shardMaps{s.following, s.followers, s.spilled} }
+		for u := range s.following { touched = append(touched, u) }
+		for u := range s.followers { touched = append(touched, u) }
+		for u := range s.spilled { touched = append(touched, u) }
+		s.following, s.followers, s.shared = f.following, f.followers, f.shared
+		s.outDeg, s.inDeg = f.outDeg, f.inDeg
+		s.frz.Store(nil) // reads fall back to the new maps until the next Freeze
+		if s.spilled != nil {
+			metrics.SpilledUsers.Sub(float64(len(s.spilled)))
+			for _, ref := range s.spilled { g.sp.live.Add(-int64(ref.n)) }
+			s.spilled = make(map[uint64]spillRef)
+			s.amu.Lock()
+			s.access = make(map[uint64]uint32)
+			s.amu.Unlock()
+		}
+		for u := range s.following { touched = append(touched, u) }
+		for u := range s.followers { touched = append(touched, u) }
+	}
+	for _, v := range vs { v.old.Store(&old) }
+	g.views.Store(nil) // writes to the new maps are not theirs to undo
+	for i := len(g.ss) - 1; i >= 0; i-- { g.ss[i].mu.Unlock() }
+	g.vmu.Unlock()
+	g.touch(touched...)
+}
+
+// EachEdge calls fn for every edge u->v until it returns false. Each
+// shard's edges are copied under its read lock and fn runs unlocked, so
+// fn may be slow (e.g. write to a client); edges written meanwhile to
+// shards not yet visited may or may not be included.
+func (g *MemGraph) EachEdge(fn func(u, v uint64) bool) error {
+	type out struct {
+		u  uint64
+		vs []uint64
+	}
+	for _, s := range g.ss {
+		s.mu.RLock()
+		batch := make([]out, 0, len(s.following)+len(s.spilled))
+		for u, fset := range s.following {
+			vs := make([]uint64, 0, len(fset))
+			for v := range fset { vs = append(vs, v) }
+			batch = append(batch, out{u, vs})
+		}
+		for u, ref := range s.spilled {
+			vs, err := g.spilledOut(ref)
+			if err != nil { s.mu.RUnlock(); return err }
+			if len(vs) > 0 { batch = append(batch, out{u, vs}) }
+		}
+		s.mu.RUnlock()
+		for _, o := range batch {
+			for _, v := range o.vs {
+				if !fn(o.u, v) { return nil }
+			}
+		}
+	}
+	return nil
+}
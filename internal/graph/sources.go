@@ -0,0 +1,142 @@
+package graph
+
+import (
+	"context"
+	"regexp"
+	"sync"
+)
+
+// -------- Follow attribution --------
+// Sources remembers where each follow came from (pymk, search, import...),
+// so follows can be counted by origin. The names are interned: an edge
+// costs one map entry holding a byte.
+
+// MaxSources bounds the distinct source names; later new names are
+// recorded as "other".
+const MaxSources = 255
+
+var validSource = regexp.MustCompile(`^[a-z0-9_.-]{1,32}$`)
+
+// ValidSource reports whether name may be used as a follow source.
+func ValidSource(name string) bool { return validSource.MatchString(name) }
+
+type sourceKey struct{}
+
+// WithSource tags writes made with ctx as coming from source.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFrom returns the source set by WithSource, or "".
+func SourceFrom(ctx context.Context) string {
+	s, _ := ctx.Value(sourceKey{}).(string)
+	return s
+}
+
+type Sources struct {
+	nmu   sync.RWMutex
+	names []string // id-1 -> name
+	ids   map[string]uint8
+
+	ss [stripes]struct {
+		mu sync.RWMutex
+		m  map[[2]uint64]uint8
+	}
+}
+
+func NewSources() *Sources {
+	s := &Sources{ids: make(map[string]uint8)}
+	for i := range s.ss { s.ss[i].m = make(map[[2]uint64]uint8) }
+	return s
+}
+
+func (s *Sources) intern(name string) uint8 {
+	s.nmu.RLock()
+	id, ok := s.ids[name]
+	s.nmu.RUnlock()
+	if ok { return id }
+	s.nmu.Lock(); defer s.nmu.Unlock()
+	if id, ok := s.ids[name]; ok { return id }
+	if len(s.names) >= MaxSources-1 { // keep the last ID for "other"
+		name = "other"
+		if id, ok := s.ids[name]; ok { return id }
+	}
+	s.names = append(s.names, name)
+	id = uint8(len(s.names))
+	s.ids[name] = id
+	return id
+}
+
+// Set records source for edge u->v.
+func (s *Sources) Set(u, v uint64, source string) {
+	id := s.intern(source)
+	sh := &s.ss[stripe(u)]
+	sh.mu.Lock()
+	sh.m[[2]uint64{u, v}] = id
+	sh.mu.Unlock()
+}
+
+func (s *Sources) Del(u, v uint64) {
+	sh := &s.ss[stripe(u)]
+	sh.mu.Lock()
+	delete(sh.m, [2]uint64{u, v})
+	sh.mu.Unlock()
+}
+
+// Get returns the source of edge u->v, or "" when none was given.
+func (s *Sources) Get(u, v uint64) string {
+	sh := &s.ss[stripe(u)]
+	sh.mu.RLock()
+	id := sh.m[[2]uint64{u, v}]
+	sh.mu.RUnlock()
+	if id == 0 { return "" }
+	s.nmu.RLock(); defer s.nmu.RUnlock()
+	return s.names[id-1]
+}
+
+// -------- Store wrapper --------
+// sourceStore records the source in each write's context for the follows
+// it makes, and forgets it for the follows it removes.
+type sourceStore struct {
+	Store
+	s *Sources
+}
+
+func TrackSources(g Store, s *Sources) Store { return &sourceStore{Store: g, s: s} }
+
+func (t *sourceStore) followed(ctx context.Context, u, v uint64) {
+	if src := SourceFrom(ctx); src != "" { t.s.Set(u, v, src) }
+}
+
+func (t *sourceStore) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := t.Store.Follow(ctx, u, v)
+	if ok { t.followed(ctx, u, v) }
+	return ok, err
+}
+
+func (t *sourceStore) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := t.Store.Unfollow(ctx, u, v)
+	if ok { t.s.Del(u, v) }
+	return ok, err
+}
+
+func (t *sourceStore) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := t.Store.FollowIf(ctx, u, v, epoch)
+	if ok { t.followed(ctx, u, v) }
+	return ok, err
+}
+
+func (t *sourceStore) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := t.Store.UnfollowIf(ctx, u, v, epoch)
+	if ok { t.s.Del(u, v) }
+	return ok, err
+}
+
+func (t *sourceStore) Apply(ctx context.Context, ops []EdgeOp) ([]bool, error) {
+	changed, err := t.Store.Apply(ctx, ops)
+	for i, ok := range changed {
+		if !ok { continue }
+		if ops[i].Op == "follow" { t.followed(ctx, ops[i].Src, ops[i].Dst) } else { t.s.Del(ops[i].Src, ops[i].Dst) }
+	}
+	return changed, err
+}
@@ -0,0 +1,330 @@
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// -------- Hot/cold tiering --------
+// With spilling enabled, a memory manager can demote the adjacency sets of
+// users to an append-only file: the least recently accessed ones under
+// memory pressure (EvictCold), and those idle for a while regardless
+// (DemoteIdle). There each set is stored sorted and delta-encoded. Any
+// access to a cold user promotes its sets back under the shard's write
+// lock, so callers never see the difference (other than latency).
+// Records of promoted users are dead space until CompactSpill rewrites
+// the live ones into a fresh file.
+
+type spillRef struct {
+	off int64
+	n   int32
+	gen uint32 // which file: compaction moves records to a newer one
+}
+
+type spillFile struct {
+	mu    sync.Mutex // serializes appends and file switches; reads use ReadAt
+	dir   string
+	f     *os.File // appended to
+	gen   uint32
+	files map[uint32]*os.File // by generation: f, plus any still being compacted away
+	size  int64 // of f
+	live  atomic.Int64 // bytes of records not yet loaded back, in any file; the rest is dead space
+	cmu   sync.Mutex // one compaction at a time
+}
+
+// accessTick is a coarse clock, in seconds since clockStart, advanced by
+// TickAccess, so an access records when it happened without calling
+// time.Now. Users not accessed since spilling was enabled count as seen at
+// the start.
+var (
+	accessTick atomic.Uint32
+	clockStart = time.Now()
+)
+
+// TickAccess advances the access clock; the memory manager calls it
+// every second.
+func TickAccess() { accessTick.Store(uint32(time.Since(clockStart) / time.Second)) }
+
+// EnableSpill turns on offloading for g, backed by a fresh file in dir.
+// Call before g is shared.
+func (g *MemGraph) EnableSpill(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+	f, err := os.CreateTemp(dir, "graph-*.spill")
+	if err != nil { return err }
+	_ = os.Remove(f.Name()) // anonymous: reclaimed when the process exits
+	g.sp = &spillFile{dir: dir, f: f, files: map[uint32]*os.File{0: f}}
+	for _, s := range g.ss {
+		s.spilled = make(map[uint64]spillRef)
+		s.access = make(map[uint64]uint32)
+	}
+	return nil
+}
+
+// rlock read-locks s with u's sets resident and records the access. When
+// u cannot be paged in, it returns the error with s unlocked.
+func (g *MemGraph) rlock(s *shard, u uint64) error {
+	s.rLock()
+	if g.sp == nil { return nil }
+	for {
+		if _, out := s.spilled[u]; !out { break }
+		s.mu.RUnlock()
+		s.lock()
+		err := g.fault(s, u)
+		s.mu.Unlock()
+		if err != nil { return err }
+		s.rLock()
+	}
+	s.amu.Lock()
+	s.access[u] = accessTick.Load()
+	s.amu.Unlock()
+	return nil
+}
+
+// ErrSpillRead wraps failures to read a spilled user back. The file is
+// private to this process, so such a user's edges are unreachable: every
+// request touching it fails (503 over HTTP) rather than answering
+// without them, while the rest of the graph keeps serving.
+var ErrSpillRead = fmt.Errorf("%w: spill file read failed", ErrUnavailable)
+
+// fault reloads u's sets if they were spilled and records the access.
+// s.mu must be held for writing. On a read error u stays spilled.
+func (g *MemGraph) fault(s *shard, u uint64) error {
+	if g.sp == nil { return nil }
+	if ref, out := s.spilled[u]; out {
+		outs, ins, err := g.sp.read(ref)
+		if err != nil {
+			metrics.SpillEvents.WithLabelValues("error").Inc()
+			return fmt.Errorf("%w: user %d: %v", ErrSpillRead, u, err)
+		}
+		delete(s.spilled, u)
+		g.sp.live.Add(-int64(ref.n))
+		if len(outs) > 0 { s.following[u] = outs }
+		if len(ins) > 0 { s.followers[u] = ins }
+		metrics.SpillEvents.WithLabelValues("load").Inc()
+		metrics.SpilledUsers.Dec()
+	}
+	s.amu.Lock()
+	s.access[u] = accessTick.Load()
+	s.amu.Unlock()
+	return nil
+}
+
+// EvictCold spills the least recently accessed users until roughly want
+// bytes (by the MemStats estimate) are released, and returns the
+// estimate actually released. Users accessed in the current second stay.
+// It is a no-op unless spilling is enabled.
+func (g *MemGraph) EvictCold(want int64) (int64, error) {
+	if g.sp == nil || want <= 0 { return 0, nil }
+	per := want/int64(len(g.ss)) + 1
+	var freed int64
+	for _, s := range g.ss {
+		n, _, err := g.evictShard(s, per, accessTick.Load())
+		freed += n
+		if err != nil { return freed, err }
+	}
+	return freed, nil
+}
+
+// DemoteIdle spills every user not accessed for idle, and returns how many
+// it spilled and the estimated bytes released. It is a no-op unless
+// spilling is enabled.
+func (g *MemGraph) DemoteIdle(idle time.Duration) (int, int64, error) {
+	now, secs := accessTick.Load(), uint32(idle/time.Second)
+	if g.sp == nil || now < secs { return 0, 0, nil }
+	var users int
+	var freed int64
+	for _, s := range g.ss {
+		n, u, err := g.evictShard(s, math.MaxInt64, now-secs)
+		freed += n
+		users += u
+		if err != nil { return users, freed, err }
+	}
+	return users, freed, nil
+}
+
+// evictShard spills users of s last seen before tick, oldest first, until
+// roughly want bytes are released.
+func (g *MemGraph) evictShard(s *shard, want int64, before uint32) (int64, int, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	type cand struct {
+		u    uint64
+		seen uint32
+	}
+	cs := make([]cand, 0, len(s.following)+len(s.followers))
+	s.amu.Lock()
+	add := func(u uint64) {
+		seen, ok := s.access[u]
+		if ok && seen >= before { return } // hot
+		cs = append(cs, cand{u, seen})
+	}
+	for u := range s.following { add(u) }
+	for u := range s.followers {
+		if _, dup := s.following[u]; !dup { add(u) }
+	}
+	s.amu.Unlock()
+	sort.Slice(cs, func(i, j int) bool { return cs[i].seen < cs[j].seen })
+
+	var freed int64
+	var users int
+	for _, c := range cs {
+		if freed >= want { break }
+		outs, ins := s.following[c.u], s.followers[c.u]
+		ref, err := g.sp.write(outs, ins)
+		if err != nil { return freed, users, err }
+		s.spilled[c.u] = ref
+		delete(s.following, c.u)
+		delete(s.followers, c.u)
+		s.amu.Lock()
+		delete(s.access, c.u)
+		delete(s.shared, c.u) // views keep the old sets; reloads are fresh
+		s.amu.Unlock()
+		freed += 2*outerEntryBytes + int64(len(outs)+len(ins))*setEntryBytes
+		users++
+		metrics.SpillEvents.WithLabelValues("evict").Inc()
+		metrics.SpilledUsers.Inc()
+	}
+	return freed, users, nil
+}
+
+// spilledOut returns u's spilled following set, for snapshots. s.mu must
+// be held.
+func (g *MemGraph) spilledOut(ref spillRef) ([]uint64, error) {
+	outs, _, err := g.sp.read(ref)
+	if err != nil { return nil, err }
+	ids := make([]uint64, 0, len(outs))
+	for v := range outs { ids = append(ids, v) }
+	return ids, nil
+}
+
+// Record: uvarint(len(out)) out... uvarint(len(in)) in..., each set in
+// ascending order as uvarint gaps from the previous ID (the first from 0),
+// so clustered IDs take a byte or two each.
+func (f *spillFile) write(outs, ins uint64Set) (spillRef, error) {
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	put := func(x uint64) { buf.Write(tmp[:binary.PutUvarint(tmp[:], x)]) }
+	var ids []uint64
+	for _, set := range []uint64Set{outs, ins} {
+		put(uint64(len(set)))
+		ids = ids[:0]
+		for v := range set { ids = append(ids, v) }
+		slices.Sort(ids)
+		prev := uint64(0)
+		for _, v := range ids { put(v - prev); prev = v }
+	}
+	return f.append(buf.Bytes())
+}
+
+// append writes an encoded record at the end of the current file.
+func (f *spillFile) append(rec []byte) (spillRef, error) {
+	f.mu.Lock(); defer f.mu.Unlock()
+	if _, err := f.f.WriteAt(rec, f.size); err != nil { return spillRef{}, err }
+	ref := spillRef{off: f.size, n: int32(len(rec)), gen: f.gen}
+	f.size += int64(len(rec))
+	f.live.Add(int64(len(rec)))
+	return ref, nil
+}
+
+// file returns the file holding records of generation gen.
+func (f *spillFile) file(gen uint32) *os.File {
+	f.mu.Lock(); defer f.mu.Unlock()
+	return f.files[gen]
+}
+
+func (f *spillFile) read(ref spillRef) (outs, ins uint64Set, err error) {
+	r := bufio.NewReader(io.NewSectionReader(f.file(ref.gen), ref.off, int64(ref.n)))
+	get := func() (uint64Set, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil { return nil, err }
+		set := make(uint64Set, n)
+		var v uint64
+		for i := uint64(0); i < n; i++ {
+			gap, err := binary.ReadUvarint(r)
+			if err != nil { return nil, err }
+			v += gap
+			set.Add(v)
+		}
+		return set, nil
+	}
+	if outs, err = get(); err != nil { return nil, nil, err }
+	ins, err = get()
+	return outs, ins, err
+}
+
+// minSpillDead is the dead space below which CompactSpill leaves the file
+// alone, so small files are not rewritten over and over.
+const minSpillDead = 64 << 20
+
+// CompactSpill rewrites the spill file once its dead records (those of
+// users loaded back since) outweigh the live ones and pass minSpillDead,
+// and reports whether it did. Live records move to a fresh file one shard
+// at a time under that shard's write lock; records of other shards stay
+// readable in the old file, which is closed once nothing refers to it. On
+// error the records not yet moved stay where they were and the next call
+// picks up from there. It is a no-op unless spilling is enabled.
+func (g *MemGraph) CompactSpill() (bool, error) {
+	sp := g.sp
+	if sp == nil { return false, nil }
+	sp.cmu.Lock(); defer sp.cmu.Unlock()
+	sp.mu.Lock()
+	live := sp.live.Load()
+	if len(sp.files) == 1 && (sp.size-live < minSpillDead || sp.size-live < live) { sp.mu.Unlock(); return false, nil }
+	f, err := os.CreateTemp(sp.dir, "graph-*.spill")
+	if err != nil { sp.mu.Unlock(); return false, err }
+	_ = os.Remove(f.Name())
+	sp.gen++
+	sp.f, sp.size = f, 0
+	sp.files[sp.gen] = f
+	cur := sp.gen
+	sp.mu.Unlock()
+
+	for _, s := range g.ss {
+		if err := g.moveSpilled(s, cur); err != nil { return false, err }
+	}
+	sp.mu.Lock(); defer sp.mu.Unlock()
+	for gen, old := range sp.files {
+		if gen != cur { old.Close(); delete(sp.files, gen) }
+	}
+	metrics.SpillEvents.WithLabelValues("compact").Inc()
+	return true, nil
+}
+
+// moveSpilled copies the records of s's spilled users that are not yet in
+// generation cur to the end of the current file.
+func (g *MemGraph) moveSpilled(s *shard, cur uint32) error {
+	s.lock(); defer s.mu.Unlock()
+	for u, ref := range s.spilled {
+		if ref.gen == cur { continue }
+		rec := make([]byte, ref.n)
+		if _, err := g.sp.file(ref.gen).ReadAt(rec, ref.off); err != nil {
+			metrics.SpillEvents.WithLabelValues("error").Inc()
+			return fmt.Errorf("%w: user %d: %v", ErrSpillRead, u, err)
+		}
+		nr, err := g.sp.append(rec)
+		if err != nil { return err }
+		s.spilled[u] = nr
+		g.sp.live.Add(-int64(ref.n))
+	}
+	return nil
+}
+
+// SpillFileStats reports the size of the current spill file and the bytes
+// still holding cold users (records of users loaded back are dead space
+// until CompactSpill runs). Both are 0 unless spilling is enabled.
+func (g *MemGraph) SpillFileStats() (size, live int64) {
+	if g.sp == nil { return 0, 0 }
+	g.sp.mu.Lock(); defer g.sp.mu.Unlock()
+	return g.sp.size, g.sp.live.Load()
+}
@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// -------- Follow times --------
+// FollowTimes remembers when each follow made through this node was
+// made, to the second, so recent connections can be told from old ones.
+// Edges loaded from snapshots, imports or peers have no time.
+
+type FollowTimes struct {
+	ss [stripes]struct {
+		mu sync.RWMutex
+		m  map[[2]uint64]uint32 // unix seconds
+	}
+}
+
+func NewFollowTimes() *FollowTimes {
+	t := &FollowTimes{}
+	for i := range t.ss { t.ss[i].m = make(map[[2]uint64]uint32) }
+	return t
+}
+
+// Set records that u followed v at.
+func (t *FollowTimes) Set(u, v uint64, at time.Time) {
+	sh := &t.ss[stripe(u)]
+	sh.mu.Lock()
+	sh.m[[2]uint64{u, v}] = uint32(at.Unix())
+	sh.mu.Unlock()
+}
+
+func (t *FollowTimes) Del(u, v uint64) {
+	sh := &t.ss[stripe(u)]
+	sh.mu.Lock()
+	delete(sh.m, [2]uint64{u, v})
+	sh.mu.Unlock()
+}
+
+// Get returns when u followed v, or false when unknown.
+func (t *FollowTimes) Get(u, v uint64) (time.Time, bool) {
+	sh := &t.ss[stripe(u)]
+	sh.mu.RLock()
+	at, ok := sh.m[[2]uint64{u, v}]
+	sh.mu.RUnlock()
+	if !ok { return time.Time{}, false }
+	return time.Unix(int64(at), 0), true
+}
+
+// -------- Store wrapper --------
+// timeStore stamps the follows it makes and forgets the ones it removes.
+type timeStore struct {
+	Store
+	t *FollowTimes
+}
+
+func TrackTimes(g Store, t *FollowTimes) Store { return &timeStore{Store: g, t: t} }
+
+func (s *timeStore) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := s.Store.Follow(ctx, u, v)
+	if ok { s.t.Set(u, v, time.Now()) }
+	return ok, err
+}
+
+func (s *timeStore) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := s.Store.Unfollow(ctx, u, v)
+	if ok { s.t.Del(u, v) }
+	return ok, err
+}
+
+func (s *timeStore) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := s.Store.FollowIf(ctx, u, v, epoch)
+	if ok { s.t.Set(u, v, time.Now()) }
+	return ok, err
+}
+
+func (s *timeStore) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := s.Store.UnfollowIf(ctx, u, v, epoch)
+	if ok { s.t.Del(u, v) }
+	return ok, err
+}
+
+func (s *timeStore) Apply(ctx context.Context, ops []EdgeOp) ([]bool, error) {
+	changed, err := s.Store.Apply(ctx, ops)
+	now := time.Now()
+	for i, ok := range changed {
+		if !ok { continue }
+		if ops[i].Op == "follow" { s.t.Set(ops[i].Src, ops[i].Dst, now) } else { s.t.Del(ops[i].Src, ops[i].Dst) }
+	}
+	return changed, err
+}
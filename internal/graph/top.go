@@ -0,0 +1,165 @@
+package graph
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// -------- Top users by degree --------
+
+type Ranked struct {
+	User  uint64 `json:"user_id"`
+	Count int    `json:"count"`
+}
+
+// TopByDegree scans every shard and returns the n users with the most
+// followers (byFollowers) or followees, highest first; ties break on the
+// lower user ID.
+func (g *MemGraph) TopByDegree(n int, byFollowers bool) []Ranked {
+	if n <= 0 { return nil }
+	hp := make(rankHeap, 0, n)
+	for _, s := range g.ss {
+		s.mu.RLock()
+		m := s.following
+		if byFollowers { m = s.followers }
+		for u, set := range m {
+			r := Ranked{User: u, Count: len(set)}
+			if len(hp) < n {
+				heap.Push(&hp, r)
+			} else if less(hp[0], r) {
+				hp[0] = r
+				heap.Fix(&hp, 0)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	sort.Slice(hp, func(i, j int) bool { return less(hp[j], hp[i]) })
+	return hp
+}
+
+// TopByDegreeIn is TopByDegree within each partition named by part, in
+// one scan; users part puts in "" are left out.
+func (g *MemGraph) TopByDegreeIn(n int, byFollowers bool, part func(u uint64) string) map[string][]Ranked {
+	if n <= 0 { return nil }
+	hps := make(map[string]*rankHeap)
+	for _, s := range g.ss {
+		s.mu.RLock()
+		m := s.following
+		if byFollowers { m = s.followers }
+		for u, set := range m {
+			p := part(u)
+			if p == "" { continue }
+			hp := hps[p]
+			if hp == nil { hp = &rankHeap{}; hps[p] = hp }
+			r := Ranked{User: u, Count: len(set)}
+			if hp.Len() < n {
+				heap.Push(hp, r)
+			} else if less((*hp)[0], r) {
+				(*hp)[0] = r
+				heap.Fix(hp, 0)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	out := make(map[string][]Ranked, len(hps))
+	for p, hp := range hps {
+		r := *hp
+		sort.Slice(r, func(i, j int) bool { return less(r[j], r[i]) })
+		out[p] = r
+	}
+	return out
+}
+
+// less orders by count, then by descending ID so lower IDs rank higher.
+func less(a, b Ranked) bool {
+	if a.Count != b.Count { return a.Count < b.Count }
+	return a.User > b.User
+}
+
+// rankHeap is a min-heap: the root is the weakest of the current top n.
+type rankHeap []Ranked
+
+func (h rankHeap) Len() int           { return len(h) }
+func (h rankHeap) Less(i, j int) bool { return less(h[i], h[j]) }
+func (h rankHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *rankHeap) Push(x any)        { *h = append(*h, x.(Ranked)) }
+func (h *rankHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// TopMax bounds the n served by Top.
+const TopMax = 1000
+
+// Top serves TopByDegree from a periodically refreshed scan so hot
+// endpoints don't walk the whole graph on every call.
+type Top struct {
+	g     *MemGraph
+	every time.Duration
+
+	// Partition, when set, names the partition (e.g. the locale) a user
+	// counts in for GetIn; "" for none. Set it before first use.
+	Partition func(u uint64) string
+
+	mu    sync.Mutex
+	last  [2]time.Time
+	res   [2][]Ranked
+	plast [2]time.Time
+	pres  [2]map[string][]Ranked
+}
+
+func NewTop(g *MemGraph, every time.Duration) *Top { return &Top{g: g, every: every} }
+
+// Get returns up to n (capped at TopMax) users, at most every old.
+func (t *Top) Get(n int, byFollowers bool) []Ranked {
+	if n > TopMax { n = TopMax }
+	i := 0
+	if byFollowers { i = 1 }
+	t.mu.Lock(); defer t.mu.Unlock()
+	if t.res[i] == nil || time.Since(t.last[i]) >= t.every {
+		t.res[i] = t.g.TopByDegree(TopMax, byFollowers)
+		t.last[i] = time.Now()
+	}
+	r := t.res[i]
+	if n < len(r) { r = r[:n] }
+	return r
+}
+
+// SetEvery changes how old a ranking may get before a request rescans.
+func (t *Top) SetEvery(every time.Duration) {
+	t.mu.Lock(); defer t.mu.Unlock()
+	t.every = every
+}
+
+// Refresh rescans every ranking now, so requests find them fresh.
+func (t *Top) Refresh() {
+	res := [2][]Ranked{t.g.TopByDegree(TopMax, false), t.g.TopByDegree(TopMax, true)}
+	var pres [2]map[string][]Ranked
+	if t.Partition != nil {
+		pres = [2]map[string][]Ranked{t.g.TopByDegreeIn(TopMax, false, t.Partition), t.g.TopByDegreeIn(TopMax, true, t.Partition)}
+	}
+	now := time.Now()
+	t.mu.Lock(); defer t.mu.Unlock()
+	t.res, t.last = res, [2]time.Time{now, now}
+	if t.Partition != nil { t.pres, t.plast = pres, [2]time.Time{now, now} }
+}
+
+// GetIn is Get within partition p. Without a Partition it returns nil.
+func (t *Top) GetIn(n int, byFollowers bool, p string) []Ranked {
+	if t.Partition == nil { return nil }
+	if n > TopMax { n = TopMax }
+	i := 0
+	if byFollowers { i = 1 }
+	t.mu.Lock(); defer t.mu.Unlock()
+	if t.pres[i] == nil || time.Since(t.plast[i]) >= t.every {
+		t.pres[i] = t.g.TopByDegreeIn(TopMax, byFollowers, t.Partition)
+		t.plast[i] = time.Now()
+	}
+	r := t.pres[i][p]
+	if n < len(r) { r = r[:n] }
+	return r
+}
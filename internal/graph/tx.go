@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// -------- Multi-edge transactions --------
+
+// EdgeOp is one step of a Store.Apply transaction. With ExpectedEpoch set,
+// the whole transaction fails with ErrEpochChanged unless Src's epoch
+// still has that value when the transaction starts.
+type EdgeOp struct {
+	Op            string  `json:"op"` // follow | unfollow
+	Src           uint64  `json:"src"`
+	Dst           uint64  `json:"dst"`
+	ExpectedEpoch *uint64 `json:"expected_epoch,omitempty"`
+}
+
+// ErrBadTx is wrapped by errors for malformed transactions.
+var ErrBadTx = errors.New("graph: bad transaction")
+
+// ValidateOps checks every op's name, so that a transaction is rejected
+// before any of it is applied.
+func ValidateOps(ops []EdgeOp) error {
+	for i, op := range ops {
+		if op.Op != "follow" && op.Op != "unfollow" {
+			return fmt.Errorf("%w: op %d: unknown op %q", ErrBadTx, i, op.Op)
+		}
+	}
+	return nil
+}
+
+// Conditional reports whether any op carries an expected epoch.
+func Conditional(ops []EdgeOp) bool {
+	for _, op := range ops {
+		if op.ExpectedEpoch != nil { return true }
+	}
+	return false
+}
+
+// Apply write-locks every shard the ops touch, in shard order like
+// lockPair, checks all expected epochs, then applies the ops in order.
+// Readers never see a partial transaction.
+func (g *MemGraph) Apply(_ context.Context, ops []EdgeOp) ([]bool, error) {
+	if err := ValidateOps(ops); err != nil { return nil, err }
+	locked := make([]bool, len(g.ss))
+	for _, op := range ops { locked[g.h(op.Src)], locked[g.h(op.Dst)] = true, true }
+	for i, s := range g.ss {
+		if locked[i] { s.lock() }
+	}
+	defer func() {
+		for i := len(g.ss) - 1; i >= 0; i-- {
+			if locked[i] { g.ss[i].mu.Unlock() }
+		}
+	}()
+	for _, op := range ops {
+		if err := g.fault(g.ss[g.h(op.Src)], op.Src); err != nil { return nil, err }
+		if err := g.fault(g.ss[g.h(op.Dst)], op.Dst); err != nil { return nil, err }
+	}
+	for _, op := range ops {
+		if op.ExpectedEpoch != nil && g.epoch(op.Src) != *op.ExpectedEpoch { return nil, ErrEpochChanged }
+	}
+	changed := make([]bool, len(ops))
+	vs := g.openViews()
+	for i, op := range ops {
+		u, v := op.Src, op.Dst
+		if u == v { continue }
+		su, sv := g.ss[g.h(u)], g.ss[g.h(v)]
+		if op.Op == "follow" {
+			if changed[i] = su.link(true, u, v, vs); changed[i] { sv.link(false, v, u, vs) }
+		} else {
+			if changed[i] = su.unlink(true, u, v, vs); changed[i] { sv.unlink(false, v, u, vs) }
+		}
+		if changed[i] { g.touch(u, v) }
+	}
+	return changed, nil
+}
@@ -0,0 +1,397 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// -------- Consistent read views --------
+// A computation making many Store calls (PYMK, mutuals) can see the graph
+// change between them: a neighbor's degree read before a follow and its
+// set after it. A View answers every read from one consistent state
+// instead, for as long as it is open.
+//
+// MemGraph views are point-in-time: a View sees exactly the writes that
+// completed before View returned, whenever a user is first read, until
+// Close. A view does not copy the graph. While it is open, every edge
+// write also records its inverse in the view (one small map entry per
+// write per open view), and reads apply those to the live sets. Replacing
+// the graph wholesale (Replace, restoring a snapshot) detaches open views:
+// they keep reading the maps it replaced, which nothing writes to any
+// more, so they still see the state they opened on. A detached view
+// reading a user that was spilled at the time fails with ErrSpillRead if
+// the spill file has been compacted since.
+//
+// Other stores (cluster mode) use RepeatableView, which is weaker: each
+// user's sets, degrees and epoch are pinned when first read, so repeated
+// reads agree and none predates the View call, but users first read at
+// different moments may reflect different states.
+//
+// Epochs are pinned when first read in both, so they are repeatable but,
+// on a MemGraph, may be newer than the view's sets.
+
+// View is a consistent read-only snapshot of a Store, from Store.View.
+// It is safe for concurrent use and must be closed.
+type View interface {
+	Reader
+	Close()
+}
+
+// memView is a MemGraph View: the live sets minus the writes made since it
+// opened, which writers record in undo under the shard lock of the user
+// whose set changed. Reads of u hold u's shard read lock, so u's entries
+// in undo cannot change under them.
+type memView struct {
+	g      *MemGraph
+	mu     sync.Mutex          // guards the maps, not the deltas in them
+	undo   [2]map[uint64]*delta // following, followers
+	epochs map[uint64]uint64
+	old    atomic.Pointer[[]shardMaps] // per shard, set by swap when it detaches the view
+}
+
+// shardMaps are a shard's adjacency maps as swap found them.
+type shardMaps struct {
+	following, followers map[uint64]uint64Set
+	spilled              map[uint64]spillRef
+}
+
+// delta is how a set changed since its view opened.
+type delta struct{ added, removed uint64Set }
+
+// dir indexes memView.undo.
+func dir(out bool) int {
+	if out { return 0 }
+	return 1
+}
+
+// View opens a point-in-time view of g; see above.
+func (g *MemGraph) View() View {
+	v := &memView{g: g, undo: [2]map[uint64]*delta{{}, {}}, epochs: make(map[uint64]uint64)}
+	g.vmu.Lock(); defer g.vmu.Unlock()
+	vs := []*memView{v}
+	if cur := g.views.Load(); cur != nil { vs = append(vs, *cur...) }
+	g.views.Store(&vs)
+	return v
+}
+
+// openViews returns the views writes must be recorded in. A write loads
+// them once, after taking all its shard locks, so a view opened meanwhile
+// sees either all of the write or none of it.
+func (g *MemGraph) openViews() []*memView {
+	if vs := g.views.Load(); vs != nil { return *vs }
+	return nil
+}
+
+func (v *memView) Close() {
+	g := v.g
+	g.vmu.Lock(); defer g.vmu.Unlock()
+	cur := g.views.Load()
+	if cur == nil { return }
+	vs := slices.DeleteFunc(slices.Clone(*cur), func(x *memView) bool { return x == v })
+	if len(vs) == 0 { g.views.Store(nil); return }
+	g.views.Store(&vs)
+}
+
+// record notes that x was added to (or removed from) u's following (out)
+// or followers set. A change undoing an earlier one cancels it.
+func (v *memView) record(out bool, u, x uint64, add bool) {
+	v.mu.Lock(); defer v.mu.Unlock()
+	m := v.undo[dir(out)]
+	d := m[u]
+	if d == nil { d = &delta{}; m[u] = d }
+	from, to := &d.removed, &d.added
+	if !add { from, to = to, from }
+	if from.Has(x) { from.Del(x); return }
+	if *to == nil { *to = make(uint64Set) }
+	to.Add(x)
+}
+
+// sets returns u's following and followers sets as the view finds them:
+// the live ones, with u's shard returned read-locked, or once the view is
+// detached the ones swap replaced, with a nil shard.
+func (v *memView) sets(u uint64) (outs, ins uint64Set, s *shard, err error) {
+	g := v.g
+	i := g.h(u)
+	if old := v.old.Load(); old == nil {
+		s = g.ss[i]
+		if err := g.rlock(s, u); err != nil { return nil, nil, nil, err }
+		if v.old.Load() == nil { return s.following[u], s.followers[u], s, nil }
+		s.mu.RUnlock() // detached while waiting for the lock
+	}
+	m := (*v.old.Load())[i]
+	ref, out := m.spilled[u]
+	if !out { return m.following[u], m.followers[u], nil, nil }
+	outs, ins, err = g.sp.read(ref)
+	if err != nil { return nil, nil, nil, fmt.Errorf("%w: user %d: %v", ErrSpillRead, u, err) }
+	return outs, ins, nil, nil
+}
+
+// read calls fn with u's live set and its delta (nil when unchanged)
+// under u's shard read lock.
+func (v *memView) read(u uint64, out bool, fn func(live uint64Set, d *delta)) error {
+	outs, ins, s, err := v.sets(u)
+	if err != nil { return err }
+	if s != nil { defer s.mu.RUnlock() }
+	live := ins
+	if out { live = outs }
+	v.mu.Lock()
+	d := v.undo[dir(out)][u]
+	v.mu.Unlock()
+	fn(live, d)
+	return nil
+}
+
+func (d *delta) has(live uint64Set, x uint64) bool {
+	if d == nil { return live.Has(x) }
+	return d.removed.Has(x) || live.Has(x) && !d.added.Has(x)
+}
+
+func (d *delta) each(live uint64Set, fn func(x uint64) bool) {
+	for x := range live {
+		if d != nil && d.added.Has(x) { continue }
+		if !fn(x) { return }
+	}
+	if d == nil { return }
+	for x := range d.removed { if !fn(x) { return } }
+}
+
+func (d *delta) len(live uint64Set) int {
+	if d == nil { return len(live) }
+	return len(live) - len(d.added) + len(d.removed)
+}
+
+func (v *memView) each(u uint64, out bool, fn func(x uint64) bool) error {
+	return v.read(u, out, func(live uint64Set, d *delta) { d.each(live, fn) })
+}
+
+func (v *memView) list(u uint64, out bool) ([]uint64, error) {
+	var l []uint64
+	err := v.read(u, out, func(live uint64Set, d *delta) {
+		l = make([]uint64, 0, d.len(live))
+		d.each(live, func(x uint64) bool { l = append(l, x); return true })
+	})
+	return l, err
+}
+
+// set returns u's set as a stable Set: the live one, marked shared like
+// MemGraph's own views, while unchanged; otherwise a copy.
+func (v *memView) set(u uint64, out bool) (Set, error) {
+	outs, ins, s, err := v.sets(u)
+	if err != nil { return Set{}, err }
+	if s != nil { defer s.mu.RUnlock() }
+	live, bit := ins, sharedIn
+	if out { live, bit = outs, sharedOut }
+	v.mu.Lock()
+	d := v.undo[dir(out)][u]
+	v.mu.Unlock()
+	if d == nil {
+		if len(live) == 0 { return Set{}, nil }
+		if s == nil { return Set{live}, nil } // detached: nothing writes to it
+		s.amu.Lock()
+		s.shared[u] |= bit
+		s.amu.Unlock()
+		return Set{live}, nil
+	}
+	c := make(uint64Set, d.len(live))
+	d.each(live, func(x uint64) bool { c.Add(x); return true })
+	return Set{c}, nil
+}
+
+func (v *memView) degree(u uint64, out bool) (int, error) {
+	n := 0
+	err := v.read(u, out, func(live uint64Set, d *delta) { n = d.len(live) })
+	return n, err
+}
+
+func (v *memView) Following(_ context.Context, u uint64) ([]uint64, error) { return v.list(u, true) }
+func (v *memView) Followers(_ context.Context, u uint64) ([]uint64, error) { return v.list(u, false) }
+func (v *memView) ForEachFollowing(_ context.Context, u uint64, fn func(x uint64) bool) error {
+	return v.each(u, true, fn)
+}
+func (v *memView) ForEachFollowers(_ context.Context, u uint64, fn func(x uint64) bool) error {
+	return v.each(u, false, fn)
+}
+func (v *memView) FollowingSet(_ context.Context, u uint64) (Set, error) { return v.set(u, true) }
+func (v *memView) FollowersSet(_ context.Context, u uint64) (Set, error) { return v.set(u, false) }
+func (v *memView) HasEdge(_ context.Context, u, x uint64) (bool, error) {
+	has := false
+	err := v.read(u, true, func(live uint64Set, d *delta) { has = d.has(live, x) })
+	return has, err
+}
+func (v *memView) DegreeOut(_ context.Context, u uint64) (int, error) { return v.degree(u, true) }
+func (v *memView) DegreeIn(_ context.Context, u uint64) (int, error) { return v.degree(u, false) }
+
+func (v *memView) Degrees(_ context.Context, users []uint64) ([]DegreeUser, error) {
+	out := make([]DegreeUser, len(users))
+	for i, u := range users {
+		in, err := v.degree(u, false)
+		if err != nil { return nil, err }
+		o, err := v.degree(u, true)
+		if err != nil { return nil, err }
+		out[i] = DegreeUser{User: u, Followers: in, Following: o}
+	}
+	return out, nil
+}
+
+// Friends and AreFriends read both of u's sets under one lock: they live
+// in the same shard.
+func (v *memView) Friends(_ context.Context, u uint64) ([]uint64, error) {
+	outs, in, s, err := v.sets(u)
+	if err != nil { return nil, err }
+	if s != nil { defer s.mu.RUnlock() }
+	v.mu.Lock()
+	dOut, dIn := v.undo[0][u], v.undo[1][u]
+	v.mu.Unlock()
+	res := make([]uint64, 0, 8)
+	dOut.each(outs, func(x uint64) bool {
+		if dIn.has(in, x) { res = append(res, x) }
+		return true
+	})
+	return res, nil
+}
+
+func (v *memView) AreFriends(_ context.Context, u, x uint64) (bool, error) {
+	outs, ins, s, err := v.sets(u)
+	if err != nil { return false, err }
+	if s != nil { defer s.mu.RUnlock() }
+	v.mu.Lock()
+	dOut, dIn := v.undo[0][u], v.undo[1][u]
+	v.mu.Unlock()
+	return dOut.has(outs, x) && dIn.has(ins, x), nil
+}
+
+func (v *memView) UserEpoch(_ context.Context, u uint64) (uint64, error) {
+	v.mu.Lock(); defer v.mu.Unlock()
+	e, ok := v.epochs[u]
+	if !ok { e = v.g.epoch(u); v.epochs[u] = e }
+	return e, nil
+}
+
+// RepeatableView returns a View of r that pins what it reads of each user
+// (sets, degrees, epoch) the first time, for stores that cannot offer a
+// point-in-time view. Degrees are pinned apart from sets, so that reading
+// a hub's degree does not fetch its whole set: a user's degree and set
+// agree only if both were pinned by the same read.
+func RepeatableView(r Reader) View {
+	return &pinView{r: r, sets: [2]map[uint64]Set{{}, {}}, degs: [2]map[uint64]int{{}, {}}, epochs: make(map[uint64]uint64)}
+}
+
+type pinView struct {
+	r      Reader
+	mu     sync.Mutex
+	sets   [2]map[uint64]Set // following, followers
+	degs   [2]map[uint64]int
+	epochs map[uint64]uint64
+}
+
+func (p *pinView) Close() {}
+
+// set returns u's pinned set, fetching it unlocked on first use; when two
+// readers race, the first to pin wins.
+func (p *pinView) set(ctx context.Context, u uint64, out bool) (Set, error) {
+	i := dir(out)
+	p.mu.Lock()
+	s, ok := p.sets[i][u]
+	p.mu.Unlock()
+	if ok { return s, nil }
+	var err error
+	if out { s, err = p.r.FollowingSet(ctx, u) } else { s, err = p.r.FollowersSet(ctx, u) }
+	if err != nil { return Set{}, err }
+	p.mu.Lock(); defer p.mu.Unlock()
+	if pinned, ok := p.sets[i][u]; ok { return pinned, nil }
+	p.sets[i][u] = s
+	return s, nil
+}
+
+func (p *pinView) degree(ctx context.Context, u uint64, out bool) (int, error) {
+	i := dir(out)
+	p.mu.Lock()
+	if s, ok := p.sets[i][u]; ok { p.mu.Unlock(); return s.Len(), nil }
+	n, ok := p.degs[i][u]
+	p.mu.Unlock()
+	if ok { return n, nil }
+	var err error
+	if out { n, err = p.r.DegreeOut(ctx, u) } else { n, err = p.r.DegreeIn(ctx, u) }
+	if err != nil { return 0, err }
+	p.mu.Lock(); defer p.mu.Unlock()
+	if pinned, ok := p.degs[i][u]; ok { return pinned, nil }
+	p.degs[i][u] = n
+	return n, nil
+}
+
+func (p *pinView) list(ctx context.Context, u uint64, out bool) ([]uint64, error) {
+	s, err := p.set(ctx, u, out)
+	if err != nil { return nil, err }
+	l := make([]uint64, 0, s.Len())
+	s.Each(func(x uint64) bool { l = append(l, x); return true })
+	return l, nil
+}
+
+func (p *pinView) Following(ctx context.Context, u uint64) ([]uint64, error) { return p.list(ctx, u, true) }
+func (p *pinView) Followers(ctx context.Context, u uint64) ([]uint64, error) { return p.list(ctx, u, false) }
+func (p *pinView) ForEachFollowing(ctx context.Context, u uint64, fn func(x uint64) bool) error {
+	s, err := p.set(ctx, u, true)
+	if err == nil { s.Each(fn) }
+	return err
+}
+func (p *pinView) ForEachFollowers(ctx context.Context, u uint64, fn func(x uint64) bool) error {
+	s, err := p.set(ctx, u, false)
+	if err == nil { s.Each(fn) }
+	return err
+}
+func (p *pinView) FollowingSet(ctx context.Context, u uint64) (Set, error) { return p.set(ctx, u, true) }
+func (p *pinView) FollowersSet(ctx context.Context, u uint64) (Set, error) { return p.set(ctx, u, false) }
+func (p *pinView) HasEdge(ctx context.Context, u, x uint64) (bool, error) {
+	s, err := p.set(ctx, u, true)
+	return s.Has(x), err
+}
+func (p *pinView) DegreeOut(ctx context.Context, u uint64) (int, error) { return p.degree(ctx, u, true) }
+func (p *pinView) DegreeIn(ctx context.Context, u uint64) (int, error) { return p.degree(ctx, u, false) }
+
+func (p *pinView) Degrees(ctx context.Context, users []uint64) ([]DegreeUser, error) {
+	out := make([]DegreeUser, len(users))
+	for i, u := range users {
+		in, err := p.degree(ctx, u, false)
+		if err != nil { return nil, err }
+		o, err := p.degree(ctx, u, true)
+		if err != nil { return nil, err }
+		out[i] = DegreeUser{User: u, Followers: in, Following: o}
+	}
+	return out, nil
+}
+
+func (p *pinView) Friends(ctx context.Context, u uint64) ([]uint64, error) {
+	out, err := p.set(ctx, u, true)
+	if err != nil { return nil, err }
+	in, err := p.set(ctx, u, false)
+	if err != nil { return nil, err }
+	res := make([]uint64, 0, 8)
+	out.Each(func(x uint64) bool {
+		if in.Has(x) { res = append(res, x) }
+		return true
+	})
+	return res, nil
+}
+
+func (p *pinView) AreFriends(ctx context.Context, u, x uint64) (bool, error) {
+	out, err := p.set(ctx, u, true)
+	if err != nil { return false, err }
+	in, err := p.set(ctx, u, false)
+	return out.Has(x) && in.Has(x), err
+}
+
+func (p *pinView) UserEpoch(ctx context.Context, u uint64) (uint64, error) {
+	p.mu.Lock()
+	e, ok := p.epochs[u]
+	p.mu.Unlock()
+	if ok { return e, nil }
+	e, err := p.r.UserEpoch(ctx, u)
+	if err != nil { return 0, err }
+	p.mu.Lock(); defer p.mu.Unlock()
+	if pinned, ok := p.epochs[u]; ok { return pinned, nil }
+	p.epochs[u] = e
+	return e, nil
+}
@@ -0,0 +1,76 @@
+package graph_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// TestView checks that a MemGraph view keeps answering from the state it
+// opened on, whatever is written after, while the graph itself moves on.
+func TestView(t *testing.T) {
+	ctx := context.Background()
+	follow := func(u, v uint64) func(*graph.MemGraph) error {
+		return func(g *graph.MemGraph) error { _, err := g.Follow(ctx, u, v); return err }
+	}
+	unfollow := func(u, v uint64) func(*graph.MemGraph) error {
+		return func(g *graph.MemGraph) error { _, err := g.Unfollow(ctx, u, v); return err }
+	}
+	replace := func(edges ...[2]uint64) func(*graph.MemGraph) error {
+		return func(g *graph.MemGraph) error {
+			fresh := graph.NewMemGraphShards(g.Shards())
+			for _, e := range edges {
+				if _, err := fresh.Follow(ctx, e[0], e[1]); err != nil { return err }
+			}
+			return g.Replace(fresh)
+		}
+	}
+	tx := func(ops ...graph.EdgeOp) func(*graph.MemGraph) error {
+		return func(g *graph.MemGraph) error { _, err := g.Apply(ctx, ops); return err }
+	}
+	tests := []struct {
+		name     string
+		after    []func(*graph.MemGraph) error // writes made while the view is open
+		view     []uint64                      // 1's following, as the view sees it
+		live     []uint64                      // and as the graph does
+		viewIns3 []uint64                      // 3's followers, as the view sees them
+	}{
+		{"no writes", nil, []uint64{2, 3}, []uint64{2, 3}, []uint64{1}},
+		{"follow", []func(*graph.MemGraph) error{follow(1, 4)}, []uint64{2, 3}, []uint64{2, 3, 4}, []uint64{1}},
+		{"unfollow", []func(*graph.MemGraph) error{unfollow(1, 3)}, []uint64{2, 3}, []uint64{2}, []uint64{1}},
+		{"follow then unfollow", []func(*graph.MemGraph) error{follow(1, 4), unfollow(1, 4)}, []uint64{2, 3}, []uint64{2, 3}, []uint64{1}},
+		{"unfollow then follow", []func(*graph.MemGraph) error{unfollow(1, 2), follow(1, 2)}, []uint64{2, 3}, []uint64{2, 3}, []uint64{1}},
+		{"other users", []func(*graph.MemGraph) error{follow(5, 3), follow(3, 1)}, []uint64{2, 3}, []uint64{2, 3}, []uint64{1}},
+		{"tx", []func(*graph.MemGraph) error{tx(graph.EdgeOp{Op: "unfollow", Src: 1, Dst: 2}, graph.EdgeOp{Op: "follow", Src: 1, Dst: 5})}, []uint64{2, 3}, []uint64{3, 5}, []uint64{1}},
+		{"replace detaches", []func(*graph.MemGraph) error{replace([2]uint64{1, 4}, [2]uint64{2, 3})}, []uint64{2, 3}, []uint64{4}, []uint64{1}},
+		{"writes after replace", []func(*graph.MemGraph) error{replace([2]uint64{1, 4}), follow(1, 3), unfollow(1, 4)}, []uint64{2, 3}, []uint64{3}, []uint64{1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := graph.NewMemGraph()
+			for _, e := range [][2]uint64{{1, 2}, {1, 3}} {
+				if _, err := g.Follow(ctx, e[0], e[1]); err != nil { t.Fatal(err) }
+			}
+			v := g.View()
+			defer v.Close()
+			for _, w := range tc.after {
+				if err := w(g); err != nil { t.Fatal(err) }
+			}
+			sorted := func(r graph.Reader, f func(graph.Reader, context.Context, uint64) ([]uint64, error), u uint64) []uint64 {
+				out, err := f(r, ctx, u)
+				if err != nil { t.Fatal(err) }
+				slices.Sort(out)
+				return out
+			}
+			if got := sorted(v, graph.Reader.Following, 1); !slices.Equal(got, tc.view) { t.Errorf("view following %v, want %v", got, tc.view) }
+			if got := sorted(g, graph.Reader.Following, 1); !slices.Equal(got, tc.live) { t.Errorf("live following %v, want %v", got, tc.live) }
+			if got := sorted(v, graph.Reader.Followers, 3); !slices.Equal(got, tc.viewIns3) { t.Errorf("view followers of 3 %v, want %v", got, tc.viewIns3) }
+			if n, err := v.DegreeOut(ctx, 1); err != nil || n != len(tc.view) { t.Errorf("view degree %d (%v), want %d", n, err, len(tc.view)) }
+			for _, x := range tc.view {
+				if ok, err := v.HasEdge(ctx, 1, x); err != nil || !ok { t.Errorf("view lacks 1->%d (%v)", x, err) }
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"sort"
+	"sync"
+)
+
+// -------- Interaction weights --------
+// Weights accumulates engagement (likes, replies, shares...) from one user
+// to another, on top of the follow bit. It is kept beside the graph, not
+// in it: users interact without following each other, and an unfollow
+// does not erase shared history.
+
+type Weighted struct {
+	User   uint64  `json:"user_id"`
+	Weight float64 `json:"weight"`
+}
+
+type Weights struct {
+	ss [stripes]struct {
+		mu sync.RWMutex
+		m  map[uint64]map[uint64]float64 // u -> v -> weight of u's interactions with v
+	}
+}
+
+func NewWeights() *Weights {
+	w := &Weights{}
+	for i := range w.ss { w.ss[i].m = make(map[uint64]map[uint64]float64) }
+	return w
+}
+
+// Add adds d to the weight of u's interactions with v and returns the new
+// weight.
+func (w *Weights) Add(u, v uint64, d float64) float64 {
+	sh := &w.ss[stripe(u)]
+	sh.mu.Lock(); defer sh.mu.Unlock()
+	m := sh.m[u]
+	if m == nil { m = make(map[uint64]float64); sh.m[u] = m }
+	m[v] += d
+	return m[v]
+}
+
+// Get returns the weight of u's interactions with v, 0 when none.
+func (w *Weights) Get(u, v uint64) float64 {
+	sh := &w.ss[stripe(u)]
+	sh.mu.RLock(); defer sh.mu.RUnlock()
+	return sh.m[u][v]
+}
+
+// Strongest returns up to n of the users u interacted with, heaviest
+// first; n <= 0 returns all.
+func (w *Weights) Strongest(u uint64, n int) []Weighted {
+	sh := &w.ss[stripe(u)]
+	sh.mu.RLock()
+	out := make([]Weighted, 0, len(sh.m[u]))
+	for v, x := range sh.m[u] { out = append(out, Weighted{v, x}) }
+	sh.mu.RUnlock()
+	SortWeighted(out)
+	if n > 0 && len(out) > n { out = out[:n] }
+	return out
+}
+
+// Decay multiplies every weight by factor, shard by shard, and drops those
+// left below floor. It returns how many pairs remain and how many were
+// dropped.
+func (w *Weights) Decay(factor, floor float64) (kept, dropped int) {
+	for i := range w.ss {
+		sh := &w.ss[i]
+		sh.mu.Lock()
+		for u, m := range sh.m {
+			for v, x := range m {
+				if x *= factor; x < floor {
+					delete(m, v)
+					dropped++
+					continue
+				}
+				m[v] = x
+				kept++
+			}
+			if len(m) == 0 { delete(sh.m, u) }
+		}
+		sh.mu.Unlock()
+	}
+	return kept, dropped
+}
+
+// Len returns the number of weighted pairs.
+func (w *Weights) Len() int {
+	n := 0
+	for i := range w.ss {
+		sh := &w.ss[i]
+		sh.mu.RLock()
+		for _, m := range sh.m { n += len(m) }
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// SortWeighted orders ws heaviest first, ties by lower user ID.
+func SortWeighted(ws []Weighted) {
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].Weight != ws[j].Weight { return ws[i].Weight > ws[j].Weight }
+		return ws[i].User < ws[j].User
+	})
+}
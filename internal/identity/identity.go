@@ -0,0 +1,156 @@
+// Package identity maps the string user IDs some callers have (UUIDs,
+// handles) to the uint64 IDs the graph uses. Each tenant's string IDs are
+// numbered from Base upwards in order of registration, so they never meet
+// numeric IDs below 2^63.
+package identity
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Base is the internal ID of a tenant's first string ID.
+const Base uint64 = 1 << 63
+
+// MaxLen bounds a string ID, in bytes.
+const MaxLen = 256
+
+// ErrInvalid is returned for strings that cannot be string IDs: empty,
+// too long, not UTF-8, or all digits (which already are numeric IDs).
+var ErrInvalid = errors.New("invalid string id")
+
+type key struct {
+	tenant   string
+	external string
+}
+
+type idKey struct {
+	tenant string
+	id     uint64
+}
+
+// entry is one line of the file.
+type entry struct {
+	Tenant   string `json:"tenant"`
+	External string `json:"external"`
+	ID       uint64 `json:"id"`
+}
+
+// Store holds every tenant's string IDs. Mappings are never removed. With
+// a path every registration is appended to a JSON-lines file and replayed
+// by Open.
+type Store struct {
+	mu   sync.RWMutex
+	ids  map[key]uint64
+	ext  map[idKey]string
+	next map[string]uint64 // tenant -> next ID to hand out
+	f    *os.File          // nil when not persisted
+}
+
+// New returns a Store kept only in memory.
+func New() *Store {
+	return &Store{ids: make(map[key]uint64), ext: make(map[idKey]string), next: make(map[string]uint64)}
+}
+
+// Open replays the identities file at path, creating it if needed, and
+// appends later registrations to it.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil { return nil, err }
+	s := New()
+	br := bufio.NewReaderSize(f, 64<<10)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 { slog.Warn("identity: dropping partial last line", "path", path) }
+			break
+		}
+		if err != nil { f.Close(); return nil, err }
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil { f.Close(); return nil, fmt.Errorf("identity: %s:%d: %w", path, n, err) }
+		if _, dup := s.ids[key{e.Tenant, e.External}]; dup || e.ID < Base {
+			f.Close()
+			return nil, fmt.Errorf("identity: %s:%d: bad entry for %q", path, n, e.External)
+		}
+		s.apply(e)
+	}
+	s.f = f
+	return s, nil
+}
+
+func (s *Store) apply(e entry) {
+	s.ids[key{e.Tenant, e.External}] = e.ID
+	s.ext[idKey{e.Tenant, e.ID}] = e.External
+	if e.ID >= s.nextID(e.Tenant) { s.next[e.Tenant] = e.ID + 1 }
+}
+
+func (s *Store) nextID(tenant string) uint64 {
+	if n, ok := s.next[tenant]; ok { return n }
+	return Base
+}
+
+// Valid reports whether external can be registered.
+func Valid(external string) error {
+	if external == "" || len(external) > MaxLen || !utf8.ValidString(external) {
+		return fmt.Errorf("%w: want 1 to %d bytes of UTF-8", ErrInvalid, MaxLen)
+	}
+	for i := 0; i < len(external); i++ {
+		if external[i] < '0' || external[i] > '9' { return nil }
+	}
+	return fmt.Errorf("%w: %q is a numeric id", ErrInvalid, external)
+}
+
+// Register returns external's ID in tenant, assigning the next one if it
+// has none; created says whether it did.
+func (s *Store) Register(tenant, external string) (id uint64, created bool, err error) {
+	if err := Valid(external); err != nil { return 0, false, err }
+	if id, ok := s.Lookup(tenant, external); ok { return id, false, nil }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if id, ok := s.ids[key{tenant, external}]; ok { return id, false, nil }
+	e := entry{Tenant: tenant, External: external, ID: s.nextID(tenant)}
+	if e.ID == 0 { return 0, false, errors.New("identity: id space exhausted") }
+	if s.f != nil {
+		b, err := json.Marshal(e)
+		if err != nil { return 0, false, err }
+		if _, err := s.f.Write(append(b, '\n')); err != nil { return 0, false, err }
+	}
+	s.apply(e)
+	return e.ID, true, nil
+}
+
+// Lookup returns external's ID in tenant, if registered.
+func (s *Store) Lookup(tenant, external string) (uint64, bool) {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	id, ok := s.ids[key{tenant, external}]
+	return id, ok
+}
+
+// External returns the string ID registered as id in tenant, if any.
+func (s *Store) External(tenant string, id uint64) (string, bool) {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	x, ok := s.ext[idKey{tenant, id}]
+	return x, ok
+}
+
+// Len is the number of string IDs registered in tenant.
+func (s *Store) Len(tenant string) int {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	if n, ok := s.next[tenant]; ok { return int(n - Base) }
+	return 0
+}
+
+func (s *Store) Close() error {
+	if s == nil || s.f == nil { return nil }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if err := s.f.Sync(); err != nil { s.f.Close(); return err }
+	return s.f.Close()
+}
@@ -0,0 +1,207 @@
+// Package idmap translates the sparse uint64 user IDs clients use into
+// dense uint32 indices 0..n-1, assigned in order of first sight. Anything
+// indexed by user (slices instead of maps for adjacency, bitmaps instead
+// of hash sets) then needs memory proportional to the users present
+// rather than to the ID space, at 4 bytes per reference instead of 8.
+//
+// A mapping never changes once assigned. With a path it is persisted as
+// an append-only file and replayed by Open, so indices stay stable across
+// restarts and can be shared with export tooling.
+package idmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+var ErrFull = errors.New("idmap: 2^32 users mapped")
+
+// File format: magic "SGM1", then uvarint(external ID) per assignment in
+// dense order.
+var magic = [4]byte{'S', 'G', 'M', '1'}
+
+type Mapper struct {
+	mu    sync.RWMutex
+	dense map[uint64]uint32
+	ext   []uint64 // dense -> external
+	f     *bufio.Writer
+	file  *os.File // nil when not persisted
+}
+
+// New returns a Mapper kept only in memory.
+func New() *Mapper { return &Mapper{dense: make(map[uint64]uint32)} }
+
+// Open replays the mapping file at path, creating it if needed, and
+// appends later assignments to it.
+func Open(path string) (*Mapper, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil { return nil, err }
+	m := New()
+	br := bufio.NewReaderSize(f, 64<<10)
+	var hdr [4]byte
+	switch _, err := io.ReadFull(br, hdr[:]); {
+	case errors.Is(err, io.EOF): // new file
+		if _, err := f.Write(magic[:]); err != nil { f.Close(); return nil, err }
+	case err != nil:
+		f.Close()
+		return nil, fmt.Errorf("idmap: %s: %w", path, err)
+	case hdr != magic:
+		f.Close()
+		return nil, fmt.Errorf("idmap: %s: not a mapping file", path)
+	default:
+		end := int64(len(magic))
+		for {
+			id, err := binary.ReadUvarint(br)
+			if errors.Is(err, io.EOF) { break }
+			if err != nil {
+				// A crash mid-append leaves a partial record; later
+				// assignments overwrite it.
+				slog.Warn("idmap: dropping partial last record", "path", path)
+				break
+			}
+			if _, dup := m.dense[id]; dup { f.Close(); return nil, fmt.Errorf("idmap: %s: %d mapped twice", path, id) }
+			m.add(id)
+			end += int64(uvarintLen(id))
+		}
+		if err := f.Truncate(end); err != nil { f.Close(); return nil, err }
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil { f.Close(); return nil, err }
+	m.file, m.f = f, bufio.NewWriter(f)
+	return m, nil
+}
+
+func uvarintLen(x uint64) int {
+	var tmp [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(tmp[:], x)
+}
+
+func (m *Mapper) add(id uint64) uint32 {
+	d := uint32(len(m.ext))
+	m.dense[id] = d
+	m.ext = append(m.ext, id)
+	return d
+}
+
+// Assign returns id's dense index, mapping it first if it is new.
+func (m *Mapper) Assign(id uint64) (uint32, error) {
+	if d, ok := m.Dense(id); ok { return d, nil }
+	m.mu.Lock(); defer m.mu.Unlock()
+	if d, ok := m.dense[id]; ok { return d, nil }
+	if len(m.ext) == math.MaxUint32 { return 0, ErrFull }
+	if m.f != nil {
+		var tmp [binary.MaxVarintLen64]byte
+		if _, err := m.f.Write(tmp[:binary.PutUvarint(tmp[:], id)]); err != nil { return 0, err }
+		if err := m.f.Flush(); err != nil { return 0, err }
+	}
+	return m.add(id), nil
+}
+
+// Dense returns id's index, if it has one.
+func (m *Mapper) Dense(id uint64) (uint32, bool) {
+	m.mu.RLock(); defer m.mu.RUnlock()
+	d, ok := m.dense[id]
+	return d, ok
+}
+
+// External returns the ID mapped to index d, if any.
+func (m *Mapper) External(d uint32) (uint64, bool) {
+	m.mu.RLock(); defer m.mu.RUnlock()
+	if int64(d) >= int64(len(m.ext)) { return 0, false }
+	return m.ext[d], true
+}
+
+// Len is the number of IDs mapped; indices are 0..Len()-1.
+func (m *Mapper) Len() int {
+	m.mu.RLock(); defer m.mu.RUnlock()
+	return len(m.ext)
+}
+
+// Each calls fn for every mapping in index order, from index from, until
+// it returns false. Mappings made meanwhile may or may not be included.
+func (m *Mapper) Each(from uint32, fn func(dense uint32, id uint64) bool) {
+	const batch = 4096 // don't hold the lock across fn for long
+	for d := int64(from); ; {
+		m.mu.RLock()
+		chunk := m.ext[min(int(d), len(m.ext)):min(int(d)+batch, len(m.ext))]
+		m.mu.RUnlock()
+		if len(chunk) == 0 { return }
+		for _, id := range chunk {
+			if !fn(uint32(d), id) { return }
+			d++
+		}
+	}
+}
+
+// Sync flushes the mapping file to disk.
+func (m *Mapper) Sync() error {
+	if m == nil || m.file == nil { return nil }
+	m.mu.Lock(); defer m.mu.Unlock()
+	return m.file.Sync()
+}
+
+func (m *Mapper) Close() error {
+	if m == nil || m.file == nil { return nil }
+	m.mu.Lock(); defer m.mu.Unlock()
+	if err := m.file.Sync(); err != nil { m.file.Close(); return err }
+	return m.file.Close()
+}
+
+// AssignAll maps every user with an edge in each (e.g. MemGraph.EachEdge),
+// for graphs restored from snapshots or backups taken without a mapping.
+func (m *Mapper) AssignAll(each func(fn func(u, v uint64) bool) error) error {
+	var err error
+	werr := each(func(u, v uint64) bool {
+		if _, err = m.Assign(u); err != nil { return false }
+		_, err = m.Assign(v)
+		return err == nil
+	})
+	if err != nil { return err }
+	return werr
+}
+
+// -------- Store wrapper --------
+// Store maps both ends of every follow made through it before making it,
+// so every user with an edge has an index.
+type Store struct {
+	graph.Store
+	m *Mapper
+}
+
+func Wrap(g graph.Store, m *Mapper) *Store { return &Store{Store: g, m: m} }
+
+func (s *Store) assign(users ...uint64) error {
+	for _, u := range users {
+		if _, err := s.m.Assign(u); err != nil { return err }
+	}
+	return nil
+}
+
+func (s *Store) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	if err := s.assign(u, v); err != nil { return false, err }
+	return s.Store.Follow(ctx, u, v)
+}
+
+func (s *Store) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	if err := s.assign(u, v); err != nil { return false, err }
+	return s.Store.FollowIf(ctx, u, v, epoch)
+}
+
+func (s *Store) Apply(ctx context.Context, ops []graph.EdgeOp) ([]bool, error) {
+	for _, op := range ops {
+		if op.Op != "follow" { continue }
+		if err := s.assign(op.Src, op.Dst); err != nil { return nil, err }
+	}
+	return s.Store.Apply(ctx, ops)
+}
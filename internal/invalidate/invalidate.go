@@ -0,0 +1,123 @@
+// Package invalidate carries "these users' edges changed" notices from the
+// write path to the caches holding results derived from them. PYMK keys
+// its cache by the requester's epoch, which only moves with the
+// requester's own edges; a mutual's new follow goes unseen until the TTL.
+// Bus lets the followers of a mutated user be invalidated instead.
+package invalidate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// Event names the users of a tenant whose following changed. Their
+// followers reach new (or lose) two-hop candidates through them.
+type Event struct {
+	Tenant string
+	Users  []uint64
+}
+
+// Bus is a pub/sub channel for Events. Local is the in-process one; a
+// multi-node deployment can put Redis or NATS pub/sub behind the same
+// interface.
+type Bus interface {
+	Publish(Event)
+	Subscribe(fn func(Event))
+}
+
+// Local delivers events on one goroutine, in order, so publishers never
+// wait on subscribers. When the buffer is full events are dropped; the
+// affected entries then only expire with the cache TTL.
+type Local struct {
+	ch   chan Event
+	mu   sync.RWMutex
+	subs []func(Event)
+}
+
+func NewLocal(buffer int) *Local {
+	if buffer <= 0 { buffer = 1 }
+	return &Local{ch: make(chan Event, buffer)}
+}
+
+func (b *Local) Publish(e Event) {
+	select {
+	case b.ch <- e:
+		metrics.Invalidations.WithLabelValues(e.Tenant, "published").Inc()
+	default:
+		metrics.Invalidations.WithLabelValues(e.Tenant, "dropped").Inc()
+	}
+}
+
+func (b *Local) Subscribe(fn func(Event)) {
+	b.mu.Lock(); defer b.mu.Unlock()
+	b.subs = append(b.subs, fn)
+}
+
+// Run delivers events to the subscribers until ctx is done.
+func (b *Local) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-b.ch:
+			b.mu.RLock()
+			subs := b.subs
+			b.mu.RUnlock()
+			for _, fn := range subs { fn(e) }
+		}
+	}
+}
+
+// -------- Store wrapper --------
+// Store publishes the source of every edge the wrapped store changes.
+type Store struct {
+	graph.Store
+	b      Bus
+	tenant string
+}
+
+func Wrap(g graph.Store, b Bus, tenant string) *Store {
+	return &Store{Store: g, b: b, tenant: tenant}
+}
+
+func (s *Store) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := s.Store.Follow(ctx, u, v)
+	if ok { s.b.Publish(Event{Tenant: s.tenant, Users: []uint64{u}}) }
+	return ok, err
+}
+
+func (s *Store) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	ok, err := s.Store.Unfollow(ctx, u, v)
+	if ok { s.b.Publish(Event{Tenant: s.tenant, Users: []uint64{u}}) }
+	return ok, err
+}
+
+func (s *Store) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := s.Store.FollowIf(ctx, u, v, epoch)
+	if ok { s.b.Publish(Event{Tenant: s.tenant, Users: []uint64{u}}) }
+	return ok, err
+}
+
+func (s *Store) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	ok, err := s.Store.UnfollowIf(ctx, u, v, epoch)
+	if ok { s.b.Publish(Event{Tenant: s.tenant, Users: []uint64{u}}) }
+	return ok, err
+}
+
+// Apply publishes a transaction's changed sources as one event.
+func (s *Store) Apply(ctx context.Context, ops []graph.EdgeOp) ([]bool, error) {
+	changed, err := s.Store.Apply(ctx, ops)
+	seen := make(map[uint64]struct{})
+	var users []uint64
+	for i, ok := range changed {
+		if !ok { continue }
+		if _, dup := seen[ops[i].Src]; dup { continue }
+		seen[ops[i].Src] = struct{}{}
+		users = append(users, ops[i].Src)
+	}
+	if len(users) > 0 { s.b.Publish(Event{Tenant: s.tenant, Users: users}) }
+	return changed, err
+}
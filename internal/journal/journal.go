@@ -0,0 +1,235 @@
+// Package journal keeps an in-memory, bounded, sequence-numbered log of
+// graph mutations for replication and other downstream consumers.
+package journal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+type Event struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant"`
+	Op     string    `json:"op"` // follow | unfollow | replace (the whole graph, by a bulk load)
+	Src    uint64    `json:"src"`
+	Dst    uint64    `json:"dst"`
+	Source string    `json:"source,omitempty"` // follows: where it came from, if given
+}
+
+// Journal is a ring buffer of the most recent Capacity events, less those
+// older than maxAge when it is set. Sequence numbers start at 1 and never
+// repeat within one Journal; a restarted process starts a new one, with
+// a new ID.
+type Journal struct {
+	mu     sync.RWMutex
+	buf    []Event
+	start  int    // index of the oldest event in buf
+	n      int    // events held
+	head   uint64 // seq of the newest event
+	notify chan struct{}
+	maxAge time.Duration
+	id     string
+}
+
+func New(capacity int, maxAge time.Duration) *Journal {
+	if capacity <= 0 { capacity = 1 }
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return &Journal{buf: make([]Event, capacity), notify: make(chan struct{}), maxAge: maxAge, id: hex.EncodeToString(b[:])}
+}
+
+// ID identifies this journal's sequence numbers: consumers that see it
+// change must resync, as the numbers have started over.
+func (j *Journal) ID() string { return j.id }
+
+// Append assigns the next sequence number (and a timestamp if unset).
+func (j *Journal) Append(e Event) uint64 {
+	if e.Time.IsZero() { e.Time = time.Now() }
+	j.mu.Lock()
+	j.expire(e.Time)
+	j.head++
+	e.Seq = j.head
+	if j.n < len(j.buf) {
+		j.buf[(j.start+j.n)%len(j.buf)] = e
+		j.n++
+	} else {
+		j.buf[j.start] = e
+		j.start = (j.start + 1) % len(j.buf)
+	}
+	ch := j.notify
+	j.notify = make(chan struct{})
+	j.mu.Unlock()
+	close(ch)
+	return e.Seq
+}
+
+// Head is the newest sequence number (0 when empty).
+func (j *Journal) Head() uint64 {
+	j.mu.RLock(); defer j.mu.RUnlock()
+	return j.head
+}
+
+// Oldest is the smallest sequence number still retained (Head()+1 when
+// none is).
+func (j *Journal) Oldest() uint64 {
+	j.prune()
+	j.mu.RLock(); defer j.mu.RUnlock()
+	return j.oldest()
+}
+
+func (j *Journal) oldest() uint64 { return j.head - uint64(j.n) + 1 }
+
+// expire drops events older than maxAge as of now. Callers hold mu.
+func (j *Journal) expire(now time.Time) {
+	if j.maxAge <= 0 { return }
+	cut := now.Add(-j.maxAge)
+	for j.n > 0 && j.buf[j.start].Time.Before(cut) {
+		j.buf[j.start] = Event{}
+		j.start = (j.start + 1) % len(j.buf)
+		j.n--
+	}
+}
+
+// prune expires old events ahead of a read, so an idle journal does not
+// keep them past maxAge.
+func (j *Journal) prune() {
+	if j.maxAge <= 0 { return }
+	j.mu.Lock()
+	j.expire(time.Now())
+	j.mu.Unlock()
+}
+
+// Since returns up to limit events with Seq >= from. ok is false when
+// events from `from` onwards were already dropped by retention.
+func (j *Journal) Since(from uint64, limit int) (out []Event, ok bool) {
+	j.prune()
+	j.mu.RLock(); defer j.mu.RUnlock()
+	if from == 0 { from = 1 }
+	if from > j.head { return nil, from == j.head+1 }
+	old := j.oldest()
+	if from < old { return nil, false }
+	cnt := int(j.head - from + 1)
+	if limit > 0 && cnt > limit { cnt = limit }
+	out = make([]Event, cnt)
+	off := int(from - old)
+	for i := 0; i < cnt; i++ {
+		out[i] = j.buf[(j.start+off+i)%len(j.buf)]
+	}
+	return out, true
+}
+
+// SinceTenant is Since for one tenant's events. Other tenants' events
+// are skipped without counting toward limit; next is the sequence number
+// to resume from.
+func (j *Journal) SinceTenant(from uint64, limit int, tenant string) (out []Event, next uint64, ok bool) {
+	j.prune()
+	j.mu.RLock(); defer j.mu.RUnlock()
+	if from == 0 { from = 1 }
+	if from > j.head { return nil, from, from == j.head+1 }
+	old := j.oldest()
+	if from < old { return nil, from, false }
+	next = from
+	for off := int(from - old); off < j.n; off++ {
+		e := &j.buf[(j.start+off)%len(j.buf)]
+		next = e.Seq + 1
+		if e.Tenant != tenant { continue }
+		out = append(out, *e)
+		if limit > 0 && len(out) == limit { break }
+	}
+	return out, next, true
+}
+
+// Wait returns a channel closed by the next Append.
+func (j *Journal) Wait() <-chan struct{} {
+	j.mu.RLock(); defer j.mu.RUnlock()
+	return j.notify
+}
+
+// -------- Store wrapper --------
+// Store records successful mutations of the wrapped store into j. Each
+// write holds its edge's stripe lock from the store call through the
+// Append, so two writes to one edge are journaled in the order they took
+// effect and replaying the journal ends in the graph's state.
+type Store struct {
+	graph.Store
+	j       *Journal
+	tenant  string
+	stripes [edgeStripes]sync.Mutex
+}
+
+const edgeStripes = 1024
+
+func Wrap(g graph.Store, j *Journal, tenant string) *Store {
+	return &Store{Store: g, j: j, tenant: tenant}
+}
+
+func stripe(u, v uint64) int { return int((u*0x9e3779b97f4a7c15 ^ v) % edgeStripes) }
+
+// lockEdge locks u->v's stripe and returns its unlock.
+func (s *Store) lockEdge(u, v uint64) func() {
+	m := &s.stripes[stripe(u, v)]
+	m.Lock()
+	return m.Unlock
+}
+
+func (s *Store) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	defer s.lockEdge(u, v)()
+	ok, err := s.Store.Follow(ctx, u, v)
+	if ok { s.j.Append(Event{Tenant: s.tenant, Op: "follow", Src: u, Dst: v, Source: graph.SourceFrom(ctx)}) }
+	return ok, err
+}
+
+func (s *Store) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	defer s.lockEdge(u, v)()
+	ok, err := s.Store.Unfollow(ctx, u, v)
+	if ok { s.j.Append(Event{Tenant: s.tenant, Op: "unfollow", Src: u, Dst: v}) }
+	return ok, err
+}
+
+func (s *Store) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	defer s.lockEdge(u, v)()
+	ok, err := s.Store.FollowIf(ctx, u, v, epoch)
+	if ok { s.j.Append(Event{Tenant: s.tenant, Op: "follow", Src: u, Dst: v, Source: graph.SourceFrom(ctx)}) }
+	return ok, err
+}
+
+func (s *Store) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	defer s.lockEdge(u, v)()
+	ok, err := s.Store.UnfollowIf(ctx, u, v, epoch)
+	if ok { s.j.Append(Event{Tenant: s.tenant, Op: "unfollow", Src: u, Dst: v}) }
+	return ok, err
+}
+
+// Replaced records that the tenant's graph was replaced wholesale, which
+// no run of follows and unfollows can express: consumers must rebuild
+// their view from the graph.
+func (s *Store) Replaced() { s.j.Append(Event{Tenant: s.tenant, Op: "replace"}) }
+
+// Apply journals a transaction's effective ops one by one; consumers see
+// them as consecutive events.
+func (s *Store) Apply(ctx context.Context, ops []graph.EdgeOp) ([]bool, error) {
+	idx := make([]int, 0, len(ops))
+	for _, op := range ops { idx = append(idx, stripe(op.Src, op.Dst)) }
+	slices.Sort(idx)
+	idx = slices.Compact(idx) // in order, so transactions cannot deadlock
+	for _, i := range idx { s.stripes[i].Lock() }
+	defer func() {
+		for _, i := range idx { s.stripes[i].Unlock() }
+	}()
+	changed, err := s.Store.Apply(ctx, ops)
+	src := graph.SourceFrom(ctx)
+	for i, ok := range changed {
+		if !ok { continue }
+		e := Event{Tenant: s.tenant, Op: ops[i].Op, Src: ops[i].Src, Dst: ops[i].Dst}
+		if e.Op == "follow" { e.Source = src }
+		s.j.Append(e)
+	}
+	return changed, err
+}
@@ -0,0 +1,67 @@
+package journal_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/graph/graphtest"
+	"github.com/pandharkardeep/social-graph/internal/journal"
+)
+
+func TestStore(t *testing.T) {
+	graphtest.TestStore(t, func() graph.Store { return journal.Wrap(graph.NewMemGraph(), journal.New(1<<16, 0), "t") })
+}
+
+// yielding lets other writers run between a write and its journaling.
+type yielding struct{ graph.Store }
+
+func (y yielding) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	defer runtime.Gosched()
+	return y.Store.Follow(ctx, u, v)
+}
+
+func (y yielding) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	defer runtime.Gosched()
+	return y.Store.Unfollow(ctx, u, v)
+}
+
+// TestReplay checks that concurrent writes to the same edges are
+// journaled in the order they took effect, so a replay ends in the
+// graph's state.
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	j := journal.New(1<<16, 0)
+	g := graph.NewMemGraph()
+	s := journal.Wrap(yielding{g}, j, "t")
+	done := make(chan struct{})
+	for w := 0; w < 8; w++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 5000; i++ {
+				u, v := uint64(i%2), uint64(2)
+				if (i+w)%2 == 0 { _, _ = s.Follow(ctx, u, v) } else { _, _ = s.Unfollow(ctx, u, v) }
+			}
+		}()
+	}
+	for w := 0; w < 8; w++ { <-done }
+
+	replayed := graph.NewMemGraph()
+	evs, ok := j.Since(1, 0)
+	if !ok { t.Fatal("journal truncated") }
+	for _, e := range evs {
+		// Only writes that changed the graph are journaled, so each event
+		// must change the replay too.
+		var changed bool
+		if e.Op == "follow" { changed, _ = replayed.Follow(ctx, e.Src, e.Dst) } else { changed, _ = replayed.Unfollow(ctx, e.Src, e.Dst) }
+		if !changed { t.Fatalf("seq %d: %s %d->%d journaled out of order", e.Seq, e.Op, e.Src, e.Dst) }
+	}
+	for u := uint64(0); u < 2; u++ {
+		for v := uint64(2); v < 3; v++ {
+			want, _ := g.HasEdge(ctx, u, v)
+			got, _ := replayed.HasEdge(ctx, u, v)
+			if got != want { t.Errorf("%d->%d: replayed %v, graph %v", u, v, got, want) }
+		}
+	}
+}
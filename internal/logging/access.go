@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// userParams are the query parameters that identify the user a request
+// is about, in lookup order.
+var userParams = []string{"user_id", "u", "viewer"}
+
+// AccessLog emits one record per request. Requests slower than slow or
+// answered with 5xx are logged at Warn so sampling never drops them.
+func AccessLog(slow time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(sw, r)
+		d := time.Since(start)
+
+		level := slog.LevelInfo
+		if sw.status >= 500 || (slow > 0 && d >= slow) { level = slog.LevelWarn }
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", r.URL.Path),
+			slog.String("tenant", r.Header.Get("X-Tenant")),
+			slog.Int("status", sw.status),
+			slog.Int("bytes", sw.bytes),
+			slog.Float64("latency_ms", float64(d.Microseconds())/1000),
+		}
+		q := r.URL.Query()
+		for _, p := range userParams {
+			if v := q.Get(p); v != "" { attrs = append(attrs, slog.String("user_id", v)); break }
+		}
+		slog.LogAttrs(r.Context(), level, "http request", attrs...)
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,101 @@
+// Package logging configures the process-wide slog logger: JSON output,
+// request/trace IDs pulled from the context, and per-message sampling of
+// high-volume records.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pandharkardeep/social-graph/internal/tracing"
+)
+
+// Sampling keeps the first First records per message each Tick, then
+// every Thereafter-th. Records at Warn or above are never sampled.
+type Sampling struct {
+	First      int
+	Thereafter int
+	Tick       time.Duration
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("bad log level %q", s)
+	}
+	return l, nil
+}
+
+// New builds a JSON logger writing to w.
+func New(w io.Writer, level slog.Leveler, s Sampling) *slog.Logger {
+	var h slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	h = &ctxHandler{Handler: h}
+	if s.First > 0 {
+		if s.Tick <= 0 { s.Tick = time.Second }
+		h = &samplingHandler{Handler: h, cfg: s, st: &sampleState{counts: make(map[string]int)}}
+	}
+	return slog.New(h)
+}
+
+// -------- Context enrichment --------
+type ctxHandler struct{ slog.Handler }
+
+func (h *ctxHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := tracing.RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ctxHandler) WithAttrs(as []slog.Attr) slog.Handler { return &ctxHandler{h.Handler.WithAttrs(as)} }
+func (h *ctxHandler) WithGroup(n string) slog.Handler       { return &ctxHandler{h.Handler.WithGroup(n)} }
+
+// -------- Sampling --------
+type sampleState struct {
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+}
+
+type samplingHandler struct {
+	slog.Handler
+	cfg Sampling
+	st  *sampleState
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn || h.keep(r.Message, r.Time) {
+		return h.Handler.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *samplingHandler) keep(msg string, now time.Time) bool {
+	st := h.st
+	st.mu.Lock(); defer st.mu.Unlock()
+	if now.Sub(st.window) >= h.cfg.Tick {
+		st.window = now
+		clear(st.counts)
+	}
+	st.counts[msg]++
+	n := st.counts[msg]
+	if n <= h.cfg.First { return true }
+	return h.cfg.Thereafter > 0 && (n-h.cfg.First)%h.cfg.Thereafter == 0
+}
+
+func (h *samplingHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(as), cfg: h.cfg, st: h.st}
+}
+func (h *samplingHandler) WithGroup(n string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(n), cfg: h.cfg, st: h.st}
+}
@@ -0,0 +1,133 @@
+// Package membudget tiers the adjacency of every registered graph between
+// memory and disk: it keeps the process under a heap ceiling by spilling
+// the coldest users, and demotes users left idle for a while.
+package membudget
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// Eviction starts above high×limit and aims for low×limit.
+const (
+	high = 0.90
+	low  = 0.75
+)
+
+type Manager struct {
+	limit     int64 // 0 = no ceiling
+	dir       string
+	every     time.Duration
+	coldAfter time.Duration // 0 = demote only under pressure
+
+	mu     sync.Mutex
+	graphs []*graph.MemGraph
+}
+
+func New(limit int64, dir string, every, coldAfter time.Duration) *Manager {
+	return &Manager{limit: limit, dir: dir, every: every, coldAfter: coldAfter}
+}
+
+// Add enables spilling on g and puts it under the budget.
+func (m *Manager) Add(g *graph.MemGraph) error {
+	if err := g.EnableSpill(m.dir); err != nil { return err }
+	m.mu.Lock(); defer m.mu.Unlock()
+	m.graphs = append(m.graphs, g)
+	return nil
+}
+
+// Remove takes g out of the budget, once it is dropped.
+func (m *Manager) Remove(g *graph.MemGraph) {
+	m.mu.Lock(); defer m.mu.Unlock()
+	m.graphs = slices.DeleteFunc(m.graphs, func(x *graph.MemGraph) bool { return x == g })
+}
+
+func (m *Manager) Run(ctx context.Context) {
+	t := time.NewTicker(m.every)
+	defer t.Stop()
+	// Idle users are looked for a few times per coldAfter, so none stays
+	// hot much longer than that.
+	demote := max(m.coldAfter/4, m.every)
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			graph.TickAccess()
+			if m.limit > 0 { m.check() }
+			if m.coldAfter > 0 && now.Sub(last) >= demote {
+				last = now
+				m.demoteIdle()
+			}
+			m.compactSpill()
+		}
+	}
+}
+
+func (m *Manager) Graphs() []*graph.MemGraph {
+	m.mu.Lock(); defer m.mu.Unlock()
+	return append([]*graph.MemGraph(nil), m.graphs...)
+}
+
+// demoteIdle moves users idle for coldAfter to the cold tier.
+func (m *Manager) demoteIdle() {
+	var users int
+	var freed int64
+	for _, g := range m.Graphs() {
+		n, b, err := g.DemoteIdle(m.coldAfter)
+		users += n
+		freed += b
+		if err != nil { slog.Error("tiering: spill failed", "err", err); break }
+	}
+	if users > 0 { slog.Info("tiering: demoted idle users", "users", users, "idle", m.coldAfter.String(), "freed_est", freed) }
+}
+
+// compactSpill reclaims the dead space of spill files that need it.
+func (m *Manager) compactSpill() {
+	for _, g := range m.Graphs() {
+		size, _ := g.SpillFileStats()
+		done, err := g.CompactSpill()
+		if err != nil { slog.Error("tiering: spill compaction failed", "err", err); continue }
+		if done {
+			after, _ := g.SpillFileStats()
+			slog.Info("tiering: compacted spill file", "before", size, "after", after)
+		}
+	}
+}
+
+// check samples the heap and, when over the high-water mark, asks each
+// graph to release a share proportional to its estimated size.
+func (m *Manager) check() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	inuse := int64(ms.HeapInuse)
+	metrics.HeapInuse.Set(float64(inuse))
+	if float64(inuse) < high*float64(m.limit) { return }
+
+	graphs := m.Graphs()
+	sizes := make([]int64, len(graphs))
+	var total int64
+	for i, g := range graphs {
+		for _, s := range g.MemStats() { sizes[i] += s.EstBytes }
+		total += sizes[i]
+	}
+	if total == 0 { return }
+	want := inuse - int64(low*float64(m.limit))
+	var freed int64
+	for i, g := range graphs {
+		n, err := g.EvictCold(want * sizes[i] / total)
+		freed += n
+		if err != nil { slog.Error("memory budget: spill failed", "err", err); break }
+	}
+	if freed == 0 { return } // everything was accessed since the last round
+	runtime.GC()
+	slog.Warn("memory budget: evicted cold users", "heap_inuse", inuse, "limit", m.limit, "freed_est", freed)
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -11,46 +12,410 @@ var (
 	RequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "sg_requests_total",
-			Help: "Total HTTP requests by method and path.",
+			Help: "Total HTTP requests by tenant, method and path.",
 		},
-		[]string{"method", "path"},
+		[]string{"tenant", "method", "path"},
 	)
 	RequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "sg_request_duration_seconds",
-			Help:    "HTTP request duration in seconds by method and path.",
+			Help:    "HTTP request duration in seconds by tenant, method and path.",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"method", "path"},
+		[]string{"tenant", "method", "path"},
 	)
 	FollowOps = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "sg_follow_ops_total",
 			Help: "Follow/Unfollow operations.",
 		},
-		[]string{"op"}, // follow | unfollow
+		[]string{"tenant", "op"}, // op: follow | unfollow
 	)
 	PYMKCache = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "sg_pymk_cache_events_total",
 			Help: "PYMK cache events.",
 		},
-		[]string{"event"}, // hit | miss | evict
+		[]string{"tenant", "event"}, // event: hit | miss | evict | invalidate
+	)
+	EpochChanges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_epoch_changes_total",
+			Help: "User epoch changes, i.e. events invalidating a user's cached suggestions.",
+		},
+		[]string{"tenant"},
+	)
+	Invalidations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_invalidation_events_total",
+			Help: "Neighbor-change invalidation events.",
+		},
+		[]string{"tenant", "result"}, // result: published | dropped
+	)
+	// PYMK stages. Cache hits (source=cache) only record stage=total;
+	// computed results record every stage plus the work sizes.
+	PYMKStageDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_stage_duration_seconds",
+			Help:    "PYMK time per stage.",
+			Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16), // 50µs .. ~1.6s
+		},
+		[]string{"tenant", "stage", "source"}, // stage: expand | features | rank | total; source: cache | computed
+	)
+	PYMKCandidates = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_candidates",
+			Help:    "Two-hop candidates scored per computed PYMK.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		},
+		[]string{"tenant", "source"},
+	)
+	PYMKNeighborsScanned = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_neighbors_scanned",
+			Help:    "Two-hop adjacency entries expanded (after sampling) per computed PYMK.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 12),
+		},
+		[]string{"tenant", "source"},
+	)
+	PYMKCapDropRatio = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_cap_drop_ratio",
+			Help:    "Fraction of two-hop adjacency entries a cap left out of the sample, per computed PYMK.",
+			Buckets: []float64{0, 0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99},
+		},
+		[]string{"tenant", "cap"}, // cap: max_expand_per_neighbor | max_candidates
+	)
+	PYMKScores = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_returned_score",
+			Help:    "Scores of returned PYMK suggestions (freshly computed only).",
+			Buckets: prometheus.LinearBuckets(0, 0.25, 17), // 0 .. 4, the default weights' range
+		},
+		[]string{"tenant"},
+	)
+	PYMKCutShort = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_pymk_cut_short_total",
+			Help: "Computed PYMK requests stopped by cancellation, timeout or latency budget, by the stage they reached.",
+		},
+		[]string{"tenant", "stage", "reason"}, // stage: expand | features; reason: deadline | canceled | budget
+	)
+	PYMKConversions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_pymk_conversions_total",
+			Help: "Follows of a user suggested by PYMK within the conversion window.",
+		},
+		[]string{"tenant"},
+	)
+	PYMKConversionRank = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_conversion_rank",
+			Help:    "Rank (1-based) at which converted suggestions were shown.",
+			Buckets: []float64{1, 2, 3, 5, 10, 20, 50, 100},
+		},
+		[]string{"tenant"},
+	)
+	Interactions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_interactions_total",
+			Help: "Interaction events ingested, by type.",
+		},
+		[]string{"tenant", "type"},
+	)
+	PYMKFeedback = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_pymk_feedback_total",
+			Help: "Feedback on PYMK suggestions, by action (accept, reject, hide).",
+		},
+		[]string{"tenant", "action"},
+	)
+	PYMKFeedbackRank = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_pymk_feedback_rank",
+			Help:    "Rank (1-based) at which suggestions given feedback were shown, when known.",
+			Buckets: []float64{1, 2, 3, 5, 10, 20, 50, 100},
+		},
+		[]string{"tenant", "action"},
+	)
+	Communities = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sg_communities",
+			Help: "Communities found by the latest community detection.",
+		},
+		[]string{"tenant"},
+	)
+	AuthFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_auth_failures_total",
+			Help: "Rejected requests by reason.",
+		},
+		[]string{"reason"}, // unauthenticated | forbidden
+	)
+	ClusterRPC = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_cluster_rpc_total",
+			Help: "Internal peer RPCs by peer, path and result.",
+		},
+		[]string{"peer", "path", "result"}, // result: ok | error
+	)
+	ClusterForwards = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_cluster_forwards_total",
+			Help: "Client requests proxied to the owning peer.",
+		},
+		[]string{"peer"},
+	)
+	ReplicationApplied = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sg_replication_applied_seq",
+		Help: "Last journal sequence applied by this replica.",
+	})
+	ReplicationLagEvents = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sg_replication_lag_events",
+		Help: "Primary journal head minus last applied sequence.",
+	})
+	ReplicationLagSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sg_replication_lag_seconds",
+		Help: "Age of the last applied mutation when it was applied.",
+	})
+	Backups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_backups_total",
+			Help: "Snapshot uploads to object storage by result.",
+		},
+		[]string{"result"},
+	)
+	BackupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sg_backup_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful backup upload.",
+	})
+	JobRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_job_runs_total",
+			Help: "Scheduled job runs by result; skipped means the previous run was still going.",
+		},
+		[]string{"job", "result"}, // result: ok | error | skipped
+	)
+	JobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_job_duration_seconds",
+			Help:    "Duration of scheduled job runs.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		},
+		[]string{"job"},
+	)
+	JobLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sg_job_last_success_timestamp_seconds",
+			Help: "Unix time of each scheduled job's last successful run.",
+		},
+		[]string{"job"},
+	)
+	SpillEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_spill_events_total",
+			Help: "Users' adjacency sets evicted to or loaded from the spill file, failed loads, and spill file compactions.",
+		},
+		[]string{"event"}, // event: evict | load | error | compact
+	)
+	SpilledUsers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sg_spilled_users",
+		Help: "Users whose adjacency sets currently live in the spill file.",
+	})
+	ShardLockWait = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_shard_lock_wait_seconds_total",
+			Help: "Estimated time spent waiting for shard locks on request paths (sampled), summed over tenants.",
+		},
+		[]string{"shard", "mode"}, // mode: read | write
+	)
+	HeapInuse = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sg_heap_inuse_bytes",
+		Help: "Heap in use as last sampled by the memory budget check.",
+	})
+	GraphAsymmetries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sg_graph_asymmetries",
+			Help: "Half-edges without their other half found by the last integrity check.",
+		},
+		[]string{"tenant", "missing"}, // missing: in | out
+	)
+	IntegrityRepairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_graph_integrity_repairs_total",
+			Help: "Half-edges added or removed by integrity repairs.",
+		},
+		[]string{"tenant"},
+	)
+	ImportEdges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_import_edges_total",
+			Help: "Edges received by /edges/import and /admin/bulk_load; rate() gives the ingest rate.",
+		},
+		[]string{"tenant", "path", "result"}, // path: import | bulk_load; result: added | skipped
+	)
+	ImportBatchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sg_import_batch_seconds",
+			Help:    "Time to write one import batch.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		},
+		[]string{"path"},
+	)
+	BulkLoadStaged = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sg_bulk_load_staged_edges",
+			Help: "Edges in each tenant's staged bulk load; 0 when none is staged.",
+		},
+		[]string{"tenant"},
+	)
+	ChaosInjected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sg_chaos_injected_total",
+			Help: "Faults injected by the chaos layer.",
+		},
+		[]string{"layer", "target", "fault"}, // layer: http | store; target: the rule's match; fault: latency | error | drop
+	)
+	IntegrityLastCheck = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sg_graph_integrity_last_check_timestamp_seconds",
+			Help: "Unix time the last integrity check finished.",
+		},
+		[]string{"tenant"},
 	)
 )
 
 func init() {
-	prometheus.MustRegister(RequestsTotal, RequestDuration, FollowOps, PYMKCache)
+	prometheus.MustRegister(RequestsTotal, RequestDuration, FollowOps, PYMKCache, EpochChanges, Invalidations, AuthFailures,
+		PYMKStageDuration, PYMKCandidates, PYMKNeighborsScanned, PYMKCapDropRatio, PYMKScores, PYMKCutShort,
+		PYMKConversions, PYMKConversionRank, PYMKFeedback, PYMKFeedbackRank,
+		Communities, Interactions,
+		ClusterRPC, ClusterForwards,
+		ReplicationApplied, ReplicationLagEvents, ReplicationLagSeconds,
+		Backups, BackupLastSuccess, JobRuns, JobDuration, JobLastSuccess,
+		SpillEvents, SpilledUsers, HeapInuse, ShardLockWait,
+		GraphAsymmetries, IntegrityRepairs, IntegrityLastCheck,
+		ImportEdges, ImportBatchDuration, BulkLoadStaged, ChaosInjected)
+}
+
+// DeleteTenant drops every series labeled with tenant, once it is gone.
+func DeleteTenant(tenant string) {
+	l := prometheus.Labels{"tenant": tenant}
+	for _, v := range []interface{ DeletePartialMatch(prometheus.Labels) int }{
+		RequestsTotal, RequestDuration, FollowOps, PYMKCache, EpochChanges, Invalidations,
+		PYMKStageDuration, PYMKCandidates, PYMKNeighborsScanned, PYMKCapDropRatio, PYMKScores, PYMKCutShort,
+		PYMKConversions, PYMKConversionRank, PYMKFeedback, PYMKFeedbackRank, Interactions, Communities,
+		GraphAsymmetries, IntegrityRepairs, IntegrityLastCheck, ImportEdges, BulkLoadStaged,
+	} {
+		v.DeletePartialMatch(l)
+	}
+}
+
+var (
+	shardUsersDesc = prometheus.NewDesc("sg_shard_users", "Users with a following or followers set in the shard, summed over tenants.", []string{"shard", "set"}, nil)
+	shardEdgesDesc = prometheus.NewDesc("sg_shard_edges", "Edges whose source lives in the shard, summed over tenants.", []string{"shard"}, nil)
+)
+
+// ShardOccupancy reports per-shard counts at scrape time: it calls report
+// once per shard of every graph it knows about.
+type ShardOccupancy func(report func(shard, followingUsers, followerUsers, edges int))
+
+func RegisterShardOccupancy(f ShardOccupancy) { prometheus.MustRegister(f) }
+
+func (f ShardOccupancy) Describe(ch chan<- *prometheus.Desc) {
+	ch <- shardUsersDesc
+	ch <- shardEdgesDesc
+}
+
+func (f ShardOccupancy) Collect(ch chan<- prometheus.Metric) {
+	type occ struct{ out, in, edges int }
+	byShard := make(map[int]*occ)
+	f(func(shard, out, in, edges int) {
+		o := byShard[shard]
+		if o == nil { o = &occ{}; byShard[shard] = o }
+		o.out += out; o.in += in; o.edges += edges
+	})
+	for shard, o := range byShard {
+		id := strconv.Itoa(shard)
+		ch <- prometheus.MustNewConstMetric(shardUsersDesc, prometheus.GaugeValue, float64(o.out), id, "following")
+		ch <- prometheus.MustNewConstMetric(shardUsersDesc, prometheus.GaugeValue, float64(o.in), id, "followers")
+		ch <- prometheus.MustNewConstMetric(shardEdgesDesc, prometheus.GaugeValue, float64(o.edges), id)
+	}
+}
+
+var (
+	churnHotDesc = prometheus.NewDesc("sg_churn_hot_users", "Users whose epochs changed at least churn.min_changes times in the decaying window.", []string{"tenant"}, nil)
+	churnTopDesc = prometheus.NewDesc("sg_churn_top_changes", "Epoch changes in the decaying window of the user changing most.", []string{"tenant"}, nil)
+)
+
+// Churn reports epoch churn at scrape time: it calls report once per
+// tenant tracking it.
+type Churn func(report func(tenant string, hotUsers int, topChanges uint32))
+
+func RegisterChurn(f Churn) { prometheus.MustRegister(f) }
+
+func (f Churn) Describe(ch chan<- *prometheus.Desc) {
+	ch <- churnHotDesc
+	ch <- churnTopDesc
+}
+
+func (f Churn) Collect(ch chan<- prometheus.Metric) {
+	f(func(tenant string, hot int, top uint32) {
+		ch <- prometheus.MustNewConstMetric(churnHotDesc, prometheus.GaugeValue, float64(hot), tenant)
+		ch <- prometheus.MustNewConstMetric(churnTopDesc, prometheus.GaugeValue, float64(top), tenant)
+	})
+}
+
+var (
+	tierUsersDesc = prometheus.NewDesc("sg_tier_users", "Users by adjacency tier (hot: in memory, cold: in the spill file), summed over tenants.", []string{"tier"}, nil)
+	tierBytesDesc = prometheus.NewDesc("sg_tier_bytes", "Adjacency bytes by tier (hot: heap estimate, cold: spill records), summed over tenants.", []string{"tier"}, nil)
+	spillFileDesc = prometheus.NewDesc("sg_spill_file_bytes", "Size of the spill files, dead space included, summed over tenants.", nil, nil)
+)
+
+// TierOccupancy reports hot/cold tier sizes at scrape time: it calls
+// report once per graph with spilling enabled.
+type TierOccupancy func(report func(hotUsers, coldUsers int, hotBytes, coldBytes, fileBytes int64))
+
+func RegisterTierOccupancy(f TierOccupancy) { prometheus.MustRegister(f) }
+
+func (f TierOccupancy) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tierUsersDesc
+	ch <- tierBytesDesc
+	ch <- spillFileDesc
+}
+
+func (f TierOccupancy) Collect(ch chan<- prometheus.Metric) {
+	var hotUsers, coldUsers int
+	var hotBytes, coldBytes, fileBytes int64
+	f(func(hu, cu int, hb, cb, fb int64) {
+		hotUsers += hu; coldUsers += cu
+		hotBytes += hb; coldBytes += cb; fileBytes += fb
+	})
+	ch <- prometheus.MustNewConstMetric(tierUsersDesc, prometheus.GaugeValue, float64(hotUsers), "hot")
+	ch <- prometheus.MustNewConstMetric(tierUsersDesc, prometheus.GaugeValue, float64(coldUsers), "cold")
+	ch <- prometheus.MustNewConstMetric(tierBytesDesc, prometheus.GaugeValue, float64(hotBytes), "hot")
+	ch <- prometheus.MustNewConstMetric(tierBytesDesc, prometheus.GaugeValue, float64(coldBytes), "cold")
+	ch <- prometheus.MustNewConstMetric(spillFileDesc, prometheus.GaugeValue, float64(fileBytes))
 }
 
 func Handler() http.Handler { return promhttp.Handler() }
 
-func HTTPMetricsMiddleware(next http.Handler) http.Handler {
+// UnknownTenant is the tenant label of requests naming a tenant that does
+// not exist, so that clients cannot mint series through X-Tenant.
+const UnknownTenant = "unknown"
+
+// HTTPMetricsMiddleware counts and times requests per tenant, labelling
+// those for tenants known does not report as UnknownTenant. known is
+// asked once the request is served, so one that auto-created its tenant
+// is counted under it.
+func HTTPMetricsMiddleware(next http.Handler, known func(tenant string) bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		path := r.URL.Path
-		RequestsTotal.WithLabelValues(r.Method, path).Inc()
+		tenant := r.Header.Get("X-Tenant") // normalized by tenant.Middleware
 		next.ServeHTTP(w, r)
-		RequestDuration.WithLabelValues(r.Method, path).Observe(time.Since(start).Seconds())
+		if !known(tenant) { tenant = UnknownTenant }
+		RequestsTotal.WithLabelValues(tenant, r.Method, path).Inc()
+		RequestDuration.WithLabelValues(tenant, r.Method, path).Observe(time.Since(start).Seconds())
 	})
 }
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	MinSize int  `yaml:"min_size"` // bytes; smaller bodies go out uncompressed
+	Level   int  `yaml:"level"`    // gzip level 1-9; brotli uses level/9*11
+}
+
+func DefaultCompression() CompressionConfig {
+	return CompressionConfig{Enabled: true, MinSize: 1024, Level: 5}
+}
+
+// compressible lists the content types worth compressing.
+var compressible = []string{"application/json", "application/yaml", "text/"}
+
+// Compress negotiates br or gzip from Accept-Encoding and compresses
+// compressible bodies of at least MinSize bytes.
+func Compress(c CompressionConfig, next http.Handler) http.Handler {
+	if !c.Enabled { return next }
+	if c.Level < 1 || c.Level > 9 { c.Level = gzip.DefaultCompression }
+	gz := &sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(io.Discard, c.Level); return w }}
+	brLevel := c.Level * brotli.BestCompression / 9
+	br := &sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brLevel) }}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := negotiate(r.Header.Get("Accept-Encoding"))
+		if enc == "" || r.Method == http.MethodHead { next.ServeHTTP(w, r); return }
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, encoding: enc, minSize: c.MinSize, status: 200, gz: gz, br: br}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func negotiate(accept string) string {
+	var gz bool
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 { continue }
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "br":
+			return "br"
+		case "gzip":
+			gz = true
+		}
+	}
+	if gz { return "gzip" }
+	return ""
+}
+
+// compressWriter buffers up to minSize bytes to decide whether the body is
+// worth compressing, then streams either raw or through the encoder.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	buf      []byte
+	decided  bool
+	enc      io.WriteCloser
+	gz, br   *sync.Pool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided { return }
+	w.status = code
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize { return len(b), nil }
+		if err := w.start(true); err != nil { return 0, err }
+		return len(b), nil
+	}
+	if w.enc != nil { return w.enc.Write(b) }
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) start(big bool) error {
+	w.decided = true
+	h := w.Header()
+	ct := h.Get("Content-Type")
+	ok := big && h.Get("Content-Encoding") == "" && w.status != http.StatusNoContent && w.status != http.StatusNotModified
+	if ok {
+		ok = false
+		for _, p := range compressible {
+			if strings.HasPrefix(ct, p) { ok = true; break }
+		}
+	}
+	if ok {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		switch w.encoding {
+		case "br":
+			bw := w.br.Get().(*brotli.Writer)
+			bw.Reset(w.ResponseWriter)
+			w.enc = bw
+		default:
+			gw := w.gz.Get().(*gzip.Writer)
+			gw.Reset(w.ResponseWriter)
+			w.enc = gw
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 { return nil }
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) close() {
+	if !w.decided { _ = w.start(false) }
+	if w.enc == nil { return }
+	_ = w.enc.Close()
+	switch e := w.enc.(type) {
+	case *gzip.Writer:
+		w.gz.Put(e)
+	case *brotli.Writer:
+		w.br.Put(e)
+	}
+	w.enc = nil
+}
+
+// Flush commits to the current decision (streaming responses such as SSE
+// start before minSize is reached) and flushes through the encoder.
+func (w *compressWriter) Flush() {
+	if !w.decided { _ = w.start(len(w.buf) >= w.minSize) }
+	if f, ok := w.enc.(interface{ Flush() error }); ok { _ = f.Flush() }
+	_ = http.NewResponseController(w.ResponseWriter).Flush() // through wrappers that only Unwrap
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,66 @@
+// Package middleware holds generic HTTP middleware (CORS, compression)
+// that is configured once for the whole listener.
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"` // "*" allows any; empty disables CORS
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAge           int      `yaml:"max_age"` // preflight cache, seconds
+}
+
+func DefaultCORS() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Tenant", "X-Request-ID", "If-None-Match"},
+		ExposedHeaders: []string{"X-Request-ID", "ETag"},
+		MaxAge:         600,
+	}
+}
+
+// CORS answers preflight requests itself (so they never hit auth) and
+// decorates responses for allowed origins.
+func CORS(c CORSConfig, next http.Handler) http.Handler {
+	if len(c.AllowedOrigins) == 0 { return next }
+	any := slices.Contains(c.AllowedOrigins, "*")
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(c.ExposedHeaders, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" { next.ServeHTTP(w, r); return }
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if !any && !slices.Contains(c.AllowedOrigins, origin) {
+			if r.Method == http.MethodOptions { w.WriteHeader(http.StatusForbidden); return }
+			next.ServeHTTP(w, r); return
+		}
+		if any && !c.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials { h.Set("Access-Control-Allow-Credentials", "true") }
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			if c.MaxAge > 0 { h.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge)) }
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if exposed != "" { h.Set("Access-Control-Expose-Headers", exposed) }
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,162 @@
+package pymk
+
+import (
+	"sync"
+
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+// doorkeeperSize is how many turned-away candidates, per unit of limit,
+// the doorkeeper remembers before it is cleared, keeping its false
+// positives near 1%.
+const doorkeeperSize = 4
+
+// candidates accumulates two-hop evidence in at most limit entries
+// (0 = unbounded). Once full, a new candidate's first hit only marks it in
+// a Bloom filter (the doorkeeper, as in TinyLFU). A second hit shows it is
+// reached from two neighbors, which beats the single-mutual long tail, so
+// it takes the slot of the oldest candidate still at one hit, if any is
+// left. Memory per request is bounded by limit however large the
+// neighborhood.
+//
+// Stats are values in st, found through idx, so a table allocates a few
+// growable buffers rather than one object per candidate; tables are
+// pooled across requests (see getCandidates).
+type candidates struct {
+	idx      map[uint64]int32 // candidate -> its index in st
+	st       []candStats
+	limit    int
+	door     *sketch.Bloom // first hits on candidates not in the table; allocated once full
+	doorN    int           // adds since door was last cleared
+	singles  []uint64      // admitted with one hit, oldest first; may be stale
+	hits     int           // every hit, admitted or not
+	rejected int           // hits that found the table full and were not admitted
+
+	// Per-worker expansion scratch, reused from one neighbor to the next.
+	cur    neighbor
+	visit  func(c uint64) bool // bound to cur by the request that set it
+	sample hashHeap
+	ids    []uint64
+}
+
+// neighbor is what visiting a neighbor's followees needs to know about it.
+type neighbor struct {
+	id    uint64
+	aa    float64 // Adamic–Adar weight
+	wUN   float64 // weight of the edge to it; see weights.go
+	fresh float64 // recency weight; see recency.go
+	ipw   float64 // inverse propensity; see approx.go
+	seen  int     // followees visited
+}
+
+// maxPooledCandidates bounds the tables kept for reuse, so one request
+// with an unbounded table does not pin its memory.
+const maxPooledCandidates = 1 << 16
+
+var candPool = sync.Pool{New: func() any { return &candidates{idx: make(map[uint64]int32, 1024)} }}
+
+// getCandidates returns an empty table from the pool; putCandidates
+// returns it once nothing refers to its stats any more.
+func getCandidates(limit int) *candidates {
+	cs := candPool.Get().(*candidates)
+	if cs.limit != limit { cs.door = nil } // sized for another limit
+	cs.limit = limit
+	return cs
+}
+
+func putCandidates(cs *candidates) {
+	if cs == nil || cap(cs.st) > maxPooledCandidates { return }
+	clear(cs.idx)
+	cs.st, cs.singles, cs.ids = cs.st[:0], cs.singles[:0], cs.ids[:0]
+	cs.sample = cs.sample[:0]
+	if cs.door != nil { cs.door.Reset() }
+	cs.doorN, cs.hits, cs.rejected = 0, 0, 0
+	cs.cur, cs.visit = neighbor{}, nil
+	candPool.Put(cs)
+}
+
+func (cs *candidates) len() int { return len(cs.st) }
+
+// get returns c's stats, or nil. The pointer is good until the next add.
+func (cs *candidates) get(c uint64) *candStats {
+	if i, ok := cs.idx[c]; ok { return &cs.st[i] }
+	return nil
+}
+
+// add inserts st for st.id, which must not be present.
+func (cs *candidates) add(st candStats) *candStats {
+	cs.idx[st.id] = int32(len(cs.st))
+	cs.st = append(cs.st, st)
+	return &cs.st[len(cs.st)-1]
+}
+
+// remove drops c, moving the last entry into its slot.
+func (cs *candidates) remove(c uint64) {
+	i, ok := cs.idx[c]
+	if !ok { return }
+	last := len(cs.st) - 1
+	if int(i) != last {
+		cs.st[i] = cs.st[last]
+		cs.idx[cs.st[i].id] = i
+	}
+	cs.st = cs.st[:last]
+	delete(cs.idx, c)
+}
+
+// hit records that c was reached through neighbor n of Adamic–Adar
+// weight aa, over a path of edge weight wt (1 when unweighted).
+func (cs *candidates) hit(c, n uint64, aa, wt float64) {
+	cs.hits++
+	aa *= wt
+	if st := cs.get(c); st != nil {
+		st.common++
+		st.wcommon += wt
+		st.aa += aa
+		if aa > st.viaW { st.via, st.viaW = n, aa }
+		return
+	}
+	if cs.limit <= 0 || cs.len() < cs.limit {
+		cs.admit(candStats{id: c, common: 1, wcommon: wt, aa: aa, via: n, viaW: aa})
+		return
+	}
+	if cs.door == nil { cs.door = sketch.NewBloom(doorkeeperSize*cs.limit, 0.01) }
+	if !cs.door.MayContain(c) || !cs.evictSingle() {
+		cs.remember(c)
+		cs.rejected++
+		return
+	}
+	// The first hit was only remembered, not weighed; credit it at this
+	// neighbor's weight.
+	cs.admit(candStats{id: c, common: 2, wcommon: 2 * wt, aa: 2 * aa, via: n, viaW: aa})
+}
+
+func (cs *candidates) admit(st candStats) {
+	cs.add(st)
+	if st.common == 1 { cs.singles = append(cs.singles, st.id) }
+}
+
+// remember puts c past the doorkeeper, clearing it once it holds as many
+// candidates as it was sized for.
+func (cs *candidates) remember(c uint64) {
+	if cs.doorN >= doorkeeperSize*cs.limit {
+		cs.door.Reset()
+		cs.doorN = 0
+	}
+	cs.door.Add(c)
+	cs.doorN++
+}
+
+// evictSingle drops the oldest admitted candidate still at one hit,
+// remembering it so one more hit brings it back.
+func (cs *candidates) evictSingle() bool {
+	for len(cs.singles) > 0 {
+		c := cs.singles[0]
+		cs.singles = cs.singles[1:]
+		if st := cs.get(c); st != nil && st.common == 1 {
+			cs.remove(c)
+			cs.remember(c)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package pymk
+
+import (
+	"context"
+	"math"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+// Approximate expansion. A user following thousands of accounts that each
+// follow thousands has a two-hop frontier in the millions; walking it all
+// costs far more than ranking can use. Past cfg.ApproxSamples adjacency
+// entries, each connector is expanded with the same probability p, chosen
+// so about ApproxSamples entries are read, and everything it contributes
+// is weighted by 1/p (and by outN/len(sample) when its own list was also
+// sampled down). The weighted common-neighbor and Adamic–Adar sums are
+// then unbiased (Horvitz–Thompson) estimates of the exact ones, so the
+// ranking stays statistically close to the exact ranking.
+
+// approxPlan returns the connectors to expand and the inverse propensity
+// of each, or nil sources when the whole frontier fits the budget. The
+// pick hashes connectors with salt, so a fixed sample_seed reproduces it.
+func (s *Service) approxPlan(ctx context.Context, rd graph.Reader, sources []uint64, cfg PYMKConfig, salt uint64) ([]uint64, float64, error) {
+	if cfg.ApproxSamples <= 0 { return nil, 0, nil }
+	frontier := 0
+	for _, n := range sources {
+		d, err := rd.DegreeOut(ctx, n)
+		if err != nil { return nil, 0, err }
+		if limit := cfg.MaxExpandPerNeighbor; limit > 0 { d = min(d, limit) }
+		frontier += d
+	}
+	if frontier <= cfg.ApproxSamples { return nil, 0, nil }
+	p := float64(cfg.ApproxSamples) / float64(frontier)
+	cut := uint64(p * math.MaxUint64)
+	seed := sketch.Hash(salt ^ 0xa7b1) // not the per-neighbor sampling hash
+	kept := make([]uint64, 0, int(p*float64(len(sources)))+1)
+	var best uint64 = math.MaxUint64
+	bestN := sources[0]
+	for _, n := range sources {
+		x := sketch.Hash(n ^ seed)
+		if x < cut { kept = append(kept, n) }
+		if x < best { best, bestN = x, n }
+	}
+	if len(kept) == 0 { kept = append(kept, bestN) } // never expand nothing
+	metrics.PYMKCapDropRatio.WithLabelValues(s.tenant, "approx_samples").Observe(1 - p)
+	return kept, 1 / p, nil
+}
@@ -0,0 +1,61 @@
+package pymk
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+)
+
+// -------- Boost rules --------
+// Declarative score adjustments on user attributes, applied in order after
+// the weighted score, e.g.
+//
+//	boosts:
+//	  - {name: same_language, when: "language == viewer.language", add: 0.2}
+//	  - {when: "verified == true", add: 0.1}
+
+// Boost adds Add to the score of candidates for which When, an attribute
+// filter (see attrs.ParseFilter), holds. A comparison with a field the
+// viewer lacks does not hold. Add may be negative to demote.
+type Boost struct {
+	Name string  `yaml:"name" json:"name,omitempty"` // in explanations; defaults to When
+	When string  `yaml:"when" json:"when"`
+	Add  float64 `yaml:"add" json:"add"`
+}
+
+func (b Boost) name() string {
+	if b.Name != "" { return b.Name }
+	return b.When
+}
+
+// ValidBoosts checks every rule's condition and amount.
+func ValidBoosts(bs []Boost) error {
+	for i, b := range bs {
+		if b.When == "" { return fmt.Errorf("boosts[%d]: when is required", i) }
+		if _, err := attrs.ParseFilter(b.When); err != nil { return fmt.Errorf("boosts[%d]: %w", i, err) }
+		if math.IsNaN(b.Add) || math.IsInf(b.Add, 0) { return fmt.Errorf("boosts[%d]: add must be finite", i) }
+	}
+	return nil
+}
+
+// boost applies cfg's boost rules to out, recording each applied rule on
+// the candidate for the explanation.
+func (s *Service) boost(u uint64, out []scored, cfg PYMKConfig) {
+	if len(cfg.Boosts) == 0 || s.Subject == nil || len(out) == 0 { return }
+	rules := make([]*attrs.Filter, len(cfg.Boosts))
+	for i, b := range cfg.Boosts { rules[i], _ = attrs.ParseFilter(b.When) } // validated with the config
+	viewer, now := s.Subject(u), time.Now()
+	for i := range out {
+		c := &out[i]
+		sub := s.Subject(c.id)
+		for j, f := range rules {
+			if !f.Holds(viewer, sub, now) { continue }
+			b := cfg.Boosts[j]
+			c.score += b.Add
+			if c.boosts == nil { c.boosts = make(map[string]float64, 1) }
+			c.boosts[b.name()] += b.Add
+		}
+	}
+}
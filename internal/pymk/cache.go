@@ -9,6 +9,7 @@ type cacheKey struct {
 	user   uint64
 	k      int
 	epoch  uint64 // user's epoch at time of compute (invalidates on change)
+	filter string // the request's attribute filter
 }
 
 type cacheEntry struct {
@@ -19,20 +20,20 @@ type cacheEntry struct {
 
 type lruCache struct {
 	capacity int
-	ttl      time.Duration
 	ll       *list.List
 	table    map[cacheKey]*list.Element
+	byUser   map[uint64]map[*list.Element]struct{} // every entry of a user, for Invalidate
 	onEvict  func()
 	onHit    func()
 	onMiss   func()
 }
 
-func newLRU(cap int, ttl time.Duration) *lruCache {
+func newLRU(cap int) *lruCache {
 	return &lruCache{
 		capacity: cap,
-		ttl:      ttl,
 		ll:       list.New(),
 		table:    make(map[cacheKey]*list.Element),
+		byUser:   make(map[uint64]map[*list.Element]struct{}),
 	}
 }
 
@@ -53,18 +54,21 @@ func (c *lruCache) Get(key cacheKey) (val []Suggestion, ok bool) {
 	return nil, false
 }
 
-func (c *lruCache) Set(key cacheKey, val []Suggestion) {
+// Set caches val under key for ttl.
+func (c *lruCache) Set(key cacheKey, val []Suggestion, ttl time.Duration) {
 	if c.capacity == 0 { return }
 	if ele, ok := c.table[key]; ok {
 		ent := ele.Value.(*cacheEntry)
 		ent.value = val
-		ent.expiresAt = time.Now().Add(c.ttl)
+		ent.expiresAt = time.Now().Add(ttl)
 		c.ll.MoveToFront(ele)
 		return
 	}
-	ent := &cacheEntry{key: key, value: val, expiresAt: time.Now().Add(c.ttl)}
+	ent := &cacheEntry{key: key, value: val, expiresAt: time.Now().Add(ttl)}
 	ele := c.ll.PushFront(ent)
 	c.table[key] = ele
+	if c.byUser[key.user] == nil { c.byUser[key.user] = make(map[*list.Element]struct{}) }
+	c.byUser[key.user][ele] = struct{}{}
 	if c.ll.Len() > c.capacity {
 		c.removeOldest()
 	}
@@ -78,8 +82,23 @@ func (c *lruCache) removeOldest() {
 	}
 }
 
+// Invalidate drops every entry of user, whatever its k, epoch or filter,
+// and returns how many there were.
+func (c *lruCache) Invalidate(user uint64) int {
+	n := 0
+	for e := range c.byUser[user] {
+		c.removeElement(e)
+		n++
+	}
+	return n
+}
+
 func (c *lruCache) removeElement(e *list.Element) {
 	ent := e.Value.(*cacheEntry)
 	delete(c.table, ent.key)
+	if set := c.byUser[ent.key.user]; set != nil {
+		delete(set, e)
+		if len(set) == 0 { delete(c.byUser, ent.key.user) }
+	}
 	c.ll.Remove(e)
 }
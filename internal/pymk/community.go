@@ -0,0 +1,37 @@
+package pymk
+
+import "fmt"
+
+// Community modes: how PYMKConfig.Community uses the requester's
+// community, as reported by Service.Community. A requester in no
+// community gets unscoped suggestions.
+const (
+	CommunityOff      = "off"      // ignore communities
+	CommunityRestrict = "restrict" // only suggest users from the requester's community
+	CommunityBoost    = "boost"    // add community_boost to their scores
+)
+
+func CommunityMode(mode string) string {
+	if mode == "" { return CommunityOff }
+	return mode
+}
+
+func ValidCommunity(mode string) error {
+	switch CommunityMode(mode) {
+	case CommunityOff, CommunityRestrict, CommunityBoost:
+		return nil
+	}
+	return fmt.Errorf("community must be off, restrict or boost, not %q", mode)
+}
+
+// community returns u's community when cfg scopes suggestions by it, and a
+// test for whether a candidate shares it.
+func (s *Service) community(u uint64, cfg PYMKConfig) (same func(c uint64) bool, ok bool) {
+	if CommunityMode(cfg.Community) == CommunityOff || s.Community == nil { return nil, false }
+	cu, ok := s.Community(u)
+	if !ok { return nil, false }
+	return func(c uint64) bool {
+		cc, ok := s.Community(c)
+		return ok && cc == cu
+	}, true
+}
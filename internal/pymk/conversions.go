@@ -0,0 +1,83 @@
+package pymk
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// -------- Conversion attribution --------
+// The last suggestions served to each user are remembered for
+// ConversionWindow. A follow of one of them within the window counts as a
+// conversion at the rank it was shown, an online quality signal for the
+// ranker.
+
+// maxServed bounds the users whose last suggestions are remembered; past
+// it, expired lists are swept and then arbitrary ones dropped.
+const maxServed = 1 << 20
+
+type served struct {
+	at  time.Time
+	ids []uint64 // rank order; 0 once converted
+}
+
+type servedLog struct {
+	mu sync.Mutex
+	m  map[uint64]served
+}
+
+// Served records res as shown to u, replacing what u was shown before.
+func (s *Service) Served(u uint64, res []Suggestion) {
+	window := s.Config().ConversionWindow
+	if window <= 0 || len(res) == 0 { return }
+	ids := make([]uint64, len(res))
+	for i, r := range res { ids[i] = r.UserID }
+	now := time.Now()
+	l := &s.served
+	l.mu.Lock(); defer l.mu.Unlock()
+	if l.m == nil { l.m = make(map[uint64]served) }
+	if _, ok := l.m[u]; !ok && len(l.m) >= maxServed {
+		for x, e := range l.m {
+			if now.Sub(e.at) > window { delete(l.m, x) }
+		}
+		for x := range l.m {
+			if len(l.m) < maxServed { break }
+			delete(l.m, x)
+		}
+	}
+	l.m[u] = served{at: now, ids: ids}
+}
+
+// Followed reports u's follow of v: if v was among the suggestions last
+// served to u within the window, it counts a conversion and logs the
+// rank (1-based). Each shown suggestion converts at most once.
+func (s *Service) Followed(u, v uint64) {
+	window := s.Config().ConversionWindow
+	if window <= 0 { return }
+	l := &s.served
+	l.mu.Lock()
+	e, ok := l.m[u]
+	i := -1
+	if ok && time.Since(e.at) <= window { i = slices.Index(e.ids, v) }
+	if i >= 0 { e.ids[i] = 0 }
+	l.mu.Unlock()
+	if i < 0 || v == 0 { return }
+	metrics.PYMKConversions.WithLabelValues(s.tenant).Inc()
+	metrics.PYMKConversionRank.WithLabelValues(s.tenant).Observe(float64(i + 1))
+	slog.Info("pymk conversion", "tenant", s.tenant, "user", u, "candidate", v, "rank", i+1,
+		"after", time.Since(e.at).Round(time.Second))
+}
+
+// ShownRank returns the 1-based rank at which v was last suggested to u
+// within the window, or 0.
+func (s *Service) ShownRank(u, v uint64) int {
+	window := s.Config().ConversionWindow
+	l := &s.served
+	l.mu.Lock(); defer l.mu.Unlock()
+	e, ok := l.m[u]
+	if !ok || window <= 0 || time.Since(e.at) > window { return 0 }
+	return slices.Index(e.ids, v) + 1
+}
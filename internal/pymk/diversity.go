@@ -0,0 +1,35 @@
+package pymk
+
+import "sort"
+
+// diverse returns the k best of out, by score, taking at most perVia
+// candidates introduced by the same mutual (their strongest one; 0 = no
+// limit), so a single well-connected friend cannot fill the list, and at
+// most maxCross candidates for which cross holds (nil = none do). If too
+// few candidates remain within the limits, the best of the rest fill it
+// up.
+func diverse(out []scored, k, perVia int, cross func(id uint64) bool, maxCross int) []scored {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score { return out[i].score > out[j].score }
+		return out[i].id < out[j].id
+	})
+	top := make([]scored, 0, min(k, len(out)))
+	var over []scored // skipped for a limit, best first
+	per := make(map[uint64]int)
+	crossed := 0
+	for _, c := range out {
+		if len(top) == k { break }
+		x := cross != nil && cross(c.id)
+		if (perVia > 0 && per[c.via] >= perVia) || (x && crossed >= maxCross) {
+			if len(over) < k { over = append(over, c) }
+			continue
+		}
+		per[c.via]++
+		if x { crossed++ }
+		top = append(top, c)
+	}
+	if len(top) < k && len(over) > 0 {
+		top = append(top, over[:min(k-len(top), len(over))]...)
+	}
+	return top
+}
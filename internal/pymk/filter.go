@@ -0,0 +1,17 @@
+package pymk
+
+import (
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+)
+
+// matcher returns the test candidates of u must pass under the configured
+// filter and the request's, or nil when neither filters anything.
+func (s *Service) matcher(u uint64, cfg PYMKConfig, req *attrs.Filter) func(c uint64) bool {
+	base, _ := attrs.ParseFilter(cfg.Filter) // validated with the config
+	f := base.And(req)
+	if f == nil || s.Subject == nil { return nil }
+	viewer, now := s.Subject(u), time.Now()
+	return func(c uint64) bool { return f.Match(viewer, s.Subject(c), now) }
+}
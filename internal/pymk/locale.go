@@ -0,0 +1,26 @@
+package pymk
+
+import (
+	"fmt"
+	"math"
+)
+
+// ValidCrossLocale checks a cross_locale ratio.
+func ValidCrossLocale(r float64) error {
+	if math.IsNaN(r) || r < 0 || r > 1 { return fmt.Errorf("cross_locale must be in [0, 1], got %v", r) }
+	return nil
+}
+
+// crossLocale returns whether a candidate is known to be in another
+// locale than u, or nil when there is no preference to apply: a
+// cross_locale of 1, or no known language for u. Candidates of unknown
+// locale count as same-locale.
+func (s *Service) crossLocale(u uint64, cfg PYMKConfig) func(uint64) bool {
+	if cfg.CrossLocale >= 1 || s.Subject == nil { return nil }
+	viewer := s.Subject(u).Attrs
+	if viewer.Language == "" { return nil }
+	return func(c uint64) bool {
+		same, ok := viewer.SameLocale(s.Subject(c).Attrs)
+		return ok && !same
+	}
+}
@@ -0,0 +1,120 @@
+package pymk
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Score normalizations: how each feature is scaled before weighting.
+const (
+	NormNone   = "none"   // raw feature values
+	NormMinMax = "minmax" // divided by this request's maximum (the default)
+	NormGlobal = "global" // divided by a running average of per-request maxima
+	NormZScore = "zscore" // standardized against running mean and deviation
+)
+
+// NormalizationName returns the normalization that mode selects, resolving the
+// empty default.
+func NormalizationName(mode string) string {
+	if mode == "" { return NormMinMax }
+	return mode
+}
+
+func ValidNormalization(mode string) error {
+	switch NormalizationName(mode) {
+	case NormNone, NormMinMax, NormGlobal, NormZScore:
+		return nil
+	}
+	return fmt.Errorf("normalization must be none, minmax, global or zscore, not %q", mode)
+}
+
+// normDecay is the weight of each computed request in the running
+// statistics; about the last few hundred requests count.
+const normDecay = 0.01
+
+const nFeatures = 6 // common, jaccard, aa, cosine, interest, topics
+
+func features(c *scored) [nFeatures]float64 {
+	return [nFeatures]float64{c.wcommon, c.jaccard, c.aa, c.cos, c.interest, float64(c.topics)}
+}
+
+// featureStats tracks each feature across requests as exponentially
+// weighted averages of the per-request mean, mean square and maximum, so
+// the global modes follow drift in the graph without storing history.
+type featureStats struct {
+	mu   sync.Mutex
+	seen bool
+	mean [nFeatures]float64
+	sq   [nFeatures]float64
+	peak [nFeatures]float64
+}
+
+// update folds one request's candidates in and returns the resulting
+// per-feature mean, deviation and typical maximum.
+func (f *featureStats) update(out []scored) (mean, dev, peak [nFeatures]float64) {
+	var m, q, x [nFeatures]float64
+	for i := range out {
+		v := features(&out[i])
+		for j := range v {
+			m[j] += v[j]
+			q[j] += v[j] * v[j]
+			x[j] = math.Max(x[j], v[j])
+		}
+	}
+	for j := range m {
+		m[j] /= float64(len(out))
+		q[j] /= float64(len(out))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.seen {
+		f.mean, f.sq, f.peak, f.seen = m, q, x, true
+	} else {
+		for j := range m {
+			f.mean[j] += normDecay * (m[j] - f.mean[j])
+			f.sq[j] += normDecay * (q[j] - f.sq[j])
+			f.peak[j] += normDecay * (x[j] - f.peak[j])
+		}
+	}
+	for j := range dev { dev[j] = math.Sqrt(math.Max(0, f.sq[j]-f.mean[j]*f.mean[j])) }
+	return f.mean, dev, f.peak
+}
+
+// score sets each candidate's score: the weighted sum of its features
+// after the configured normalization.
+func (s *Service) score(out []scored, cfg PYMKConfig) {
+	if len(out) == 0 { return }
+	w := [nFeatures]float64{cfg.WCommon, cfg.WJaccard, cfg.WAA, cfg.WCosine, cfg.WInterest, cfg.WTopics}
+	var shift, scale [nFeatures]float64 // normalized = (x - shift) * scale
+	switch NormalizationName(cfg.Normalization) {
+	case NormNone:
+		scale = [nFeatures]float64{1, 1, 1, 1, 1, 1}
+	case NormMinMax:
+		var x [nFeatures]float64
+		for i := range out {
+			v := features(&out[i])
+			for j := range v { x[j] = math.Max(x[j], v[j]) }
+		}
+		for j := range x {
+			if x[j] > 0 { scale[j] = 1 / x[j] }
+		}
+	case NormGlobal:
+		_, _, x := s.norm.update(out)
+		for j := range x {
+			if x[j] > 0 { scale[j] = 1 / x[j] }
+		}
+	case NormZScore:
+		mean, dev, _ := s.norm.update(out)
+		shift = mean
+		for j := range dev {
+			if dev[j] > 0 { scale[j] = 1 / dev[j] }
+		}
+	}
+	for i := range out {
+		v := features(&out[i])
+		sc := 0.0
+		for j := range v { sc += w[j] * (v[j] - shift[j]) * scale[j] }
+		out[i].score = sc
+	}
+}
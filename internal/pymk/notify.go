@@ -0,0 +1,55 @@
+package pymk
+
+import "sync"
+
+// Why a user's suggestions may have changed, as told to watchers.
+const (
+	RefreshPrecomputed = "precomputed" // Warm cached a fresh result
+	RefreshInvalidated = "invalidated" // dropped through someone else's edges
+)
+
+// Notifier tells watchers of a user when fresher suggestions are
+// available, so clients can refresh instead of polling. Notifications
+// coalesce: a watcher that has not read the last one gets only the
+// latest reason.
+type Notifier struct {
+	mu   sync.Mutex
+	subs map[uint64]map[chan string]struct{}
+}
+
+func NewNotifier() *Notifier { return &Notifier{subs: make(map[uint64]map[chan string]struct{})} }
+
+// Watch subscribes to u's notifications until stop is called.
+func (n *Notifier) Watch(u uint64) (c <-chan string, stop func()) {
+	ch := make(chan string, 1)
+	n.mu.Lock()
+	if n.subs[u] == nil { n.subs[u] = make(map[chan string]struct{}) }
+	n.subs[u][ch] = struct{}{}
+	n.mu.Unlock()
+	return ch, func() {
+		n.mu.Lock(); defer n.mu.Unlock()
+		delete(n.subs[u], ch)
+		if len(n.subs[u]) == 0 { delete(n.subs, u) }
+	}
+}
+
+// Notify tells the watchers of users, never blocking. A nil Notifier
+// does nothing.
+func (n *Notifier) Notify(reason string, users ...uint64) {
+	if n == nil { return }
+	n.mu.Lock(); defer n.mu.Unlock()
+	if len(n.subs) == 0 { return }
+	for _, u := range users {
+		for ch := range n.subs[u] {
+			select {
+			case ch <- reason:
+			default: // replace the unread one
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- reason
+			}
+		}
+	}
+}
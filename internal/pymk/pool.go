@@ -0,0 +1,32 @@
+package pymk
+
+import "sync"
+
+// buffers are one request's reusable scratch space: the one-hop set, the
+// expansion sources and the scored and ranked candidates. They come from
+// a pool, so requests at high QPS mostly reuse the previous ones' memory
+// instead of allocating it again (candidate tables have their own pool,
+// see getCandidates).
+type buffers struct {
+	oneHop  map[uint64]struct{}
+	sources []uint64
+	out     []scored
+	top     minHeap
+}
+
+// maxPooledEntries bounds the buffers kept for reuse, so one request of a
+// huge neighborhood does not pin its memory.
+const maxPooledEntries = 1 << 16
+
+var bufPool = sync.Pool{New: func() any { return &buffers{oneHop: make(map[uint64]struct{}, 256)} }}
+
+func getBuffers() *buffers { return bufPool.Get().(*buffers) }
+
+func putBuffers(b *buffers) {
+	if len(b.oneHop) > maxPooledEntries || cap(b.sources) > maxPooledEntries || cap(b.out) > maxPooledEntries { return }
+	clear(b.oneHop)
+	clear(b.out[:cap(b.out)]) // drop boost maps and the like
+	clear(b.top[:cap(b.top)])
+	b.sources, b.out, b.top = b.sources[:0], b.out[:0], b.top[:0]
+	bufPool.Put(b)
+}
@@ -0,0 +1,38 @@
+package pymk
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// BenchmarkPYMK runs uncached requests over a random graph, so the pooled
+// buffers and candidate tables are reused from one request to the next.
+// Watch allocs/op: it should not grow with the neighborhood.
+func BenchmarkPYMK(b *testing.B) {
+	const users, degree = 20_000, 40
+	ctx := context.Background()
+	g := graph.NewMemGraph()
+	r := rand.New(rand.NewPCG(1, 2))
+	for u := uint64(1); u <= users; u++ {
+		for i := 0; i < degree; i++ {
+			if _, err := g.Follow(ctx, u, 1+r.Uint64N(users)); err != nil { b.Fatal(err) }
+		}
+	}
+	s := NewService(g, nil, PYMKConfig{
+		MaxExpandPerNeighbor: 200,
+		MaxCandidates:        20000,
+		WCommon:              1.00,
+		WJaccard:             0.60,
+		WAA:                  0.80,
+		K:                    20,
+		SampleSeed:           1,
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := s.PYMK(ctx, 1+uint64(n)%users, Query{}); err != nil { b.Fatal(err) }
+	}
+}
@@ -1,43 +1,31 @@
 package pymk
 
 import (
+	"cmp"
 	"container/heap"
+	"context"
+	"errors"
+	"log/slog"
 	"math"
+	"math/rand/v2"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
 	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/flags"
 	"github.com/pandharkardeep/social-graph/internal/graph"
 	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+	"github.com/pandharkardeep/social-graph/internal/tracing"
 )
 
 // -------- Utilities --------
-func intersectCount(a, b map[uint64]struct{}, capAt int) (cnt int) {
-	// iterate smaller
-	if len(a) > len(b) {
-		a, b = b, a
-	}
-	for x := range a {
-		if _, ok := b[x]; ok {
-			cnt++
-			if capAt > 0 && cnt >= capAt {
-				return
-			}
-		}
-	}
-	return
-}
-func unionSize(a, b map[uint64]struct{}) int {
-	inter := intersectCount(a, b, 0)
-	return len(a) + len(b) - inter
-}
-func toStdSet(s graph.Store, ids []uint64) map[uint64]struct{} {
-	if len(ids) == 0 { return nil }
-	m := make(map[uint64]struct{}, len(ids))
-	for _, id := range ids { m[id] = struct{}{} }
-	return m
-}
-
 func cosine(a, b []float32) float64 {
 	if len(a) == 0 || len(a) != len(b) { return 0 }
 	var dot, na, nb float64
@@ -54,198 +42,712 @@ func cosine(a, b []float32) float64 {
 	return res
 }
 
+// bloomMinOneHop is the one-hop size from which the Bloom filter pays
+// off. Measured on random probes (BenchmarkOneHopProbe): below ~50k
+// entries the map still fits in cache and wins (≈20ns vs ≈28ns per
+// probe); at 100k the filter is ahead (≈35ns vs ≈47ns).
+const bloomMinOneHop = 50_000
+
 // -------- Public types --------
 type Suggestion struct {
 	UserID uint64  `json:"user_id"`
 	Score  float64 `json:"score"`
 	Why    struct {
 		CommonNeighbors int     `json:"common_neighbors"`
+		WeightedCommon  float64 `json:"weighted_common_neighbors,omitempty"` // with edge_weights or recency_boost on
 		Jaccard         float64 `json:"jaccard"`
 		AdamicAdar      float64 `json:"adamic_adar"`
 		Cosine          float64 `json:"cosine"`
+		InterestOverlap float64 `json:"interest_overlap"`
+		CommonTopics    int     `json:"common_topics"`
+		Boosts          map[string]float64 `json:"boosts,omitempty"` // boost rules applied, by name
 	} `json:"why"`
 }
 
 type PYMKConfig struct {
-	MaxExpandPerNeighbor int
-	MaxCandidates        int
-	WCommon              float64
-	WJaccard             float64
-	WAA                  float64
-	WCosine              float64
-	CacheSize            int
-	CacheTTL             time.Duration
+	Tenant               string        `yaml:"-" json:"-"` // metrics label; set by the tenant registry
+	MaxExpandPerNeighbor int           `yaml:"max_expand_per_neighbor" json:"max_expand_per_neighbor"`
+	MaxCandidates        int           `yaml:"max_candidates" json:"max_candidates"` // candidate table bound per request; 0 = unbounded
+	WCommon              float64       `yaml:"w_common" json:"w_common"`
+	WJaccard             float64       `yaml:"w_jaccard" json:"w_jaccard"`
+	WAA                  float64       `yaml:"w_aa" json:"w_aa"`
+	WCosine              float64       `yaml:"w_cosine" json:"w_cosine"`
+	WInterest            float64       `yaml:"w_interest" json:"w_interest"` // weighted Jaccard of interest tags
+	WTopics              float64       `yaml:"w_topics" json:"w_topics"` // topics followed by both
+	TopicFanout          int           `yaml:"topic_fanout" json:"topic_fanout"` // followers read per topic the requester follows; 0 = topics add no candidates
+	EdgeWeights          string        `yaml:"edge_weights" json:"edge_weights"` // off | min | geomean: weigh common neighbors and AA by interaction weights; "" = off
+	RecencyBoost         float64       `yaml:"recency_boost" json:"recency_boost"` // extra weight of paths through a just-made connection; 0 = off
+	RecencyHalfLife      time.Duration `yaml:"recency_half_life" json:"recency_half_life"` // that extra weight halves this often
+	CacheSize            int           `yaml:"cache_size" json:"cache_size"`
+	CacheTTL             time.Duration `yaml:"cache_ttl" json:"cache_ttl"`
+	Parallelism          int           `yaml:"parallelism" json:"parallelism"` // expansion workers; 0 = GOMAXPROCS, 1 = sequential
+	SampleSeed           int64         `yaml:"sample_seed" json:"sample_seed"` // neighbor sampling past max_expand_per_neighbor; 0 = fresh per request
+	Normalization        string        `yaml:"normalization" json:"normalization"` // none | minmax | global | zscore; "" = minmax
+	Timeout              time.Duration `yaml:"timeout" json:"timeout"` // per computed request; 0 = none
+	K                    int           `yaml:"k" json:"k"` // suggestions when a request names no k; 0 = 20
+	MaxPerMutual         int           `yaml:"max_per_mutual" json:"max_per_mutual"` // diversity: suggestions sharing a strongest mutual; 0 = no limit
+	Community            string        `yaml:"community" json:"community"` // off | restrict | boost; "" = off
+	CommunityBoost       float64       `yaml:"community_boost" json:"community_boost"` // added to same-community scores in boost mode
+	ConversionWindow     time.Duration `yaml:"conversion_window" json:"conversion_window"` // follows this soon after a suggestion count as conversions; 0 = off
+	Filter               string        `yaml:"filter" json:"filter"` // attribute filter every candidate must pass; see attrs.ParseFilter
+	Boosts               []Boost       `yaml:"boosts" json:"boosts"` // score adjustments on attributes; see boost.go
+	CrossLocale          float64       `yaml:"cross_locale" json:"cross_locale"` // most of the k from another locale while same-locale candidates remain; 1 = no preference
+	ApproxSamples        int           `yaml:"approx_samples" json:"approx_samples"` // past this many two-hop entries, sample connectors with reweighting; 0 = always exact; see approx.go
+}
+
+// Query is one PYMK request's parameters.
+type Query struct {
+	K       int                 // suggestions; 0 = the configured k
+	Exclude map[uint64]struct{} // never suggested
+	Filter  *attrs.Filter       // candidates must pass it as well as the configured one
+	// Emit, when set, receives the suggestions in rank order a bucket at
+	// a time, as ranking settles them, so a caller can pass the first ones
+	// on before the rest are ordered. An error from it stops the request.
+	Emit   func([]Suggestion) error
+	Bucket int // suggestions per Emit call; 0 = DefaultBucket
+	// Budget, when > 0, bounds the computation: past it expansion stops
+	// and the candidates not scored yet are ranked on the features already
+	// known (common neighbors, Adamic–Adar...), skipping the per-candidate
+	// reads. The result is then partial and comes with ErrOverBudget.
+	Budget time.Duration
+
+	warm bool // from Warm: a computed result is announced to Notify
 }
 
+// ErrOverBudget comes with the best-so-far suggestions of a request that
+// ran out of its Query.Budget. They are not cached.
+var ErrOverBudget = errors.New("pymk: latency budget exceeded, results are partial")
+
+// DefaultBucket is how many suggestions each Query.Emit call gets by
+// default.
+const DefaultBucket = 10
+
 type Service struct {
 	G graph.Store
 	E embeds.Store
-	C PYMKConfig
+	// Eligible, when set, filters candidates (e.g. deactivated users). It
+	// is also applied to cached results, so status changes show at once.
+	Eligible func(id uint64) bool
+
+	// Flags gates experimental candidate sources per user; nil turns
+	// them all off.
+	Flags *flags.Set
+
+	// Community, when set, returns a user's community for the community
+	// modes; see community.go.
+	Community func(u uint64) (uint64, bool)
 
-	cacheMu sync.RWMutex
+	// Subject, when set, returns what attribute filters see of a user;
+	// without it filters are ignored.
+	Subject func(u uint64) attrs.Subject
+
+	// Topics, when set, adds people following the requester's topics to
+	// the candidates; see topics.go.
+	Topics TopicGraph
+
+	// Weights, when set, holds the interaction weights edge_weights reads;
+	// see weights.go.
+	Weights *graph.Weights
+
+	// Times, when set, holds the follow times recency weighting reads;
+	// see recency.go.
+	Times *graph.FollowTimes
+
+	// Notify, when set, hears of precomputed and invalidated results;
+	// see notify.go.
+	Notify *Notifier
+
+	// Read, when set, serves the reads of neighbor expansion (degrees and
+	// followees of u's neighbors and candidates) in place of the request's
+	// view of G, e.g. from lock-free frozen views (graph.FrozenReads),
+	// trading consistency for lock freedom. u's own sets always come from
+	// the view.
+	Read graph.Store
+
+	// TTL, when set, shortens the cache TTL for users it returns a
+	// positive duration for, e.g. those whose edges change often.
+	TTL func(u uint64) time.Duration
+
+	tenant string
+	cfg    atomic.Pointer[PYMKConfig]
+
+	cacheMu sync.Mutex // the LRU reorders on Get, so every access writes
 	cache   *lruCache
+
+	// Bumped by Invalidate, per stripe of users, and by SetConfig; see
+	// Generation.
+	gens   [genStripes]atomic.Uint64
+	cfgGen atomic.Uint64
+
+	norm featureStats // running statistics for the global normalizations
+
+	served servedLog // last suggestions shown per user, for conversions.go
 }
 
 func NewService(g graph.Store, e embeds.Store, cfg PYMKConfig) *Service {
-	s := &Service{G: g, E: e, C: cfg}
-	s.cache = newLRU(cfg.CacheSize, cfg.CacheTTL)
-	s.cache.onHit  = func(){ metrics.PYMKCache.WithLabelValues("hit").Inc() }
-	s.cache.onMiss = func(){ metrics.PYMKCache.WithLabelValues("miss").Inc() }
-	s.cache.onEvict= func(){ metrics.PYMKCache.WithLabelValues("evict").Inc() }
+	s := &Service{G: g, E: e, tenant: cfg.Tenant}
+	s.cfg.Store(&cfg)
+	s.cache = s.newCache(cfg)
 	return s
 }
 
+func (s *Service) newCache(cfg PYMKConfig) *lruCache {
+	c := newLRU(cfg.CacheSize)
+	c.onHit  = func(){ metrics.PYMKCache.WithLabelValues(s.tenant, "hit").Inc() }
+	c.onMiss = func(){ metrics.PYMKCache.WithLabelValues(s.tenant, "miss").Inc() }
+	c.onEvict= func(){ metrics.PYMKCache.WithLabelValues(s.tenant, "evict").Inc() }
+	return c
+}
+
+// Config returns the config in effect.
+func (s *Service) Config() PYMKConfig { return *s.cfg.Load() }
+
+// SetConfig replaces the config of a live service. Requests already
+// running finish with the old one. The cache is dropped, since its
+// entries were ranked with the old weights and sized by the old limits.
+func (s *Service) SetConfig(cfg PYMKConfig) {
+	cfg.Tenant = s.tenant
+	s.cfg.Store(&cfg)
+	s.cacheMu.Lock()
+	s.cache = s.newCache(cfg)
+	s.cacheMu.Unlock()
+	s.cfgGen.Add(1)
+}
+
+// genStripes bounds the invalidation generations kept: users share a
+// counter per stripe, so an invalidation may also change the generation
+// of unrelated users, never fail to change the one of its own.
+const genStripes = 4096
+
+// Generation changes whenever u's results may have gone stale other than
+// through u's epoch: an Invalidate naming u, or a new config. Together
+// with the epoch it tells a client whether its copy is still current.
+func (s *Service) Generation(u uint64) uint64 {
+	return s.gens[u%genStripes].Load() + s.cfgGen.Load()
+}
+
+func (s *Service) cacheGet(key cacheKey) ([]Suggestion, bool) {
+	s.cacheMu.Lock(); defer s.cacheMu.Unlock()
+	return s.cache.Get(key)
+}
+
+func (s *Service) cacheSet(key cacheKey, val []Suggestion) {
+	ttl := s.Config().CacheTTL
+	if s.TTL != nil {
+		if d := s.TTL(key.user); d > 0 && d < ttl { ttl = d }
+	}
+	s.cacheMu.Lock(); defer s.cacheMu.Unlock()
+	s.cache.Set(key, val, ttl)
+}
+
+// Invalidate drops the cached suggestions of users. The epoch in the
+// cache key only covers a user's own edges; this is for results that went
+// stale through someone else's, e.g. a mutual's new follow.
+func (s *Service) Invalidate(users ...uint64) int {
+	s.cacheMu.Lock(); defer s.cacheMu.Unlock()
+	n := 0
+	for _, u := range users {
+		n += s.cache.Invalidate(u)
+		s.gens[u%genStripes].Add(1)
+	}
+	if n > 0 { metrics.PYMKCache.WithLabelValues(s.tenant, "invalidate").Add(float64(n)) }
+	s.Notify.Notify(RefreshInvalidated, users...)
+	return n
+}
+
 // Stats per candidate while expanding
 type candStats struct {
-	common int
-	aa     float64
+	id      uint64
+	common  int
+	wcommon float64 // common weighted by the connecting edges; see weights.go
+	aa      float64
+	via     uint64  // the mutual of highest Adamic–Adar weight, i.e. lowest degree
+	viaW    float64 // its weight
+	topics  int     // topics followed by both, among those sampled
 }
 
 type scored struct {
 	id       uint64
 	common   int
+	wcommon  float64
 	jaccard  float64
 	aa       float64
 	cos      float64
+	interest float64
+	topics   int
 	score    float64
+	via      uint64
+	boosts   map[string]float64 // rules applied, by name
 }
 
-// The core PYMK algorithm with caching & fan-out caps.
-func (s *Service) PYMK(u uint64, k int, exclude map[uint64]struct{}) []Suggestion {
+// The core PYMK algorithm with caching & fan-out caps. Each stage is
+// traced as a child span of ctx.
+//
+// Computation stops once ctx is done (or the configured timeout passes):
+// cut short during expansion it returns no suggestions, during scoring the
+// best of the candidates scored so far. Either way the error is ctx.Err()
+// and nothing is cached. Any store error fails the whole request. A
+// Query.Budget, unlike the timeout, always yields a ranking; see there.
+func (s *Service) PYMK(ctx context.Context, u uint64, q Query) ([]Suggestion, error) {
+	cfg := s.Config()
+	k, exclude := q.K, q.Exclude
+	if k <= 0 { k = cfg.K }
 	if k <= 0 { k = 20 }
-	epoch := s.G.UserEpoch(u)
+	ctx, span := tracing.Start(ctx, "pymk", attribute.Int64("user", int64(u)), attribute.Int("k", k))
+	defer span.End()
+	epoch, err := s.G.UserEpoch(ctx, u)
+	if err != nil { return nil, err }
+	start := time.Now()
 
 	// 0) Cache
-	key := cacheKey{user: u, k: k, epoch: epoch}
-	if got, ok := s.cache.Get(key); ok {
-		return got
+	key := cacheKey{user: u, k: k, epoch: epoch, filter: q.Filter.String()}
+	if got, ok := s.cacheGet(key); ok {
+		span.SetAttributes(attribute.Bool("cache_hit", true))
+		res := s.eligible(got)
+		s.observe("total", "cache", start)
+		if q.Emit != nil {
+			if err := emitBuckets(res, q); err != nil { return nil, err }
+		}
+		return res, nil
 	}
+	span.SetAttributes(attribute.Bool("cache_hit", false))
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	defer s.observe("total", "computed", start)
+	_, stage := tracing.Start(ctx, "pymk.expand")
+	t := start
+
+	// Every read below goes through one view, so features computed at
+	// different times agree with each other (see graph.View).
+	view := s.G.View()
+	defer view.Close()
+	rd := graph.Reader(view)
+	if s.Read != nil { rd = s.Read }
 
 	// 1) One-hop sets
-	outU := toStdSet(s.G, s.G.Following(u))
-	inU  := toStdSet(s.G, s.G.Followers(u))
+	outU, err := view.FollowingSet(ctx, u)
+	if err != nil { return nil, err }
+	inU, err := view.FollowersSet(ctx, u)
+	if err != nil { return nil, err }
 
-	oneHop := make(map[uint64]struct{}, len(outU)+len(inU))
-	for x := range outU { oneHop[x] = struct{}{} }
-	for x := range inU  { oneHop[x] = struct{}{} }
+	buf := getBuffers()
+	defer putBuffers(buf)
+	oneHop := buf.oneHop
+	add := func(x uint64) bool { oneHop[x] = struct{}{}; return true }
+	outU.Each(add)
+	inU.Each(add)
+
+	// Large one-hop sets get a Bloom filter in front of the map: most
+	// candidates are not neighbors, and a miss costs a few cached bit
+	// probes instead of a map lookup. Hits are confirmed exactly.
+	var bf *sketch.Bloom
+	if len(oneHop) >= bloomMinOneHop {
+		bf = sketch.NewBloom(len(oneHop), 0.01)
+		for x := range oneHop { bf.Add(x) }
+	}
+	isOneHop := func(c uint64) bool {
+		if bf != nil && !bf.MayContain(c) { return false }
+		_, ok := oneHop[c]
+		return ok
+	}
 
 	// 2) Expand two-hop
-	stats := make(map[uint64]*candStats, 1024)
-	expand := func(src map[uint64]struct{}) {
-		for n := range src {
-			neighbors := s.G.Following(n) // bias: outgoing neighbors
-			if s.C.MaxExpandPerNeighbor > 0 && len(neighbors) > s.C.MaxExpandPerNeighbor {
-				neighbors = neighbors[:s.C.MaxExpandPerNeighbor]
-			}
-			degN := s.G.DegreeOut(n) + s.G.DegreeIn(n)
-			aaWeight := 0.0
-			if degN > 0 {
-				aaWeight = 1.0 / math.Log(float64(1+degN)+1e-9)
-			}
-			for _, c := range neighbors {
-				if c == u { continue }
-				if _, ok := oneHop[c]; ok { continue }
-				if exclude != nil {
-					if _, bad := exclude[c]; bad { continue }
-				}
-				cs := stats[c]
-				if cs == nil {
-					cs = &candStats{}
-					stats[c] = cs
-				}
-				cs.common++
-				cs.aa += aaWeight
-				if s.C.MaxCandidates > 0 && len(stats) >= s.C.MaxCandidates {
-					// soft cap; keep accumulating for existing keys
-				}
+	sameCommunity, scoped := s.community(u, cfg)
+	restrict := scoped && CommunityMode(cfg.Community) == CommunityRestrict
+	match := s.matcher(u, cfg, q.Filter)
+	var scanned, capped atomic.Int64 // adjacency entries expanded / left out by MaxExpandPerNeighbor, across workers
+	salt := uint64(cfg.SampleSeed)
+	if salt == 0 { salt = rand.Uint64() }
+	var failed firstErr // store errors, across workers
+	ew := s.edgeWeighting(cfg)
+	rec := s.recency(u, cfg, start)
+	var budgetEnd time.Time
+	if q.Budget > 0 { budgetEnd = start.Add(q.Budget) }
+	overBudget := func() bool { return q.Budget > 0 && time.Now().After(budgetEnd) }
+	invP, approx := 1.0, false // see approx.go
+	// allowed reports whether c may be a candidate; admitted ones already
+	// passed the filter.
+	allowed := func(c uint64, admitted bool) bool {
+		if c == u || isOneHop(c) { return false }
+		if exclude != nil {
+			if _, bad := exclude[c]; bad { return false }
+		}
+		if s.Eligible != nil && !s.Eligible(c) { return false }
+		if restrict && !sameCommunity(c) { return false }
+		return admitted || match == nil || match(c)
+	}
+	// expandOne credits n's followees. Its state lives in cands, whose
+	// visit callback is made once per table rather than once per neighbor.
+	expandOne := func(n uint64, cands *candidates) {
+		if ctx.Err() != nil || failed.get() != nil || overBudget() { return }
+		outN, err := rd.DegreeOut(ctx, n)
+		if err != nil { failed.set(err); return }
+		inN, err := rd.DegreeIn(ctx, n)
+		if err != nil { failed.set(err); return }
+		degN := outN + inN
+		cur := &cands.cur
+		*cur = neighbor{id: n, wUN: 1, fresh: 1, ipw: invP} // ipw: inverse propensity; 1 unless approximating
+		if degN > 0 {
+			cur.aa = 1.0 / math.Log(float64(1+degN)+1e-9)
+		}
+		if ew != nil { cur.wUN = ew.edge(u, n) }
+		if rec != nil { cur.fresh = rec(n) }
+		if cands.visit == nil {
+			cands.visit = func(c uint64) bool {
+				cur := &cands.cur
+				cur.seen++
+				if !allowed(c, cands.get(c) != nil) { return true }
+				wt := cur.fresh * cur.ipw
+				if ew != nil { wt *= ew.path(cur.wUN, ew.edge(cur.id, c)) }
+				cands.hit(c, cur.id, cur.aa, wt)
+				return true
 			}
 		}
+		// bias: outgoing neighbors. Past the cap, expand a uniform sample
+		// rather than whatever prefix map order yields.
+		if limit := cfg.MaxExpandPerNeighbor; limit > 0 && outN > limit {
+			sample, err := sampleFollowing(ctx, rd, n, limit, salt, cands)
+			if err != nil { failed.set(err); return }
+			if approx && len(sample) > 0 { cur.ipw *= float64(outN) / float64(len(sample)) }
+			for _, c := range sample { cands.visit(c) }
+			scanned.Add(int64(len(sample)))
+			capped.Add(int64(outN - len(sample)))
+			return
+		}
+		failed.set(rd.ForEachFollowing(ctx, n, cands.visit))
+		scanned.Add(int64(cur.seen))
+	}
+	// Both directions are expanded, so a mutual neighbor counts twice.
+	sources := buf.sources
+	collect := func(n uint64) bool { sources = append(sources, n); return true }
+	outU.Each(collect)
+	inU.Each(collect)
+	buf.sources = sources
+	if len(sources) > 0 {
+		kept, w, err := s.approxPlan(ctx, rd, sources, cfg, salt)
+		if err != nil { return nil, err }
+		if kept != nil { sources, invP, approx = kept, w, true }
+	}
+	span.SetAttributes(attribute.Bool("approximate", approx))
+	stats, hits, rejected := s.expand(sources, cfg.MaxCandidates, expandOne)
+	defer putCandidates(stats)
+	invP = 1 // three-hop sources below were not sampled
+	if stats.len() > 0 && stats.len() < k && s.Flags.Enabled(FlagThreeHop, u) {
+		s.threeHop(stats, cfg.MaxCandidates, expandOne)
+	}
+	if !overBudget() { s.topicCandidates(u, stats, cfg, func(c uint64) bool { return allowed(c, false) }) }
+	stage.SetAttributes(attribute.Int("one_hop", len(oneHop)), attribute.Int("candidates", stats.len()))
+	stage.End()
+	t = s.observe("expand", "computed", t)
+	metrics.PYMKCandidates.WithLabelValues(s.tenant, "computed").Observe(float64(stats.len()))
+	metrics.PYMKNeighborsScanned.WithLabelValues(s.tenant, "computed").Observe(float64(scanned.Load()))
+	if total := scanned.Load() + capped.Load(); total > 0 {
+		metrics.PYMKCapDropRatio.WithLabelValues(s.tenant, "max_expand_per_neighbor").Observe(float64(capped.Load()) / float64(total))
+	}
+	if hits > 0 && cfg.MaxCandidates > 0 {
+		metrics.PYMKCapDropRatio.WithLabelValues(s.tenant, "max_candidates").Observe(float64(rejected) / float64(hits))
 	}
-	expand(outU)
-	expand(inU)
 
-	if len(stats) == 0 {
-		s.cache.Set(key, []Suggestion{})
-		return []Suggestion{}
+	if err := ctx.Err(); err != nil {
+		s.cutShort("expand", err)
+		return []Suggestion{}, err
+	}
+	if err := failed.get(); err != nil { return nil, err }
+	over := overBudget()
+	if over { s.cutShort("expand", ErrOverBudget) }
+	if stats.len() == 0 {
+		if over { return []Suggestion{}, ErrOverBudget }
+		s.cacheSet(key, []Suggestion{})
+		if q.warm { s.Notify.Notify(RefreshPrecomputed, u) }
+		return []Suggestion{}, nil
 	}
 
 	// 3) Compute features for each candidate
-	degU := len(outU)
+	_, stage = tracing.Start(ctx, "pymk.features", attribute.Int("candidates", stats.len()))
+	degU := outU.Len()
 	var uvec []float32
 	if s.E != nil {
 		if v, ok := s.E.Get(u); ok { uvec = v }
 	}
+	var viewer attrs.Attrs
+	if s.Subject != nil && cfg.WInterest != 0 { viewer = s.Subject(u).Attrs }
 
-	var (
-		maxCommon int
-		maxJacc   float64
-		maxAA     float64
-		maxCos    float64
-	)
-	out := make([]scored, 0, len(stats))
-	for id, st := range stats {
-		outC := toStdSet(s.G, s.G.Following(id))
-		jacc := 0.0
-		if degU > 0 || len(outC) > 0 {
-			jacc = float64(intersectCount(outU, outC, 0)) / (float64(unionSize(outU, outC)) + 1e-9)
+	out := slices.Grow(buf.out, stats.len())
+	defer func() { buf.out = out }()
+	var inter, degC int
+	countC := func(v uint64) bool {
+		degC++
+		if outU.Has(v) { inter++ }
+		return true
+	}
+	for i := range stats.st {
+		st := &stats.st[i]
+		id := st.id
+		if len(out)%ctxCheckEvery == 0 {
+			if ctx.Err() != nil { break }
+			if !over && overBudget() { over = true; s.cutShort("features", ErrOverBudget) }
 		}
-		cos := 0.0
-		if uvec != nil && s.E != nil {
-			if v, ok := s.E.Get(id); ok {
-				cos = cosine(uvec, v)
+		// Over budget, the remaining candidates skip the reads below and
+		// rank on the features expansion already gave them.
+		jacc, cos := 0.0, 0.0
+		if !over {
+			inter, degC = 0, 0
+			if err := rd.ForEachFollowing(ctx, id, countC); err != nil {
+				if ctx.Err() != nil { break }
+				return nil, err
+			}
+			if degU > 0 || degC > 0 {
+				jacc = float64(inter) / (float64(degU+degC-inter) + 1e-9)
+			}
+			if uvec != nil && s.E != nil {
+				if v, ok := s.E.Get(id); ok {
+					cos = cosine(uvec, v)
+				}
 			}
 		}
+		interest := 0.0
+		if len(viewer.Interests) > 0 { interest = viewer.InterestOverlap(s.Subject(id).Attrs) }
 		sc := scored{
-			id:      id,
-			common:  st.common,
-			jaccard: jacc,
-			aa:      st.aa,
-			cos:     cos,
+			id:       id,
+			common:   st.common,
+			wcommon:  st.wcommon,
+			jaccard:  jacc,
+			aa:       st.aa,
+			cos:      cos,
+			interest: interest,
+			topics:   st.topics,
+			via:      st.via,
 		}
-		if sc.common > maxCommon { maxCommon = sc.common }
-		if sc.jaccard > maxJacc { maxJacc = sc.jaccard }
-		if sc.aa > maxAA { maxAA = sc.aa }
-		if sc.cos > maxCos { maxCos = sc.cos }
 		out = append(out, sc)
 	}
 
-	// 4) Weighted scoring with min-max normalization
-	for i := range out {
-		var nCommon, nJ, nAA, nCos float64
-		if maxCommon > 0 { nCommon = float64(out[i].common) / float64(maxCommon) }
-		if maxJacc   > 0 { nJ = out[i].jaccard / maxJacc }
-		if maxAA     > 0 { nAA = out[i].aa / maxAA }
-		if maxCos    > 0 { nCos = out[i].cos / maxCos }
-		out[i].score = s.C.WCommon*nCommon + s.C.WJaccard*nJ + s.C.WAA*nAA + s.C.WCosine*nCos
-	}
-
-	// 5) Top-K via min-heap
-	h := &minHeap{}; heap.Init(h)
-	for i := range out {
-		if h.Len() < k {
-			heap.Push(h, out[i])
-		} else if out[i].score > (*h)[0].score {
-			heap.Pop(h)
-			heap.Push(h, out[i])
+	// 4) Weighted scoring of normalized features
+	partial := ctx.Err()
+	if partial != nil { s.cutShort("features", partial) } else if over { partial = ErrOverBudget }
+	s.score(out, cfg)
+	if scoped && CommunityMode(cfg.Community) == CommunityBoost {
+		for i := range out {
+			if sameCommunity(out[i].id) { out[i].score += cfg.CommunityBoost }
 		}
 	}
+	s.boost(u, out, cfg)
+
+	stage.End()
+	t = s.observe("features", "computed", t)
 
-	res := make([]Suggestion, h.Len())
-	for i := len(res)-1; i >= 0; i-- {
-		it := heap.Pop(h).(scored)
+	// 5) Top-K via min-heap
+	_, stage = tracing.Start(ctx, "pymk.rank")
+	suggestion := func(it scored) Suggestion {
 		sug := Suggestion{UserID: it.id, Score: it.score}
 		sug.Why.CommonNeighbors = it.common
+		if ew != nil || rec != nil || approx { sug.Why.WeightedCommon = it.wcommon }
 		sug.Why.Jaccard = it.jaccard
 		sug.Why.AdamicAdar = it.aa
 		sug.Why.Cosine = it.cos
-		res[i] = sug
+		sug.Why.InterestOverlap = it.interest
+		sug.Why.CommonTopics = it.topics
+		sug.Why.Boosts = it.boosts
+		return sug
 	}
+	var res []Suggestion
+	if cross := s.crossLocale(u, cfg); cfg.MaxPerMutual > 0 || cross != nil {
+		for _, it := range diverse(out, k, cfg.MaxPerMutual, cross, int(cfg.CrossLocale*float64(k))) { res = append(res, suggestion(it)) }
+		if q.Emit != nil {
+			if err := emitBuckets(res, q); err != nil { return nil, err }
+		}
+	} else if q.Emit != nil {
+		// Streaming: heapify every candidate once (linear) and pop them in
+		// rank order, so the top bucket goes out after O(n + bucket·log n)
+		// rather than once all k are ordered.
+		h := maxHeap(out); heap.Init(&h)
+		bucket, sent := bucketSize(q), 0
+		for h.Len() > 0 && len(res) < k {
+			res = append(res, suggestion(h.popTop()))
+			if len(res)-sent == bucket || h.Len() == 0 || len(res) == k {
+				if err := q.Emit(res[sent:]); err != nil { return nil, err }
+				sent = len(res)
+			}
+		}
+	} else {
+		buf.top = topK(out, k, buf.top)
+		res = make([]Suggestion, len(buf.top))
+		for i, it := range buf.top { res[i] = suggestion(it) }
+	}
+	if res == nil { res = []Suggestion{} }
+
+	scores := metrics.PYMKScores.WithLabelValues(s.tenant)
+	for _, sug := range res { scores.Observe(sug.Score) }
+	stage.SetAttributes(attribute.Int("returned", len(res)))
+	stage.End()
+	s.observe("rank", "computed", t)
+	slog.DebugContext(ctx, "pymk computed", "tenant", s.tenant, "user_id", u, "k", k,
+		"one_hop", len(oneHop), "candidates", stats.len(), "returned", len(res))
 
 	// 6) Cache & return
-	s.cache.Set(key, res)
+	if partial != nil { return res, partial }
+	s.cacheSet(key, res)
+	if q.warm { s.Notify.Notify(RefreshPrecomputed, u) }
+	return res, nil
+}
+
+// firstErr keeps the first error reported by any expansion worker.
+type firstErr struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *firstErr) set(err error) {
+	if err == nil { return }
+	f.mu.Lock(); defer f.mu.Unlock()
+	if f.err == nil { f.err = err }
+}
+
+func (f *firstErr) get() error {
+	f.mu.Lock(); defer f.mu.Unlock()
+	return f.err
+}
+
+// ctxCheckEvery is how many candidates are scored between cancellation
+// checks.
+const ctxCheckEvery = 256
+
+func (s *Service) cutShort(stage string, err error) {
+	reason := "canceled"
+	if errors.Is(err, context.DeadlineExceeded) { reason = "deadline" }
+	if errors.Is(err, ErrOverBudget) { reason = "budget" }
+	metrics.PYMKCutShort.WithLabelValues(s.tenant, stage, reason).Inc()
+}
+
+// Feature flags consulted by PYMK (see package flags).
+const (
+	FlagThreeHop = "pymk.three_hop" // fill thin two-hop pools from three hops out
+)
+
+// Three-hop fill: expand from the strongest two-hop candidates and add
+// what they reach, scored only by adjacency weight, discounted.
+const (
+	threeHopSources  = 50
+	threeHopDiscount = 0.25
+)
+
+func (s *Service) threeHop(stats *candidates, limit int, one func(n uint64, cands *candidates)) {
+	srcs := make([]*candStats, 0, stats.len())
+	for i := range stats.st { srcs = append(srcs, &stats.st[i]) }
+	slices.SortFunc(srcs, func(a, b *candStats) int { return b.common - a.common })
+	if len(srcs) > threeHopSources { srcs = srcs[:threeHopSources] }
+	if limit > 0 { limit = max(1, limit-stats.len()) }
+	far := getCandidates(limit)
+	defer putCandidates(far)
+	for _, n := range srcs { one(n.id, far) } // before any add below moves them
+	for _, st := range far.st {
+		if stats.get(st.id) != nil { continue } // two-hop evidence wins
+		stats.add(candStats{id: st.id, aa: st.aa * threeHopDiscount})
+	}
+}
+
+// observe records the time since t as stage's duration and returns now,
+// the start of the next stage.
+func (s *Service) observe(stage, source string, t time.Time) time.Time {
+	now := time.Now()
+	metrics.PYMKStageDuration.WithLabelValues(s.tenant, stage, source).Observe(now.Sub(t).Seconds())
+	return now
+}
+
+// parallelMinSources is the neighbor count below which goroutine start-up
+// outweighs any gain from expanding concurrently.
+const parallelMinSources = 64
+
+// expand runs one over every source, sequentially or, for large
+// neighborhoods, on up to Parallelism workers with private candidate
+// tables merged at the end. Each worker gets an equal share of limit, so
+// the merged table stays within it. It also returns the total hits and
+// how many of them were turned away by the limit.
+func (s *Service) expand(sources []uint64, limit int, one func(n uint64, cands *candidates)) (stats *candidates, hits, rejected int) {
+	workers := s.Config().Parallelism
+	if workers <= 0 { workers = runtime.GOMAXPROCS(0) }
+	workers = min(workers, len(sources)/(parallelMinSources/2))
+	if workers <= 1 || len(sources) < parallelMinSources {
+		cands := getCandidates(limit)
+		for _, n := range sources { one(n, cands) }
+		return cands, cands.hits, cands.rejected
+	}
+	if limit > 0 { limit = max(1, limit/workers) }
+	parts := make([]*candidates, workers)
+	var wg sync.WaitGroup
+	chunk := (len(sources) + workers - 1) / workers
+	for w := range parts {
+		lo, hi := w*chunk, min((w+1)*chunk, len(sources))
+		parts[w] = getCandidates(limit)
+		wg.Add(1)
+		go func(part *candidates, src []uint64) {
+			defer wg.Done()
+			for _, n := range src { one(n, part) }
+		}(parts[w], sources[lo:hi])
+	}
+	wg.Wait()
+	stats = parts[0]
+	for _, p := range parts {
+		hits += p.hits
+		rejected += p.rejected
+		if p == parts[0] { continue }
+		for i := range p.st {
+			ps := &p.st[i]
+			if cs := stats.get(ps.id); cs != nil {
+				cs.common += ps.common
+				cs.wcommon += ps.wcommon
+				cs.aa += ps.aa
+				if ps.viaW > cs.viaW { cs.via, cs.viaW = ps.via, ps.viaW }
+			} else {
+				stats.add(*ps)
+			}
+		}
+		putCandidates(p)
+	}
+	return stats, hits, rejected
+}
+
+// Warm precomputes (and caches) top-k suggestions for users, hottest
+// first, stopping early when ctx is done. k <= 0 means the configured k.
+func (s *Service) Warm(ctx context.Context, users []uint64, k int) {
+	for _, u := range users {
+		if ctx.Err() != nil { return }
+		_, _ = s.PYMK(ctx, u, Query{K: k, warm: true})
+	}
+}
+
+// eligible drops suggestions that became ineligible after being cached,
+// copying only when something is dropped.
+func (s *Service) eligible(res []Suggestion) []Suggestion {
+	if s.Eligible == nil { return res }
+	for i := range res {
+		if s.Eligible(res[i].UserID) { continue }
+		out := append([]Suggestion(nil), res[:i]...)
+		for _, sg := range res[i+1:] {
+			if s.Eligible(sg.UserID) { out = append(out, sg) }
+		}
+		return out
+	}
 	return res
 }
 
+func bucketSize(q Query) int {
+	if q.Bucket > 0 { return q.Bucket }
+	return DefaultBucket
+}
+
+// emitBuckets hands an already ranked list to q.Emit, bucket by bucket.
+func emitBuckets(res []Suggestion, q Query) error {
+	for b := bucketSize(q); len(res) > 0; {
+		n := min(b, len(res))
+		if err := q.Emit(res[:n]); err != nil { return err }
+		res = res[n:]
+	}
+	return nil
+}
+
 // -------- Heap for Top-K --------
 type minHeap []scored
 func (h minHeap) Len() int            { return len(h) }
@@ -259,3 +761,47 @@ func (h *minHeap) Pop() interface{} {
 	*h = old[:n-1]
 	return x
 }
+
+// topK returns the k best of out, best first, in h's storage. Entries go
+// in and out of the heap by assignment and heap.Fix, never through
+// Push/Pop, which would box each one.
+func topK(out []scored, k int, h minHeap) minHeap {
+	h = h[:0]
+	for i := range out {
+		switch {
+		case len(h) < k:
+			h = append(h, out[i])
+			if len(h) == k { heap.Init(&h) }
+		case out[i].score > h[0].score:
+			h[0] = out[i]
+			heap.Fix(&h, 0)
+		}
+	}
+	slices.SortFunc(h, func(a, b scored) int { return cmp.Compare(b.score, a.score) })
+	return h
+}
+
+// maxHeap pops the best first; streamed rankings use it.
+type maxHeap []scored
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(scored)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// popTop is heap.Pop without boxing the result.
+func (h *maxHeap) popTop() scored {
+	old := *h
+	n := len(old) - 1
+	top := old[0]
+	old[0] = old[n]
+	*h = old[:n]
+	if n > 0 { heap.Fix(h, 0) }
+	return top
+}
@@ -0,0 +1,47 @@
+package pymk
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+// BenchmarkOneHopProbe compares isOneHop's two probes, the bare map and
+// the Bloom filter in front of it, across viewer degrees around
+// bloomMinOneHop. Probes are candidate-like: mostly not neighbors.
+func BenchmarkOneHopProbe(b *testing.B) {
+	for _, degree := range []int{1_000, 10_000, bloomMinOneHop, 2 * bloomMinOneHop, 500_000} {
+		r := rand.New(rand.NewPCG(1, uint64(degree)))
+		oneHop := make(map[uint64]struct{}, degree)
+		for len(oneHop) < degree { oneHop[r.Uint64()] = struct{}{} }
+		bf := sketch.NewBloom(len(oneHop), 0.01)
+		for x := range oneHop { bf.Add(x) }
+		probes := make([]uint64, 1<<16)
+		for i := range probes { probes[i] = r.Uint64() }
+		i := 0
+		for x := range oneHop { // one probe in 16 hits
+			if i >= len(probes) { break }
+			probes[i] = x
+			i += 16
+		}
+
+		b.Run(fmt.Sprintf("degree=%d/set", degree), func(b *testing.B) {
+			var hits int
+			for n := 0; n < b.N; n++ {
+				if _, ok := oneHop[probes[n&(len(probes)-1)]]; ok { hits++ }
+			}
+			_ = hits
+		})
+		b.Run(fmt.Sprintf("degree=%d/bloom", degree), func(b *testing.B) {
+			var hits int
+			for n := 0; n < b.N; n++ {
+				c := probes[n&(len(probes)-1)]
+				if !bf.MayContain(c) { continue }
+				if _, ok := oneHop[c]; ok { hits++ }
+			}
+			_ = hits
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package pymk
+
+import (
+	"math"
+	"time"
+)
+
+// recency returns the factor a path through neighbor n contributes with:
+// 1 plus cfg.RecencyBoost, halving every cfg.RecencyHalfLife since u and n
+// connected, so a fresh follow counts up to 1+boost times as much and an
+// old one (or one of unknown time) as before. It returns nil when recency
+// weighting is off.
+func (s *Service) recency(u uint64, cfg PYMKConfig, now time.Time) func(n uint64) float64 {
+	if s.Times == nil || cfg.RecencyBoost <= 0 || cfg.RecencyHalfLife <= 0 { return nil }
+	return func(n uint64) float64 {
+		at, ok := s.Times.Get(u, n)
+		if !ok { at, ok = s.Times.Get(n, u) }
+		if !ok { return 1 }
+		age := max(now.Sub(at), 0)
+		return 1 + cfg.RecencyBoost*math.Exp2(-float64(age)/float64(cfg.RecencyHalfLife))
+	}
+}
@@ -0,0 +1,53 @@
+package pymk
+
+import (
+	"container/heap"
+	"context"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+// sampleFollowing returns a uniform sample of k of n's followees: the k
+// with the smallest salted hash (bottom-k). Unlike a reservoir over map
+// iteration order, the sample depends only on the set and the salt, so a
+// fixed salt reproduces it exactly. Each n gets its own hash, so the same
+// users are not favored under every neighbor. The heap and the result
+// live in scratch's buffers; the result is good until the next call.
+func sampleFollowing(ctx context.Context, g graph.Reader, n uint64, k int, salt uint64, scratch *candidates) ([]uint64, error) {
+	seed := sketch.Hash(n ^ salt)
+	h := scratch.sample[:0]
+	err := g.ForEachFollowing(ctx, n, func(c uint64) bool {
+		x := sketch.Hash(c ^ seed)
+		switch {
+		case len(h) < k:
+			h = append(h, hashed{x, c})
+			if len(h) == k { heap.Init(&h) }
+		case x < h[0].h:
+			h[0] = hashed{x, c}
+			heap.Fix(&h, 0)
+		}
+		return true
+	})
+	out := scratch.ids[:0]
+	for _, e := range h { out = append(out, e.id) }
+	scratch.sample, scratch.ids = h, out
+	return out, err
+}
+
+type hashed struct{ h, id uint64 }
+
+// hashHeap is a max-heap on h: the root is the sample's largest hash,
+// the first to go when a smaller one turns up.
+type hashHeap []hashed
+
+func (h hashHeap) Len() int            { return len(h) }
+func (h hashHeap) Less(i, j int) bool  { return h[i].h > h[j].h }
+func (h hashHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x interface{}) { *h = append(*h, x.(hashed)) }
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
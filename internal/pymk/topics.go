@@ -0,0 +1,118 @@
+package pymk
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+)
+
+// TopicGraph is the user→topic follow graph PYMK reads as a candidate
+// source: people who follow the same topics as the requester.
+type TopicGraph interface {
+	Of(u uint64) []string                        // topics u follows
+	Followers(topic string, limit int) []uint64 // up to limit of topic's followers
+	Count(topic string) int                     // topic's followers
+}
+
+// topicCandidates credits every candidate among up to cfg.TopicFanout
+// followers of each topic u follows with one common topic, adding those
+// not yet in stats while it holds fewer than cfg.MaxCandidates and ok
+// admits them.
+func (s *Service) topicCandidates(u uint64, stats *candidates, cfg PYMKConfig, ok func(c uint64) bool) {
+	if s.Topics == nil || cfg.TopicFanout <= 0 { return }
+	for _, t := range s.Topics.Of(u) {
+		for _, c := range s.Topics.Followers(t, cfg.TopicFanout) {
+			st := stats.get(c)
+			if st == nil {
+				if cfg.MaxCandidates > 0 && stats.len() >= cfg.MaxCandidates { continue }
+				if !ok(c) { continue }
+				st = stats.add(candStats{id: c})
+			}
+			st.topics++
+		}
+	}
+}
+
+// TopicSuggestion is a topic suggested to follow.
+type TopicSuggestion struct {
+	Topic     string  `json:"topic"`
+	Score     float64 `json:"score"`
+	Followers int     `json:"followers"`
+	Similar   int     `json:"similar_users"` // similar users who follow it
+}
+
+const (
+	// topicSimilar bounds the similar users whose topics are counted.
+	topicSimilar = 200
+	// topicFanoutDefault stands in for a topic_fanout of 0, which only
+	// turns topics off as a PYMK candidate source.
+	topicFanoutDefault = 100
+)
+
+// SuggestTopics recommends k topics to u by collaborative filtering.
+// Similar users are found as PYMK candidates are: other followers of u's
+// topics, each shared topic weighted like an Adamic–Adar mutual by
+// 1/log(followers) so niche topics count most, and the users u follows.
+// The best of them then vote for the topics they follow and u does not,
+// each with its similarity.
+func (s *Service) SuggestTopics(ctx context.Context, u uint64, k int) ([]TopicSuggestion, error) {
+	if s.Topics == nil || k <= 0 { return []TopicSuggestion{}, nil }
+	cfg := s.Config()
+	fanout := cfg.TopicFanout
+	if fanout <= 0 { fanout = topicFanoutDefault }
+
+	// 1) Similar users, in the PYMK candidate table.
+	mine := s.Topics.Of(u)
+	cands := getCandidates(cfg.MaxCandidates)
+	defer putCandidates(cands)
+	for _, t := range mine {
+		w := 1 / math.Log(float64(2+s.Topics.Count(t)))
+		for _, v := range s.Topics.Followers(t, fanout) {
+			if v != u { cands.hit(v, 0, w, 1) }
+		}
+	}
+	out, err := s.G.DegreeOut(ctx, u)
+	if err != nil { return nil, err }
+	if out > 0 {
+		w := 1 / math.Log(float64(2+out))
+		err = s.G.ForEachFollowing(ctx, u, func(v uint64) bool { cands.hit(v, 0, w, 1); return true })
+		if err != nil { return nil, err }
+	}
+	similar := slices.Clone(cands.st)
+	slices.SortFunc(similar, func(a, b candStats) int {
+		if c := cmp.Compare(b.aa, a.aa); c != 0 { return c }
+		return cmp.Compare(a.id, b.id)
+	})
+	if len(similar) > topicSimilar { similar = similar[:topicSimilar] }
+
+	// 2) Their votes for topics u does not follow.
+	votes := make(map[string]*TopicSuggestion)
+	for _, v := range similar {
+		if err := ctx.Err(); err != nil { return nil, err }
+		w := v.aa
+		for _, t := range s.Topics.Of(v.id) {
+			if _, ok := slices.BinarySearch(mine, t); ok { continue }
+			ts := votes[t]
+			if ts == nil { ts = &TopicSuggestion{Topic: t}; votes[t] = ts }
+			ts.Score += w
+			ts.Similar++
+		}
+	}
+
+	// 3) Top-K via min-heap, as for users; ids index names.
+	names := make([]string, 0, len(votes))
+	all := make([]scored, 0, len(votes))
+	for t, ts := range votes {
+		all = append(all, scored{id: uint64(len(names)), score: ts.Score})
+		names = append(names, t)
+	}
+	top := topK(all, k, nil)
+	res := make([]TopicSuggestion, len(top))
+	for i, sc := range top {
+		ts := votes[names[sc.id]]
+		ts.Followers = s.Topics.Count(ts.Topic)
+		res[i] = *ts
+	}
+	return res, nil
+}
@@ -0,0 +1,45 @@
+package pymk
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Edge weightings: how the two edges of a path u - n - c combine into the
+// path's contribution to common neighbors and Adamic–Adar. An edge weighs
+// 1 (the follow) plus the interaction weights both ways, so engagement
+// strengthens a path and a plain follow counts as before.
+const (
+	EdgeWeightsOff     = "off"
+	EdgeWeightsMin     = "min"     // the weaker edge
+	EdgeWeightsGeoMean = "geomean" // geometric mean of the two
+)
+
+func ValidEdgeWeights(mode string) error {
+	switch mode {
+	case "", EdgeWeightsOff, EdgeWeightsMin, EdgeWeightsGeoMean:
+		return nil
+	}
+	return fmt.Errorf("edge_weights must be off, min or geomean, not %q", mode)
+}
+
+type edgeWeighting struct {
+	w   *graph.Weights
+	geo bool
+}
+
+// edgeWeighting returns the weighting cfg asks for, or nil when paths all
+// count 1.
+func (s *Service) edgeWeighting(cfg PYMKConfig) *edgeWeighting {
+	if s.Weights == nil || cfg.EdgeWeights == "" || cfg.EdgeWeights == EdgeWeightsOff { return nil }
+	return &edgeWeighting{w: s.Weights, geo: cfg.EdgeWeights == EdgeWeightsGeoMean}
+}
+
+func (e *edgeWeighting) edge(a, b uint64) float64 { return 1 + e.w.Get(a, b) + e.w.Get(b, a) }
+
+func (e *edgeWeighting) path(x, y float64) float64 {
+	if e.geo { return math.Sqrt(x * y) }
+	return math.Min(x, y)
+}
@@ -0,0 +1,362 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -------- Cypher subset --------
+// ParseCypher translates a read-only openCypher query into a Plan:
+//
+//	MATCH (a:User {id: 1})-[:FOLLOWS]->(b)-[:FOLLOWS]->(c:User)
+//	WHERE c.country = a.country AND c.followers >= 10
+//	RETURN DISTINCT c LIMIT 50
+//
+// The pattern is one path of FOLLOWS relationships, either direction,
+// anchored by id at one end (in the node's map, or with id(a) = n, a.id =
+// n or IN [...] in WHERE). WHERE is a conjunction of comparisons of a
+// node's property with a literal, or with the anchor's when it has a
+// single id. Properties are the attribute filter's fields plus followers
+// and following, the degrees. RETURN names the other end, its id, or
+// count of it; rows are distinct nodes, lowest IDs first, as if DISTINCT
+// were always given. Anything else is rejected rather than half-run.
+
+// Return says what a Cypher query's RETURN asked for.
+type Return struct {
+	Column string // as written, e.g. "c" or "count(c)"
+	Count  bool
+}
+
+type cyNode struct {
+	name  string
+	ids   []uint64
+	where []cyCond
+	degs  Step // degree bounds only
+}
+
+// cyCond is one attribute comparison: prop op lit, or prop op ref.refProp.
+type cyCond struct {
+	prop, op, lit string
+	ref           *cyNode
+	refProp       string
+}
+
+// ParseCypher parses src; budgets are left for Compile to default.
+func ParseCypher(src string) (Plan, Return, error) {
+	toks, err := cyLex(src)
+	if err != nil { return Plan{}, Return{}, err }
+	c := &cyParser{toks: toks}
+	p, ret, err := c.query()
+	if err != nil { return Plan{}, Return{}, fmt.Errorf("cypher: %w", err) }
+	return p, ret, nil
+}
+
+type cyParser struct {
+	toks  []string
+	i     int
+	nodes []*cyNode
+	rels  []string // "following" | "followers", between nodes[i] and nodes[i+1]
+	byVar map[string]*cyNode
+}
+
+func (c *cyParser) peek() string {
+	if c.i < len(c.toks) { return c.toks[c.i] }
+	return ""
+}
+
+func (c *cyParser) next() string {
+	t := c.peek()
+	c.i++
+	return t
+}
+
+// accept consumes the next token if it is want (keywords case-insensitively).
+func (c *cyParser) accept(want string) bool {
+	if strings.EqualFold(c.peek(), want) { c.i++; return true }
+	return false
+}
+
+func (c *cyParser) expect(want string) error {
+	if !c.accept(want) { return fmt.Errorf("want %s, not %q", want, c.peek()) }
+	return nil
+}
+
+func (c *cyParser) ident() (string, error) {
+	t := c.next()
+	if t == "" || !(unicode.IsLetter(rune(t[0])) || t[0] == '_') { return "", fmt.Errorf("want a name, not %q", t) }
+	return t, nil
+}
+
+func (c *cyParser) query() (Plan, Return, error) {
+	var ret Return
+	c.byVar = make(map[string]*cyNode)
+	if err := c.expect("MATCH"); err != nil { return Plan{}, ret, err }
+	if err := c.pattern(); err != nil { return Plan{}, ret, err }
+	if c.accept("WHERE") {
+		for {
+			if err := c.cond(); err != nil { return Plan{}, ret, err }
+			if !c.accept("AND") { break }
+		}
+	}
+	if err := c.expect("RETURN"); err != nil { return Plan{}, ret, err }
+	c.accept("DISTINCT")
+	out, err := c.ret(&ret)
+	if err != nil { return Plan{}, ret, err }
+	var p Plan
+	if c.accept("LIMIT") {
+		n, err := strconv.Atoi(c.next())
+		if err != nil || n < 1 { return Plan{}, ret, errors.New("LIMIT wants a positive integer") }
+		p.Limit = n
+	}
+	if c.peek() != "" { return Plan{}, ret, fmt.Errorf("unexpected %q", c.peek()) }
+	return c.plan(p, out, ret)
+}
+
+func (c *cyParser) pattern() error {
+	for {
+		n, err := c.node()
+		if err != nil { return err }
+		c.nodes = append(c.nodes, n)
+		var dir string
+		switch {
+		case c.accept("-"):
+			dir = "following"
+		case c.accept("<-"):
+			dir = "followers"
+		default:
+			return nil
+		}
+		if err := c.expect("["); err != nil { return err }
+		if c.peek() != ":" {
+			if _, err := c.ident(); err != nil { return err }
+		}
+		if err := c.expect(":"); err != nil { return err }
+		if !c.accept("FOLLOWS") { return fmt.Errorf("only FOLLOWS relationships, not %q", c.peek()) }
+		if err := c.expect("]"); err != nil { return err }
+		if dir == "following" {
+			if err := c.expect("->"); err != nil { return errors.New("relationships must be directed") }
+		} else if err := c.expect("-"); err != nil { return err }
+		c.rels = append(c.rels, dir)
+	}
+}
+
+func (c *cyParser) node() (*cyNode, error) {
+	if err := c.expect("("); err != nil { return nil, err }
+	n := &cyNode{}
+	if t := c.peek(); t != ":" && t != "{" && t != ")" {
+		name, err := c.ident()
+		if err != nil { return nil, err }
+		if _, dup := c.byVar[name]; dup { return nil, fmt.Errorf("%s appears twice in the pattern", name) }
+		n.name = name
+		c.byVar[name] = n
+	}
+	if c.accept(":") && !c.accept("User") { return nil, fmt.Errorf("only User nodes, not %q", c.peek()) }
+	if c.accept("{") {
+		if err := c.expect("id"); err != nil { return nil, err }
+		if err := c.expect(":"); err != nil { return nil, err }
+		id, err := strconv.ParseUint(c.next(), 10, 64)
+		if err != nil { return nil, errors.New("id wants an integer") }
+		n.ids = []uint64{id}
+		if err := c.expect("}"); err != nil { return nil, err }
+	}
+	return n, c.expect(")")
+}
+
+// operand parses v.prop or id(v), returning v and the property.
+func (c *cyParser) operand() (*cyNode, string, error) {
+	if c.accept("id") {
+		if err := c.expect("("); err != nil { return nil, "", err }
+		v, err := c.variable()
+		if err != nil { return nil, "", err }
+		return v, "id", c.expect(")")
+	}
+	v, err := c.variable()
+	if err != nil { return nil, "", err }
+	if err := c.expect("."); err != nil { return nil, "", err }
+	prop, err := c.ident()
+	return v, prop, err
+}
+
+func (c *cyParser) variable() (*cyNode, error) {
+	name, err := c.ident()
+	if err != nil { return nil, err }
+	v, ok := c.byVar[name]
+	if !ok { return nil, fmt.Errorf("unknown variable %s", name) }
+	return v, nil
+}
+
+var cyOps = map[string]string{"=": "==", "<>": "!=", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+func (c *cyParser) cond() error {
+	v, prop, err := c.operand()
+	if err != nil { return err }
+	if prop == "id" {
+		if c.accept("IN") { return c.idList(v) }
+		if err := c.expect("="); err != nil { return errors.New("ids only support = and IN") }
+		id, err := strconv.ParseUint(c.next(), 10, 64)
+		if err != nil { return errors.New("id wants an integer") }
+		v.ids = append(v.ids, id)
+		return nil
+	}
+	op, ok := cyOps[c.next()]
+	if !ok { return fmt.Errorf("unknown operator %q", c.toks[c.i-1]) }
+	rhs := c.next()
+	if prop == "followers" || prop == "following" { return v.degree(prop, op, rhs) }
+	if rhs == "" { return errors.New("comparison without a right-hand side") }
+	cd := cyCond{prop: prop, op: op, lit: rhs}
+	switch {
+	case rhs[0] == '\'' || rhs[0] == '"':
+		s := rhs[1 : len(rhs)-1]
+		if strings.ContainsRune(s, '"') { return errors.New(`strings may not contain "`) }
+		cd.lit = `"` + s + `"`
+	case c.byVar[rhs] != nil:
+		if err := c.expect("."); err != nil { return err }
+		vprop, err := c.ident()
+		if err != nil { return err }
+		cd.ref, cd.refProp = c.byVar[rhs], vprop
+	}
+	v.where = append(v.where, cd)
+	return nil
+}
+
+func (c *cyParser) idList(v *cyNode) error {
+	if err := c.expect("["); err != nil { return err }
+	for !c.accept("]") {
+		id, err := strconv.ParseUint(c.next(), 10, 64)
+		if err != nil { return errors.New("IN wants a list of integer ids") }
+		v.ids = append(v.ids, id)
+		c.accept(",")
+	}
+	return nil
+}
+
+func (n *cyNode) degree(prop, op, rhs string) error {
+	k, err := strconv.Atoi(rhs)
+	if err != nil || k < 0 { return fmt.Errorf("%s compares with a non-negative integer", prop) }
+	lo, hi := 0, 0
+	switch op {
+	case "==":
+		lo, hi = k, k
+	case ">=":
+		lo = k
+	case ">":
+		lo = k + 1
+	case "<=":
+		hi = k
+	case "<":
+		hi = k - 1
+	default:
+		return fmt.Errorf("%s does not support %s", prop, op)
+	}
+	if op != ">=" && op != ">" && hi < 1 { return fmt.Errorf("%s must allow at least 1", prop) }
+	minp, maxp := &n.degs.MinFollowers, &n.degs.MaxFollowers
+	if prop == "following" { minp, maxp = &n.degs.MinFollowing, &n.degs.MaxFollowing }
+	*minp = max(*minp, lo)
+	if hi > 0 && (*maxp == 0 || hi < *maxp) { *maxp = hi }
+	return nil
+}
+
+func (c *cyParser) ret(ret *Return) (*cyNode, error) {
+	start := c.i
+	if c.accept("count") {
+		ret.Count = true
+		if err := c.expect("("); err != nil { return nil, err }
+		c.accept("DISTINCT") // implied anyway
+		ret.Column = "count(" + c.peek() + ")"
+		var v *cyNode
+		if !c.accept("*") {
+			var err error
+			if v, err = c.variable(); err != nil { return nil, err }
+		}
+		return v, c.expect(")")
+	}
+	defer func() { ret.Column = strings.Join(c.toks[start:c.i], "") }()
+	if c.accept("id") {
+		if err := c.expect("("); err != nil { return nil, err }
+		v, err := c.variable()
+		if err != nil { return nil, err }
+		return v, c.expect(")")
+	}
+	v, err := c.variable()
+	if err != nil { return nil, err }
+	if c.accept(".") && !c.accept("id") { return nil, errors.New("RETURN supports only ids") }
+	return v, nil
+}
+
+// plan orients the path from its anchored end and turns each node's
+// conditions into the filter step after the traversal reaching it.
+func (c *cyParser) plan(p Plan, out *cyNode, ret Return) (Plan, Return, error) {
+	nodes, rels := c.nodes, c.rels
+	last := nodes[len(nodes)-1]
+	if len(nodes[0].ids) == 0 && len(last.ids) > 0 {
+		nodes = slices.Clone(nodes)
+		slices.Reverse(nodes)
+		rels = make([]string, len(c.rels))
+		for i, r := range c.rels {
+			if r == "following" { r = "followers" } else { r = "following" }
+			rels[len(rels)-1-i] = r
+		}
+	}
+	anchor := nodes[0]
+	if len(anchor.ids) == 0 { return p, ret, errors.New("the path must start or end at nodes given by id") }
+	for _, n := range nodes[1:] {
+		if len(n.ids) > 0 { return p, ret, errors.New("only one end of the path may be given by id") }
+	}
+	if out == nil { out = nodes[len(nodes)-1] }
+	if out != nodes[len(nodes)-1] { return p, ret, errors.New("RETURN must name the end of the path opposite its anchor") }
+	p.Start = anchor.ids
+	for i, n := range nodes {
+		if i > 0 { p.Steps = append(p.Steps, Step{Traverse: rels[i-1]}) }
+		var where []string
+		for _, cd := range n.where {
+			rhs := cd.lit
+			if cd.ref != nil {
+				if cd.ref != anchor || len(anchor.ids) != 1 { return p, ret, errors.New("properties may only be compared with the anchor's, and only when it has a single id") }
+				rhs = "viewer." + cd.refProp
+			}
+			where = append(where, cd.prop+" "+cd.op+" "+rhs)
+		}
+		st := n.degs
+		st.Where = strings.Join(where, " && ")
+		if st.filters() { p.Steps = append(p.Steps, st) }
+	}
+	return p, ret, nil
+}
+
+func cyLex(src string) ([]string, error) {
+	var toks []string
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		two := ""
+		if i+1 < len(rs) { two = string(rs[i : i+2]) }
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != r { j++ }
+			if j == len(rs) { return nil, errors.New("cypher: unterminated string") }
+			toks = append(toks, string(rs[i:j+1]))
+			i = j + 1
+		case two == "->" || two == "<-" || two == "<>" || two == "<=" || two == ">=" || two == "!=":
+			toks = append(toks, two)
+			i += 2
+		case strings.ContainsRune("()[]{}:,.-<>=*", r):
+			toks = append(toks, string(r))
+			i++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') { j++ }
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("cypher: unexpected %q", r)
+		}
+	}
+	return toks, nil
+}
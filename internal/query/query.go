@@ -0,0 +1,242 @@
+// Package query runs small ad-hoc traversal plans against a graph.Store:
+// start users, then a list of steps that each either move the frontier
+// along following/followers edges or filter it by attributes or degree.
+//
+//	{"start":[1],
+//	 "steps":[{"traverse":"following"},
+//	          {"traverse":"following","new":true},
+//	          {"where":"country == viewer.country","min_followers":10}],
+//	 "limit":50}
+//
+// is "friends of friends of 1 who are not already within one hop, in 1's
+// country, with at least 10 followers". Every plan runs under budgets on
+// adjacency entries read, frontier size and time; a plan that runs out
+// returns what it reached, marked partial.
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Defaults apply to zero plan fields; larger values are rejected.
+const (
+	MaxStart = 1000
+	MaxSteps = 8
+
+	DefaultLimit, MaxLimit       = 100, 10_000
+	DefaultVisits, MaxVisits     = 100_000, 2_000_000
+	DefaultFrontier, MaxFrontier = 100_000, 1_000_000
+	DefaultTimeout, MaxTimeout   = time.Second, 10 * time.Second
+)
+
+type Plan struct {
+	Start       []uint64 `json:"start"`
+	Steps       []Step   `json:"steps"`
+	Limit       int      `json:"limit"`        // IDs returned, lowest first
+	MaxVisits   int      `json:"max_visits"`   // adjacency entries read in all
+	MaxFrontier int      `json:"max_frontier"` // distinct users held by one step
+	TimeoutMS   int      `json:"timeout_ms"`
+}
+
+// Step either traverses or filters, not both.
+type Step struct {
+	Traverse string `json:"traverse,omitempty"` // following | followers
+	New      bool   `json:"new,omitempty"`      // traverse: skip users reached by an earlier step (or started from)
+
+	Where        string `json:"where,omitempty"` // attribute filter, as pymk.filter; viewer is the single start user
+	MinFollowers int    `json:"min_followers,omitempty"`
+	MaxFollowers int    `json:"max_followers,omitempty"` // 0 = no maximum
+	MinFollowing int    `json:"min_following,omitempty"`
+	MaxFollowing int    `json:"max_following,omitempty"`
+
+	where *attrs.Filter
+}
+
+func (st Step) filters() bool {
+	return st.Where != "" || st.MinFollowers > 0 || st.MaxFollowers > 0 || st.MinFollowing > 0 || st.MaxFollowing > 0
+}
+
+func (st Step) degrees() bool {
+	return st.MinFollowers > 0 || st.MaxFollowers > 0 || st.MinFollowing > 0 || st.MaxFollowing > 0
+}
+
+// Env is what a plan sees beyond the graph.
+type Env struct {
+	Subject func(u uint64) attrs.Subject // for where filters
+	Visible func(u uint64) bool          // users left out of the result; nil = all
+	// Lists reports whether u's neighbors may be traversed; those whose
+	// lists are hidden from the caller are not expanded. nil = all.
+	Lists func(u uint64) (bool, error)
+	Now     time.Time
+}
+
+// Why a plan stopped early.
+const (
+	ReasonVisits   = "max_visits"
+	ReasonFrontier = "max_frontier"
+	ReasonTimeout  = "timeout"
+)
+
+type Result struct {
+	UserIDs []uint64 `json:"user_ids"`
+	Count   int      `json:"count"`  // users in the final frontier, before limit
+	Steps   int      `json:"steps"`  // steps completed
+	Visits  int      `json:"visits"` // adjacency entries read
+	Partial bool     `json:"partial"`
+	// With partial, the budget that ran out; the result is then the
+	// incomplete frontier of step number steps (0-based).
+	Reason string `json:"reason,omitempty"`
+}
+
+var errStop = errors.New("query: budget exhausted")
+
+// Compile checks p, fills in its defaults and parses its filters.
+func Compile(p Plan) (Plan, error) {
+	switch {
+	case len(p.Start) == 0:
+		return p, errors.New("start is empty")
+	case len(p.Start) > MaxStart:
+		return p, fmt.Errorf("at most %d start users", MaxStart)
+	case len(p.Steps) > MaxSteps:
+		return p, fmt.Errorf("at most %d steps", MaxSteps)
+	}
+	var err error
+	if p.Limit, err = bounded("limit", p.Limit, DefaultLimit, MaxLimit); err != nil { return p, err }
+	if p.MaxVisits, err = bounded("max_visits", p.MaxVisits, DefaultVisits, MaxVisits); err != nil { return p, err }
+	if p.MaxFrontier, err = bounded("max_frontier", p.MaxFrontier, DefaultFrontier, MaxFrontier); err != nil { return p, err }
+	if p.TimeoutMS, err = bounded("timeout_ms", p.TimeoutMS, int(DefaultTimeout/time.Millisecond), int(MaxTimeout/time.Millisecond)); err != nil { return p, err }
+	p.Steps = slices.Clone(p.Steps)
+	for i := range p.Steps {
+		st := &p.Steps[i]
+		switch st.Traverse {
+		case "":
+			if !st.filters() { return p, fmt.Errorf("step %d: neither traverse nor a filter", i) }
+			if st.New { return p, fmt.Errorf("step %d: new needs traverse", i) }
+		case "following", "followers":
+			if st.filters() { return p, fmt.Errorf("step %d: traverse and filter in one step", i) }
+		default:
+			return p, fmt.Errorf("step %d: traverse must be following or followers", i)
+		}
+		if st.MinFollowers < 0 || st.MaxFollowers < 0 || st.MinFollowing < 0 || st.MaxFollowing < 0 {
+			return p, fmt.Errorf("step %d: negative degree bound", i)
+		}
+		if st.where, err = attrs.ParseFilter(st.Where); err != nil { return p, fmt.Errorf("step %d: %w", i, err) }
+	}
+	return p, nil
+}
+
+func bounded(name string, v, def, max int) (int, error) {
+	if v < 0 || v > max { return 0, fmt.Errorf("%s must be 0-%d", name, max) }
+	if v == 0 { return def, nil }
+	return v, nil
+}
+
+// Run executes p, which must come from Compile.
+func Run(ctx context.Context, g graph.Store, p Plan, env Env) (Result, error) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.TimeoutMS)*time.Millisecond)
+	defer cancel()
+	var res Result
+	frontier := dedup(p.Start)
+	var seen map[uint64]struct{} // everyone reached so far; only kept when a step skips them
+	if slices.ContainsFunc(p.Steps, func(st Step) bool { return st.New }) { seen = toSet(frontier) }
+	for _, st := range p.Steps {
+		var err error
+		if st.Traverse != "" {
+			frontier, err = traverse(ctx, g, st, frontier, seen, p, env, &res)
+		} else {
+			frontier, err = filter(ctx, g, st, frontier, p.Start, env)
+		}
+		if errors.Is(err, errStop) || (err != nil && parent.Err() == nil && ctx.Err() != nil) {
+			res.Partial = true
+			if res.Reason == "" { res.Reason = ReasonTimeout }
+			break
+		}
+		if err != nil { return res, err }
+		res.Steps++
+	}
+	if env.Visible != nil {
+		frontier = slices.DeleteFunc(frontier, func(u uint64) bool { return !env.Visible(u) })
+	}
+	slices.Sort(frontier)
+	res.Count = len(frontier)
+	res.UserIDs = frontier[:min(len(frontier), p.Limit)]
+	return res, nil
+}
+
+func traverse(ctx context.Context, g graph.Store, st Step, frontier []uint64, seen map[uint64]struct{}, p Plan, env Env, res *Result) ([]uint64, error) {
+	each := g.ForEachFollowing
+	if st.Traverse == "followers" { each = g.ForEachFollowers }
+	reached := make(map[uint64]struct{})
+	var next []uint64
+	for _, u := range frontier {
+		if err := ctx.Err(); err != nil { return next, err }
+		if env.Lists != nil {
+			ok, err := env.Lists(u)
+			if err != nil { return next, err }
+			if !ok { continue }
+		}
+		err := each(ctx, u, func(v uint64) bool {
+			if res.Visits >= p.MaxVisits { res.Reason = ReasonVisits; return false }
+			res.Visits++
+			if _, ok := reached[v]; ok { return true }
+			if st.New {
+				if _, ok := seen[v]; ok { return true }
+			}
+			if len(next) >= p.MaxFrontier { res.Reason = ReasonFrontier; return false }
+			reached[v] = struct{}{}
+			next = append(next, v)
+			return true
+		})
+		if err != nil { return next, err }
+		if res.Reason != "" { return next, errStop }
+	}
+	if seen != nil {
+		for _, v := range next { seen[v] = struct{}{} }
+	}
+	return next, nil
+}
+
+func filter(ctx context.Context, g graph.Store, st Step, frontier, start []uint64, env Env) ([]uint64, error) {
+	if st.where != nil {
+		var viewer attrs.Subject
+		if len(start) == 1 && env.Subject != nil { viewer = env.Subject(start[0]) }
+		frontier = slices.DeleteFunc(frontier, func(u uint64) bool {
+			return env.Subject == nil || !st.where.Match(viewer, env.Subject(u), env.Now)
+		})
+	}
+	if !st.degrees() || len(frontier) == 0 { return frontier, nil }
+	ds, err := g.Degrees(ctx, frontier)
+	if err != nil { return frontier, err }
+	out := frontier[:0]
+	for _, d := range ds {
+		if d.Followers < st.MinFollowers || (st.MaxFollowers > 0 && d.Followers > st.MaxFollowers) { continue }
+		if d.Following < st.MinFollowing || (st.MaxFollowing > 0 && d.Following > st.MaxFollowing) { continue }
+		out = append(out, d.User)
+	}
+	return out, nil
+}
+
+func dedup(us []uint64) []uint64 {
+	set := make(map[uint64]struct{}, len(us))
+	out := make([]uint64, 0, len(us))
+	for _, u := range us {
+		if _, ok := set[u]; ok { continue }
+		set[u] = struct{}{}
+		out = append(out, u)
+	}
+	return out
+}
+
+func toSet(us []uint64) map[uint64]struct{} {
+	m := make(map[uint64]struct{}, len(us))
+	for _, u := range us { m[u] = struct{}{} }
+	return m
+}
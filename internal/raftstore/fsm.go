@@ -0,0 +1,127 @@
+package raftstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/hashicorp/raft"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+type command struct {
+	Op     string         `json:"op"` // follow | unfollow | tx
+	Tenant string         `json:"t"`
+	U      uint64         `json:"u"`
+	V      uint64         `json:"v"`
+	Ops    []graph.EdgeOp `json:"ops,omitempty"` // tx
+}
+
+// result is what applying a command returns, locally or from the leader.
+type result struct {
+	OK      bool   `json:"ok"`
+	Changed []bool `json:"changed,omitempty"` // tx
+	Err     string `json:"err,omitempty"`     // the local store refused the entry
+}
+
+type fsm struct {
+	tenants Tenants
+}
+
+func (f *fsm) Apply(l *raft.Log) any {
+	var c command
+	if err := json.Unmarshal(l.Data, &c); err != nil {
+		slog.Error("raft: bad log entry", "index", l.Index, "err", err)
+		return result{}
+	}
+	g, err := f.tenants.Local(c.Tenant)
+	if err != nil {
+		slog.Error("raft: tenant", "tenant", c.Tenant, "err", err)
+		return result{}
+	}
+	var res result
+	switch c.Op {
+	case "follow":
+		res.OK, err = g.Follow(context.Background(), c.U, c.V)
+	case "unfollow":
+		res.OK, err = g.Unfollow(context.Background(), c.U, c.V)
+	case "tx":
+		// Validated before replication and unconditional, so only the
+		// store itself (e.g. a failed spill read) can refuse it.
+		res.Changed, err = g.Apply(context.Background(), c.Ops)
+		res.OK = err == nil
+	default:
+		return result{}
+	}
+	if err != nil {
+		slog.Error("raft: apply", "index", l.Index, "op", c.Op, "tenant", c.Tenant, "err", err)
+		res.Err = err.Error()
+	}
+	return res
+}
+
+// Snapshot serializes every tenant's graph up front: Apply is paused only
+// for the duration of this call, so the copy is point-in-time.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	putBytes := func(b []byte) {
+		n := binary.PutUvarint(tmp[:], uint64(len(b)))
+		buf.Write(tmp[:n])
+		buf.Write(b)
+	}
+	names := f.tenants.Names()
+	n := binary.PutUvarint(tmp[:], uint64(len(names)))
+	buf.Write(tmp[:n])
+	for _, name := range names {
+		g, err := f.tenants.Local(name)
+		if err != nil { return nil, err }
+		var gb bytes.Buffer
+		if err := g.WriteSnapshot(&gb); err != nil { return nil, err }
+		putBytes([]byte(name))
+		putBytes(gb.Bytes())
+	}
+	return &snapshot{data: buf.Bytes()}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	br := bufio.NewReader(rc)
+	count, err := binary.ReadUvarint(br)
+	if err != nil { return fmt.Errorf("raft restore: %w", err) }
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil { return nil, err }
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+	for i := uint64(0); i < count; i++ {
+		name, err := readBytes()
+		if err != nil { return fmt.Errorf("raft restore: %w", err) }
+		data, err := readBytes()
+		if err != nil { return fmt.Errorf("raft restore: %w", err) }
+		g, err := f.tenants.Local(string(name))
+		if err != nil { return err }
+		if err := g.ReadSnapshot(bytes.NewReader(data)); err != nil { return err }
+	}
+	return nil
+}
+
+type snapshot struct{ data []byte }
+
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.data); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *snapshot) Release() {}
@@ -0,0 +1,190 @@
+// Package raftstore replicates Follow/Unfollow through a Raft log so every
+// node holds the full graph: writes go through the leader (followers
+// forward them), reads are served from the local replica.
+package raftstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+type Config struct {
+	Enabled           bool          `yaml:"enabled"`
+	NodeID            string        `yaml:"node_id"`
+	BindAddr          string        `yaml:"bind_addr"` // raft transport host:port
+	DataDir           string        `yaml:"data_dir"`
+	Bootstrap         bool          `yaml:"bootstrap"` // form the cluster from peers if no state exists
+	Peers             []string      `yaml:"peers"`     // id=raft_addr=http_url, including self
+	Token             string        `yaml:"token" secret:"true"`
+	ApplyTimeout      time.Duration `yaml:"apply_timeout"`
+	SnapshotInterval  time.Duration `yaml:"snapshot_interval"`
+	SnapshotThreshold int           `yaml:"snapshot_threshold"` // log entries between snapshots
+	RetainSnapshots   int           `yaml:"retain_snapshots"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		DataDir:           "data/raft",
+		ApplyTimeout:      5 * time.Second,
+		SnapshotInterval:  2 * time.Minute,
+		SnapshotThreshold: 8192,
+		RetainSnapshots:   2,
+	}
+}
+
+type peer struct {
+	id, raftAddr, httpURL string
+}
+
+func parsePeers(specs []string) (map[string]peer, error) {
+	out := make(map[string]peer, len(specs))
+	for _, sp := range specs {
+		f := strings.SplitN(strings.TrimSpace(sp), "=", 3)
+		if len(f) != 3 || f[0] == "" || f[1] == "" || f[2] == "" {
+			return nil, fmt.Errorf("bad peer %q (want id=raft_addr=http_url)", sp)
+		}
+		out[f[0]] = peer{id: f[0], raftAddr: f[1], httpURL: strings.TrimRight(f[2], "/")}
+	}
+	return out, nil
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled { return nil }
+	if c.NodeID == "" || c.BindAddr == "" || c.DataDir == "" { return errors.New("node_id, bind_addr and data_dir are required") }
+	peers, err := parsePeers(c.Peers)
+	if err != nil { return err }
+	if _, ok := peers[c.NodeID]; !ok { return fmt.Errorf("node_id %q is not among peers", c.NodeID) }
+	if c.Token == "" { return errors.New("token is required") }
+	return nil
+}
+
+// Tenants gives the FSM access to each tenant's node-local graph.
+type Tenants interface {
+	Local(tenant string) (*graph.MemGraph, error)
+	Names() []string
+}
+
+type Node struct {
+	cfg   Config
+	raft  *raft.Raft
+	peers map[string]peer
+	hc    *http.Client
+}
+
+var ErrNoLeader = errors.New("raft: no leader")
+
+// New prepares a node; Stores can be handed out before Start, which must
+// be called once all configured tenants exist.
+func New(cfg Config) (*Node, error) {
+	if err := cfg.Validate(); err != nil { return nil, err }
+	peers, _ := parsePeers(cfg.Peers)
+	return &Node{cfg: cfg, peers: peers, hc: &http.Client{Timeout: cfg.ApplyTimeout + time.Second}}, nil
+}
+
+// Start opens the log and snapshot stores, bootstraps if configured, and
+// joins the Raft group. Restored state is replayed into tenants.
+func (n *Node) Start(tenants Tenants) error {
+	cfg, peers := n.cfg, n.peers
+	if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil { return err }
+
+	logger := hclog.New(&hclog.LoggerOptions{Name: "raft", Level: hclog.Warn, JSONFormat: true, Output: os.Stderr})
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(cfg.NodeID)
+	rc.Logger = logger
+	if cfg.SnapshotInterval > 0 { rc.SnapshotInterval = cfg.SnapshotInterval }
+	if cfg.SnapshotThreshold > 0 { rc.SnapshotThreshold = uint64(cfg.SnapshotThreshold) }
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft.db"))
+	if err != nil { return err }
+	snaps, err := raft.NewFileSnapshotStoreWithLogger(cfg.DataDir, max(cfg.RetainSnapshots, 1), logger)
+	if err != nil { return err }
+	advertise, err := net.ResolveTCPAddr("tcp", peers[cfg.NodeID].raftAddr)
+	if err != nil { return err }
+	trans, err := raft.NewTCPTransportWithLogger(cfg.BindAddr, advertise, 3, 10*time.Second, logger)
+	if err != nil { return err }
+
+	if cfg.Bootstrap {
+		has, err := raft.HasExistingState(store, store, snaps)
+		if err != nil { return err }
+		if !has {
+			var servers []raft.Server
+			for _, p := range peers {
+				servers = append(servers, raft.Server{ID: raft.ServerID(p.id), Address: raft.ServerAddress(p.raftAddr)})
+			}
+			if err := raft.BootstrapCluster(rc, store, store, snaps, trans, raft.Configuration{Servers: servers}); err != nil {
+				return err
+			}
+		}
+	}
+	r, err := raft.NewRaft(rc, &fsm{tenants: tenants}, store, store, snaps, trans)
+	if err != nil { return err }
+	n.raft = r
+	return nil
+}
+
+func (n *Node) Shutdown() error { return n.raft.Shutdown().Error() }
+
+func (n *Node) IsLeader() bool { return n.raft.State() == raft.Leader }
+
+// apply commits cmd through the log, forwarding to the leader when this
+// node is a follower, and returns the FSM's result.
+func (n *Node) apply(cmd command) (result, error) {
+	if !n.IsLeader() { return n.forward(cmd) }
+	b, _ := json.Marshal(cmd)
+	f := n.raft.Apply(b, n.cfg.ApplyTimeout)
+	if err := f.Error(); err != nil { return result{}, err }
+	res, _ := f.Response().(result)
+	if res.Err != "" { return result{}, errors.New(res.Err) }
+	return res, nil
+}
+
+func (n *Node) forward(cmd command) (result, error) {
+	_, id := n.raft.LeaderWithID()
+	p, ok := n.peers[string(id)]
+	if !ok { return result{}, ErrNoLeader }
+	b, _ := json.Marshal(cmd)
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ApplyTimeout)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.httpURL+"/internal/raft/apply", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tokenHeader, n.cfg.Token)
+	resp, err := n.hc.Do(req)
+	if err != nil { return result{}, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return result{}, fmt.Errorf("leader %s: %s: %s", id, resp.Status, bytes.TrimSpace(msg))
+	}
+	var res result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil { return result{}, err }
+	if res.Err != "" { return result{}, errors.New(res.Err) }
+	return res, nil
+}
+
+// Status summarizes this node's view of the cluster for /admin/raft.
+func (n *Node) Status() map[string]any {
+	addr, id := n.raft.LeaderWithID()
+	return map[string]any{
+		"node_id":     n.cfg.NodeID,
+		"state":       n.raft.State().String(),
+		"leader_id":   string(id),
+		"leader_addr": string(addr),
+		"stats":       n.raft.Stats(),
+	}
+}
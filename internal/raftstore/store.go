@@ -0,0 +1,92 @@
+package raftstore
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+const tokenHeader = "X-Raft-Token"
+
+// Store is a tenant's replicated graph: reads come from the local replica
+// (possibly slightly behind the leader), Follow/Unfollow go through Raft.
+// A failed replication is reported as graph.ErrUnavailable.
+type Store struct {
+	*graph.MemGraph
+	n      *Node
+	tenant string
+}
+
+func (n *Node) Store(tenant string, local *graph.MemGraph) *Store {
+	return &Store{MemGraph: local, n: n, tenant: tenant}
+}
+
+func (s *Store) Local() *graph.MemGraph { return s.MemGraph }
+
+func (s *Store) Follow(ctx context.Context, u, v uint64) (bool, error) {
+	if u == v { return false, nil }
+	return s.replicate(ctx, "follow", u, v)
+}
+
+func (s *Store) Unfollow(ctx context.Context, u, v uint64) (bool, error) {
+	return s.replicate(ctx, "unfollow", u, v)
+}
+
+// FollowIf and UnfollowIf are not supported: epochs are per replica and
+// advance independently of the log, so no replica's epoch is one the
+// leader could check a command against.
+func (s *Store) FollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	return false, fmt.Errorf("%w: conditional writes under raft", errors.ErrUnsupported)
+}
+
+func (s *Store) UnfollowIf(ctx context.Context, u, v, epoch uint64) (bool, error) {
+	return false, fmt.Errorf("%w: conditional writes under raft", errors.ErrUnsupported)
+}
+
+// Apply replicates the transaction as one log entry, which every replica
+// applies atomically. Expected epochs are unsupported, as for FollowIf.
+func (s *Store) Apply(ctx context.Context, ops []graph.EdgeOp) ([]bool, error) {
+	if err := graph.ValidateOps(ops); err != nil { return nil, err }
+	if graph.Conditional(ops) { return nil, fmt.Errorf("%w: conditional writes under raft", errors.ErrUnsupported) }
+	res, err := s.replicateCmd(ctx, command{Op: "tx", Tenant: s.tenant, Ops: ops})
+	return res.Changed, err
+}
+
+func (s *Store) replicate(ctx context.Context, op string, u, v uint64) (bool, error) {
+	res, err := s.replicateCmd(ctx, command{Op: op, Tenant: s.tenant, U: u, V: v})
+	return res.OK, err
+}
+
+func (s *Store) replicateCmd(ctx context.Context, c command) (result, error) {
+	if err := ctx.Err(); err != nil { return result{}, err }
+	res, err := s.n.apply(c)
+	if err != nil {
+		slog.Warn("raft apply failed", "op", c.Op, "tenant", s.tenant, "err", err)
+		return result{}, fmt.Errorf("%w: raft %s: %v", graph.ErrUnavailable, c.Op, err)
+	}
+	return res, nil
+}
+
+// Handler serves /internal/raft/apply, used by followers to hand writes
+// to the leader.
+func (n *Node) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(tokenHeader)), []byte(n.cfg.Token)) != 1 {
+			http.Error(w, "bad raft token", http.StatusUnauthorized); return
+		}
+		var c command
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil { http.Error(w, err.Error(), 400); return }
+		if !n.IsLeader() { http.Error(w, "not the leader", http.StatusServiceUnavailable); return }
+		res, err := n.apply(c)
+		if err != nil { http.Error(w, err.Error(), http.StatusServiceUnavailable); return }
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,119 @@
+package replica
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/pandharkardeep/social-graph/internal/journal"
+)
+
+const (
+	serviceName = "socialgraph.replication.Replication"
+	chunkSize   = 1 << 20
+	batchSize   = 1024
+)
+
+type replicationServer interface {
+	stream(*StreamRequest, grpc.ServerStream) error
+	snapshot(*SnapshotRequest, grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*replicationServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Stream", ServerStreams: true, Handler: func(srv any, ss grpc.ServerStream) error {
+			var req StreamRequest
+			if err := ss.RecvMsg(&req); err != nil { return err }
+			return srv.(replicationServer).stream(&req, ss)
+		}},
+		{StreamName: "Snapshot", ServerStreams: true, Handler: func(srv any, ss grpc.ServerStream) error {
+			var req SnapshotRequest
+			if err := ss.RecvMsg(&req); err != nil { return err }
+			return srv.(replicationServer).snapshot(&req, ss)
+		}},
+	},
+}
+
+// Primary serves the journal and snapshots to replicas.
+type Primary struct {
+	cfg     Config
+	j       *journal.Journal
+	tenants Tenants
+	srv     *grpc.Server
+}
+
+func NewPrimary(cfg Config, j *journal.Journal, tenants Tenants) *Primary {
+	p := &Primary{cfg: cfg, j: j, tenants: tenants}
+	p.srv = grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}), grpc.StreamInterceptor(p.authorize))
+	p.srv.RegisterService(&serviceDesc, p)
+	return p
+}
+
+func (p *Primary) Serve() error {
+	ln, err := net.Listen("tcp", p.cfg.GRPCAddr)
+	if err != nil { return err }
+	slog.Info("replication primary listening", "addr", p.cfg.GRPCAddr)
+	return p.srv.Serve(ln)
+}
+
+func (p *Primary) Stop() { p.srv.GracefulStop() }
+
+func (p *Primary) authorize(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	if v := md.Get(tokenKey); len(v) != 1 || subtle.ConstantTimeCompare([]byte(v[0]), []byte(p.cfg.Token)) != 1 {
+		return status.Error(codes.Unauthenticated, "bad replication token")
+	}
+	return h(srv, ss)
+}
+
+// stream sends every event from req.FromSeq on, then follows the journal
+// until the replica disconnects.
+func (p *Primary) stream(req *StreamRequest, ss grpc.ServerStream) error {
+	if req.JournalID != p.j.ID() { return status.Error(codes.OutOfRange, "journal restarted; resync from snapshot") }
+	next := req.FromSeq
+	ctx := ss.Context()
+	for {
+		wait := p.j.Wait()
+		evs, ok := p.j.Since(next, batchSize)
+		if !ok { return status.Error(codes.OutOfRange, "journal truncated; resync from snapshot") }
+		head := p.j.Head()
+		for _, e := range evs {
+			m := Mutation{Seq: e.Seq, Head: head, Time: e.Time.UnixNano(), Tenant: e.Tenant, Op: e.Op, Src: e.Src, Dst: e.Dst, Source: e.Source}
+			if err := ss.SendMsg(&m); err != nil { return err }
+			next = e.Seq + 1
+		}
+		if len(evs) == batchSize { continue }
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Primary) snapshot(_ *SnapshotRequest, ss grpc.ServerStream) error {
+	seq := p.j.Head()
+	for _, name := range p.tenants.Names() {
+		g, err := p.tenants.Local(name)
+		if err != nil { return status.Error(codes.Internal, err.Error()) }
+		var buf bytes.Buffer
+		if err := g.WriteSnapshot(&buf); err != nil { return status.Error(codes.Internal, err.Error()) }
+		data := buf.Bytes()
+		for {
+			n := min(len(data), chunkSize)
+			c := SnapshotChunk{Seq: seq, JournalID: p.j.ID(), Tenant: name, Data: data[:n], Last: n == len(data)}
+			if err := ss.SendMsg(&c); err != nil { return err }
+			data = data[n:]
+			if c.Last { break }
+		}
+	}
+	return nil
+}
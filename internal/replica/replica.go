@@ -0,0 +1,111 @@
+// Package replica ships the primary's mutation journal to read-only
+// replicas over a gRPC server stream. Messages are JSON-encoded, so no
+// generated protobuf code is needed.
+package replica
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+type Config struct {
+	Role          string        `yaml:"role"`      // "" (standalone) | primary | replica
+	GRPCAddr      string        `yaml:"grpc_addr"` // primary: listen address
+	Primary       string        `yaml:"primary"`   // replica: primary's gRPC host:port
+	Token         string        `yaml:"token" secret:"true"`
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{GRPCAddr: ":9090", RetryInterval: 2 * time.Second}
+}
+
+func (c Config) Validate() error {
+	switch c.Role {
+	case "":
+		return nil
+	case "primary":
+		if c.GRPCAddr == "" { return errors.New("grpc_addr is required for a primary") }
+	case "replica":
+		if c.Primary == "" { return errors.New("primary is required for a replica") }
+	default:
+		return errors.New("role must be primary or replica")
+	}
+	if c.Token == "" { return errors.New("token is required") }
+	return nil
+}
+
+// Tenants gives replication access to each tenant's node-local graph.
+type Tenants interface {
+	Local(tenant string) (*graph.MemGraph, error)
+	Names() []string
+}
+
+// -------- Wire messages --------
+// StreamRequest resumes from FromSeq of the journal JournalID, as given
+// by the last snapshot; on any other journal (the primary restarted) the
+// stream fails with OutOfRange and the replica resyncs.
+type StreamRequest struct {
+	FromSeq   uint64 `json:"from_seq"`
+	JournalID string `json:"journal_id"`
+}
+
+type Mutation struct {
+	Seq    uint64 `json:"seq"`
+	Head   uint64 `json:"head"` // primary's newest seq when sent, for lag
+	Time   int64  `json:"time"` // unix nanos of the original write
+	Tenant string `json:"tenant"`
+	Op     string `json:"op"`
+	Src    uint64 `json:"src"`
+	Dst    uint64 `json:"dst"`
+	Source string `json:"source,omitempty"`
+}
+
+type SnapshotRequest struct{}
+
+// SnapshotChunk carries part of one tenant's graph snapshot. Seq is the
+// position in journal JournalID the snapshot is consistent with (at
+// least).
+type SnapshotChunk struct {
+	Seq       uint64 `json:"seq"`
+	JournalID string `json:"journal_id"`
+	Tenant string `json:"tenant"`
+	Data   []byte `json:"data"`
+	Last   bool   `json:"last"` // final chunk of this tenant
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)   { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(b []byte, v any) error { return json.Unmarshal(b, v) }
+func (jsonCodec) Name() string                    { return "json" }
+
+const tokenKey = "x-replication-token"
+
+// readPosts are POST routes that only read (the body is a query). A
+// pipeline's ops are checked again one by one as they run.
+var readPosts = map[string]bool{"/edges/exists": true, "/degrees": true, "/mutual_counts": true, "/query": true, "/cypher": true, "/pipeline": true}
+
+// adminPosts are the admin routes a replica serves beyond GET: node-local
+// maintenance that leaves the graph and the node's settings as they are.
+var adminPosts = map[string]bool{"/admin/compact": true, "/admin/communities": true}
+
+// ReadOnly rejects mutating requests on a replica, admin ones included,
+// with 403; internal routes stay available.
+func ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !readPosts[r.URL.Path] && !adminPosts[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/internal/") {
+				http.Error(w, "read-only replica", http.StatusForbidden); return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,134 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// Replica follows a primary and applies its mutations to local graphs.
+type Replica struct {
+	cfg     Config
+	tenants Tenants
+	applied uint64
+	journal string // the primary's journal ID that applied counts in
+}
+
+func NewReplica(cfg Config, tenants Tenants) *Replica {
+	return &Replica{cfg: cfg, tenants: tenants}
+}
+
+var errResync = errors.New("resync required")
+
+// Run keeps the replica in sync until ctx is cancelled, reconnecting with
+// a fixed back-off and re-snapshotting when the primary's journal no
+// longer reaches back to our position or is not the one our position is
+// in (the primary restarted).
+func (r *Replica) Run(ctx context.Context) error {
+	conn, err := grpc.NewClient(r.cfg.Primary,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})))
+	if err != nil { return err }
+	defer conn.Close()
+	ctx = metadata.AppendToOutgoingContext(ctx, tokenKey, r.cfg.Token)
+
+	needSnapshot := true
+	for ctx.Err() == nil {
+		if needSnapshot {
+			if err := r.snapshot(ctx, conn); err != nil {
+				slog.Warn("replica snapshot failed", "err", err)
+				sleep(ctx, r.cfg.RetryInterval)
+				continue
+			}
+			needSnapshot = false
+		}
+		err := r.follow(ctx, conn)
+		if errors.Is(err, errResync) { needSnapshot = true; continue }
+		if ctx.Err() == nil {
+			slog.Warn("replica stream ended", "err", err, "applied", r.applied)
+			sleep(ctx, r.cfg.RetryInterval)
+		}
+	}
+	return ctx.Err()
+}
+
+func (r *Replica) snapshot(ctx context.Context, conn *grpc.ClientConn) error {
+	cs, err := conn.NewStream(ctx, &serviceDesc.Streams[1], "/"+serviceName+"/Snapshot")
+	if err != nil { return err }
+	if err := cs.SendMsg(&SnapshotRequest{}); err != nil { return err }
+	if err := cs.CloseSend(); err != nil { return err }
+	var seq uint64
+	var journal string
+	bufs := make(map[string]*bytes.Buffer)
+	for {
+		var c SnapshotChunk
+		err := cs.RecvMsg(&c)
+		if err == io.EOF { break }
+		if err != nil { return err }
+		seq, journal = c.Seq, c.JournalID
+		b := bufs[c.Tenant]
+		if b == nil { b = &bytes.Buffer{}; bufs[c.Tenant] = b }
+		b.Write(c.Data)
+		if !c.Last { continue }
+		g, err := r.tenants.Local(c.Tenant)
+		if err != nil { return err }
+		if err := g.ReadSnapshot(b); err != nil { return err }
+		delete(bufs, c.Tenant)
+	}
+	r.applied, r.journal = seq, journal
+	metrics.ReplicationApplied.Set(float64(seq))
+	slog.Info("replica restored snapshot", "seq", seq)
+	return nil
+}
+
+// follow applies streamed mutations. Replaying events already contained
+// in the snapshot is harmless: each event sets an edge's final state. A
+// tenant's graph replaced on the primary (a bulk load) takes a resync.
+func (r *Replica) follow(ctx context.Context, conn *grpc.ClientConn) error {
+	cs, err := conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/Stream")
+	if err != nil { return err }
+	if err := cs.SendMsg(&StreamRequest{FromSeq: r.applied + 1, JournalID: r.journal}); err != nil { return err }
+	if err := cs.CloseSend(); err != nil { return err }
+	for {
+		var m Mutation
+		if err := cs.RecvMsg(&m); err != nil {
+			if status.Code(err) == codes.OutOfRange { return errResync }
+			return err
+		}
+		g, err := r.tenants.Local(m.Tenant)
+		if err != nil { return err }
+		switch m.Op {
+		case "follow":
+			g.Follow(ctx, m.Src, m.Dst)
+		case "unfollow":
+			g.Unfollow(ctx, m.Src, m.Dst)
+		case "replace":
+			slog.Info("replica resyncing: primary replaced a graph", "tenant", m.Tenant, "seq", m.Seq)
+			return errResync
+		}
+		r.applied = m.Seq
+		metrics.ReplicationApplied.Set(float64(m.Seq))
+		metrics.ReplicationLagEvents.Set(float64(m.Head - m.Seq))
+		metrics.ReplicationLagSeconds.Set(time.Since(time.Unix(0, m.Time)).Seconds())
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
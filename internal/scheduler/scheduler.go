@@ -0,0 +1,154 @@
+// Package scheduler runs the server's periodic jobs (snapshots, backups,
+// community detection, embedding retraining...) in-process, each on its
+// own interval. A job never overlaps itself: a tick that finds the
+// previous run still going is skipped and counted. Every run is timed and
+// counted by result in the sg_job_* metrics.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+var (
+	ErrUnknown = errors.New("scheduler: unknown job")
+	ErrRunning = errors.New("scheduler: job already running")
+)
+
+type job struct {
+	name  string
+	every time.Duration
+	now   bool // also run at start
+	fn    func(ctx context.Context) error
+
+	running atomic.Bool
+	mu      sync.Mutex
+	status  Status
+}
+
+// Status is a job's state as shown by /admin/jobs.
+type Status struct {
+	Name        string        `json:"name"`
+	Every       time.Duration `json:"every_ns"`
+	Running     bool          `json:"running"`
+	Runs        int           `json:"runs"`
+	Skipped     int           `json:"skipped"`
+	LastStart   time.Time     `json:"last_start,omitzero"`
+	LastTook    time.Duration `json:"last_took_ns"`
+	LastError   string        `json:"last_error,omitempty"`
+	LastSuccess time.Time     `json:"last_success,omitzero"`
+}
+
+type Scheduler struct {
+	mu   sync.RWMutex
+	jobs map[string]*job
+	ctx  context.Context // set by Run; runs triggered before it use Background
+}
+
+func New() *Scheduler { return &Scheduler{jobs: make(map[string]*job), ctx: context.Background()} }
+
+// Add registers fn to run every interval once Run starts, and at once as
+// well with now. A non-positive interval leaves the job to Trigger only.
+// Jobs must be added before Run.
+func (s *Scheduler) Add(name string, every time.Duration, now bool, fn func(ctx context.Context) error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.jobs[name] = &job{name: name, every: every, now: now, fn: fn, status: Status{Name: name, Every: every}}
+}
+
+// Run ticks every job until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs { jobs = append(jobs, j) }
+	s.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		if j.every <= 0 { continue }
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	if j.now { s.start(ctx, j) }
+	t := time.NewTicker(j.every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.start(ctx, j)
+		}
+	}
+}
+
+// start runs j in the background unless it is running already.
+func (s *Scheduler) start(ctx context.Context, j *job) bool {
+	if !j.running.CompareAndSwap(false, true) {
+		metrics.JobRuns.WithLabelValues(j.name, "skipped").Inc()
+		j.mu.Lock(); j.status.Skipped++; j.mu.Unlock()
+		slog.Warn("job still running, skipping this run", "job", j.name)
+		return false
+	}
+	go func() {
+		defer j.running.Store(false)
+		start := time.Now()
+		j.mu.Lock(); j.status.LastStart = start; j.mu.Unlock()
+		err := j.fn(ctx)
+		took := time.Since(start)
+		metrics.JobDuration.WithLabelValues(j.name).Observe(took.Seconds())
+		j.mu.Lock(); defer j.mu.Unlock()
+		j.status.Runs++
+		j.status.LastTook = took
+		if err != nil {
+			metrics.JobRuns.WithLabelValues(j.name, "error").Inc()
+			j.status.LastError = err.Error()
+			if ctx.Err() == nil { slog.Error("job failed", "job", j.name, "took_ms", took.Milliseconds(), "err", err) }
+			return
+		}
+		metrics.JobRuns.WithLabelValues(j.name, "ok").Inc()
+		metrics.JobLastSuccess.WithLabelValues(j.name).SetToCurrentTime()
+		j.status.LastError, j.status.LastSuccess = "", time.Now()
+		slog.Debug("job done", "job", j.name, "took_ms", took.Milliseconds())
+	}()
+	return true
+}
+
+// Trigger starts job name now, outside its schedule.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.RLock()
+	j, ok := s.jobs[name]
+	ctx := s.ctx
+	s.mu.RUnlock()
+	if !ok { return ErrUnknown }
+	if !s.start(ctx, j) { return ErrRunning }
+	return nil
+}
+
+// Status returns every job's state, by name.
+func (s *Scheduler) Status() []Status {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	out := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		st := j.status
+		j.mu.Unlock()
+		st.Running = j.running.Load()
+		out = append(out, st)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
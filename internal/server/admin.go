@@ -0,0 +1,641 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/audit"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/config"
+	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/pymk"
+	"github.com/pandharkardeep/social-graph/internal/scheduler"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+)
+
+// /admin/keys: GET lists keys, POST creates one (secret returned once),
+// DELETE ?id= revokes.
+func (s *server) adminKeys(w http.ResponseWriter, r *http.Request) {
+	if s.auth == nil { http.Error(w, "auth disabled", 404); return }
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.auth.Keys())
+	case http.MethodPost:
+		type req struct {
+			ID     string   `json:"id"`
+			Key    string   `json:"key"`
+			Scopes []string `json:"scopes"`
+			Tenant string   `json:"tenant"`
+		}
+		var body req
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), 400); return
+		}
+		if body.ID == "" || len(body.Scopes) == 0 { http.Error(w, "id and scopes required", 400); return }
+		k := auth.Key{ID: body.ID, Secret: body.Key, Tenant: strings.ToLower(body.Tenant)}
+		if k.Tenant != "" && !tenant.ValidName(k.Tenant) { http.Error(w, tenant.ErrBadName.Error(), 400); return }
+		for _, sc := range body.Scopes {
+			p, err := auth.ParseScope(sc)
+			if err != nil { http.Error(w, err.Error(), 400); return }
+			k.Scopes = append(k.Scopes, p)
+		}
+		added, err := s.auth.AddKey(k)
+		if errors.Is(err, auth.ErrDuplicateKey) { http.Error(w, err.Error(), http.StatusConflict); return }
+		writeJSON(w, added)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" { http.Error(w, "missing id", 400); return }
+		writeJSON(w, map[string]any{"ok": s.auth.RemoveKey(id)})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// /admin/tenants: GET lists tenants, POST {name, config?} creates one with
+// its own PYMK config (defaults when omitted).
+func (s *server) adminTenants(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		names := []string{}
+		for _, n := range s.reg.Names() {
+			if _, g := tenant.Split(n); g == "" { names = append(names, n) }
+		}
+		writeJSON(w, names)
+	case http.MethodPost:
+		type req struct {
+			Name   string           `json:"name"`
+			Config *pymk.PYMKConfig `json:"config"`
+		}
+		var body req
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), 400); return
+		}
+		t, err := s.reg.Create(body.Name, body.Config)
+		if err != nil { http.Error(w, err.Error(), 400); return }
+		writeJSON(w, map[string]any{"ok": true, "name": t.Name})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// /admin/graphs: GET lists the request's tenant's graphs, its main one
+// as "default", with when ephemeral ones expire; POST {name, config?,
+// ttl?} creates a named graph, with the tenant's PYMK config unless one
+// is given, dropped after ttl ("30m") when set; DELETE ?name= drops one.
+func (s *server) adminGraphs(w http.ResponseWriter, r *http.Request) {
+	tn, _ := tenant.Split(tenant.FromRequest(r))
+	if _, err := s.reg.Get(tn); err != nil { http.Error(w, err.Error(), 404); return }
+	switch r.Method {
+	case http.MethodGet:
+		expires := map[string]time.Time{}
+		for _, g := range s.reg.GraphsOf(tn) {
+			if t, err := s.reg.Get(tenant.Key(tn, g)); err == nil && t.Ephemeral() { expires[g] = t.Expires }
+		}
+		writeJSON(w, map[string]any{"tenant": tn, "graphs": append([]string{tenant.Default}, s.reg.GraphsOf(tn)...), "expires": expires})
+	case http.MethodPost:
+		var body struct {
+			Name   string           `json:"name"`
+			Config *pymk.PYMKConfig `json:"config"`
+			TTL    string           `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), 400); return
+		}
+		if body.Name == "" || body.Name == tenant.Default || !tenant.ValidName(body.Name) { http.Error(w, tenant.ErrBadName.Error(), 400); return }
+		key := tenant.Key(tn, body.Name)
+		if body.TTL == "" {
+			t, err := s.reg.Create(key, body.Config)
+			if err != nil { http.Error(w, err.Error(), 400); return }
+			writeJSON(w, map[string]any{"ok": true, "tenant": tn, "graph": t.Graph})
+			return
+		}
+		ttl, err := time.ParseDuration(body.TTL)
+		if err != nil || ttl <= 0 { http.Error(w, "bad ttl", 400); return }
+		if cfg := s.cfg(); cfg.Cluster.Enabled || cfg.Raft.Enabled || cfg.Replication.Role != "" {
+			http.Error(w, "ephemeral graphs live on one node; not available in cluster, raft or replication mode", 501); return
+		}
+		t, err := s.reg.CreateEphemeral(key, body.Config, ttl)
+		if errors.Is(err, tenant.ErrExists) { http.Error(w, err.Error(), 409); return }
+		if err != nil { http.Error(w, err.Error(), 400); return }
+		slog.InfoContext(r.Context(), "ephemeral graph created", "tenant", tn, "graph", t.Graph, "expires", t.Expires)
+		writeJSON(w, map[string]any{"ok": true, "tenant": tn, "graph": t.Graph, "expires": t.Expires})
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		err := s.reg.Drop(tenant.Key(tn, name))
+		if errors.Is(err, tenant.ErrUnknown) { http.Error(w, "unknown graph", 404); return }
+		if err != nil { http.Error(w, err.Error(), 400); return }
+		writeJSON(w, map[string]any{"ok": true})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// /admin/config dumps the effective configuration as YAML, secrets masked.
+func (s *server) getConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+	if s.cfg == nil { http.Error(w, "no config", 404); return }
+	b, err := s.cfg().Redacted()
+	if err != nil { http.Error(w, err.Error(), 500); return }
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(b)
+}
+
+// /admin/merge_users: POST {from, to, embedding?} moves every edge of from
+// onto to, merges embeddings (keep_to | keep_from | average, default
+// keep_to) and aliases from to to so stale IDs keep resolving.
+func (s *server) adminMergeUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		From      uint64 `json:"from"`
+		To        uint64 `json:"to"`
+		Embedding string `json:"embedding"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	from, to := body.From, s.users.Resolve(body.To)
+	if s.users.Resolve(from) != from { http.Error(w, "from is already merged", 409); return }
+	if from == to { http.Error(w, "from and to are the same user", 400); return }
+	vec, err := mergeEmbedding(s.e, from, to, body.Embedding)
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	if err := s.users.Alias(from, to); err != nil { http.Error(w, err.Error(), 409); return }
+	s.audit.Record(r.Context(), audit.Record{Tenant: s.tenant, Op: "merge", Src: from, Dst: to})
+
+	ctx := r.Context()
+	out, err := s.g.Following(ctx, from)
+	if storeError(w, r, err) { return }
+	in, err := s.g.Followers(ctx, from)
+	if storeError(w, r, err) { return }
+	ops := make([]graph.EdgeOp, 0, 2*(len(out)+len(in)))
+	move := func(old, next [2]uint64) {
+		ops = append(ops, graph.EdgeOp{Op: "unfollow", Src: old[0], Dst: old[1]})
+		if next[0] != next[1] { ops = append(ops, graph.EdgeOp{Op: "follow", Src: next[0], Dst: next[1]}) }
+	}
+	for _, x := range out { move([2]uint64{from, x}, [2]uint64{to, x}) }
+	for _, x := range in { move([2]uint64{x, from}, [2]uint64{x, to}) }
+	moved, err := s.moveEdges(ctx, ops)
+	if storeError(w, r, err) { return }
+	if vec != nil { s.e.Put(to, vec) }
+	if storeError(w, r, s.g.TouchUsers(ctx, from, to)) { return }
+	writeJSON(w, map[string]any{"ok": true, "to": to, "edges_moved": moved})
+}
+
+// moveEdges applies a merge's ops as one transaction and returns how many
+// follows it added. Where the store cannot (a merge spanning cluster
+// nodes, or larger than a transaction may be), they are applied one by
+// one, and a store failure stops the merge part way: from is already
+// aliased to to, and edges not yet moved stay on from.
+func (s *server) moveEdges(ctx context.Context, ops []graph.EdgeOp) (int, error) {
+	moved := 0
+	if len(ops) <= maxTxOps {
+		changed, err := s.g.Apply(ctx, ops)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			for i, ok := range changed {
+				if ok && ops[i].Op == "follow" { moved++ }
+			}
+			return moved, err
+		}
+	}
+	for _, op := range ops {
+		if op.Op == "unfollow" {
+			if _, err := s.g.Unfollow(ctx, op.Src, op.Dst); err != nil { return moved, err }
+			continue
+		}
+		ok, err := s.g.Follow(ctx, op.Src, op.Dst)
+		if ok { moved++ }
+		if err != nil { return moved, err }
+	}
+	return moved, nil
+}
+
+func mergeEmbedding(e embeds.Store, from, to uint64, strategy string) ([]float32, error) {
+	fv, fok := e.Get(from)
+	tv, tok := e.Get(to)
+	switch strategy {
+	case "", "keep_to":
+		if !tok && fok { return fv, nil } // nothing to keep; inherit from's
+		return nil, nil
+	case "keep_from":
+		if fok { return fv, nil }
+		return nil, nil
+	case "average":
+		if !fok || !tok || len(fv) != len(tv) {
+			if !tok && fok { return fv, nil }
+			return nil, nil
+		}
+		out := make([]float32, len(tv))
+		for i := range tv { out[i] = (fv[i] + tv[i]) / 2 }
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown embedding strategy %q", strategy)
+}
+
+type memStats struct {
+	Tenant   string             `json:"tenant"`
+	Edges    int                `json:"edges"`
+	EstBytes int64              `json:"est_bytes"`
+	HeapUsed uint64             `json:"heap_inuse_bytes"` // whole process
+	Shards   []graph.ShardStats `json:"shards"`
+}
+
+func (s *server) memStats() memStats {
+	m := memStats{Tenant: s.tenant, Shards: s.local.MemStats()}
+	for _, sh := range m.Shards { m.Edges += sh.Edges; m.EstBytes += sh.EstBytes }
+	var rt runtime.MemStats
+	runtime.ReadMemStats(&rt)
+	m.HeapUsed = rt.HeapInuse
+	return m
+}
+
+// /admin/memstats reports this node's per-shard map sizes for the tenant.
+func (s *server) adminMemStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+	writeJSON(w, s.memStats())
+}
+
+// /admin/compact rebuilds the tenant's maps to release memory left behind
+// by deletions, returning heap usage before and after.
+func (s *server) adminCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	before := s.memStats().HeapUsed
+	start := time.Now()
+	s.local.Compact()
+	writeJSON(w, map[string]any{
+		"heap_inuse_before": before, "heap_inuse_after": s.memStats().HeapUsed,
+		"took_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+// /admin/hot_keys lists the tenant's most-queried users over the decaying
+// window.
+func (s *server) adminHotKeys(w http.ResponseWriter, r *http.Request) {
+	if s.hot == nil { http.Error(w, "hot key tracking disabled", 404); return }
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	writeJSON(w, s.hot.Top(n))
+}
+
+// /admin/churn lists the tenant's users whose epochs change most over the
+// decaying window, ?hot=true only those past churn.min_changes.
+func (s *server) adminChurn(w http.ResponseWriter, r *http.Request) {
+	if s.churn == nil { http.Error(w, "churn tracking disabled", 404); return }
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	top := s.churn.Top(n)
+	if r.URL.Query().Get("hot") == "true" {
+		top = s.churn.HotUsers()
+		if n > 0 && n < len(top) { top = top[:n] }
+	}
+	writeJSON(w, map[string]any{"users": top, "min_changes": s.churn.Min})
+}
+
+// /admin/users: this node's users with at least min_followers followers
+// and min_following followees, from the shards' degree indexes. limit
+// defaults to 100.
+func (s *server) adminUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var minIn, minOut int
+	limit := 100
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"min_followers", &minIn}, {"min_following", &minOut}, {"limit", &limit}} {
+		v := q.Get(p.name)
+		if v == "" { continue }
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 { http.Error(w, "bad "+p.name, 400); return }
+		*p.dst = n
+	}
+	if minIn == 0 && minOut == 0 { http.Error(w, "min_followers or min_following required", 400); return }
+	if limit == 0 || limit > 10000 { http.Error(w, "bad limit", 400); return }
+	us := s.local.UsersByDegree(minIn, minOut, limit)
+	if us == nil { us = []graph.DegreeUser{} }
+	writeJSON(w, us)
+}
+
+// /admin/integrity: GET checks that both halves of every edge agree, POST
+// checks and repairs. Both scan the whole tenant graph.
+func (s *server) adminIntegrity(w http.ResponseWriter, r *http.Request) {
+	var repair bool
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		repair = true
+	default:
+		http.Error(w, "method not allowed", 405); return
+	}
+	if s.cfg().Cluster.Enabled {
+		http.Error(w, "integrity checks need the whole graph on one node; not available in cluster mode", 501); return
+	}
+	t, err := s.reg.Get(s.tenant)
+	if err != nil { http.Error(w, err.Error(), 404); return }
+	rep, err := t.CheckIntegrity(repair)
+	if storeError(w, r, err) { return }
+	if rep.Sample == nil { rep.Sample = []graph.Asymmetry{} }
+	if repair {
+		actor := ""
+		if p := auth.FromContext(r.Context()); p != nil { actor = p.ID }
+		slog.InfoContext(r.Context(), "audit: integrity repair", "tenant", s.tenant, "actor", actor, "repaired", rep.Repaired)
+	}
+	writeJSON(w, map[string]any{"report": rep, "took_ms": rep.Took.Milliseconds()})
+}
+
+// /admin/communities: GET the latest community detection (largest
+// communities, or user_id's), or POST to run one now.
+func (s *server) adminCommunities(w http.ResponseWriter, r *http.Request) {
+	t, err := s.reg.Get(s.tenant)
+	if err != nil { http.Error(w, err.Error(), 404); return }
+	l := t.Communities()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if s.cfg().Cluster.Enabled {
+			http.Error(w, "community detection needs the whole graph on one node; not available in cluster mode", 501); return
+		}
+		if l, err = t.DetectCommunities(r.Context(), s.cfg().Community.Rounds); storeError(w, r, err) { return }
+	default:
+		http.Error(w, "method not allowed", 405); return
+	}
+	if l == nil { http.Error(w, "no community detection has run", 404); return }
+	if q := r.URL.Query().Get("user_id"); q != "" {
+		u, err := s.parseID(q)
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		c, ok := l.Of(u)
+		if !ok { writeJSON(w, map[string]any{"user_id": u, "community": nil}); return }
+		writeJSON(w, map[string]any{"user_id": u, "community": c, "size": l.Size(c)})
+		return
+	}
+	writeJSON(w, map[string]any{"communities": l.Count(), "largest": l.Largest(20), "rounds": l.Rounds,
+		"at": l.At, "took_ms": l.Took.Milliseconds()})
+}
+
+// /admin/audit: the tenant's audit records, oldest first, optionally
+// only those involving user_id. since is an RFC 3339 time or a duration back from now ("24h");
+// limit defaults to 1000.
+func (s *server) adminAudit(w http.ResponseWriter, r *http.Request) {
+	if s.audit == nil { http.Error(w, "audit log disabled", 404); return }
+	q := r.URL.Query()
+	var user *uint64
+	if v := q.Get("user_id"); v != "" {
+		u, err := s.parseID(v)
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		user = &u
+	}
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			since = time.Now().Add(-d)
+		} else if since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "bad since: want RFC 3339 or a duration", 400); return
+		}
+	}
+	limit := 1000
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > 10000 { http.Error(w, "bad limit", 400); return }
+	}
+	recs, more, err := s.audit.Query(s.tenant, user, since, limit)
+	if err != nil { slog.ErrorContext(r.Context(), "audit query failed", "err", err); http.Error(w, "internal error", 500); return }
+	if recs == nil { recs = []audit.Record{} }
+	writeJSON(w, map[string]any{"records": recs, "truncated": more})
+}
+
+// /admin/idmap: GET ?id= or ?dense= looks up one mapping; otherwise every
+// mapping from index ?from= (default 0) is streamed as JSON lines in index
+// order, for export tooling.
+func (s *server) adminIDMap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+	if s.ids == nil { http.Error(w, "idmap disabled", 404); return }
+	q := r.URL.Query()
+	if v := q.Get("id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil { http.Error(w, "bad id", 400); return }
+		d, ok := s.ids.Dense(id)
+		if !ok { http.Error(w, "not mapped", 404); return }
+		writeJSON(w, map[string]any{"id": id, "dense": d}); return
+	}
+	if v := q.Get("dense"); v != "" {
+		d, err := strconv.ParseUint(v, 10, 32)
+		if err != nil { http.Error(w, "bad dense", 400); return }
+		id, ok := s.ids.External(uint32(d))
+		if !ok { http.Error(w, "not mapped", 404); return }
+		writeJSON(w, map[string]any{"id": id, "dense": d}); return
+	}
+	var from uint64
+	if v := q.Get("from"); v != "" {
+		var err error
+		if from, err = strconv.ParseUint(v, 10, 32); err != nil { http.Error(w, "bad from", 400); return }
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Mapped", strconv.Itoa(s.ids.Len()))
+	enc := json.NewEncoder(w)
+	s.ids.Each(uint32(from), func(d uint32, id uint64) bool {
+		return enc.Encode(struct {
+			Dense uint32 `json:"dense"`
+			ID    uint64 `json:"id"`
+		}{d, id}) == nil && r.Context().Err() == nil
+	})
+}
+
+// pymkConfigView is PYMKConfig on the wire, with its durations
+// as Go duration strings ("2m") rather than nanoseconds.
+type pymkConfigView struct {
+	MaxExpandPerNeighbor int     `json:"max_expand_per_neighbor"`
+	MaxCandidates        int     `json:"max_candidates"`
+	WCommon              float64 `json:"w_common"`
+	WJaccard             float64 `json:"w_jaccard"`
+	WAA                  float64 `json:"w_aa"`
+	WCosine              float64 `json:"w_cosine"`
+	WInterest            float64 `json:"w_interest"`
+	WTopics              float64 `json:"w_topics"`
+	CacheSize            int     `json:"cache_size"`
+	CacheTTL             string  `json:"cache_ttl"`
+	Parallelism          int     `json:"parallelism"`
+	SampleSeed           int64   `json:"sample_seed"`
+	Normalization        string  `json:"normalization"`
+	Timeout              string  `json:"timeout"`
+	ConversionWindow     string  `json:"conversion_window"`
+	K                    int     `json:"k"`
+	MaxPerMutual         int     `json:"max_per_mutual"`
+	Community            string  `json:"community"`
+	CommunityBoost       float64 `json:"community_boost"`
+	Filter               string       `json:"filter"`
+	Boosts               []pymk.Boost `json:"boosts"`
+	CrossLocale          float64      `json:"cross_locale"`
+	TopicFanout          int          `json:"topic_fanout"`
+	EdgeWeights          string       `json:"edge_weights"`
+	RecencyBoost         float64      `json:"recency_boost"`
+	RecencyHalfLife      string       `json:"recency_half_life"`
+	ApproxSamples        int          `json:"approx_samples"`
+}
+
+func viewPYMKConfig(c pymk.PYMKConfig) pymkConfigView {
+	return pymkConfigView{c.MaxExpandPerNeighbor, c.MaxCandidates, c.WCommon, c.WJaccard, c.WAA, c.WCosine, c.WInterest, c.WTopics,
+		c.CacheSize, c.CacheTTL.String(), c.Parallelism, c.SampleSeed, pymk.NormalizationName(c.Normalization),
+		c.Timeout.String(), c.ConversionWindow.String(), c.K, c.MaxPerMutual,
+		pymk.CommunityMode(c.Community), c.CommunityBoost, c.Filter, c.Boosts, c.CrossLocale, c.TopicFanout, c.EdgeWeights, c.RecencyBoost, c.RecencyHalfLife.String(), c.ApproxSamples}
+}
+
+// /admin/pymk_config: GET the tenant's effective PYMK config, or PATCH it
+// live with any subset of its fields; ?profile= picks a profile's instead.
+// Changes are validated like the config file, drop that PYMK cache, and
+// last until restart or a reload that touches PYMK.
+func (s *server) adminPYMKConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, viewPYMKConfig(s.svc.Config()))
+	case http.MethodPatch:
+		var p struct {
+			MaxExpandPerNeighbor *int     `json:"max_expand_per_neighbor"`
+			MaxCandidates        *int     `json:"max_candidates"`
+			WCommon              *float64 `json:"w_common"`
+			WJaccard             *float64 `json:"w_jaccard"`
+			WAA                  *float64 `json:"w_aa"`
+			WCosine              *float64 `json:"w_cosine"`
+			WInterest            *float64 `json:"w_interest"`
+			WTopics              *float64 `json:"w_topics"`
+			TopicFanout          *int     `json:"topic_fanout"`
+			ApproxSamples        *int     `json:"approx_samples"`
+			EdgeWeights          *string  `json:"edge_weights"`
+			RecencyBoost         *float64 `json:"recency_boost"`
+			RecencyHalfLife      *string  `json:"recency_half_life"`
+			CacheSize            *int     `json:"cache_size"`
+			CacheTTL             *string  `json:"cache_ttl"`
+			Parallelism          *int     `json:"parallelism"`
+			SampleSeed           *int64   `json:"sample_seed"`
+			Normalization        *string  `json:"normalization"`
+			Timeout              *string  `json:"timeout"`
+			ConversionWindow     *string  `json:"conversion_window"`
+			K                    *int     `json:"k"`
+			MaxPerMutual         *int     `json:"max_per_mutual"`
+			Community            *string  `json:"community"`
+			CommunityBoost       *float64 `json:"community_boost"`
+			Filter               *string       `json:"filter"`
+			Boosts               *[]pymk.Boost `json:"boosts"`
+			CrossLocale          *float64      `json:"cross_locale"`
+		}
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil { http.Error(w, err.Error(), 400); return }
+		old := s.svc.Config()
+		c := old
+		set := func(dst *int, v *int) { if v != nil { *dst = *v } }
+		setF := func(dst *float64, v *float64) { if v != nil { *dst = *v } }
+		set(&c.MaxExpandPerNeighbor, p.MaxExpandPerNeighbor)
+		set(&c.MaxCandidates, p.MaxCandidates)
+		setF(&c.WCommon, p.WCommon)
+		setF(&c.WJaccard, p.WJaccard)
+		setF(&c.WAA, p.WAA)
+		setF(&c.WCosine, p.WCosine)
+		setF(&c.WInterest, p.WInterest)
+		setF(&c.WTopics, p.WTopics)
+		setF(&c.RecencyBoost, p.RecencyBoost)
+		set(&c.TopicFanout, p.TopicFanout)
+		set(&c.ApproxSamples, p.ApproxSamples)
+		set(&c.CacheSize, p.CacheSize)
+		set(&c.Parallelism, p.Parallelism)
+		set(&c.K, p.K)
+		set(&c.MaxPerMutual, p.MaxPerMutual)
+		setF(&c.CommunityBoost, p.CommunityBoost)
+		setF(&c.CrossLocale, p.CrossLocale)
+		if p.Community != nil { c.Community = *p.Community }
+		if p.Filter != nil { c.Filter = *p.Filter }
+		if p.EdgeWeights != nil { c.EdgeWeights = *p.EdgeWeights }
+		if p.Boosts != nil { c.Boosts = *p.Boosts }
+		if p.SampleSeed != nil { c.SampleSeed = *p.SampleSeed }
+		if p.Normalization != nil { c.Normalization = *p.Normalization }
+		if p.CacheTTL != nil {
+			d, err := time.ParseDuration(*p.CacheTTL)
+			if err != nil { http.Error(w, "bad cache_ttl: "+err.Error(), 400); return }
+			c.CacheTTL = d
+		}
+		if p.Timeout != nil {
+			d, err := time.ParseDuration(*p.Timeout)
+			if err != nil { http.Error(w, "bad timeout: "+err.Error(), 400); return }
+			c.Timeout = d
+		}
+		if p.RecencyHalfLife != nil {
+			d, err := time.ParseDuration(*p.RecencyHalfLife)
+			if err != nil { http.Error(w, "bad recency_half_life: "+err.Error(), 400); return }
+			c.RecencyHalfLife = d
+		}
+		if p.ConversionWindow != nil {
+			d, err := time.ParseDuration(*p.ConversionWindow)
+			if err != nil { http.Error(w, "bad conversion_window: "+err.Error(), 400); return }
+			c.ConversionWindow = d
+		}
+		if err := config.ValidatePYMK(c); err != nil { http.Error(w, err.Error(), 400); return }
+		s.svc.SetConfig(c)
+		actor := ""
+		if p := auth.FromContext(r.Context()); p != nil { actor = p.ID }
+		slog.InfoContext(r.Context(), "audit: pymk config changed", "tenant", s.tenant, "actor", actor,
+			"before", viewPYMKConfig(old), "after", viewPYMKConfig(c))
+		writeJSON(w, viewPYMKConfig(c))
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// /admin/flags: GET every rollout, PUT {name, percent} to change one, or
+// DELETE ?name= to turn one off. Changes last until restart or a config
+// reload that touches flags.
+// /admin/jobs: GET lists the scheduled jobs and their last runs; POST
+// ?name= starts one now, 409 while it is still running.
+func (s *server) adminJobs(w http.ResponseWriter, r *http.Request) {
+	if s.jobs == nil { http.Error(w, "no scheduler", 404); return }
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.jobs.Status())
+	case http.MethodPost:
+		name := r.URL.Query().Get("name")
+		switch err := s.jobs.Trigger(name); {
+		case errors.Is(err, scheduler.ErrUnknown):
+			http.Error(w, err.Error(), 404)
+		case errors.Is(err, scheduler.ErrRunning):
+			http.Error(w, err.Error(), 409)
+		default:
+			if p := auth.FromContext(r.Context()); p != nil {
+				slog.InfoContext(r.Context(), "audit: job triggered", "actor", p.ID, "job", name)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(map[string]string{"started": name})
+		}
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+func (s *server) adminFlags(w http.ResponseWriter, r *http.Request) {
+	fs := s.reg.Flags
+	if fs == nil { http.Error(w, "flags disabled", 404); return }
+	actor := ""
+	if p := auth.FromContext(r.Context()); p != nil { actor = p.ID }
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, fs.All())
+	case http.MethodPut:
+		var body struct {
+			Name    string  `json:"name"`
+			Percent float64 `json:"percent"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		if err := fs.Set(body.Name, body.Percent); err != nil { http.Error(w, err.Error(), 400); return }
+		slog.InfoContext(r.Context(), "audit: flag changed", "actor", actor, "flag", body.Name, "percent", body.Percent)
+		writeJSON(w, fs.All())
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		fs.Delete(name)
+		slog.InfoContext(r.Context(), "audit: flag removed", "actor", actor, "flag", name)
+		writeJSON(w, fs.All())
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+)
+
+// postUser creates a user: it vends a new ID (see users.IDs) and stores
+// the attributes and embedding given, if any, as PUT /attrs and PUT
+// /embedding would. Nothing is stored for a bare POST; the ID is simply
+// never handed out again.
+func (s *server) postUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	if s.vend == nil { http.Error(w, "user ids not configured", 404); return }
+	var body struct {
+		Locale string    `json:"locale"`
+		Vec    []float32 `json:"vector"`
+		attrs.Attrs
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF { http.Error(w, err.Error(), 400); return } // empty is fine
+	if body.Locale != "" { body.Language, body.Country = attrs.ParseLocale(body.Locale) }
+	if err := body.Attrs.Normalize(); err != nil { http.Error(w, err.Error(), 400); return }
+	u := s.vend.Next()
+	if err := s.attrs.Set(u, body.Attrs); err != nil { http.Error(w, err.Error(), 400); return }
+	if len(body.Vec) > 0 { s.e.Put(u, body.Vec) }
+	if s.ids != nil {
+		if _, err := s.ids.Assign(u); err != nil { slog.WarnContext(r.Context(), "no dense id for new user", "user_id", u, "err", err) }
+	}
+	a, _ := s.attrs.Get(u)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"user_id": u, "attrs": a, "locale": a.Locale()})
+}
+
+// userAttrs reads (GET ?user_id=) or, with write scope, replaces (PUT
+// {user_id, ...attrs}), partially updates (PATCH, only the fields given)
+// or deletes (DELETE ?user_id=) a user's attributes. Writes also take a
+// locale such as "de-AT", which sets language and country together.
+func (s *server) userAttrs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u, err := s.parseID(r.URL.Query().Get("user_id"))
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		a, _ := s.attrs.Get(u)
+		writeAttrs(w, u, a)
+	case http.MethodPut:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			UserID uint64 `json:"user_id"`
+			Locale string `json:"locale"`
+			attrs.Attrs
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		if body.Locale != "" { body.Language, body.Country = attrs.ParseLocale(body.Locale) }
+		u := s.users.Resolve(body.UserID)
+		if err := s.attrs.Set(u, body.Attrs); err != nil { http.Error(w, err.Error(), 400); return }
+		a, _ := s.attrs.Get(u)
+		writeAttrs(w, u, a)
+	case http.MethodPatch:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			UserID   uint64     `json:"user_id"`
+			Country  *string    `json:"country"`
+			Language *string    `json:"language"`
+			Locale   *string    `json:"locale"`
+			Created  *time.Time `json:"created"`
+			Verified *bool      `json:"verified"`
+			Topics   *[]string  `json:"topics"`
+			Interests *map[string]float64 `json:"interests"`
+		}
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		u := s.users.Resolve(body.UserID)
+		a, err := s.attrs.Update(u, func(a *attrs.Attrs) {
+			if body.Country != nil { a.Country = *body.Country }
+			if body.Language != nil { a.Language = *body.Language }
+			if body.Locale != nil { a.Language, a.Country = attrs.ParseLocale(*body.Locale) }
+			if body.Created != nil { a.Created = *body.Created }
+			if body.Verified != nil { a.Verified = *body.Verified }
+			if body.Topics != nil { a.Topics = *body.Topics }
+			if body.Interests != nil { a.Interests = *body.Interests }
+		})
+		if err != nil { http.Error(w, err.Error(), 400); return }
+		writeAttrs(w, u, a)
+	case http.MethodDelete:
+		if !s.canWrite(w, r) { return }
+		u, err := s.parseID(r.URL.Query().Get("user_id"))
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		writeJSON(w, map[string]any{"ok": s.attrs.Delete(u)})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+func writeAttrs(w http.ResponseWriter, u uint64, a attrs.Attrs) {
+	writeJSON(w, map[string]any{"user_id": u, "attrs": a, "locale": a.Locale()})
+}
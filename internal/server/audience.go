@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+// Audiences up to exactLimit users are compared exactly; past that they
+// spill into an HLL (union size) and a bottom-k MinHash (Jaccard). A
+// two-hop audience expands at most maxExpand of the user's followers.
+const (
+	exactLimit = 10_000
+	minhashK   = 1024
+	maxExpand  = 1_000
+)
+
+type audience struct {
+	set     map[uint64]struct{}
+	hll     *sketch.HLL
+	mh      *sketch.MinHash
+	partial bool // only a sample of the followers was expanded
+}
+
+func newAudience() *audience { return &audience{set: make(map[uint64]struct{})} }
+
+func (a *audience) add(x uint64) {
+	if a.set == nil {
+		a.hll.Add(x); a.mh.Add(x)
+		return
+	}
+	a.set[x] = struct{}{}
+	if len(a.set) > exactLimit { a.spill() }
+}
+
+func (a *audience) spill() {
+	if a.set == nil { return }
+	a.hll, a.mh = sketch.NewHLL(), sketch.NewMinHash(minhashK)
+	for x := range a.set { a.hll.Add(x); a.mh.Add(x) }
+	a.set = nil
+}
+
+func (a *audience) size() uint64 {
+	if a.set != nil { return uint64(len(a.set)) }
+	return a.hll.Count()
+}
+
+type overlapResult struct {
+	U            uint64  `json:"u"`
+	V            uint64  `json:"v"`
+	Intersection uint64  `json:"intersection"`
+	Jaccard      float64 `json:"jaccard"`
+	Exact        bool    `json:"exact"`
+	Partial      bool    `json:"partial,omitempty"`
+}
+
+func overlap(a, b *audience) overlapResult {
+	r := overlapOf(a, b)
+	r.Partial = a.partial || b.partial
+	return r
+}
+
+func overlapOf(a, b *audience) overlapResult {
+	if a.set != nil && b.set != nil {
+		small, big := a.set, b.set
+		if len(small) > len(big) { small, big = big, small }
+		var n uint64
+		for x := range small {
+			if _, ok := big[x]; ok { n++ }
+		}
+		r := overlapResult{U: a.size(), V: b.size(), Intersection: n, Exact: true}
+		if union := r.U + r.V - n; union > 0 { r.Jaccard = float64(n) / float64(union) }
+		return r
+	}
+	a.spill(); b.spill()
+	union := sketch.NewHLL()
+	union.Merge(a.hll); union.Merge(b.hll)
+	j := a.mh.Jaccard(b.mh)
+	return overlapResult{U: a.size(), V: b.size(), Jaccard: j, Intersection: uint64(math.Round(j * float64(union.Count())))}
+}
+
+// followerAudience is u's followers; with twoHop it also includes the
+// followers of those whose lists see allows (the people one reshare
+// away). u itself is excluded. Past maxExpand followers only a uniform
+// sample of them is expanded, and the audience is marked partial.
+func (s *server) followerAudience(ctx context.Context, u uint64, twoHop bool, see func(uint64) (bool, error)) (*audience, error) {
+	a := newAudience()
+	fs, err := s.g.Followers(ctx, u)
+	if err != nil { return nil, err }
+	for _, f := range fs {
+		if f != u { a.add(f) }
+	}
+	if !twoHop { return a, nil }
+	if len(fs) > maxExpand { fs, a.partial = sampleIDs(fs, maxExpand, u), true }
+	for _, f := range fs {
+		if err := ctx.Err(); err != nil { return nil, err }
+		ok, err := see(f)
+		if err != nil { return nil, err }
+		if !ok { continue }
+		err = s.g.ForEachFollowers(ctx, f, func(ff uint64) bool {
+			if ff != u { a.add(ff) }
+			return true
+		})
+		if err != nil { return nil, err }
+	}
+	return a, nil
+}
+
+// sampleIDs keeps the k ids with the smallest hash salted by seed (bottom-k,
+// as PYMK samples past max_expand_per_neighbor), so the same audience
+// expands the same followers every time.
+func sampleIDs(ids []uint64, k int, seed uint64) []uint64 {
+	salt := sketch.Hash(seed)
+	h := make([]uint64, len(ids))
+	idx := make([]int, len(ids))
+	for i, id := range ids { h[i], idx[i] = sketch.Hash(id^salt), i }
+	sort.Slice(idx, func(i, j int) bool { return h[idx[i]] < h[idx[j]] })
+	out := make([]uint64, k)
+	for i := range out { out[i] = ids[idx[i]] }
+	return out
+}
+
+// getAudienceOverlap compares the follower bases and the 2-hop audiences
+// of u and v.
+func (s *server) getAudienceOverlap(w http.ResponseWriter, r *http.Request) {
+	u, err1 := s.parseID(r.URL.Query().Get("u"))
+	v, err2 := s.parseID(r.URL.Query().Get("v"))
+	if err1 != nil || err2 != nil { http.Error(w, "bad ids", 400); return }
+	if !s.mustSee(w, r, u, v) { return }
+	see := s.lists(r)
+	res := make(map[string]overlapResult, 2)
+	for name, twoHop := range map[string]bool{"followers": false, "two_hop": true} {
+		a, err := s.followerAudience(r.Context(), u, twoHop, see)
+		if storeError(w, r, err) { return }
+		b, err := s.followerAudience(r.Context(), v, twoHop, see)
+		if storeError(w, r, err) { return }
+		res[name] = overlap(a, b)
+	}
+	writeJSON(w, res)
+}
+
+// getOverlap is the follower half of /audience_overlap on its own, flat:
+// {"u":..,"v":..,"intersection":..,"jaccard":..,"exact":..}. Follower sets
+// up to exactLimit are intersected in place, without copying either.
+func (s *server) getOverlap(w http.ResponseWriter, r *http.Request) {
+	u, err1 := s.parseID(r.URL.Query().Get("u"))
+	v, err2 := s.parseID(r.URL.Query().Get("v"))
+	if err1 != nil || err2 != nil { http.Error(w, "bad ids", 400); return }
+	if !s.mustSee(w, r, u, v) { return }
+	fu, err := s.g.FollowersSet(r.Context(), u)
+	if storeError(w, r, err) { return }
+	fv, err := s.g.FollowersSet(r.Context(), v)
+	if storeError(w, r, err) { return }
+	if fu.Len() > exactLimit || fv.Len() > exactLimit {
+		a, err := s.followerAudience(r.Context(), u, false, nil)
+		if storeError(w, r, err) { return }
+		b, err := s.followerAudience(r.Context(), v, false, nil)
+		if storeError(w, r, err) { return }
+		writeJSON(w, overlap(a, b))
+		return
+	}
+	// Self-follows don't count, as in followerAudience.
+	res := overlapResult{U: uint64(fu.Len()), V: uint64(fv.Len()), Exact: true}
+	if fu.Has(u) { res.U-- }
+	if fv.Has(v) { res.V-- }
+	scan, probe := fu, fv
+	if scan.Len() > probe.Len() { scan, probe = probe, scan }
+	scan.Each(func(x uint64) bool {
+		if x != u && x != v && probe.Has(x) { res.Intersection++ }
+		return true
+	})
+	if union := res.U + res.V - res.Intersection; union > 0 { res.Jaccard = float64(res.Intersection) / float64(union) }
+	writeJSON(w, res)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pandharkardeep/social-graph/internal/audit"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/block"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// viewerParam reads the optional ?viewer= whose block/mute lists filter a
+// read endpoint's results.
+func (s *server) viewerParam(w http.ResponseWriter, r *http.Request) (viewer uint64, ok, valid bool) {
+	q := r.URL.Query().Get("viewer")
+	if q == "" { return 0, false, true }
+	v, err := s.parseID(q)
+	if err != nil { http.Error(w, "bad viewer", 400); return 0, false, false }
+	return v, true, true
+}
+
+// postBlockOp serves POST /block, /unblock, /mute and /unmute. A change
+// bumps both users' epochs so cached PYMK results and ETags for either
+// side are invalidated.
+func postBlockOp(op func(b *block.Store, viewer, target uint64) bool) tenantHandler {
+	return func(s *server, w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+		var body struct {
+			Viewer uint64 `json:"viewer"`
+			Target uint64 `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), 400); return
+		}
+		viewer, target := s.users.Resolve(body.Viewer), s.users.Resolve(body.Target)
+		ok := op(s.blocks, viewer, target)
+		if ok {
+			s.audit.Record(r.Context(), audit.Record{Tenant: s.tenant, Op: strings.TrimPrefix(r.URL.Path, "/"), Src: viewer, Dst: target})
+		}
+		if ok && storeError(w, r, s.g.TouchUsers(r.Context(), viewer, target)) { return }
+		writeJSON(w, map[string]any{"ok": ok})
+	}
+}
+
+// getBlocks lists whom viewer blocked and muted. Only viewer themself
+// (the subject of a JWT) or admin scope may read them; with auth off
+// anyone may.
+func (s *server) getBlocks(w http.ResponseWriter, r *http.Request) {
+	v, err := s.parseID(r.URL.Query().Get("viewer"))
+	if err != nil { http.Error(w, "bad viewer", 400); return }
+	if s.auth != nil && !auth.FromContext(r.Context()).Has(auth.ScopeAdmin) {
+		if me, known, _ := s.listViewer(r); !known || me != v {
+			metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+			http.Error(w, "can only list your own blocks", http.StatusForbidden); return
+		}
+	}
+	writeJSON(w, map[string]any{"blocked": s.blocks.Blocked(v), "muted": s.blocks.Muted(v)})
+}
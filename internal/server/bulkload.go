@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+)
+
+// /admin/bulk_load replaces the tenant's whole graph without disturbing
+// live traffic: edges are staged into a graph of their own, then swapped
+// in at once (see tenant.Load).
+//
+//	GET                        status of the staged load
+//	POST ?begin=true           starts one (409 if one is staged)
+//	POST {edges:[[src,dst]]}   stages up to maxImportEdges more, shard-parallel
+//	POST ?commit=true          stages the body's edges, if any, and swaps
+//	DELETE                     drops the staged load
+func (s *server) adminBulkLoad(w http.ResponseWriter, r *http.Request) {
+	cfg := s.cfg()
+	if cfg.Cluster.Enabled || cfg.Raft.Enabled || cfg.Replication.Role == "replica" {
+		http.Error(w, "bulk loads replace this node's graph alone; not available in cluster or raft mode, or on a replica", 501); return
+	}
+	t, err := s.reg.Get(s.tenant)
+	if err != nil { http.Error(w, err.Error(), 404); return }
+	switch r.Method {
+	case http.MethodGet:
+		l := t.Staged()
+		if l == nil { writeJSON(w, map[string]any{"staged": false}); return }
+		age := time.Since(l.Started)
+		writeJSON(w, map[string]any{"staged": true, "edges": l.Added.Load(), "started": l.Started, "age_ms": age.Milliseconds(),
+			"edges_per_sec": int64(float64(l.Added.Load()) / age.Seconds())})
+	case http.MethodPost:
+		s.postBulkLoad(w, r, t)
+	case http.MethodDelete:
+		if !t.AbortLoad() { http.Error(w, tenant.ErrNoLoad.Error(), 404); return }
+		metrics.BulkLoadStaged.WithLabelValues(s.tenant).Set(0)
+		s.logBulkLoad(r, "aborted")
+		writeJSON(w, map[string]any{"ok": true})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+func (s *server) postBulkLoad(w http.ResponseWriter, r *http.Request, t *tenant.Tenant) {
+	q := r.URL.Query()
+	if q.Get("begin") == "true" {
+		if _, err := t.BeginLoad(); err != nil { http.Error(w, err.Error(), 409); return }
+		s.logBulkLoad(r, "begun")
+		writeJSON(w, map[string]any{"ok": true})
+		return
+	}
+	var body struct {
+		Edges [][2]uint64 `json:"edges"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), 400); return
+	}
+	if len(body.Edges) > maxImportEdges {
+		http.Error(w, fmt.Sprintf("at most %d edges per batch", maxImportEdges), 400); return
+	}
+	l := t.Staged()
+	if l == nil { http.Error(w, tenant.ErrNoLoad.Error(), 409); return }
+	for i, e := range body.Edges { body.Edges[i] = [2]uint64{s.users.Resolve(e[0]), s.users.Resolve(e[1])} }
+	start := time.Now()
+	added, err := l.Add(r.Context(), body.Edges)
+	if errors.Is(err, tenant.ErrNoLoad) { http.Error(w, err.Error(), 409); return }
+	if storeError(w, r, err) { return }
+	if len(body.Edges) > 0 { s.observeImport("bulk_load", start, added, len(body.Edges)-added) }
+	metrics.BulkLoadStaged.WithLabelValues(s.tenant).Set(float64(l.Added.Load()))
+	res := map[string]any{"added": added, "skipped": len(body.Edges) - added, "staged_edges": l.Added.Load()}
+	if q.Get("commit") == "true" {
+		start = time.Now()
+		if _, err := t.CommitLoad(); err != nil {
+			status := 500
+			if errors.Is(err, tenant.ErrNoLoad) { status = 409 }
+			http.Error(w, err.Error(), status); return
+		}
+		res["committed"], res["swap_ms"] = true, time.Since(start).Milliseconds()
+		metrics.BulkLoadStaged.WithLabelValues(s.tenant).Set(0)
+		s.logBulkLoad(r, "committed", "edges", l.Added.Load())
+	}
+	writeJSON(w, res)
+}
+
+func (s *server) logBulkLoad(r *http.Request, what string, args ...any) {
+	actor := ""
+	if p := auth.FromContext(r.Context()); p != nil { actor = p.ID }
+	slog.InfoContext(r.Context(), "audit: bulk load "+what, append([]any{"tenant", s.tenant, "actor", actor}, args...)...)
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// maxEdgeChecks caps the pairs one /edges/exists call may ask about.
+const maxEdgeChecks = 10_000
+
+// maxDegreeLookups caps the users one /degrees call may ask about.
+const maxDegreeLookups = 10_000
+
+// maxImportEdges caps the edges in one /edges/import batch.
+const maxImportEdges = 50_000
+
+// postEdgesExists answers many HasEdge questions in one call, either for
+// one source ({"src":1,"dsts":[2,3]}) or for arbitrary pairs
+// ({"pairs":[[1,2],[4,5]]}). Results come back in request order.
+// Pairs are grouped by source so each source's set is looked up once.
+func (s *server) postEdgesExists(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		Src   uint64      `json:"src"`
+		Dsts  []uint64    `json:"dsts"`
+		Pairs [][2]uint64 `json:"pairs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	pairs := body.Pairs
+	if len(body.Dsts) > 0 {
+		if len(pairs) > 0 { http.Error(w, "give either src/dsts or pairs", 400); return }
+		pairs = make([][2]uint64, len(body.Dsts))
+		for i, v := range body.Dsts { pairs[i] = [2]uint64{body.Src, v} }
+	}
+	if len(pairs) > maxEdgeChecks {
+		http.Error(w, fmt.Sprintf("at most %d pairs", maxEdgeChecks), 400); return
+	}
+
+	see := s.lists(r)
+	bySrc := make(map[uint64][]int)
+	for i, p := range pairs {
+		u := s.users.Resolve(p[0])
+		pairs[i] = [2]uint64{u, s.users.Resolve(p[1])}
+		ok, err := edgeVisible(see, u, pairs[i][1])
+		if storeError(w, r, err) { return }
+		if !ok { forbidLists(w); return }
+		bySrc[u] = append(bySrc[u], i)
+	}
+	exists := make([]bool, len(pairs))
+	for u, idx := range bySrc {
+		if len(idx) == 1 { // not worth fetching a whole remote set
+			has, err := s.g.HasEdge(r.Context(), u, pairs[idx[0]][1])
+			if storeError(w, r, err) { return }
+			exists[idx[0]] = has
+			continue
+		}
+		set, err := s.g.FollowingSet(r.Context(), u)
+		if storeError(w, r, err) { return }
+		for _, i := range idx { exists[i] = set.Has(pairs[i][1]) }
+	}
+	writeJSON(w, map[string]any{"exists": exists})
+}
+
+// postDegrees returns the in- and out-degree of many users in one call,
+// {"user_ids":[1,2,3]} → {"degrees":[{"user_id":1,"followers":..,"following":..},...]},
+// in request order. The store groups them by shard (or cluster owner).
+func (s *server) postDegrees(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		UserIDs []uint64 `json:"user_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	if len(body.UserIDs) > maxDegreeLookups {
+		http.Error(w, fmt.Sprintf("at most %d user_ids", maxDegreeLookups), 400); return
+	}
+	users := make([]uint64, len(body.UserIDs))
+	for i, u := range body.UserIDs { users[i] = s.users.Resolve(u) }
+	degs, err := s.g.Degrees(r.Context(), users)
+	if storeError(w, r, err) { return }
+	for i := range degs { degs[i].User = body.UserIDs[i] } // as asked, even if merged
+	writeJSON(w, map[string]any{"degrees": degs})
+}
+
+// postEdgesImport follows every [src,dst] pair in {"edges":[...]}, for
+// bulk loaders, attributed to "source" (default "import"). It reports how
+// many edges were new; existing edges and self-loops are skipped, so
+// retrying a batch is safe.
+func (s *server) postEdgesImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		Edges  [][2]uint64 `json:"edges"`
+		Source string      `json:"source"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	if body.Source == "" { body.Source = "import" }
+	ctx, ok := sourceContext(w, r, body.Source)
+	if !ok { return }
+	if len(body.Edges) > maxImportEdges {
+		http.Error(w, fmt.Sprintf("at most %d edges per batch", maxImportEdges), 400); return
+	}
+	// On a store error some edges may be in; retrying the whole batch is
+	// safe.
+	for i, e := range body.Edges { body.Edges[i] = [2]uint64{s.users.Resolve(e[0]), s.users.Resolve(e[1])} }
+	start := time.Now()
+	added, err := s.importEdges(ctx, body.Edges)
+	metrics.FollowOps.WithLabelValues(s.tenant, "follow").Add(float64(added))
+	s.observeImport("import", start, added, len(body.Edges)-added)
+	if storeError(w, r, err) { return }
+	writeJSON(w, map[string]any{"added": added, "skipped": len(body.Edges) - added})
+}
+
+// importEdges follows every edge through the tenant's store, wrappers
+// and all, from up to s.workers goroutines. The edges are partitioned by
+// the shard of their destination, and each goroutine takes whole
+// partitions, so no two contend for the same followers shard.
+func (s *server) importEdges(ctx context.Context, edges [][2]uint64) (int, error) {
+	parts := make([][][2]uint64, max(1, min(s.workers, len(edges)/minImportPart)))
+	for _, e := range edges {
+		p := s.local.ShardOf(e[1]) % len(parts)
+		parts[p] = append(parts[p], e)
+	}
+	var added atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, len(parts))
+	for i, part := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, e := range part {
+				ok, err := s.g.Follow(ctx, e[0], e[1])
+				if ok { added.Add(1) }
+				if err != nil { errs[i] = err; return }
+			}
+		}()
+	}
+	wg.Wait()
+	return int(added.Load()), errors.Join(errs...)
+}
+
+// minImportPart is the fewest edges worth a goroutine of their own.
+const minImportPart = 1000
+
+// observeImport records an import batch in the ingest metrics.
+func (s *server) observeImport(path string, start time.Time, added, skipped int) {
+	metrics.ImportEdges.WithLabelValues(s.tenant, path, "added").Add(float64(added))
+	metrics.ImportEdges.WithLabelValues(s.tenant, path, "skipped").Add(float64(skipped))
+	metrics.ImportBatchDuration.WithLabelValues(path).Observe(time.Since(start).Seconds())
+}
+
+// sourceContext tags r's context with a follow source, answering 400 for
+// a malformed one. An empty source leaves the context as is.
+func sourceContext(w http.ResponseWriter, r *http.Request, source string) (context.Context, bool) {
+	if source == "" { return r.Context(), true }
+	if !graph.ValidSource(source) {
+		http.Error(w, "bad source: want 1-32 of [a-z0-9_.-]", 400); return nil, false
+	}
+	return graph.WithSource(r.Context(), source), true
+}
+
+// getEdgesExport streams this node's edges as JSON lines, with each
+// follow's source when one was recorded: {"src":1,"dst":2,"source":"pymk"}.
+// An admin acting for a ?viewer= gets only the edges that viewer may see.
+func (s *server) getEdgesExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+	type line struct {
+		Src    uint64 `json:"src"`
+		Dst    uint64 `json:"dst"`
+		Source string `json:"source,omitempty"`
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	see := s.lists(r)
+	var werr, serr error
+	err := s.local.EachEdge(func(u, v uint64) bool {
+		var ok bool
+		if ok, serr = edgeVisible(see, u, v); !ok { return serr == nil }
+		werr = enc.Encode(line{u, v, s.sources.Get(u, v)})
+		return werr == nil && r.Context().Err() == nil
+	})
+	if err == nil { err = serr }
+	if err != nil && werr == nil { slog.ErrorContext(r.Context(), "edge export failed", "err", err) }
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pandharkardeep/social-graph/internal/exclusions"
+)
+
+// pymkExclusions manages the users PYMK never suggests to a user:
+// GET ?user_id= lists them; PUT {user_id, ids} replaces the set, POST
+// {user_id, add, remove} edits it and DELETE ?user_id= clears it (write
+// scope). A change bumps the user's epoch so cached suggestions are
+// recomputed with it.
+func (s *server) pymkExclusions(w http.ResponseWriter, r *http.Request) {
+	var u uint64
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		if u, err = s.parseID(r.URL.Query().Get("user_id")); err != nil { http.Error(w, "bad user_id", 400); return }
+		writeJSON(w, map[string]any{"user_id": u, "ids": s.exclusions.List(s.tenant, u)})
+		return
+	case http.MethodPut, http.MethodPost:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			UserID uint64   `json:"user_id"`
+			IDs    []uint64 `json:"ids"`    // PUT
+			Add    []uint64 `json:"add"`    // POST
+			Remove []uint64 `json:"remove"` // POST
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		u = s.users.Resolve(body.UserID)
+		resolve := func(ids []uint64) {
+			for i := range ids { ids[i] = s.users.Resolve(ids[i]) }
+		}
+		resolve(body.IDs); resolve(body.Add); resolve(body.Remove)
+		if r.Method == http.MethodPut {
+			err = s.exclusions.Replace(s.tenant, u, body.IDs)
+		} else {
+			err = s.exclusions.Update(s.tenant, u, body.Add, body.Remove)
+		}
+	case http.MethodDelete:
+		if !s.canWrite(w, r) { return }
+		if u, err = s.parseID(r.URL.Query().Get("user_id")); err != nil { http.Error(w, "bad user_id", 400); return }
+		err = s.exclusions.Replace(s.tenant, u, nil)
+	default:
+		http.Error(w, "method not allowed", 405); return
+	}
+	if errors.Is(err, exclusions.ErrTooMany) { http.Error(w, err.Error(), 400); return }
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exclusions write failed", "err", err)
+		http.Error(w, "internal error", 500); return
+	}
+	if storeError(w, r, s.g.TouchUsers(r.Context(), u)) { return }
+	writeJSON(w, map[string]any{"ok": true, "count": len(s.exclusions.List(s.tenant, u))})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pandharkardeep/social-graph/internal/feedback"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+// pymkFeedback reads a user's suggestion feedback (GET ?user_id=) or
+// records one (POST {user_id, candidate_id, action}, write scope). A hide
+// bumps the user's epoch so a cached PYMK result without it is dropped.
+func (s *server) pymkFeedback(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u, err := s.parseID(r.URL.Query().Get("user_id"))
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		writeJSON(w, map[string]any{"user_id": u, "feedback": s.feedback.User(s.tenant, u)})
+	case http.MethodPost:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			UserID      uint64 `json:"user_id"`
+			CandidateID uint64 `json:"candidate_id"`
+			Action      string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		if !feedback.ValidAction(body.Action) { http.Error(w, "action must be accept, reject or hide", 400); return }
+		u, c := s.users.Resolve(body.UserID), s.users.Resolve(body.CandidateID)
+		if u == c { http.Error(w, "candidate_id must differ from user_id", 400); return }
+		ev := feedback.Event{Tenant: s.tenant, User: u, Candidate: c, Action: body.Action, }
+		for _, svc := range s.services() {
+			if ev.Rank = svc.ShownRank(u, c); ev.Rank > 0 { break }
+		}
+		if err := s.feedback.Record(ev); err != nil {
+			slog.ErrorContext(r.Context(), "feedback write failed", "err", err)
+			http.Error(w, "internal error", 500); return
+		}
+		metrics.PYMKFeedback.WithLabelValues(s.tenant, ev.Action).Inc()
+		if ev.Rank > 0 { metrics.PYMKFeedbackRank.WithLabelValues(s.tenant, ev.Action).Observe(float64(ev.Rank)) }
+		if ev.Action == feedback.Hide && storeError(w, r, s.g.TouchUsers(r.Context(), u)) { return }
+		writeJSON(w, map[string]any{"ok": true})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// adminFeedbackExport streams the tenant's accepts and rejects as JSON
+// lines, the latest per (user, candidate), as PYMK training data.
+func (s *server) adminFeedbackExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	s.feedback.Each(s.tenant, func(ev feedback.Event) bool {
+		return enc.Encode(ev) == nil && r.Context().Err() == nil
+	})
+}
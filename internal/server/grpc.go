@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/pymk"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+)
+
+// PYMK over gRPC: a server stream that sends suggestions in buckets as
+// ranking settles them, best first, so clients asking for a large k can
+// render the top of the list early. Messages are JSON-encoded like the
+// replication stream's, so no generated protobuf code is needed.
+// Credentials and the tenant go in metadata: x-api-key or authorization,
+// and x-tenant.
+const pymkServiceName = "socialgraph.pymk.PYMK"
+
+// StreamPYMKRequest asks for user_id's suggestions, as /pymk does.
+type StreamPYMKRequest struct {
+	UserID  uint64 `json:"user_id"`
+	K       int    `json:"k"`         // 0 = the profile's default
+	Bucket  int    `json:"bucket"`    // suggestions per message; 0 = pymk.DefaultBucket
+	Profile string `json:"profile"`   // named PYMK profile; "" = the tenant's default
+	Filter  string `json:"filter"`    // attribute filter, as /pymk?filter=
+	Budget  int    `json:"budget_ms"` // latency budget, as /pymk?budget_ms=; 0 = none
+}
+
+// PYMKBucket is one message of the stream. A stream cut short by the
+// PYMK timeout or budget_ms ends with DEADLINE_EXCEEDED after the buckets
+// it found.
+type PYMKBucket struct {
+	Rank        int               `json:"rank"` // position of the first suggestion, from 0
+	Suggestions []pymk.Suggestion `json:"suggestions"`
+}
+
+type pymkStreamer interface {
+	streamPYMK(*StreamPYMKRequest, grpc.ServerStream) error
+}
+
+var pymkServiceDesc = grpc.ServiceDesc{
+	ServiceName: pymkServiceName,
+	HandlerType: (*pymkStreamer)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Stream", ServerStreams: true, Handler: func(srv any, ss grpc.ServerStream) error {
+			var req StreamPYMKRequest
+			if err := ss.RecvMsg(&req); err != nil { return err }
+			return srv.(pymkStreamer).streamPYMK(&req, ss)
+		}},
+	},
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)   { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(b []byte, v any) error { return json.Unmarshal(b, v) }
+func (jsonCodec) Name() string                    { return "json" }
+
+// NewGRPC returns a gRPC server with the streaming PYMK service
+// registered, sharing the tenants, auth and per-user state of d.
+func NewGRPC(d Deps) *grpc.Server {
+	srv := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	srv.RegisterService(&pymkServiceDesc, newServer(d))
+	return srv
+}
+
+func (s *server) streamPYMK(req *StreamPYMKRequest, ss grpc.ServerStream) error {
+	ctx := ss.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	hd := http.Header{}
+	for k, v := range md {
+		if len(v) > 0 { hd.Set(k, v[0]) }
+	}
+	if s.auth != nil {
+		p, err := s.auth.AuthenticateHeader(hd)
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues("unauthenticated").Inc()
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		if !p.Has(auth.ScopeRead) {
+			metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+			return status.Error(codes.PermissionDenied, "insufficient scope")
+		}
+		ctx = auth.WithPrincipal(ctx, p)
+	}
+	name := hd.Get(tenant.Header)
+	if name == "" { name = tenant.Default }
+	if g := hd.Get(tenant.GraphHeader); g != "" { tn, _ := tenant.Split(name); name = tenant.Key(tn, g) }
+	if tn, _ := tenant.Split(name); !auth.FromContext(ctx).CanUse(tn) {
+		metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+		return status.Error(codes.PermissionDenied, "key not valid for this tenant")
+	}
+	t, err := s.reg.Get(name)
+	if err != nil { return status.Error(codes.NotFound, err.Error()) }
+	v, ok := s.bind(t, req.Profile)
+	if !ok { return status.Error(codes.InvalidArgument, "unknown profile") }
+	if req.K < 0 || req.Bucket < 0 || req.Budget < 0 { return status.Error(codes.InvalidArgument, "k, bucket and budget_ms must be >= 0") }
+	filter, err := attrs.ParseFilter(req.Filter)
+	if err != nil { return status.Error(codes.InvalidArgument, err.Error()) }
+
+	u := v.users.Resolve(req.UserID)
+	v.observe(u)
+	rank := 0
+	emit := func(b []pymk.Suggestion) error {
+		if err := ss.SendMsg(&PYMKBucket{Rank: rank, Suggestions: b}); err != nil { return err }
+		rank += len(b)
+		return nil
+	}
+	res, err := v.svc.PYMK(ctx, u, pymk.Query{K: req.K, Exclude: v.hiddenFrom(u, nil), Filter: filter, Emit: emit, Bucket: req.Bucket, Budget: time.Duration(req.Budget) * time.Millisecond})
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, pymk.ErrOverBudget):
+		v.svc.Served(u, res)
+		return status.Error(codes.DeadlineExceeded, "partial results")
+	case errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case err != nil:
+		if _, ok := status.FromError(err); ok { return err } // the send failed
+		slog.ErrorContext(ctx, "grpc pymk failed", "tenant", v.tenant, "user_id", u, "err", err)
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	v.svc.Served(u, res)
+	return nil
+}
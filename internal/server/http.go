@@ -1,25 +1,95 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/audit"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/block"
+	"github.com/pandharkardeep/social-graph/internal/config"
 	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/exclusions"
+	"github.com/pandharkardeep/social-graph/internal/feedback"
 	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/identity"
+	"github.com/pandharkardeep/social-graph/internal/idmap"
+	"github.com/pandharkardeep/social-graph/internal/journal"
 	"github.com/pandharkardeep/social-graph/internal/metrics"
 	"github.com/pandharkardeep/social-graph/internal/pymk"
+	"github.com/pandharkardeep/social-graph/internal/replica"
+	"github.com/pandharkardeep/social-graph/internal/scheduler"
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+	"github.com/pandharkardeep/social-graph/internal/topics"
+	"github.com/pandharkardeep/social-graph/internal/tracing"
+	"github.com/pandharkardeep/social-graph/internal/users"
 )
 
+// server is bound to one tenant per request; see scoped.
 type server struct {
-	svc *pymk.Service
-	g   graph.Store
-	e   embeds.Store
+	tenant     string
+	svc        *pymk.Service // the default, or the ?profile= named
+	services   func() []*pymk.Service
+	g          graph.Store
+	local      *graph.MemGraph
+	e          embeds.Store
+	top        *graph.Top
+	blocks     *block.Store
+	users      *users.Store
+	attrs      *attrs.Store
+	hot        *sketch.HeavyHitters
+	churn      *tenant.Churn
+	auth       *auth.Authenticator
+	reg        *tenant.Registry
+	cfg        func() *config.Config
+	audit      *audit.Log
+	feedback   *feedback.Store
+	exclusions *exclusions.Store
+	idents     *identity.Store
+	vend       *users.IDs
+	sources    *graph.Sources
+	topics     topics.View
+	weights    *graph.Weights
+	refresh    *pymk.Notifier
+	ids        *idmap.Mapper
+	jobs       *scheduler.Scheduler
+	journal    *journal.Journal
+	workers    int // goroutines per import batch
 }
 
-func AttachRoutes(mux *http.ServeMux, svc *pymk.Service, g graph.Store, e embeds.Store) {
-	s := &server{svc: svc, g: g, e: e}
+type tenantHandler func(s *server, w http.ResponseWriter, r *http.Request)
+
+// Deps are the process-wide dependencies shared by all tenants.
+type Deps struct {
+	Tenants    *tenant.Registry
+	Auth       *auth.Authenticator   // nil leaves every route open
+	Config     func() *config.Config // current config; replaced on reload
+	Audit      *audit.Log            // nil when audit logging is off
+	Feedback   *feedback.Store
+	Exclusions *exclusions.Store
+	Identities *identity.Store      // string user IDs; nil accepts numeric IDs only
+	UserIDs    *users.IDs           // vends IDs for POST /users; nil disables it
+	Jobs       *scheduler.Scheduler // nil when nothing is scheduled
+	Journal    *journal.Journal     // nil disables GET /journal
+}
+
+// AttachRoutes registers all endpoints on mux. Tenant-scoped handlers see
+// the stores of the tenant resolved by tenant.Middleware.
+func AttachRoutes(mux *http.ServeMux, d Deps) {
+	a := d.Auth
+	s := newServer(d)
+	read, write := s.scoped(auth.ScopeRead), s.scoped(auth.ScopeWrite)
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -27,68 +97,445 @@ func AttachRoutes(mux *http.ServeMux, svc *pymk.Service, g graph.Store, e embeds
 	})
 	mux.Handle("/metrics", metrics.Handler())
 
-	mux.HandleFunc("/follow", s.postFollow)       // POST
-	mux.HandleFunc("/unfollow", s.postUnfollow)   // POST
-	mux.HandleFunc("/following", s.getFollowing)  // GET
-	mux.HandleFunc("/followers", s.getFollowers)  // GET
-	mux.HandleFunc("/mutuals", s.getMutuals)      // GET
-	mux.HandleFunc("/embedding", s.putEmbedding)  // PUT
-	mux.HandleFunc("/pymk", s.getPYMK)            // GET
+	mux.HandleFunc("/follow", write((*server).postFollow))       // POST
+	mux.HandleFunc("/unfollow", write((*server).postUnfollow))   // POST
+	mux.HandleFunc("/following", read((*server).getFollowing))   // GET
+	mux.HandleFunc("/followers", read((*server).getFollowers))   // GET
+	mux.HandleFunc("/tx", write((*server).postTx))                  // POST {ops:[{op,src,dst[,expected_epoch]}]}
+	mux.HandleFunc("/journal", read((*server).getJournal))            // GET ?from_seq=&limit=&wait=
+	mux.HandleFunc("/edges/import", write((*server).postEdgesImport)) // POST {edges:[[src,dst],...]}
+	mux.HandleFunc("/edges/export", s.scoped(auth.ScopeAdmin)((*server).getEdgesExport)) // GET, JSON lines
+	mux.HandleFunc("/edges/exists", read((*server).postEdgesExists)) // POST {src,dsts} | {pairs}
+	mux.HandleFunc("/degrees", read((*server).postDegrees))          // POST {user_ids}
+	mux.HandleFunc("/neighborhood_size", read((*server).getNeighborhoodSize)) // GET ?user_id=&hops=2&approx=true
+	mux.HandleFunc("/query", read((*server).postQuery))                     // POST {start,steps,limit,...}
+	mux.HandleFunc("/cypher", read((*server).postCypher))                   // POST {query}
+	mux.HandleFunc("/mutuals", read((*server).getMutuals))       // GET
+	mux.HandleFunc("/friends", read((*server).getFriends))       // GET ?user_id=[&v=]
+	mux.HandleFunc("/close_friends", read((*server).getCloseFriends)) // GET ?user_id=&k=
+	mux.HandleFunc("/interactions", read((*server).interactions))      // GET ?u=&v= | POST {events:[{src,dst,type[,count]}]} (write)
+	mux.HandleFunc("/social_proof", read((*server).getSocialProof)) // GET ?viewer=&target=&limit=
+	mux.HandleFunc("/mutual_counts", read((*server).postMutualCounts)) // POST {viewer,candidates}
+	mux.HandleFunc("/followers_you_know", read((*server).getFollowersYouKnow)) // GET ?viewer=&target=&limit=
+	mux.HandleFunc("/audience_overlap", read((*server).getAudienceOverlap)) // GET ?u=&v=
+	mux.HandleFunc("/overlap", read((*server).getOverlap))                  // GET ?u=&v=
+	mux.HandleFunc("/why_connected", read((*server).getWhyConnected))       // GET ?u=&v=&limit=
+	mux.HandleFunc("/block", write(postBlockOp((*block.Store).Block)))       // POST {viewer,target}
+	mux.HandleFunc("/unblock", write(postBlockOp((*block.Store).Unblock)))   // POST
+	mux.HandleFunc("/mute", write(postBlockOp((*block.Store).Mute)))         // POST
+	mux.HandleFunc("/unmute", write(postBlockOp((*block.Store).Unmute)))     // POST
+	mux.HandleFunc("/blocks", read((*server).getBlocks))                    // GET ?viewer=
+	mux.HandleFunc("/users", write((*server).postUser))                     // POST {...attrs, locale, vector}
+	mux.HandleFunc("/user_status", read((*server).userStatus))              // GET ?user_id= | PUT {user_id,status} (write)
+	mux.HandleFunc("/privacy", read((*server).userPrivacy))                 // GET ?user_id= | PUT {user_id,lists} (write)
+	mux.HandleFunc("/attrs", read((*server).userAttrs))                       // GET ?user_id= | PUT/PATCH {user_id,...} | DELETE ?user_id= (write)
+	mux.HandleFunc("/embedding", write((*server).putEmbedding))  // PUT
+	mux.HandleFunc("/pymk", read((*server).getPYMK))             // GET
+	mux.HandleFunc("/pymk/stream", read((*server).getPYMKStream)) // GET ?user_id=, server-sent events
+	mux.HandleFunc("/pymk/feedback", read((*server).pymkFeedback)) // GET ?user_id= | POST {user_id,candidate_id,action} (write)
+	mux.HandleFunc("/pymk/exclusions", read((*server).pymkExclusions)) // GET ?user_id= | PUT {user_id,ids} | POST {user_id,add,remove} | DELETE ?user_id= (write)
+	mux.HandleFunc("/identities", read((*server).identities))               // GET ?external=&id= | POST {external} | {externals} (write)
+	mux.HandleFunc("/topics/follow", write((*server).postTopicFollow))        // POST {user_id,topic}
+	mux.HandleFunc("/topics/unfollow", write((*server).postTopicUnfollow))    // POST {user_id,topic}
+	mux.HandleFunc("/topics/following", read((*server).getTopicsFollowing))   // GET ?user_id=
+	mux.HandleFunc("/topics/followers", read((*server).getTopicFollowers))    // GET ?topic=&limit=
+	mux.HandleFunc("/topics/suggest", read((*server).getTopicSuggestions))    // GET ?user_id=&k=
+	mux.HandleFunc("/recommendations/onboarding", read((*server).getOnboarding)) // GET ?user_id=&interests=&k=
+	mux.HandleFunc("/top", read((*server).getTop))               // GET ?by=followers|following&n=[&locale=]
+	mux.HandleFunc("/stats/degrees", read((*server).getDegreeStats)) // GET
+	ops := http.Handler(mux)
+	if s.cfg().Replication.Role == "replica" { ops = replica.ReadOnly(mux) } // ops run past the outer check
+	mux.HandleFunc("/pipeline", a.RequireIn(auth.ScopeRead, requestTenant, pipeline(ops))) // POST {ops:[{op,args}],stop_on_error}; each op checks its own scope
+
+	mux.HandleFunc("/admin/keys", a.Require(auth.ScopeAdmin, s.adminKeys))       // GET | POST | DELETE
+	mux.HandleFunc("/admin/tenants", a.Require(auth.ScopeAdmin, s.adminTenants)) // GET | POST
+	mux.HandleFunc("/admin/graphs", a.Require(auth.ScopeAdmin, s.adminGraphs))   // GET | POST {name, config?, ttl?} | DELETE ?name=
+	mux.HandleFunc("/admin/config", a.Require(auth.ScopeAdmin, s.getConfig))     // GET
+	mux.HandleFunc("/admin/flags", a.Require(auth.ScopeAdmin, s.adminFlags))     // GET | PUT {name,percent} | DELETE ?name=
+	mux.HandleFunc("/admin/jobs", a.Require(auth.ScopeAdmin, s.adminJobs))       // GET | POST ?name= (run now)
+	mux.HandleFunc("/admin/merge_users", s.scoped(auth.ScopeAdmin)((*server).adminMergeUsers)) // POST
+	mux.HandleFunc("/admin/memstats", s.scoped(auth.ScopeAdmin)((*server).adminMemStats))      // GET
+	mux.HandleFunc("/admin/compact", s.scoped(auth.ScopeAdmin)((*server).adminCompact))        // POST
+	mux.HandleFunc("/admin/bulk_load", s.scoped(auth.ScopeAdmin)((*server).adminBulkLoad))     // GET | POST [?begin=true|?commit=true] {edges} | DELETE
+	mux.HandleFunc("/admin/pymk_config", s.scoped(auth.ScopeAdmin)((*server).adminPYMKConfig)) // GET | PATCH
+	mux.HandleFunc("/admin/hot_keys", s.scoped(auth.ScopeAdmin)((*server).adminHotKeys))       // GET ?n=
+	mux.HandleFunc("/admin/churn", s.scoped(auth.ScopeAdmin)((*server).adminChurn))            // GET ?n=&hot=true
+	mux.HandleFunc("/admin/users", s.scoped(auth.ScopeAdmin)((*server).adminUsers))            // GET ?min_followers=&min_following=&limit=
+	mux.HandleFunc("/admin/integrity", s.scoped(auth.ScopeAdmin)((*server).adminIntegrity))    // GET | POST (repair)
+	mux.HandleFunc("/admin/communities", s.scoped(auth.ScopeAdmin)((*server).adminCommunities)) // GET [?user_id=] | POST (detect now)
+	mux.HandleFunc("/admin/audit", s.scoped(auth.ScopeAdmin)((*server).adminAudit))            // GET ?user_id=&since=&limit=
+	mux.HandleFunc("/admin/pymk_feedback", s.scoped(auth.ScopeAdmin)((*server).adminFeedbackExport)) // GET, JSON lines
+	mux.HandleFunc("/admin/idmap", s.scoped(auth.ScopeAdmin)((*server).adminIDMap))            // GET ?id= | ?dense= | [?from=] (JSON lines)
 }
 
+func newServer(d Deps) *server {
+	return &server{auth: d.Auth, reg: d.Tenants, cfg: d.Config, audit: d.Audit, feedback: d.Feedback, exclusions: d.Exclusions, idents: d.Identities, vend: d.UserIDs, jobs: d.Jobs, journal: d.Journal}
+}
+
+// scoped returns a wrapper enforcing sc and binding the handler to the
+// request's tenant and, given ?profile=, to that PYMK profile. String user
+// IDs in the request are translated to numeric ones first.
+func (s *server) scoped(sc auth.Scope) func(tenantHandler) http.HandlerFunc {
+	return func(h tenantHandler) http.HandlerFunc {
+		return s.auth.RequireIn(sc, requestTenant, func(w http.ResponseWriter, r *http.Request) {
+			t, err := s.reg.Get(tenant.FromRequest(r))
+			if err != nil { http.Error(w, err.Error(), 404); return }
+			v, ok := s.bind(t, r.URL.Query().Get("profile"))
+			if !ok { http.Error(w, "unknown profile", 400); return }
+			if err := v.translateIDs(r); err != nil { idError(w, err); return }
+			h(v, w, r)
+		})
+	}
+}
+
+// requestTenant is the tenant whose graph (main or named) r is for.
+func requestTenant(r *http.Request) string {
+	tn, _ := tenant.Split(tenant.FromRequest(r))
+	return tn
+}
+
+// bind returns a copy of s bound to t and, when profile is not "", to
+// that PYMK profile; false when there is no such profile.
+func (s *server) bind(t *tenant.Tenant, profile string) (*server, bool) {
+	v := *s
+	v.tenant, v.g, v.local, v.e = t.Name, tracing.Store(t.G), t.Local, t.E
+	v.svc, v.top, v.blocks, v.users, v.hot = t.Svc, t.Top, t.Blocks, t.Users, t.Hot
+	v.attrs, v.sources, v.services, v.topics, v.weights = t.Attrs, t.Sources, t.Services, t.Topics, t.Weights
+	v.refresh, v.ids, v.churn = t.Refresh, t.IDs, t.Churn
+	v.workers = t.LoadWorkers()
+	if profile != "" {
+		svc, ok := t.Profile(profile)
+		if !ok { return nil, false }
+		v.svc = svc
+	}
+	return &v, true
+}
+
+// parseID parses a user ID, resolving aliases left by merged accounts.
 func (s *server) parseID(q string) (uint64, error) {
-	return strconv.ParseUint(q, 10, 64)
+	u, err := strconv.ParseUint(q, 10, 64)
+	if err != nil { return 0, err }
+	return s.users.Resolve(u), nil
 }
 
 func (s *server) postFollow(w http.ResponseWriter, r *http.Request) {
+	s.postEdge(w, r, "follow", s.g.Follow, s.g.FollowIf)
+}
+
+func (s *server) postUnfollow(w http.ResponseWriter, r *http.Request) {
+	s.postEdge(w, r, "unfollow", s.g.Unfollow, s.g.UnfollowIf)
+}
+
+// postEdge applies a follow or unfollow. source (pymk, search...) is kept
+// for the follow. With expected_epoch set the write goes through only if
+// src's epoch (as in its ETags) still matches; otherwise it answers 409
+// with the current epoch so the client can re-read and retry.
+func (s *server) postEdge(w http.ResponseWriter, r *http.Request, op string,
+	do func(context.Context, uint64, uint64) (bool, error),
+	doIf func(context.Context, uint64, uint64, uint64) (bool, error)) {
 	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
-	type req struct{ Src, Dst uint64 }
+	type req struct {
+		Src, Dst      uint64
+		ExpectedEpoch *uint64 `json:"expected_epoch"`
+		Source        string  `json:"source"`
+	}
 	var body req
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, err.Error(), 400); return
 	}
-	ok := s.g.Follow(body.Src, body.Dst)
-	if ok { metrics.FollowOps.WithLabelValues("follow").Inc() }
-	writeJSON(w, map[string]any{"ok": ok})
+	ctx, valid := sourceContext(w, r, body.Source)
+	if !valid { return }
+	u, v := s.users.Resolve(body.Src), s.users.Resolve(body.Dst)
+	var ok bool
+	var err error
+	if body.ExpectedEpoch != nil {
+		ok, err = doIf(ctx, u, v, *body.ExpectedEpoch)
+	} else {
+		ok, err = do(ctx, u, v)
+	}
+	if errors.Is(err, graph.ErrEpochChanged) {
+		res := map[string]any{"error": "epoch changed"}
+		if e, err := s.g.UserEpoch(r.Context(), u); err == nil { res["epoch"] = e }
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(res)
+		return
+	}
+	if storeError(w, r, err) { return }
+	if ok {
+		metrics.FollowOps.WithLabelValues(s.tenant, op).Inc()
+		if op == "follow" { s.followed(u, v) }
+	}
+	res := map[string]any{"ok": ok}
+	if body.ExpectedEpoch != nil {
+		if e, err := s.g.UserEpoch(r.Context(), u); err == nil { res["epoch"] = e }
+	}
+	writeJSON(w, res)
 }
 
-func (s *server) postUnfollow(w http.ResponseWriter, r *http.Request) {
+// followed reports u's new follow of v to every PYMK profile, whichever
+// suggested v.
+func (s *server) followed(u, v uint64) {
+	for _, svc := range s.services() { svc.Followed(u, v) }
+}
+
+// maxTxOps bounds the ops in one /tx; every shard they touch stays locked
+// while it applies.
+const maxTxOps = 1000
+
+// postTx applies a list of follows and unfollows atomically: all or none.
+// A stale expected_epoch on any op rejects the whole transaction with 409.
+func (s *server) postTx(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
-	type req struct{ Src, Dst uint64 }
-	var body req
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), 400); return
+	var body struct {
+		Ops    []graph.EdgeOp `json:"ops"`
+		Source string         `json:"source"` // for the transaction's follows
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+	ctx, valid := sourceContext(w, r, body.Source)
+	if !valid { return }
+	if len(body.Ops) == 0 || len(body.Ops) > maxTxOps {
+		http.Error(w, fmt.Sprintf("ops must hold 1 to %d operations", maxTxOps), 400); return
+	}
+	for i := range body.Ops {
+		op := &body.Ops[i]
+		op.Src, op.Dst = s.users.Resolve(op.Src), s.users.Resolve(op.Dst)
 	}
-	ok := s.g.Unfollow(body.Src, body.Dst)
-	if ok { metrics.FollowOps.WithLabelValues("unfollow").Inc() }
-	writeJSON(w, map[string]any{"ok": ok})
+	changed, err := s.g.Apply(ctx, body.Ops)
+	if storeError(w, r, err) { return }
+	for i, ok := range changed {
+		if !ok { continue }
+		op := body.Ops[i]
+		metrics.FollowOps.WithLabelValues(s.tenant, op.Op).Inc()
+		if op.Op == "follow" { s.followed(op.Src, op.Dst) }
+	}
+	writeJSON(w, map[string]any{"ok": true, "changed": changed})
 }
 
-func (s *server) getFollowing(w http.ResponseWriter, r *http.Request) {
+func (s *server) getFollowing(w http.ResponseWriter, r *http.Request) { s.listUsers(w, r, s.g.Following, s.g.DegreeOut) }
+func (s *server) getFollowers(w http.ResponseWriter, r *http.Request) { s.listUsers(w, r, s.g.Followers, s.g.DegreeIn) }
+
+// listUsers serves a per-user ID list, filtered through ?viewer='s blocks
+// and mutes when given. A list the user's privacy hides from the caller
+// answers with its size only, or 403 with privacy.hidden: forbid.
+func (s *server) listUsers(w http.ResponseWriter, r *http.Request, get func(context.Context, uint64) ([]uint64, error), size func(context.Context, uint64) (int, error)) {
 	u, err := s.parseID(r.URL.Query().Get("user_id"))
 	if err != nil { http.Error(w, "bad user_id", 400); return }
-	writeJSON(w, s.g.Following(u))
+	s.observe(u)
+	viewer, hasViewer, ok := s.viewerParam(w, r)
+	if !ok { return }
+	visible, err := s.canSee(r, u)
+	if storeError(w, r, err) { return }
+	if !visible {
+		if s.cfg().Privacy.Hidden == "forbid" { forbidLists(w); return }
+		n, err := size(r.Context(), u)
+		if storeError(w, r, err) { return }
+		writeJSON(w, map[string]any{"user_id": u, "hidden": true, "count": n}); return
+	}
+	if !hasViewer {
+		if s.notModified(w, r, u) { return }
+		ids, err := get(r.Context(), u)
+		if storeError(w, r, err) { return }
+		writeJSON(w, ids); return
+	}
+	if s.notModified(w, r, u, viewer) { return }
+	ids, err := get(r.Context(), u)
+	if storeError(w, r, err) { return }
+	writeJSON(w, s.blocks.Filter(viewer, ids))
 }
-func (s *server) getFollowers(w http.ResponseWriter, r *http.Request) {
+// getFriends lists reciprocal follows of user_id; with v it answers
+// whether the two are friends.
+func (s *server) getFriends(w http.ResponseWriter, r *http.Request) {
 	u, err := s.parseID(r.URL.Query().Get("user_id"))
 	if err != nil { http.Error(w, "bad user_id", 400); return }
-	writeJSON(w, s.g.Followers(u))
+	if !s.mustSee(w, r, u) { return }
+	if q := r.URL.Query().Get("v"); q != "" {
+		v, err := s.parseID(q)
+		if err != nil { http.Error(w, "bad v", 400); return }
+		are, err := s.g.AreFriends(r.Context(), u, v)
+		if storeError(w, r, err) { return }
+		writeJSON(w, map[string]any{"friends": are}); return
+	}
+	viewer, hasViewer, ok := s.viewerParam(w, r)
+	if !ok { return }
+	if !hasViewer {
+		if s.notModified(w, r, u) { return }
+		friends, err := s.g.Friends(r.Context(), u)
+		if storeError(w, r, err) { return }
+		writeJSON(w, friends); return
+	}
+	if s.notModified(w, r, u, viewer) { return }
+	friends, err := s.g.Friends(r.Context(), u)
+	if storeError(w, r, err) { return }
+	writeJSON(w, s.blocks.Filter(viewer, friends))
+}
+
+// getSocialProof answers "followed by people you follow": which of
+// viewer's followings also follow target.
+func (s *server) getSocialProof(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	viewer, err1 := s.parseID(q.Get("viewer"))
+	target, err2 := s.parseID(q.Get("target"))
+	if err1 != nil || err2 != nil { http.Error(w, "bad ids", 400); return }
+	limit := 3
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 { http.Error(w, "bad limit", 400); return }
+		limit = n
+	}
+	if !s.mustSee(w, r, viewer, target) { return }
+	vf, err := s.g.FollowingSet(r.Context(), viewer)
+	if storeError(w, r, err) { return }
+	count, sample, err := s.followersKnown(r.Context(), viewer, vf, s.blocks.Hidden(viewer), target, limit)
+	if storeError(w, r, err) { return }
+	writeJSON(w, map[string]any{"count": count, "sample": sample})
+}
+
+// followersKnown counts target's followers among vf, the users viewer
+// follows, leaving out viewer, inactive users and those hidden from
+// viewer, and returns up to limit of them, lowest IDs first. It scans the
+// smaller of the two sets and probes the other; neither is copied.
+func (s *server) followersKnown(ctx context.Context, viewer uint64, vf graph.Set, hidden map[uint64]struct{}, target uint64, limit int) (int, []uint64, error) {
+	tf, err := s.g.FollowersSet(ctx, target)
+	if err != nil { return 0, nil, err }
+	scan, probe := vf, tf
+	if scan.Len() > probe.Len() { scan, probe = probe, scan }
+	count, ids := 0, []uint64{}
+	scan.Each(func(x uint64) bool {
+		if x == viewer || !probe.Has(x) || !s.users.Visible(x) { return true }
+		if _, ok := hidden[x]; ok { return true }
+		count++
+		if limit > 0 { ids = append(ids, x) }
+		return true
+	})
+	slices.Sort(ids)
+	if len(ids) > limit { ids = ids[:limit] }
+	return count, ids, nil
 }
+
+// getFollowersYouKnow is the profile-page module: which of target's
+// followers viewer follows, as {"count":..,"user_ids":[..]}.
+func (s *server) getFollowersYouKnow(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	viewer, err1 := s.parseID(q.Get("viewer"))
+	target, err2 := s.parseID(q.Get("target"))
+	if err1 != nil || err2 != nil { http.Error(w, "bad ids", 400); return }
+	limit := 20
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 1000 { http.Error(w, "bad limit", 400); return }
+		limit = n
+	}
+	if !s.mustSee(w, r, viewer, target) { return }
+	vf, err := s.g.FollowingSet(r.Context(), viewer)
+	if storeError(w, r, err) { return }
+	count, ids, err := s.followersKnown(r.Context(), viewer, vf, s.blocks.Hidden(viewer), target, limit)
+	if storeError(w, r, err) { return }
+	writeJSON(w, map[string]any{"count": count, "user_ids": ids})
+}
+
+// maxMutualCounts caps the candidates one /mutual_counts call may ask
+// about.
+const maxMutualCounts = 1000
+
+// postMutualCounts is /social_proof's count for many targets at once:
+// {"viewer":1,"candidates":[7,8]} → {"counts":[2,0]}, how many of the
+// users viewer follows follow each candidate, in request order. viewer
+// defaults to the caller's (see listViewer), and the caller must be
+// allowed to see the lists of viewer and of every candidate. The
+// viewer's set is read once; each candidate's followers are intersected
+// with it, scanning the smaller side.
+func (s *server) postMutualCounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		Viewer     *uint64  `json:"viewer"`
+		Candidates []uint64 `json:"candidates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+	if len(body.Candidates) > maxMutualCounts {
+		http.Error(w, fmt.Sprintf("at most %d candidates", maxMutualCounts), 400); return
+	}
+	if body.Viewer == nil {
+		v, known, _ := s.listViewer(r)
+		if !known { http.Error(w, "viewer is required", 400); return }
+		body.Viewer = &v
+	}
+	viewer := s.users.Resolve(*body.Viewer)
+	for i, c := range body.Candidates { body.Candidates[i] = s.users.Resolve(c) }
+	if !s.mustSee(w, r, append([]uint64{viewer}, body.Candidates...)...) { return }
+	vf, err := s.g.FollowingSet(r.Context(), viewer)
+	if storeError(w, r, err) { return }
+	hidden := s.blocks.Hidden(viewer)
+	counts := make([]int, len(body.Candidates))
+	for i, c := range body.Candidates {
+		if c == viewer { continue }
+		n, _, err := s.followersKnown(r.Context(), viewer, vf, hidden, c, 0)
+		if storeError(w, r, err) { return }
+		counts[i] = n
+	}
+	writeJSON(w, map[string]any{"counts": counts})
+}
+
 func (s *server) getMutuals(w http.ResponseWriter, r *http.Request) {
 	u, err1 := s.parseID(r.URL.Query().Get("u"))
 	v, err2 := s.parseID(r.URL.Query().Get("v"))
 	if err1 != nil || err2 != nil { http.Error(w, "bad ids", 400); return }
-	uf := graph.ToSet(s.g.Following(u))
-	vf := graph.ToSet(s.g.Following(v))
-	if uf == nil || vf == nil {
-		writeJSON(w, []uint64{}); return
-	}
-	res := make([]uint64, 0, 8)
+	viewer, hasViewer, ok := s.viewerParam(w, r)
+	if !ok || !s.mustSee(w, r, u, v) { return }
+	// Scan the smaller set and probe the larger; neither is copied. Both
+	// come from one view, so a concurrent write shows in both or neither.
+	view := s.g.View()
+	defer view.Close()
+	uf, err := view.FollowingSet(r.Context(), u)
+	if storeError(w, r, err) { return }
+	vf, err := view.FollowingSet(r.Context(), v)
+	if storeError(w, r, err) { return }
 	if uf.Len() > vf.Len() { uf, vf = vf, uf }
-	for x := range uf { if vf.Has(x) { res = append(res, x) } }
+	res := make([]uint64, 0, 8)
+	uf.Each(func(x uint64) bool {
+		if vf.Has(x) && s.users.Visible(x) { res = append(res, x) }
+		return true
+	})
+	if hasViewer { res = s.blocks.Filter(viewer, res) }
 	writeJSON(w, res)
 }
 
+// canWrite checks for write scope on a read-scoped route that also takes
+// writes, answering 403 when it is missing.
+func (s *server) canWrite(w http.ResponseWriter, r *http.Request) bool {
+	if s.auth == nil || auth.FromContext(r.Context()).Has(auth.ScopeWrite) { return true }
+	metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+	http.Error(w, "insufficient scope", http.StatusForbidden)
+	return false
+}
+
+// userStatus reads (GET) or changes (PUT, write scope) a user's account
+// status. Non-active users keep their edges but drop out of PYMK, mutuals
+// and connection explanations.
+func (s *server) userStatus(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u, err := s.parseID(r.URL.Query().Get("user_id"))
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		writeJSON(w, map[string]any{"user_id": u, "status": s.users.Get(u)})
+	case http.MethodPut:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			UserID uint64 `json:"user_id"`
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		st, err := users.ParseStatus(body.Status)
+		if err != nil { http.Error(w, err.Error(), 400); return }
+		u := s.users.Resolve(body.UserID)
+		ok := s.users.Set(u, st)
+		if ok { s.audit.Record(r.Context(), audit.Record{Tenant: s.tenant, Op: "status", Src: u, Detail: string(st)}) }
+		writeJSON(w, map[string]any{"ok": ok})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
 func (s *server) putEmbedding(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut { http.Error(w, "method not allowed", 405); return }
 	type req struct {
@@ -100,18 +547,21 @@ func (s *server) putEmbedding(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400); return
 	}
 	if len(body.Vec) == 0 { http.Error(w, "empty vector", 400); return }
-	s.e.Put(body.UserID, body.Vec)
+	s.e.Put(s.users.Resolve(body.UserID), body.Vec)
 	writeJSON(w, map[string]any{"ok": true})
 }
 
 func (s *server) getPYMK(w http.ResponseWriter, r *http.Request) {
 	u, err := s.parseID(r.URL.Query().Get("user_id"))
 	if err != nil { http.Error(w, "bad user_id", 400); return }
-	k := 20
+	s.observe(u)
+	if s.pymkNotModified(w, r, u) { return }
+	k := 0 // the profile's default
 	if q := strings.TrimSpace(r.URL.Query().Get("k")); q != "" {
 		if v, err := strconv.Atoi(q); err == nil && v > 0 { k = v }
 	}
-	// ?exclude=1,2,3
+	// ?exclude=1,2,3 predates /pymk/exclusions and is kept for old clients;
+	// it does not bypass the cache, so prefer the stored exclusions.
 	var ex map[uint64]struct{}
 	if exStr := strings.TrimSpace(r.URL.Query().Get("exclude")); exStr != "" {
 		ex = make(map[uint64]struct{})
@@ -121,10 +571,171 @@ func (s *server) getPYMK(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	res := s.svc.PYMK(u, k, ex)
+	ex = s.hiddenFrom(u, ex)
+	// ?filter=country == viewer.country && account_age > 7d
+	filter, err := attrs.ParseFilter(r.URL.Query().Get("filter"))
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	// ?budget_ms=50 answers within about 50ms with the best ranking found
+	// so far, as {"suggestions":[...],"partial":bool}.
+	var budget time.Duration
+	if v := strings.TrimSpace(r.URL.Query().Get("budget_ms")); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 { http.Error(w, "bad budget_ms", 400); return }
+		budget = time.Duration(ms) * time.Millisecond
+	}
+	res, err := s.svc.PYMK(r.Context(), u, pymk.Query{K: k, Exclude: ex, Filter: filter, Budget: budget})
+	if errors.Is(err, context.Canceled) { return } // client gone
+	if budget > 0 && (err == nil || errors.Is(err, pymk.ErrOverBudget)) {
+		partial := err != nil
+		w.Header().Set("X-PYMK-Normalization", pymk.NormalizationName(s.svc.Config().Normalization))
+		s.svc.Served(u, res)
+		if partial {
+			w.Header().Set("X-PYMK-Partial", "true")
+			w.Header().Del("ETag")
+		}
+		writeJSON(w, map[string]any{"suggestions": res, "partial": partial})
+		return
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) { storeError(w, r, err); return }
+	w.Header().Set("X-PYMK-Normalization", pymk.NormalizationName(s.svc.Config().Normalization))
+	s.svc.Served(u, res) // partial results are shown too
+	if err != nil {
+		// Timed out: the best suggestions found so far, possibly none.
+		w.Header().Set("X-PYMK-Partial", "true")
+		w.Header().Del("ETag")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGatewayTimeout)
+		_ = json.NewEncoder(w).Encode(res)
+		return
+	}
 	writeJSON(w, res)
 }
 
+// pymkNotModified is notModified for /pymk. Suggestions also change with
+// the query (k, filter, exclude, profile) and through other users' edges,
+// which reach u's results as invalidations rather than epochs, so the tag
+// carries a hash of the query and u's invalidation generation. Without
+// invalidation, results go stale with no such signal and no tag is set.
+func (s *server) pymkNotModified(w http.ResponseWriter, r *http.Request, u uint64) bool {
+	if !s.cfg().Invalidation.Enabled { return false }
+	h := fnv.New64a()
+	h.Write([]byte(r.URL.Query().Encode())) // keys sorted
+	return s.notModifiedAs(w, r, fmt.Sprintf(";q%x;g%d", h.Sum64(), s.svc.Generation(u)), u)
+}
+
+// hiddenFrom adds to ex the users PYMK never shows u: blocked, muted,
+// dismissed through feedback or excluded.
+func (s *server) hiddenFrom(u uint64, ex map[uint64]struct{}) map[uint64]struct{} {
+	for _, hidden := range []map[uint64]struct{}{s.blocks.Hidden(u), s.feedback.Hidden(s.tenant, u), s.exclusions.Excluded(s.tenant, u)} {
+		if hidden == nil { continue }
+		if ex == nil { ex = hidden } else { for x := range hidden { ex[x] = struct{}{} } }
+	}
+	return ex
+}
+
+// getDegreeStats serves this node's log-bucketed in- and out-degree
+// histograms, read from the degree indexes without scanning any sets.
+func (s *server) getDegreeStats(w http.ResponseWriter, r *http.Request) {
+	in, out := s.local.DegreeHistogram()
+	writeJSON(w, map[string]any{"in": in, "out": out})
+}
+
+func (s *server) getTop(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var byFollowers bool
+	switch q.Get("by") {
+	case "", "followers":
+		byFollowers = true
+	case "following":
+	default:
+		http.Error(w, "by must be followers or following", 400); return
+	}
+	n := 100
+	if v := strings.TrimSpace(q.Get("n")); v != "" {
+		x, err := strconv.Atoi(v)
+		if err != nil || x <= 0 || x > graph.TopMax { http.Error(w, "bad n", 400); return }
+		n = x
+	}
+	if v := q.Get("locale"); v != "" {
+		a := attrs.Attrs{}
+		a.Language, a.Country = attrs.ParseLocale(v)
+		if err := a.Normalize(); err != nil { http.Error(w, "bad locale: "+err.Error(), 400); return }
+		top := s.top.GetIn(n, byFollowers, a.Locale())
+		if top == nil { top = []graph.Ranked{} }
+		writeJSON(w, top)
+		return
+	}
+	writeJSON(w, s.top.Get(n, byFollowers))
+}
+
+// notModified sets a strong ETag derived from u's epoch (which advances
+// on every edge change touching u) and answers 304 when the client's
+// If-None-Match already matches it. Extra users (e.g. a filtering viewer)
+// are folded into the tag.
+//
+// If an epoch cannot be read no tag is set, and the handler's own store
+// calls report the failure.
+func (s *server) notModified(w http.ResponseWriter, r *http.Request, u uint64, extra ...uint64) bool {
+	return s.notModifiedAs(w, r, "", u, extra...)
+}
+
+// notModifiedAs is notModified with suffix appended to the tag, for
+// results that depend on more than the users' epochs.
+func (s *server) notModifiedAs(w http.ResponseWriter, r *http.Request, suffix string, u uint64, extra ...uint64) bool {
+	tag := ""
+	for i, x := range append([]uint64{u}, extra...) {
+		e, err := s.g.UserEpoch(r.Context(), x)
+		if err != nil { return false }
+		if i > 0 { tag += ";" }
+		tag += strconv.FormatUint(x, 10) + ":" + strconv.FormatUint(e, 10)
+	}
+	tag = `"` + tag + suffix + `"`
+	h := w.Header()
+	h.Set("ETag", tag)
+	h.Add("Vary", tenant.Header)
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" { return false }
+	for _, t := range strings.Split(inm, ",") {
+		if t = strings.TrimSpace(t); t == tag || t == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// observe counts a lookup of u toward the tenant's heavy hitters.
+func (s *server) observe(u uint64) {
+	if s.hot != nil { s.hot.Observe(u) }
+}
+
+// storeError answers a failed graph store call and reports whether err
+// was non-nil: 503 when the backend is unavailable, 504 when the request
+// ran out of time, 409 for a stale conditional write, 501 for an
+// operation the backend does not support, 400 for a malformed transaction, nothing when the client has
+// gone, 500 otherwise.
+func storeError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled):
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	case errors.Is(err, graph.ErrUnavailable):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, graph.ErrEpochChanged):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, graph.ErrBadTx):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errors.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		slog.ErrorContext(r.Context(), "graph store failed", "path", r.URL.Path, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+	return true
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandharkardeep/social-graph/internal/identity"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+)
+
+// owner is the tenant whose string IDs apply: a named graph shares its
+// tenant's users.
+func (s *server) owner() string {
+	tn, _ := tenant.Split(s.tenant)
+	return tn
+}
+
+// identities registers and looks up string user IDs: POST {external} or
+// {externals:[...]} registers them (write scope), returning their IDs;
+// GET ?external= and ?id=, each repeatable, looks them up either way.
+// Unknown ones are left out of the answer.
+func (s *server) identities(w http.ResponseWriter, r *http.Request) {
+	type mapping struct {
+		External string `json:"external"`
+		ID       uint64 `json:"id"`
+		Created  bool   `json:"created,omitempty"`
+	}
+	out := []mapping{}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if len(q["external"])+len(q["id"]) > maxIdentityBatch { http.Error(w, fmt.Sprintf("at most %d lookups", maxIdentityBatch), 400); return }
+		for _, x := range q["external"] {
+			if id, ok := s.idents.Lookup(s.owner(), x); ok { out = append(out, mapping{External: x, ID: id}) }
+		}
+		for _, v := range q["id"] {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil { http.Error(w, "bad id", 400); return }
+			if x, ok := s.idents.External(s.owner(), id); ok { out = append(out, mapping{External: x, ID: id}) }
+		}
+	case http.MethodPost:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			External  string   `json:"external"`
+			Externals []string `json:"externals"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		if body.External != "" { body.Externals = append(body.Externals, body.External) }
+		if len(body.Externals) == 0 { http.Error(w, "external or externals is required", 400); return }
+		if len(body.Externals) > maxIdentityBatch { http.Error(w, fmt.Sprintf("at most %d externals", maxIdentityBatch), 400); return }
+		for _, x := range body.Externals {
+			if err := identity.Valid(x); err != nil { http.Error(w, err.Error(), 400); return }
+		}
+		for _, x := range body.Externals {
+			id, created, err := s.idents.Register(s.owner(), x)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "identity registration failed", "err", err)
+				http.Error(w, "internal error", 500); return
+			}
+			out = append(out, mapping{External: x, ID: id, Created: created})
+		}
+	default:
+		http.Error(w, "method not allowed", 405); return
+	}
+	writeJSON(w, map[string]any{"identities": out})
+}
+
+const maxIdentityBatch = 1000
+
+// Query parameters and JSON body fields that hold user IDs, and so may
+// be given as registered string IDs instead.
+var (
+	idParams = []string{"user_id", "u", "v", "viewer", "target", "exclude"} // exclude is comma-separated
+	idFields = map[string]bool{
+		"src": true, "dst": true, "dsts": true, "pairs": true, "edges": true,
+		"user_id": true, "user_ids": true, "candidate_id": true, "candidates": true,
+		"viewer": true, "target": true, "ids": true, "add": true, "remove": true,
+		"from": true, "to": true, "start": true,
+	}
+)
+
+// errUnknownID is returned by translateIDs for strings never registered.
+type errUnknownID string
+
+func (e errUnknownID) Error() string {
+	return fmt.Sprintf("unknown user id %q: register it with POST /identities", string(e))
+}
+
+// translateIDs rewrites the string IDs in r's user ID parameters and JSON
+// body fields (see idParams, idFields) to the numeric IDs registered for
+// them, so handlers only ever see numbers. Tenants without string IDs are
+// left alone.
+func (s *server) translateIDs(r *http.Request) error {
+	if s.idents == nil || s.idents.Len(s.owner()) == 0 { return nil }
+	lookup := func(x string) (uint64, error) {
+		x = strings.TrimSpace(x)
+		if id, err := strconv.ParseUint(x, 10, 64); err == nil { return id, nil }
+		if id, ok := s.idents.Lookup(s.owner(), x); ok { return id, nil }
+		return 0, errUnknownID(x)
+	}
+	q := r.URL.Query()
+	changed := false
+	for _, p := range idParams {
+		for i, v := range q[p] {
+			parts := []string{v}
+			if p == "exclude" { parts = strings.Split(v, ",") }
+			for j, x := range parts {
+				if x == "" || isNumeric(strings.TrimSpace(x)) { continue }
+				id, err := lookup(x)
+				if err != nil { return err }
+				parts[j] = strconv.FormatUint(id, 10)
+				changed = true
+			}
+			q[p][i] = strings.Join(parts, ",")
+		}
+	}
+	if changed { r.URL.RawQuery = q.Encode() }
+	return s.translateBody(r, lookup)
+}
+
+func isNumeric(x string) bool {
+	_, err := strconv.ParseUint(x, 10, 64)
+	return err == nil
+}
+
+// translateBody rewrites string IDs in a JSON object body. Bodies that are
+// not JSON objects, or do not parse, are left for the handler to reject.
+func (s *server) translateBody(r *http.Request, lookup func(string) (uint64, error)) error {
+	if r.Body == nil || r.Body == http.NoBody || r.Method == http.MethodGet { return nil }
+	if ct := r.Header.Get("Content-Type"); strings.Contains(ct, "ndjson") || strings.Contains(ct, "csv") { return nil } // streamed
+	raw, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil { return nil } // the handler sees the same short body
+	if t := bytes.TrimSpace(raw); len(t) == 0 || t[0] != '{' || !bytes.Contains(t, []byte(`"`)) { return nil }
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var body map[string]any
+	if dec.Decode(&body) != nil { return nil }
+	changed := false
+	var walk func(v any) (any, error)
+	walk = func(v any) (any, error) {
+		switch x := v.(type) {
+		case string:
+			id, err := lookup(x)
+			if err != nil { return nil, err }
+			changed = true
+			return json.Number(strconv.FormatUint(id, 10)), nil
+		case []any:
+			for i := range x {
+				var err error
+				if x[i], err = walk(x[i]); err != nil { return nil, err }
+			}
+		}
+		return v, nil
+	}
+	for k, v := range body {
+		if !idFields[k] { continue }
+		if body[k], err = walk(v); err != nil { return err }
+	}
+	if !changed { return nil }
+	if raw, err = json.Marshal(body); err != nil { return err }
+	r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(raw)), int64(len(raw))
+	r.Header.Del("Content-Length")
+	return nil
+}
+
+// idError answers a translateIDs failure.
+func idError(w http.ResponseWriter, err error) {
+	var unknown errUnknownID
+	if errors.As(err, &unknown) { http.Error(w, err.Error(), 404); return }
+	http.Error(w, err.Error(), 400)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+)
+
+const (
+	maxInteractionBatch = 10_000
+	maxInteractionCount = 1000 // events of one kind folded into one entry
+	closeFriendsMax     = 1000
+)
+
+type interaction struct {
+	Src   uint64 `json:"src"`
+	Dst   uint64 `json:"dst"`
+	Type  string `json:"type"`  // like | reply | share | any type in interactions.weights
+	Count int    `json:"count"` // events folded into this entry; 0 = 1
+}
+
+// interactions ingests engagement events (POST {events:[...]}, write
+// scope), each adding its type's weight from interactions.weights to the
+// weight of src's interactions with dst. GET ?user_id=[&k=] lists whom a
+// user interacts with most; GET ?u=&v= reads one pair both ways.
+func (s *server) interactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if q.Has("user_id") {
+			u, err := s.parseID(q.Get("user_id"))
+			if err != nil { http.Error(w, "bad user_id", 400); return }
+			k, ok := parseK(w, q.Get("k"), 20, closeFriendsMax)
+			if !ok || !s.mustSee(w, r, u) { return }
+			writeJSON(w, map[string]any{"user_id": u, "strongest": s.weights.Strongest(u, k)})
+			return
+		}
+		u, err1 := s.parseID(q.Get("u"))
+		v, err2 := s.parseID(q.Get("v"))
+		if err1 != nil || err2 != nil { http.Error(w, "bad ids", 400); return }
+		if !s.mustSeeEdge(w, r, u, v) { return }
+		writeJSON(w, map[string]any{"u": u, "v": v, "uv": s.weights.Get(u, v), "vu": s.weights.Get(v, u)})
+	case http.MethodPost:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			Events []interaction `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		if len(body.Events) > maxInteractionBatch { http.Error(w, fmt.Sprintf("at most %d events per request", maxInteractionBatch), 400); return }
+		mult := s.cfg().Interactions.Weights
+		for i, e := range body.Events {
+			if _, ok := mult[e.Type]; !ok { http.Error(w, fmt.Sprintf("events[%d]: unknown type %q", i, e.Type), 400); return }
+			if e.Count < 0 || e.Count > maxInteractionCount { http.Error(w, fmt.Sprintf("events[%d]: count must be in [0, %d]", i, maxInteractionCount), 400); return }
+			if e.Src == e.Dst { http.Error(w, fmt.Sprintf("events[%d]: src and dst are the same user", i), 400); return }
+		}
+		for _, e := range body.Events {
+			n := max(e.Count, 1)
+			s.weights.Add(s.users.Resolve(e.Src), s.users.Resolve(e.Dst), mult[e.Type]*float64(n))
+			metrics.Interactions.WithLabelValues(s.tenant, e.Type).Add(float64(n))
+		}
+		writeJSON(w, map[string]any{"ok": true, "applied": len(body.Events)})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// getCloseFriends ranks a user's friends (mutual follows) by engagement
+// both ways, leaving out friends they never interacted with.
+func (s *server) getCloseFriends(w http.ResponseWriter, r *http.Request) {
+	u, err := s.parseID(r.URL.Query().Get("user_id"))
+	if err != nil { http.Error(w, "bad user_id", 400); return }
+	k, ok := parseK(w, r.URL.Query().Get("k"), 20, closeFriendsMax)
+	if !ok || !s.mustSee(w, r, u) { return }
+	friends, err := s.g.Friends(r.Context(), u)
+	if storeError(w, r, err) { return }
+	out := make([]graph.Weighted, 0, len(friends))
+	for _, v := range friends {
+		if x := s.weights.Get(u, v) + s.weights.Get(v, u); x > 0 && s.users.Visible(v) { out = append(out, graph.Weighted{User: v, Weight: x}) }
+	}
+	graph.SortWeighted(out)
+	if len(out) > k { out = out[:k] }
+	writeJSON(w, out)
+}
+
+// parseK parses an optional count in [1, max], answering 400 when it is
+// not one.
+func parseK(w http.ResponseWriter, q string, def, max int) (int, bool) {
+	q = strings.TrimSpace(q)
+	if q == "" { return def, true }
+	k, err := strconv.Atoi(q)
+	if err != nil || k <= 0 || k > max { http.Error(w, "bad k", 400); return 0, false }
+	return k, true
+}
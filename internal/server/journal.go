@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/journal"
+)
+
+const (
+	defaultJournalLimit = 1000
+	maxJournalLimit     = 10000
+	maxJournalWait      = 20 * time.Second // under the default server.write_timeout
+)
+
+// getJournal pages through the tenant's mutations, oldest first, for
+// consumers building derived views:
+//
+//	GET /journal?from_seq=1&limit=1000[&wait=10s]
+//
+// Sequence numbers increase without gaps across tenants, so a tenant's own
+// events may skip some; resume from next_seq. With wait, an empty page is
+// held until an event arrives or wait passes. A from_seq that retention
+// has dropped answers 410 with oldest_seq, as does one from another
+// journal_id (a restarted server): the consumer must resync its view.
+// Edges hidden from the caller by list privacy are left out.
+func (s *server) getJournal(w http.ResponseWriter, r *http.Request) {
+	if s.journal == nil { http.Error(w, "journal not available", 501); return }
+	q := r.URL.Query()
+	var from uint64 = 1
+	if v := strings.TrimSpace(q.Get("from_seq")); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil { http.Error(w, "bad from_seq", 400); return }
+		from = n
+	}
+	limit := defaultJournalLimit
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxJournalLimit { http.Error(w, "bad limit", 400); return }
+		limit = n
+	}
+	var wait time.Duration
+	if v := strings.TrimSpace(q.Get("wait")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > maxJournalWait { http.Error(w, "bad wait", 400); return }
+		wait = d
+	}
+	j := s.journal
+	gone := func() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "journal truncated; resync", "journal_id": j.ID(), "oldest_seq": j.Oldest(), "head_seq": j.Head()})
+	}
+	if id := q.Get("journal_id"); id != "" && id != j.ID() { gone(); return }
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	see := s.lists(r)
+	for {
+		ready := j.Wait()
+		evs, next, ok := j.SinceTenant(from, limit, s.tenant)
+		if !ok {
+			if from > j.Head()+1 { http.Error(w, "from_seq is past the journal head", 400); return }
+			gone(); return
+		}
+		from = next
+		kept := evs[:0]
+		for _, e := range evs {
+			visible, err := edgeVisible(see, e.Src, e.Dst)
+			if storeError(w, r, err) { return }
+			if visible || e.Op == "replace" { kept = append(kept, e) }
+		}
+		evs = kept
+		if len(evs) > 0 || timeout == nil {
+			if evs == nil { evs = []journal.Event{} }
+			writeJSON(w, map[string]any{"journal_id": j.ID(), "events": evs, "next_seq": next, "oldest_seq": j.Oldest(), "head_seq": j.Head()})
+			return
+		}
+		select {
+		case <-ready:
+		case <-timeout:
+			timeout = nil
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+)
+
+const maxNeighborhoodHops = 3
+
+type neighborhoodSize struct {
+	UserID   uint64 `json:"user_id"`
+	Hops     int    `json:"hops"`
+	Size     uint64 `json:"size"` // distinct users within hops, u excluded
+	Exact    bool   `json:"exact"`
+	Frontier int    `json:"frontier"` // adjacency entries read on the last hop, duplicates included
+}
+
+// getNeighborhoodSize counts the users u reaches within ?hops= follow
+// hops (default 2). With approx=true the last hop goes into a
+// HyperLogLog instead of a set, so a frontier of millions costs 16 KiB;
+// the nearer hops are still kept exactly, since they must be expanded.
+//
+// GET /neighborhood_size?user_id=&hops=2&approx=true
+func (s *server) getNeighborhoodSize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	u, err := s.parseID(q.Get("user_id"))
+	if err != nil { http.Error(w, "bad user_id", 400); return }
+	hops := 2
+	if v := q.Get("hops"); v != "" {
+		if hops, err = strconv.Atoi(v); err != nil || hops < 1 || hops > maxNeighborhoodHops {
+			http.Error(w, "hops must be 1-3", 400); return
+		}
+	}
+	approx := false
+	if v := q.Get("approx"); v != "" {
+		if approx, err = strconv.ParseBool(v); err != nil { http.Error(w, "bad approx", 400); return }
+	}
+	res, err := s.neighborhoodSize(r.Context(), u, hops, approx)
+	if storeError(w, r, err) { return }
+	writeJSON(w, res)
+}
+
+func (s *server) neighborhoodSize(ctx context.Context, u uint64, hops int, approx bool) (neighborhoodSize, error) {
+	res := neighborhoodSize{UserID: u, Hops: hops, Exact: true}
+	seen := map[uint64]struct{}{u: {}}
+	level := []uint64{u}
+	for h := 1; h <= hops; h++ {
+		last := h == hops
+		var hll *sketch.HLL
+		if last && approx { hll = sketch.NewHLL() }
+		var next []uint64
+		res.Frontier = 0
+		for _, x := range level {
+			err := s.g.ForEachFollowing(ctx, x, func(v uint64) bool {
+				res.Frontier++
+				if hll != nil {
+					hll.Add(v)
+					return true
+				}
+				if _, ok := seen[v]; !ok {
+					seen[v] = struct{}{}
+					next = append(next, v)
+				}
+				return true
+			})
+			if err != nil { return res, err }
+		}
+		if hll != nil {
+			// The nearer hops and u itself are in both; count them once.
+			for x := range seen { hll.Add(x) }
+			n := hll.Count()
+			res.Size, res.Exact = max(n, uint64(len(seen)))-1, false
+			return res, nil
+		}
+		level = next
+	}
+	res.Size = uint64(len(seen) - 1)
+	return res, nil
+}
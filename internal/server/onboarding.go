@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+const (
+	onboardingMaxK = 100
+	// onboardingScan bounds the users read per interest, so a broad topic
+	// costs the same as a niche one.
+	onboardingScan = 10_000
+)
+
+type onboardingSuggestion struct {
+	UserID    uint64   `json:"user_id"`
+	Followers int      `json:"followers"`
+	Reason    string   `json:"reason"`           // topic | popular
+	Topics    []string `json:"topics,omitempty"` // interests the account shares
+}
+
+// getOnboarding suggests accounts to follow for a user with no graph yet,
+// where PYMK has nothing to go on: accounts sharing the ?interests= topics
+// (default: the user's own topics), most shared first, then the
+// most-followed accounts of the user's locale and then of everyone.
+// Accounts the user already follows or hides are left out.
+//
+// GET /recommendations/onboarding?user_id=&interests=music,tech&k=
+func (s *server) getOnboarding(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	u, err := s.parseID(q.Get("user_id"))
+	if err != nil { http.Error(w, "bad user_id", 400); return }
+	k := 20
+	if v := strings.TrimSpace(q.Get("k")); v != "" {
+		x, err := strconv.Atoi(v)
+		if err != nil || x <= 0 || x > onboardingMaxK { http.Error(w, "bad k", 400); return }
+		k = x
+	}
+	me, _ := s.attrs.Get(u)
+	interests := me.Topics
+	if v := strings.TrimSpace(q.Get("interests")); v != "" {
+		a := attrs.Attrs{Topics: strings.Split(v, ",")}
+		for i := range a.Topics { a.Topics[i] = strings.TrimSpace(a.Topics[i]) }
+		if err := a.Normalize(); err != nil { http.Error(w, "bad interests: "+err.Error(), 400); return }
+		interests = a.Topics
+	}
+
+	skip := map[uint64]struct{}{u: {}}
+	for _, hidden := range []map[uint64]struct{}{s.blocks.Hidden(u), s.feedback.Hidden(s.tenant, u), s.exclusions.Excluded(s.tenant, u)} {
+		for x := range hidden { skip[x] = struct{}{} }
+	}
+	err = s.g.ForEachFollowing(r.Context(), u, func(v uint64) bool { skip[v] = struct{}{}; return true })
+	if storeError(w, r, err) { return }
+	ok := func(c uint64) bool {
+		_, skipped := skip[c]
+		return !skipped && s.users.Visible(c)
+	}
+
+	// Topic matches, by interests shared, then locale, then followers.
+	shared := make(map[uint64][]string)
+	for _, t := range interests {
+		n := 0
+		s.attrs.WithTopic(t, func(c uint64) bool {
+			shared[c] = append(shared[c], t)
+			n++
+			return n < onboardingScan
+		})
+	}
+	type match struct {
+		onboardingSuggestion
+		local bool
+	}
+	var matches []match
+	for c, ts := range shared {
+		if !ok(c) { continue }
+		n, err := s.g.DegreeIn(r.Context(), c)
+		if err != nil { storeError(w, r, err); return }
+		a, _ := s.attrs.Get(c)
+		same, known := me.SameLocale(a)
+		matches = append(matches, match{onboardingSuggestion{c, n, "topic", ts}, same && known})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if len(a.Topics) != len(b.Topics) { return len(a.Topics) > len(b.Topics) }
+		if a.local != b.local { return a.local }
+		if a.Followers != b.Followers { return a.Followers > b.Followers }
+		return a.UserID < b.UserID
+	})
+	out := make([]onboardingSuggestion, 0, k)
+	for _, m := range matches {
+		if len(out) == k { break }
+		out = append(out, m.onboardingSuggestion)
+		skip[m.UserID] = struct{}{}
+	}
+
+	// Then popular accounts, in the user's locale first.
+	var popular [][]graph.Ranked
+	if loc := me.Locale(); loc != "" { popular = append(popular, s.top.GetIn(graph.TopMax, true, loc)) }
+	popular = append(popular, s.top.Get(graph.TopMax, true))
+	for _, list := range popular {
+		for _, p := range list {
+			if len(out) == k { break }
+			if !ok(p.User) { continue }
+			out = append(out, onboardingSuggestion{UserID: p.User, Followers: p.Count, Reason: "popular"})
+			skip[p.User] = struct{}{}
+		}
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Edge directions between consecutive path nodes a and b.
+const (
+	dirFollows    = "follows"     // a follows b
+	dirFollowedBy = "followed_by" // b follows a
+	dirMutual     = "mutual"
+)
+
+// maxPathExpand caps how many of u's neighbors are expanded when looking
+// for 3-hop paths.
+const maxPathExpand = 500
+
+type path struct {
+	Nodes []uint64 `json:"nodes"`
+	Edges []string `json:"edges"`
+}
+
+// neighbors returns u's followees and followers with the direction of
+// each edge as seen from u.
+func (s *server) neighbors(ctx context.Context, u uint64) (map[uint64]string, error) {
+	n := make(map[uint64]string)
+	err := s.g.ForEachFollowing(ctx, u, func(x uint64) bool { n[x] = dirFollows; return true })
+	if err != nil { return nil, err }
+	err = s.g.ForEachFollowers(ctx, u, func(x uint64) bool {
+		if n[x] == dirFollows { n[x] = dirMutual } else { n[x] = dirFollowedBy }
+		return true
+	})
+	return n, err
+}
+
+func flip(d string) string {
+	switch d {
+	case dirFollows:
+		return dirFollowedBy
+	case dirFollowedBy:
+		return dirFollows
+	}
+	return d
+}
+
+// connections finds up to limit simple paths of at most three hops from u
+// to v, ignoring edge direction but reporting it. Shorter paths come
+// first; paths through non-active users, and through users whose lists
+// see hides in the middle hop, are skipped.
+func (s *server) connections(ctx context.Context, u, v uint64, limit int, see func(uint64) (bool, error)) ([]path, error) {
+	out := []path{}
+	nu, err := s.neighbors(ctx, u)
+	if err != nil { return nil, err }
+	nv, err := s.neighbors(ctx, v)
+	if err != nil { return nil, err }
+	if d, ok := nu[v]; ok {
+		out = append(out, path{Nodes: []uint64{u, v}, Edges: []string{d}})
+	}
+	ids := make([]uint64, 0, len(nu))
+	for x := range nu { if x != v && s.users.Visible(x) { ids = append(ids, x) } }
+	slices.Sort(ids) // deterministic output
+	for _, x := range ids {
+		if len(out) >= limit { return out, nil }
+		if d, ok := nv[x]; ok {
+			out = append(out, path{Nodes: []uint64{u, x, v}, Edges: []string{nu[x], flip(d)}})
+		}
+	}
+	if len(ids) > maxPathExpand { ids = ids[:maxPathExpand] }
+	for _, x := range ids {
+		ok, err := see(x)
+		if err != nil { return nil, err }
+		if !ok { continue }
+		nx, err := s.neighbors(ctx, x)
+		if err != nil { return nil, err }
+		ys := make([]uint64, 0)
+		for y := range nx {
+			if _, ok := nv[y]; ok && y != u && y != v && s.users.Visible(y) { ys = append(ys, y) }
+		}
+		slices.Sort(ys)
+		for _, y := range ys {
+			if len(out) >= limit { return out, nil }
+			out = append(out, path{Nodes: []uint64{u, x, y, v}, Edges: []string{nu[x], nx[y], flip(nv[y])}})
+		}
+	}
+	return out, nil
+}
+
+func (s *server) getWhyConnected(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	u, err1 := s.parseID(q.Get("u"))
+	v, err2 := s.parseID(q.Get("v"))
+	if err1 != nil || err2 != nil || u == v { http.Error(w, "bad ids", 400); return }
+	limit := 5
+	if l := strings.TrimSpace(q.Get("limit")); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > 100 { http.Error(w, "bad limit", 400); return }
+		limit = n
+	}
+	if !s.mustSee(w, r, u, v) { return }
+	paths, err := s.connections(r.Context(), u, v, limit, s.lists(r))
+	if storeError(w, r, err) { return }
+	writeJSON(w, map[string]any{"paths": paths})
+}
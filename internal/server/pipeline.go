@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxPipelineOps caps the operations in one /pipeline call.
+const maxPipelineOps = 50
+
+// pipelineOps are the operations /pipeline runs, by the route serving
+// each: GET ones take their args as query parameters, POST ones as the
+// JSON body.
+var pipelineOps = map[string]struct{ method, path string }{
+	"follow":             {http.MethodPost, "/follow"},
+	"unfollow":           {http.MethodPost, "/unfollow"},
+	"following":          {http.MethodGet, "/following"},
+	"followers":          {http.MethodGet, "/followers"},
+	"mutuals":            {http.MethodGet, "/mutuals"},
+	"friends":            {http.MethodGet, "/friends"},
+	"pymk":               {http.MethodGet, "/pymk"},
+	"social_proof":       {http.MethodGet, "/social_proof"},
+	"followers_you_know": {http.MethodGet, "/followers_you_know"},
+	"degrees":            {http.MethodPost, "/degrees"},
+	"block":              {http.MethodPost, "/block"},
+	"unblock":            {http.MethodPost, "/unblock"},
+	"user_status":        {http.MethodGet, "/user_status"},
+	"attrs":              {http.MethodGet, "/attrs"},
+}
+
+type pipelineOp struct {
+	Op   string          `json:"op"`
+	Args json.RawMessage `json:"args"`
+}
+
+type pipelineResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// pipeline runs {"ops":[{"op","args"},...]} in order, each through mux
+// exactly as if it were its own request with this one's headers, so it
+// is authorized by its own route's scope and sees earlier ops' writes.
+// Results come back per op; with stop_on_error the ops after the first
+// failure are answered 424 without running. Mobile clients assembling a
+// screen make one round trip instead of several.
+//
+// POST /pipeline {"ops":[{"op":"followers","args":{"user_id":1}},{"op":"pymk","args":{"user_id":1,"k":5}}]}
+func pipeline(mux http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+		var body struct {
+			Ops         []pipelineOp `json:"ops"`
+			StopOnError bool         `json:"stop_on_error"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), 400); return
+		}
+		if len(body.Ops) > maxPipelineOps {
+			http.Error(w, fmt.Sprintf("at most %d ops", maxPipelineOps), 400); return
+		}
+		for i, op := range body.Ops {
+			if _, ok := pipelineOps[op.Op]; !ok { http.Error(w, fmt.Sprintf("op %d: unknown op %q", i, op.Op), 400); return }
+		}
+		results := make([]pipelineResult, len(body.Ops))
+		failed := false
+		for i, op := range body.Ops {
+			if failed {
+				results[i] = pipelineResult{Status: http.StatusFailedDependency, Error: "skipped after an earlier failure"}
+				continue
+			}
+			results[i] = runPipelineOp(mux, r, op)
+			failed = body.StopOnError && results[i].Status >= 400
+		}
+		writeJSON(w, map[string]any{"results": results})
+	}
+}
+
+func runPipelineOp(mux http.Handler, r *http.Request, op pipelineOp) pipelineResult {
+	route := pipelineOps[op.Op]
+	r2 := r.Clone(r.Context())
+	r2.Method, r2.URL = route.method, &url.URL{Path: route.path}
+	r2.RequestURI = route.path
+	if route.method == http.MethodGet {
+		q, err := queryArgs(op.Args)
+		if err != nil { return pipelineResult{Status: 400, Error: err.Error()} }
+		r2.URL.RawQuery = q.Encode()
+		r2.Body, r2.ContentLength = http.NoBody, 0
+	} else {
+		r2.Body, r2.ContentLength = io.NopCloser(bytes.NewReader(op.Args)), int64(len(op.Args))
+		r2.Header.Set("Content-Type", "application/json")
+	}
+	rec := &opRecorder{h: make(http.Header), code: 200}
+	mux.ServeHTTP(rec, r2)
+	res := pipelineResult{Status: rec.code}
+	if b := rec.buf.Bytes(); strings.HasPrefix(rec.h.Get("Content-Type"), "application/json") && json.Valid(b) {
+		res.Body = bytes.TrimSpace(b)
+	} else {
+		res.Error = strings.TrimSpace(rec.buf.String())
+	}
+	return res
+}
+
+// queryArgs turns a GET op's args object into query parameters: strings
+// as they are, numbers and booleans as written.
+func queryArgs(args json.RawMessage) (url.Values, error) {
+	q := url.Values{}
+	if len(args) == 0 { return q, nil }
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(args, &m); err != nil { return nil, fmt.Errorf("args: %w", err) }
+	for k, v := range m {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			q.Set(k, s)
+			continue
+		}
+		if t := strings.TrimSpace(string(v)); t != "" && !strings.ContainsAny(t[:1], "[{") {
+			q.Set(k, t)
+			continue
+		}
+		return nil, fmt.Errorf("args: %s must be a string, number or boolean", k)
+	}
+	return q, nil
+}
+
+// opRecorder buffers one pipeline op's response.
+type opRecorder struct {
+	h    http.Header
+	code int
+	buf  bytes.Buffer
+}
+
+func (o *opRecorder) Header() http.Header         { return o.h }
+func (o *opRecorder) Write(b []byte) (int, error) { return o.buf.Write(b) }
+func (o *opRecorder) WriteHeader(code int)        { o.code = code }
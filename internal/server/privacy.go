@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pandharkardeep/social-graph/internal/audit"
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/users"
+)
+
+// userPrivacy reads (GET) or changes (PUT, write scope) who may see a
+// user's following and followers lists. A user signed in with a JWT may
+// change only their own setting.
+func (s *server) userPrivacy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u, err := s.parseID(r.URL.Query().Get("user_id"))
+		if err != nil { http.Error(w, "bad user_id", 400); return }
+		writeJSON(w, map[string]any{"user_id": u, "lists": s.users.Privacy(u)})
+	case http.MethodPut:
+		if !s.canWrite(w, r) { return }
+		var body struct {
+			UserID uint64 `json:"user_id"`
+			Lists  string `json:"lists"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+		p, err := users.ParsePrivacy(body.Lists)
+		if err != nil { http.Error(w, err.Error(), 400); return }
+		u := s.users.Resolve(body.UserID)
+		if viewer, known, all := s.listViewer(r); !all && isJWT(r) && (!known || viewer != u) {
+			metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+			http.Error(w, "can only change your own privacy", http.StatusForbidden); return
+		}
+		ok := s.users.SetPrivacy(u, p)
+		if ok { s.audit.Record(r.Context(), audit.Record{Tenant: s.tenant, Op: "privacy", Src: u, Detail: string(p)}) }
+		// Cached list responses carry u's epoch in their ETag.
+		if ok && storeError(w, r, s.g.TouchUsers(r.Context(), u)) { return }
+		writeJSON(w, map[string]any{"ok": ok})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+func isJWT(r *http.Request) bool {
+	p := auth.FromContext(r.Context())
+	return p != nil && p.Via == "jwt"
+}
+
+// listViewer is who is asking to see a list: the subject of a JWT. Only
+// admin scope (or anyone, with auth off) may name someone else with
+// ?viewer=, as a backend acting for its user does; admin scope without
+// it sees every list. known is false for an anonymous caller, which API
+// keys below admin scope are here.
+func (s *server) listViewer(r *http.Request) (viewer uint64, known, all bool) {
+	p := auth.FromContext(r.Context())
+	if s.auth == nil || p.Has(auth.ScopeAdmin) {
+		q := r.URL.Query()
+		if !q.Has("viewer") { return 0, false, s.auth != nil }
+		u, err := s.parseID(q.Get("viewer"))
+		return u, err == nil, false
+	}
+	if p != nil && p.Via == "jwt" {
+		if u, err := s.parseID(p.ID); err == nil { return u, true, false }
+		if s.idents != nil {
+			if u, ok := s.idents.Lookup(s.owner(), p.ID); ok { return s.users.Resolve(u), true, false }
+		}
+	}
+	return 0, false, false
+}
+
+// canSee reports whether the caller may see u's lists: public ones, their
+// own, and followers-only ones of users they follow.
+func (s *server) canSee(r *http.Request, u uint64) (bool, error) { return s.lists(r)(u) }
+
+// lists returns canSee for r's caller, remembering each answer, for
+// handlers that check many users. It is not safe for concurrent use.
+func (s *server) lists(r *http.Request) func(u uint64) (bool, error) {
+	viewer, known, all := s.listViewer(r)
+	seen := make(map[uint64]bool)
+	return func(u uint64) (bool, error) {
+		if all || known && viewer == u { return true, nil }
+		if ok, hit := seen[u]; hit { return ok, nil }
+		var ok bool
+		switch s.users.Privacy(u) {
+		case users.Public:
+			ok = true
+		case users.Followers:
+			if !known { break }
+			var err error
+			if ok, err = s.g.HasEdge(r.Context(), viewer, u); err != nil { return false, err }
+		}
+		seen[u] = ok
+		return ok, nil
+	}
+}
+
+// edgeVisible reports whether see allows the edge u->v: it shows in u's
+// following list and in v's followers, so either being visible suffices.
+func edgeVisible(see func(uint64) (bool, error), u, v uint64) (bool, error) {
+	ok, err := see(u)
+	if ok || err != nil { return ok, err }
+	return see(v)
+}
+
+// mustSee answers 403 unless the caller may see each of ids' lists.
+func (s *server) mustSee(w http.ResponseWriter, r *http.Request, ids ...uint64) bool {
+	see := s.lists(r)
+	for _, u := range ids {
+		ok, err := see(u)
+		if storeError(w, r, err) { return false }
+		if !ok { forbidLists(w); return false }
+	}
+	return true
+}
+
+// mustSeeEdge answers 403 unless the caller may see the edge u->v.
+func (s *server) mustSeeEdge(w http.ResponseWriter, r *http.Request, u, v uint64) bool {
+	ok, err := edgeVisible(s.lists(r), u, v)
+	if storeError(w, r, err) { return false }
+	if !ok { forbidLists(w) }
+	return ok
+}
+
+func forbidLists(w http.ResponseWriter) {
+	http.Error(w, "lists of this user are not visible to you", http.StatusForbidden)
+}
@@ -0,0 +1,104 @@
+package server_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pandharkardeep/social-graph/internal/auth"
+	"github.com/pandharkardeep/social-graph/internal/config"
+	"github.com/pandharkardeep/social-graph/internal/server"
+	"github.com/pandharkardeep/social-graph/internal/tenant"
+	"github.com/pandharkardeep/social-graph/internal/users"
+)
+
+var jwtSecret = []byte("test-secret")
+
+// jwt signs an HS256 token for sub with read scope.
+func jwt(sub string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	body := enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc([]byte(`{"sub":"`+sub+`","scope":"read"}`))
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(body))
+	return body + "." + enc(mac.Sum(nil))
+}
+
+// newPrivacyServer serves a graph where 4's lists are private and 5's
+// are for followers only, which 1 is and 2 is not:
+//
+//	1 <-> 2, 1 -> 5, 3 -> 4, 4 <-> 5
+func newPrivacyServer(t *testing.T) http.Handler {
+	t.Helper()
+	keys, err := auth.ParseKeys("ops:opsopsops:admin,app:appappapp:read")
+	if err != nil { t.Fatal(err) }
+	a, err := auth.New(jwtSecret, keys...)
+	if err != nil { t.Fatal(err) }
+	cfg := config.Defaults()
+	reg := tenant.NewRegistry(cfg.PYMK)
+	tn, err := reg.Create(tenant.Default, nil)
+	if err != nil { t.Fatal(err) }
+	ctx := context.Background()
+	for _, e := range [][2]uint64{{1, 2}, {2, 1}, {1, 5}, {3, 4}, {4, 5}, {5, 4}} {
+		if _, err := tn.G.Follow(ctx, e[0], e[1]); err != nil { t.Fatal(err) }
+	}
+	tn.Users.SetPrivacy(4, users.Private)
+	tn.Users.SetPrivacy(5, users.Followers)
+	tn.Blocks.Block(1, 3)
+	mux := http.NewServeMux()
+	server.AttachRoutes(mux, server.Deps{Tenants: reg, Auth: a, Config: func() *config.Config { return &cfg }})
+	return tenant.Middleware(mux)
+}
+
+func TestListPrivacy(t *testing.T) {
+	h := newPrivacyServer(t)
+	tests := []struct {
+		name   string
+		cred   string // X-API-Key, or a bearer JWT when it holds dots
+		method string
+		path   string
+		body   string
+		want   int
+		has    string // in the response body, when set
+	}{
+		{"public list", "appappapp", "GET", "/following?user_id=1", "", 200, "2"},
+		{"private list, anonymous", "appappapp", "GET", "/following?user_id=4", "", 200, `"hidden":true`},
+		{"private list, owner", jwt("4"), "GET", "/following?user_id=4", "", 200, "5"},
+		{"private list, admin", "opsopsops", "GET", "/followers?user_id=4", "", 200, "3"},
+		{"followers-only list, follower", jwt("1"), "GET", "/following?user_id=5", "", 200, "4"},
+		{"followers-only list, stranger", jwt("2"), "GET", "/following?user_id=5", "", 200, `"hidden":true`},
+		{"mutuals through a private user", "appappapp", "GET", "/mutuals?u=1&v=4", "", 403, ""},
+		{"mutuals of public users", "appappapp", "GET", "/mutuals?u=1&v=2", "", 200, ""},
+		{"friends check of a private user", "appappapp", "GET", "/friends?user_id=4&v=5", "", 403, ""},
+		{"friends check, admin", "opsopsops", "GET", "/friends?user_id=4&v=5", "", 200, `"friends":true`},
+		{"overlap with a private user", "appappapp", "GET", "/overlap?u=1&v=4", "", 403, ""},
+		{"overlap, admin acting for a viewer", "opsopsops", "GET", "/overlap?u=1&v=4&viewer=2", "", 403, ""},
+		{"audience overlap with a private user", jwt("2"), "GET", "/audience_overlap?u=1&v=4", "", 403, ""},
+		{"audience overlap, owner", jwt("4"), "GET", "/audience_overlap?u=2&v=4", "", 200, ""},
+		{"mutual counts, private candidate", jwt("1"), "POST", "/mutual_counts", `{"candidates":[4]}`, 403, ""},
+		{"mutual counts, public candidate", jwt("1"), "POST", "/mutual_counts", `{"candidates":[2]}`, 200, ""},
+		{"mutual counts, no viewer", "appappapp", "POST", "/mutual_counts", `{"candidates":[2]}`, 400, ""},
+		{"edge of two hidden users", jwt("2"), "POST", "/edges/exists", `{"src":4,"dsts":[5]}`, 403, ""},
+		{"someone else's blocks", jwt("2"), "GET", "/blocks?viewer=1", "", 403, ""},
+		{"own blocks", jwt("1"), "GET", "/blocks?viewer=1", "", 200, "3"},
+		{"blocks, admin", "opsopsops", "GET", "/blocks?viewer=1", "", 200, "3"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if strings.Count(tc.cred, ".") == 2 {
+				r.Header.Set("Authorization", "Bearer "+tc.cred)
+			} else {
+				r.Header.Set("X-API-Key", tc.cred)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want { t.Fatalf("status %d, want %d: %s", w.Code, tc.want, w.Body) }
+			if tc.has != "" && !strings.Contains(w.Body.String(), tc.has) { t.Fatalf("body %s lacks %s", w.Body, tc.has) }
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/query"
+)
+
+// postQuery runs an ad-hoc traversal plan (see package query) for
+// questions no endpoint answers yet. Start IDs may be merged-away ones;
+// the result holds only active users.
+//
+// POST /query {"start":[1],"steps":[{"traverse":"following"},...],"limit":50}
+func (s *server) postQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var p query.Plan
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	p, err := query.Compile(p)
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	for i, u := range p.Start { p.Start[i] = s.users.Resolve(u) }
+	res, err := query.Run(r.Context(), s.g, p, query.Env{Subject: s.subject, Visible: s.users.Visible, Lists: s.lists(r), Now: time.Now()})
+	if storeError(w, r, err) { return }
+	writeJSON(w, res)
+}
+
+func (s *server) subject(u uint64) attrs.Subject {
+	a, _ := s.attrs.Get(u)
+	return attrs.Subject{Attrs: a, Status: string(s.users.Get(u))}
+}
+
+// postCypher runs a read-only openCypher query (see query.ParseCypher) as
+// a /query plan under the same budgets, answering in columns and rows.
+//
+// POST /cypher {"query":"MATCH (a {id: 1})-[:FOLLOWS]->(b) RETURN b LIMIT 10"}
+func (s *server) postCypher(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		Query       string `json:"query"`
+		MaxVisits   int    `json:"max_visits"`
+		MaxFrontier int    `json:"max_frontier"`
+		TimeoutMS   int    `json:"timeout_ms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	p, ret, err := query.ParseCypher(body.Query)
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	p.MaxVisits, p.MaxFrontier, p.TimeoutMS = body.MaxVisits, body.MaxFrontier, body.TimeoutMS
+	if p, err = query.Compile(p); err != nil { http.Error(w, err.Error(), 400); return }
+	for i, u := range p.Start { p.Start[i] = s.users.Resolve(u) }
+	res, err := query.Run(r.Context(), s.g, p, query.Env{Subject: s.subject, Visible: s.users.Visible, Lists: s.lists(r), Now: time.Now()})
+	if storeError(w, r, err) { return }
+	rows := [][]any{{res.Count}}
+	if !ret.Count {
+		rows = make([][]any, len(res.UserIDs))
+		for i, u := range res.UserIDs { rows[i] = []any{u} }
+	}
+	writeJSON(w, map[string]any{"columns": []string{ret.Column}, "rows": rows, "visits": res.Visits, "partial": res.Partial, "reason": res.Reason})
+}
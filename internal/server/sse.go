@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// How often /pymk/stream checks the user's epoch, and sends a comment so
+// proxies keep an idle stream open.
+const (
+	streamPoll      = time.Second
+	streamHeartbeat = 15 * time.Second
+)
+
+// getPYMKStream holds a server-sent events stream that announces when
+// fresher suggestions are available for the user, so an app can refresh
+// its PYMK module instead of polling /pymk. Each announcement is
+//
+//	event: refresh
+//	data: {"user_id":1,"reason":"epoch","epoch":7}
+//
+// reason is epoch (the user's own edges changed, seen by polling the
+// epoch, so writes arriving through replication count too), precomputed
+// (hot-key warming cached a new result) or invalidated (a mutual's edges
+// changed). Announcements coalesce; the client should refetch /pymk.
+//
+// GET /pymk/stream?user_id=
+func (s *server) getPYMKStream(w http.ResponseWriter, r *http.Request) {
+	u, err := s.parseID(r.URL.Query().Get("user_id"))
+	if err != nil { http.Error(w, "bad user_id", 400); return }
+	epoch, err := s.g.UserEpoch(r.Context(), u)
+	if storeError(w, r, err) { return }
+	notes, stop := s.refresh.Watch(u)
+	defer stop()
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{}) // outlives the server's write timeout
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	send := func(format string, args ...any) bool {
+		if _, err := fmt.Fprintf(w, format, args...); err != nil { return false }
+		return rc.Flush() == nil
+	}
+	if !send("retry: 5000\n: watching %d\n\n", u) { return }
+
+	poll, beat := time.NewTicker(streamPoll), time.NewTicker(streamHeartbeat)
+	defer poll.Stop()
+	defer beat.Stop()
+	refresh := func(reason string) bool {
+		// Read on so the poll doesn't announce a change already announced.
+		if e, err := s.g.UserEpoch(r.Context(), u); err == nil { epoch = e }
+		b, _ := json.Marshal(map[string]any{"user_id": u, "reason": reason, "epoch": epoch})
+		return send("event: refresh\ndata: %s\n\n", b)
+	}
+	for {
+		var ok bool
+		select {
+		case <-r.Context().Done():
+			return
+		case reason := <-notes:
+			ok = refresh(reason)
+		case <-poll.C:
+			e, err := s.g.UserEpoch(r.Context(), u)
+			if err != nil || e == epoch { continue }
+			ok = refresh("epoch")
+		case <-beat.C:
+			ok = send(": ping\n\n")
+		}
+		if !ok { return }
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandharkardeep/social-graph/internal/topics"
+)
+
+const (
+	topicFollowersMax = 10_000 // followers /topics/followers lists
+	topicSuggestMax   = 100
+)
+
+func (s *server) postTopicFollow(w http.ResponseWriter, r *http.Request) {
+	s.postTopicEdge(w, r, topics.View.Follow)
+}
+
+func (s *server) postTopicUnfollow(w http.ResponseWriter, r *http.Request) {
+	s.postTopicEdge(w, r, topics.View.Unfollow)
+}
+
+// postTopicEdge applies a topic follow or unfollow and bumps the user's
+// epoch, so their cached suggestions are recomputed with it.
+func (s *server) postTopicEdge(w http.ResponseWriter, r *http.Request, do func(topics.View, uint64, string) (bool, error)) {
+	if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+	var body struct {
+		UserID uint64 `json:"user_id"`
+		Topic  string `json:"topic"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
+	u := s.users.Resolve(body.UserID)
+	changed, err := do(s.topics, u, body.Topic)
+	if errors.Is(err, topics.ErrBadName) || errors.Is(err, topics.ErrTooMany) { http.Error(w, err.Error(), 400); return }
+	if err != nil {
+		slog.ErrorContext(r.Context(), "topics write failed", "err", err)
+		http.Error(w, "internal error", 500); return
+	}
+	if changed && storeError(w, r, s.g.TouchUsers(r.Context(), u)) { return }
+	writeJSON(w, map[string]any{"ok": true, "changed": changed})
+}
+
+// getTopicsFollowing lists the topics a user follows.
+func (s *server) getTopicsFollowing(w http.ResponseWriter, r *http.Request) {
+	u, err := s.parseID(r.URL.Query().Get("user_id"))
+	if err != nil { http.Error(w, "bad user_id", 400); return }
+	writeJSON(w, map[string]any{"user_id": u, "topics": s.topics.Of(u)})
+}
+
+// getTopicFollowers counts a topic's followers and lists up to ?limit=
+// (default 100) of them, in no particular order.
+func (s *server) getTopicFollowers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	t, err := topics.Normalize(q.Get("topic"))
+	if err != nil { http.Error(w, err.Error(), 400); return }
+	limit := 100
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		x, err := strconv.Atoi(v)
+		if err != nil || x <= 0 || x > topicFollowersMax { http.Error(w, "bad limit", 400); return }
+		limit = x
+	}
+	writeJSON(w, map[string]any{"topic": t, "count": s.topics.Count(t), "user_ids": s.topics.Followers(t, limit)})
+}
+
+// getTopicSuggestions recommends up to ?k= (default 10) topics for a user
+// to follow; see pymk.SuggestTopics.
+func (s *server) getTopicSuggestions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	u, err := s.parseID(q.Get("user_id"))
+	if err != nil { http.Error(w, "bad user_id", 400); return }
+	k := 10
+	if v := strings.TrimSpace(q.Get("k")); v != "" {
+		x, err := strconv.Atoi(v)
+		if err != nil || x <= 0 || x > topicSuggestMax { http.Error(w, "bad k", 400); return }
+		k = x
+	}
+	res, err := s.svc.SuggestTopics(r.Context(), u, k)
+	if storeError(w, r, err) { return }
+	writeJSON(w, res)
+}
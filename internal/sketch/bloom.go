@@ -0,0 +1,48 @@
+package sketch
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Bloom is a fixed-size Bloom filter over user IDs. Both probe positions
+// come from one mixed hash (Kirsch–Mitzenmacher double hashing).
+type Bloom struct {
+	bits []uint64
+	m    uint64 // bit count, a power of two
+	k    int
+}
+
+// NewBloom sizes a filter for n items at false-positive rate p.
+func NewBloom(n int, p float64) *Bloom {
+	if n < 1 { n = 1 }
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = 1 << (64 - bits.LeadingZeros64(m-1)) // round up to a power of two for masking
+	if m < 64 { m = 64 }
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	k = max(1, min(k, 16))
+	return &Bloom{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+func (b *Bloom) Add(x uint64) {
+	h := Hash(x)
+	h1, h2 := h, h>>32|h<<32|1
+	for i := 0; i < b.k; i++ {
+		j := (h1 + uint64(i)*h2) & (b.m - 1)
+		b.bits[j>>6] |= 1 << (j & 63)
+	}
+}
+
+// MayContain is false only if x was never added.
+func (b *Bloom) MayContain(x uint64) bool {
+	h := Hash(x)
+	h1, h2 := h, h>>32|h<<32|1
+	for i := 0; i < b.k; i++ {
+		j := (h1 + uint64(i)*h2) & (b.m - 1)
+		if b.bits[j>>6]&(1<<(j&63)) == 0 { return false }
+	}
+	return true
+}
+
+// Reset empties the filter, keeping its size.
+func (b *Bloom) Reset() { clear(b.bits) }
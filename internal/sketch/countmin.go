@@ -0,0 +1,121 @@
+package sketch
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// -------- Count-min sketch --------
+
+type CountMin struct {
+	w    uint64
+	rows [][]uint32
+}
+
+// NewCountMin sizes the sketch as depth rows of width counters; error is
+// about 2/width of the total count with probability 1-2^-depth.
+func NewCountMin(width, depth int) *CountMin {
+	c := &CountMin{w: uint64(width), rows: make([][]uint32, depth)}
+	for i := range c.rows { c.rows[i] = make([]uint32, width) }
+	return c
+}
+
+func (c *CountMin) index(row int, x uint64) uint64 {
+	return Hash(x^uint64(row)*0x9e3779b97f4a7c15) % c.w
+}
+
+// Add increments x and returns its new estimate.
+func (c *CountMin) Add(x uint64, n uint32) uint32 {
+	est := ^uint32(0)
+	for i, r := range c.rows {
+		j := c.index(i, x)
+		r[j] += n
+		est = min(est, r[j])
+	}
+	return est
+}
+
+func (c *CountMin) Estimate(x uint64) uint32 {
+	est := ^uint32(0)
+	for i, r := range c.rows { est = min(est, r[c.index(i, x)]) }
+	return est
+}
+
+// Halve ages every counter, turning totals into an exponentially decaying
+// window.
+func (c *CountMin) Halve() {
+	for _, r := range c.rows {
+		for j := range r { r[j] >>= 1 }
+	}
+}
+
+// -------- Heavy hitters --------
+
+type Hit struct {
+	User  uint64 `json:"user_id"`
+	Count uint32 `json:"count"`
+}
+
+// HeavyHitters tracks the k most frequent IDs over a window that halves
+// every decay period, using a count-min sketch for the counts.
+type HeavyHitters struct {
+	mu    sync.Mutex
+	k     int
+	decay time.Duration
+	last  time.Time
+	cms   *CountMin
+	top   map[uint64]uint32 // candidate -> last estimate
+}
+
+func NewHeavyHitters(k int, decay time.Duration) *HeavyHitters {
+	return &HeavyHitters{k: k, decay: decay, last: time.Now(), cms: NewCountMin(2048, 4), top: make(map[uint64]uint32, k+1)}
+}
+
+func (h *HeavyHitters) Observe(x uint64) {
+	h.mu.Lock(); defer h.mu.Unlock()
+	if h.decay > 0 && time.Since(h.last) >= h.decay {
+		h.cms.Halve()
+		for u, c := range h.top { h.top[u] = c >> 1 }
+		h.last = time.Now()
+	}
+	est := h.cms.Add(x, 1)
+	if _, ok := h.top[x]; ok || len(h.top) < h.k {
+		h.top[x] = est
+		return
+	}
+	// Replace the weakest candidate if x now beats it. k is small, so a
+	// linear scan is cheaper than maintaining a heap.
+	var minU uint64
+	minC := ^uint32(0)
+	for u, c := range h.top {
+		if c < minC { minU, minC = u, c }
+	}
+	if est > minC {
+		delete(h.top, minU)
+		h.top[x] = est
+	}
+}
+
+// Count returns x's estimated count if it is among the tracked IDs.
+func (h *HeavyHitters) Count(x uint64) (uint32, bool) {
+	h.mu.Lock(); defer h.mu.Unlock()
+	c, ok := h.top[x]
+	return c, ok
+}
+
+// Top returns up to n tracked IDs, most frequent first.
+func (h *HeavyHitters) Top(n int) []Hit {
+	h.mu.Lock()
+	out := make([]Hit, 0, len(h.top))
+	for u, c := range h.top {
+		if c > 0 { out = append(out, Hit{User: u, Count: c}) }
+	}
+	h.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count { return out[i].Count > out[j].Count }
+		return out[i].User < out[j].User
+	})
+	if n > 0 && n < len(out) { out = out[:n] }
+	return out
+}
@@ -0,0 +1,56 @@
+// Package sketch holds small probabilistic summaries of user-ID sets, for
+// answering size and overlap questions without materializing the sets.
+package sketch
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Hash mixes a user ID (splitmix64 finalizer) so sequential IDs spread
+// over the whole 64-bit range.
+func Hash(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// -------- HyperLogLog --------
+// Precision 14: 16 KiB of registers, ~0.8% standard error.
+const (
+	hllP = 14
+	hllM = 1 << hllP
+)
+
+type HLL struct{ reg [hllM]uint8 }
+
+func NewHLL() *HLL { return &HLL{} }
+
+func (h *HLL) Add(x uint64) {
+	v := Hash(x)
+	i := v >> (64 - hllP)
+	rho := uint8(bits.LeadingZeros64(v<<hllP|1<<(hllP-1))) + 1
+	if rho > h.reg[i] { h.reg[i] = rho }
+}
+
+// Merge folds o into h; h then estimates the union.
+func (h *HLL) Merge(o *HLL) {
+	for i, r := range o.reg {
+		if r > h.reg[i] { h.reg[i] = r }
+	}
+}
+
+func (h *HLL) Count() uint64 {
+	sum, zeros := 0.0, 0
+	for _, r := range h.reg {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 { zeros++ }
+	}
+	m := float64(hllM)
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros)) // linear counting for small sets
+	}
+	return uint64(est + 0.5)
+}
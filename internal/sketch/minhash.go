@@ -0,0 +1,74 @@
+package sketch
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// MinHash is a bottom-k sketch: the k smallest distinct hashes seen. It
+// estimates Jaccard similarity between sets and, on its own, cardinality.
+type MinHash struct {
+	k    int
+	h    maxHeap
+	seen map[uint64]struct{}
+}
+
+func NewMinHash(k int) *MinHash {
+	return &MinHash{k: k, seen: make(map[uint64]struct{}, k)}
+}
+
+func (m *MinHash) Add(x uint64) { m.addHash(Hash(x)) }
+
+func (m *MinHash) addHash(v uint64) {
+	if _, ok := m.seen[v]; ok { return }
+	if len(m.h) < m.k {
+		heap.Push(&m.h, v)
+		m.seen[v] = struct{}{}
+		return
+	}
+	if v >= m.h[0] { return }
+	delete(m.seen, m.h[0])
+	m.h[0] = v
+	heap.Fix(&m.h, 0)
+	m.seen[v] = struct{}{}
+}
+
+// Count estimates the number of distinct elements added.
+func (m *MinHash) Count() uint64 {
+	if len(m.h) < m.k { return uint64(len(m.h)) }
+	kth := float64(m.h[0]) / math.MaxUint64
+	return uint64(float64(m.k-1)/kth + 0.5)
+}
+
+// Jaccard estimates |A∩B| / |A∪B| from the k smallest hashes of the union.
+func (m *MinHash) Jaccard(o *MinHash) float64 {
+	all := make([]uint64, 0, len(m.h)+len(o.h))
+	all = append(all, m.h...)
+	for _, v := range o.h {
+		if _, ok := m.seen[v]; !ok { all = append(all, v) }
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	k := min(m.k, len(all))
+	if k == 0 { return 0 }
+	both := 0
+	for _, v := range all[:k] {
+		_, a := m.seen[v]
+		_, b := o.seen[v]
+		if a && b { both++ }
+	}
+	return float64(both) / float64(k)
+}
+
+type maxHeap []uint64
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,261 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/journal"
+)
+
+// A tenant's snapshot is a chain: the full snapshot <tenant>.sgs, then
+// delta files <tenant>.<n>.sgd, each holding the journal's follows and
+// unfollows for the tenant since the one before. <tenant>.chain lists
+// them. Replaying a delta over a full snapshot taken while its first
+// events were being applied is harmless: the last event for each edge
+// decides its state either way.
+//
+// Delta format: magic "SGD1", uvarint(from) uvarint(to) uvarint(count),
+// count records of op(1 byte: 1 follow, 0 unfollow) uvarint(src)
+// uvarint(dst), then the crc32c of everything after the magic, 4 bytes
+// little endian.
+var deltaMagic = [4]byte{'S', 'G', 'D', '1'}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var ErrCorruptDelta = errors.New("snapshot: corrupt delta")
+
+// chain is the <tenant>.chain manifest. Seq is the journal's head when the
+// full snapshot was started and Through the last seq the chain covers;
+// deltas lie in between, in order. Ranges without events for the tenant
+// get no file.
+type chain struct {
+	Seq     uint64      `json:"seq"`
+	Through uint64      `json:"through"`
+	Deltas  []deltaFile `json:"deltas"`
+}
+
+type deltaFile struct {
+	File   string `json:"file"`
+	From   uint64 `json:"from"` // journal seqs covered, inclusive
+	To     uint64 `json:"to"`
+	Events int    `json:"events"`
+}
+
+func chainPath(dir, tenant string) string { return filepath.Join(dir, tenant+".chain") }
+
+// Result says what Writer.Write wrote.
+type Result struct {
+	Kind   string // full | delta | none (nothing changed since the last one)
+	Path   string
+	Bytes  int64
+	Events int // delta: mutations recorded
+}
+
+// Writer writes each tenant's snapshot chain in dir: a full snapshot
+// first, whenever the journal no longer holds the events since the last
+// one, and after the graph was replaced (a journaled "replace"), then
+// deltas until maxDeltas of them are chained. A nil
+// journal, or maxDeltas 0, writes full snapshots only. The journal
+// numbers events per process, so a new process starts with a full one.
+type Writer struct {
+	dir       string
+	j         *journal.Journal
+	maxDeltas int
+
+	mu     sync.Mutex
+	chains map[string]*chain // written by this process
+}
+
+func NewWriter(dir string, j *journal.Journal, maxDeltas int) *Writer {
+	return &Writer{dir: dir, j: j, maxDeltas: maxDeltas, chains: make(map[string]*chain)}
+}
+
+// Write extends tenant's chain with a delta, or starts a new one with a
+// full snapshot of g.
+func (w *Writer) Write(tenant string, g *graph.MemGraph) (Result, error) {
+	w.mu.Lock(); defer w.mu.Unlock()
+	c := w.chains[tenant]
+	if w.j != nil && w.maxDeltas > 0 && c != nil && len(c.Deltas) < w.maxDeltas {
+		from, to := c.Through+1, w.j.Head()
+		if to < from { return Result{Kind: "none"}, nil }
+		if evs, ok := w.j.Since(from, int(to-from+1)); ok && !replaced(evs, tenant, to) {
+			return w.writeDelta(tenant, c, from, to, evs)
+		}
+	}
+	return w.writeFull(tenant, g)
+}
+
+// replaced reports whether evs replace tenant's graph by seq to.
+func replaced(evs []journal.Event, tenant string, to uint64) bool {
+	for _, e := range evs {
+		if e.Tenant == tenant && e.Seq <= to && e.Op == "replace" { return true }
+	}
+	return false
+}
+
+func (w *Writer) writeFull(tenant string, g *graph.MemGraph) (Result, error) {
+	var seq uint64
+	if w.j != nil { seq = w.j.Head() } // before the snapshot starts: replay covers anything it misses
+	if err := os.MkdirAll(w.dir, 0o755); err != nil { return Result{}, err }
+	// Until the new manifest is in place, restore uses the full
+	// snapshot alone: older, but never mixed with deltas of another.
+	if err := os.Remove(chainPath(w.dir, tenant)); err != nil && !errors.Is(err, os.ErrNotExist) { return Result{}, err }
+	size, err := Write(w.dir, tenant, g)
+	if err != nil { return Result{}, err }
+	c := &chain{Seq: seq, Through: seq}
+	if err := writeChain(w.dir, tenant, c); err != nil { return Result{}, err }
+	removeDeltas(w.dir, tenant)
+	w.chains[tenant] = c
+	return Result{Kind: "full", Path: Path(w.dir, tenant), Bytes: size}, nil
+}
+
+func (w *Writer) writeDelta(tenant string, c *chain, from, to uint64, evs []journal.Event) (Result, error) {
+	var mine []journal.Event
+	for _, e := range evs {
+		if e.Tenant == tenant && e.Seq <= to { mine = append(mine, e) }
+	}
+	next := chain{Seq: c.Seq, Through: to, Deltas: c.Deltas}
+	if len(mine) == 0 {
+		if err := writeChain(w.dir, tenant, &next); err != nil { return Result{}, err }
+		*c = next
+		return Result{Kind: "none"}, nil
+	}
+	d := deltaFile{File: fmt.Sprintf("%s.%06d.sgd", tenant, len(c.Deltas)+1), From: from, To: to, Events: len(mine)}
+	var buf bytes.Buffer
+	buf.Write(deltaMagic[:])
+	var tmp [binary.MaxVarintLen64]byte
+	put := func(x uint64) { buf.Write(tmp[:binary.PutUvarint(tmp[:], x)]) }
+	put(from); put(to); put(uint64(len(mine)))
+	for _, e := range mine {
+		op := byte(0)
+		if e.Op == "follow" { op = 1 }
+		buf.WriteByte(op)
+		put(e.Src); put(e.Dst)
+	}
+	binary.LittleEndian.PutUint32(tmp[:4], crc32.Checksum(buf.Bytes()[len(deltaMagic):], crcTable))
+	buf.Write(tmp[:4])
+	path := filepath.Join(w.dir, d.File)
+	if err := writeAtomic(path, buf.Bytes()); err != nil { return Result{}, err }
+	next.Deltas = append(append([]deltaFile(nil), c.Deltas...), d)
+	if err := writeChain(w.dir, tenant, &next); err != nil { return Result{}, err }
+	*c = next
+	return Result{Kind: "delta", Path: path, Bytes: int64(buf.Len()), Events: len(mine)}, nil
+}
+
+func writeChain(dir, tenant string, c *chain) error {
+	b, err := json.Marshal(c)
+	if err != nil { return err }
+	return writeAtomic(chainPath(dir, tenant), b)
+}
+
+// writeAtomic replaces path with data through a synced temporary file.
+func writeAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil { return err }
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil { f.Close(); return err }
+	if err := f.Sync(); err != nil { f.Close(); return err }
+	if err := f.Close(); err != nil { return err }
+	return os.Rename(f.Name(), path)
+}
+
+func removeDeltas(dir, tenant string) {
+	old, _ := filepath.Glob(filepath.Join(dir, tenant+".*.sgd"))
+	for _, p := range old { os.Remove(p) }
+}
+
+type deltaEvent struct {
+	follow   bool
+	src, dst uint64
+}
+
+func readDelta(path string, want deltaFile) ([]deltaEvent, error) {
+	bad := func(what string) error { return fmt.Errorf("%w: %s: %s", ErrCorruptDelta, filepath.Base(path), what) }
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) { return nil, bad("missing") }
+	if err != nil { return nil, err }
+	if len(data) < len(deltaMagic)+4 || !bytes.Equal(data[:4], deltaMagic[:]) { return nil, bad("not a delta") }
+	body, sum := data[4:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, crcTable) != sum { return nil, bad("checksum mismatch") }
+	r := bufio.NewReader(bytes.NewReader(body))
+	var hdr [3]uint64 // from, to, count
+	for i := range hdr {
+		if hdr[i], err = binary.ReadUvarint(r); err != nil { return nil, bad("truncated") }
+	}
+	if hdr[0] != want.From || hdr[1] != want.To || hdr[2] != uint64(want.Events) { return nil, bad("does not match the chain") }
+	evs := make([]deltaEvent, 0, hdr[2])
+	for i := uint64(0); i < hdr[2]; i++ {
+		op, err := r.ReadByte()
+		if err != nil { return nil, bad("truncated") }
+		var e deltaEvent
+		e.follow = op == 1
+		if e.src, err = binary.ReadUvarint(r); err != nil { return nil, bad("truncated") }
+		if e.dst, err = binary.ReadUvarint(r); err != nil { return nil, bad("truncated") }
+		evs = append(evs, e)
+	}
+	if _, err := r.ReadByte(); err != io.EOF { return nil, bad("data after the last event") }
+	return evs, nil
+}
+
+// Restored says what Restore loaded.
+type Restored struct {
+	Deltas int
+	Events int
+}
+
+// Restore loads tenant's chain from dir into g: the full snapshot, then
+// every delta in order. All files are verified before g is touched; a
+// missing, corrupt or out-of-order one fails the restore. It returns
+// os.ErrNotExist when tenant has no snapshot.
+func Restore(dir, tenant string, g *graph.MemGraph) (Restored, error) {
+	var c chain
+	b, err := os.ReadFile(chainPath(dir, tenant))
+	chained := err == nil
+	switch {
+	case errors.Is(err, os.ErrNotExist): // a full snapshot alone
+	case err != nil:
+		return Restored{}, err
+	default:
+		if err := json.Unmarshal(b, &c); err != nil { return Restored{}, fmt.Errorf("snapshot: %s: %w", chainPath(dir, tenant), err) }
+	}
+	covered := c.Seq
+	var events [][]deltaEvent
+	res := Restored{Deltas: len(c.Deltas)}
+	for i, d := range c.Deltas {
+		if d.From <= covered || d.To < d.From || d.To > c.Through {
+			return Restored{}, fmt.Errorf("%w: %s: out of order in the chain (delta %d)", ErrCorruptDelta, d.File, i+1)
+		}
+		covered = d.To
+		evs, err := readDelta(filepath.Join(dir, d.File), d)
+		if err != nil { return Restored{}, err }
+		events = append(events, evs)
+		res.Events += len(evs)
+	}
+	f, err := os.Open(Path(dir, tenant))
+	if chained && errors.Is(err, os.ErrNotExist) { return Restored{}, fmt.Errorf("snapshot: %s is missing", Path(dir, tenant)) }
+	if err != nil { return Restored{}, err }
+	defer f.Close()
+	if err := g.ReadSnapshot(f); err != nil { return Restored{}, fmt.Errorf("%s: %w", f.Name(), err) }
+	ctx := context.Background()
+	for _, evs := range events {
+		for _, e := range evs {
+			if e.follow {
+				g.Follow(ctx, e.src, e.dst)
+			} else {
+				g.Unfollow(ctx, e.src, e.dst)
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// -------- Double-buffered bulk load --------
+// A full re-import is built into a staging graph beside the live one,
+// which keeps serving reads and writes untouched, and then swapped in
+// whole (graph.MemGraph.Replace). Writes made to the live graph while a
+// load is staged are lost at the swap. Staging holds a second copy of
+// the graph in memory until it is committed or aborted.
+
+var (
+	ErrLoadInProgress = errors.New("tenant: a bulk load is already staged")
+	ErrNoLoad         = errors.New("tenant: no bulk load staged")
+)
+
+// Load is a staged bulk load.
+type Load struct {
+	G       *graph.MemGraph
+	Started time.Time
+	Added   atomic.Int64 // edges new to G
+
+	mu      sync.RWMutex // held for reading by Add, for writing to end the load
+	done    bool
+	workers int // see Registry.LoadWorkers
+}
+
+// Add stages edges, returning how many were new. Each batch is written
+// shard-parallel (graph.MemGraph.LoadEdges). It fails with ErrNoLoad once
+// the load is committed or aborted: G's maps may be live by then.
+func (l *Load) Add(ctx context.Context, edges [][2]uint64) (int, error) {
+	l.mu.RLock(); defer l.mu.RUnlock()
+	if l.done { return 0, ErrNoLoad }
+	if err := ctx.Err(); err != nil { return 0, err }
+	added, err := l.G.LoadEdges(edges, l.workers)
+	l.Added.Add(int64(added))
+	return added, err
+}
+
+// end waits out in-flight Adds and refuses later ones.
+func (l *Load) end() {
+	l.mu.Lock(); defer l.mu.Unlock()
+	l.done = true
+}
+
+// LoadWorkers is how many goroutines write an import batch at once.
+func (t *Tenant) LoadWorkers() int { return t.loadWorkers }
+
+// BeginLoad starts staging an empty graph with the live one's shard count.
+func (t *Tenant) BeginLoad() (*Load, error) {
+	l := &Load{G: graph.NewMemGraphShards(t.Local.Shards()), Started: time.Now(), workers: t.loadWorkers}
+	if !t.load.CompareAndSwap(nil, l) { return nil, ErrLoadInProgress }
+	return l, nil
+}
+
+// Staged returns the staged load, or nil.
+func (t *Tenant) Staged() *Load { return t.load.Load() }
+
+// AbortLoad drops the staged load, reporting whether there was one.
+func (t *Tenant) AbortLoad() bool {
+	l := t.load.Swap(nil)
+	if l == nil { return false }
+	l.end()
+	return true
+}
+
+// OnReplace adds f to the hooks CommitLoad runs once the staged graph is
+// live, for wrappers that must tell their consumers (the journal). Call it
+// from a WrapFunc.
+func (t *Tenant) OnReplace(f func()) { t.replaced = append(t.replaced, f) }
+
+// CommitLoad swaps the staged graph in for the live one and returns it.
+// Every user of either graph has its epoch bumped, so cached suggestions
+// are recomputed; dense IDs are assigned to the new users first. The
+// OnReplace hooks run after the swap.
+func (t *Tenant) CommitLoad() (*Load, error) {
+	l := t.load.Swap(nil)
+	if l == nil { return nil, ErrNoLoad }
+	l.end()
+	if t.IDs != nil {
+		if err := t.IDs.AssignAll(l.G.EachEdge); err != nil { return nil, err }
+	}
+	if err := t.Local.Replace(l.G); err != nil { return nil, err }
+	for _, f := range t.replaced { f() }
+	return l, nil
+}
@@ -0,0 +1,491 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandharkardeep/social-graph/internal/attrs"
+	"github.com/pandharkardeep/social-graph/internal/block"
+	"github.com/pandharkardeep/social-graph/internal/community"
+	"github.com/pandharkardeep/social-graph/internal/embeds"
+	"github.com/pandharkardeep/social-graph/internal/flags"
+	"github.com/pandharkardeep/social-graph/internal/graph"
+	"github.com/pandharkardeep/social-graph/internal/idmap"
+	"github.com/pandharkardeep/social-graph/internal/metrics"
+	"github.com/pandharkardeep/social-graph/internal/pymk"
+	"github.com/pandharkardeep/social-graph/internal/sketch"
+	"github.com/pandharkardeep/social-graph/internal/topics"
+	"github.com/pandharkardeep/social-graph/internal/users"
+)
+
+const (
+	Default = "default"
+	Header  = "X-Tenant"
+	prefix  = "/t/"
+
+	GraphHeader = "X-Graph"
+	graphPrefix = "/g/"
+	graphSep    = ":" // between a tenant and a graph in registry keys
+)
+
+var (
+	ErrUnknown = errors.New("unknown tenant")
+	ErrBadName = errors.New("bad tenant name")
+	ErrExists  = errors.New("graph already exists")
+	ErrMain    = errors.New("a tenant's main graph cannot be dropped")
+
+	validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// Tenant is one isolated namespace: its own graph, embeddings and PYMK
+// service (and therefore its own cache).
+//
+// A tenant can also have named graphs, one per relationship type (see
+// Key): each is registered as a Tenant of its own, with its own Store,
+// rankings and PYMK service, sharing the users, attributes, blocks and
+// embeddings of its tenant's main graph.
+type Tenant struct {
+	Name    string // the registry key: "<tenant>" or "<tenant>:<graph>"
+	Graph   string // the named graph; "" for the tenant's main graph
+	Local   *graph.MemGraph // this node's storage, beneath any wrappers
+	G       graph.Store
+	E       embeds.Store
+	Svc     *pymk.Service
+	Top     *graph.Top // node-local: in cluster mode only this node's users
+	Blocks  *block.Store
+	Users   *users.Store
+	Attrs   *attrs.Store
+	Topics  topics.View
+	Weights *graph.Weights // interaction weights; node-local like Sources
+	Times   *graph.FollowTimes // when follows made through this node were made
+	Hot     *sketch.HeavyHitters // most-queried users; nil when not tracked
+	Churn   *Churn               // users whose epochs change most; nil when not tracked
+	// Where follows made through this node came from; node-local like Top.
+	Sources *graph.Sources
+	Refresh *pymk.Notifier // tells /pymk/stream watchers of fresher suggestions, in every profile
+	IDs     *idmap.Mapper  // dense user indices; nil unless idmap is enabled
+
+	pmu      sync.RWMutex
+	profiles map[string]*pymk.Service // named PYMK variants; see SetProfiles
+
+	// Expires is when an ephemeral graph is dropped; zero for the others.
+	Expires time.Time
+
+	communities atomic.Pointer[community.Labels] // latest detection; nil before the first
+	expiry      *time.Timer                      // drops an ephemeral graph
+	frozen      bool                             // see Registry.FrozenReads
+	load        atomic.Pointer[Load]             // the staged bulk load; see bulkload.go
+	replaced    []func()                         // see OnReplace
+	loadWorkers int                              // see Registry.LoadWorkers
+}
+
+// Churn tracks the users whose epochs change most often (see
+// graph.MemGraph.OnTouch) over a window halving every decay period. Their
+// cached suggestions go stale soonest.
+type Churn struct {
+	*sketch.HeavyHitters
+	Min uint32        // changes within the window that make a user hot
+	TTL time.Duration // PYMK cache TTL for hot users; 0 keeps the configured one
+}
+
+// Hot reports whether u's epoch changes often enough to count as hot.
+func (c *Churn) Hot(u uint64) bool {
+	if c == nil { return false }
+	n, ok := c.Count(u)
+	return ok && n >= c.Min
+}
+
+// HotUsers returns the tracked users that are hot, most changed first.
+func (c *Churn) HotUsers() []sketch.Hit {
+	top := c.Top(0)
+	for i, h := range top {
+		if h.Count < c.Min { return top[:i] }
+	}
+	return top
+}
+
+// Profile derives a named PYMK profile's config from a tenant's own.
+type Profile func(base pymk.PYMKConfig) (pymk.PYMKConfig, error)
+
+// WrapFunc lets a deployment mode (cluster, raft, journaling...) put its
+// own view in front of a new tenant's stores by replacing t.G / t.E. It
+// runs before the tenant's PYMK service is built.
+type WrapFunc func(t *Tenant)
+
+type Registry struct {
+	mu         sync.RWMutex
+	tenants    map[string]*Tenant
+	defaults   pymk.PYMKConfig
+	wraps      []WrapFunc
+	drops      []WrapFunc
+	profiles   map[string]Profile
+	AutoCreate bool       // create unknown tenants on first use
+	Shards     int        // of each new tenant's graph; 0 = graph.DefaultShards
+	// FrozenReads has PYMK expand neighbors from the graph's frozen views
+	// (see graph.FrozenReads); the caller freezes Local periodically.
+	FrozenReads bool
+	// LoadWorkers is how many goroutines write each staged bulk load batch
+	// (and /edges/import batch) shard-parallel; 0 = GOMAXPROCS.
+	LoadWorkers int
+	Graphs     []string   // named graphs created with every tenant
+	Flags      *flags.Set // feature rollouts shared by every tenant's PYMK
+	Topics     *topics.Store // user→topic follows of every tenant; nil = none
+}
+
+// Use appends a wrapper applied, in registration order, to tenants
+// created afterwards.
+func (r *Registry) Use(w WrapFunc) {
+	r.mu.Lock(); defer r.mu.Unlock()
+	r.wraps = append(r.wraps, w)
+}
+
+// OnDrop appends a hook run, in registration order, on each graph
+// dropped, to release what the wrappers gave it.
+func (r *Registry) OnDrop(f WrapFunc) {
+	r.mu.Lock(); defer r.mu.Unlock()
+	r.drops = append(r.drops, f)
+}
+
+func NewRegistry(defaults pymk.PYMKConfig) *Registry {
+	return &Registry{tenants: make(map[string]*Tenant), defaults: defaults}
+}
+
+// SetDefaults changes the PYMK config given to tenants created later.
+func (r *Registry) SetDefaults(p pymk.PYMKConfig) {
+	r.mu.Lock(); defer r.mu.Unlock()
+	r.defaults = p
+}
+
+// SetProfiles changes the PYMK profiles given to tenants created later.
+func (r *Registry) SetProfiles(ps map[string]Profile) {
+	r.mu.Lock(); defer r.mu.Unlock()
+	r.profiles = ps
+}
+
+func ValidName(name string) bool { return validName.MatchString(name) }
+
+// Key is the registry key of a tenant's graph: the tenant's own name for
+// its main graph ("" or Default), "<tenant>:<graph>" for a named one.
+func Key(tenant, graph string) string {
+	if graph == "" || graph == Default { return tenant }
+	return tenant + graphSep + graph
+}
+
+// Split is the inverse of Key; graph is "" for a main graph.
+func Split(key string) (tenant, graph string) {
+	tenant, graph, _ = strings.Cut(key, graphSep)
+	return tenant, graph
+}
+
+// Create registers a tenant with cfg (or the registry defaults when cfg is
+// nil), along with its Graphs. An existing tenant is returned unchanged.
+// Given a Key naming a graph, it creates that graph, and its tenant if
+// need be; a nil cfg then means the tenant's config.
+func (r *Registry) Create(name string, cfg *pymk.PYMKConfig) (*Tenant, error) {
+	r.mu.Lock(); defer r.mu.Unlock()
+	tn, g := Split(name)
+	if !ValidName(tn) || (g != "" && !ValidName(g)) { return nil, ErrBadName }
+	if g == "" { return r.create(tn, cfg) }
+	p, err := r.create(tn, nil)
+	if err != nil { return nil, err }
+	return r.createGraph(p, g, cfg)
+}
+
+func (r *Registry) create(name string, cfg *pymk.PYMKConfig) (*Tenant, error) {
+	if t, ok := r.tenants[name]; ok { return t, nil }
+	c := r.defaults
+	if cfg != nil { c = *cfg }
+	t := &Tenant{Name: name, Blocks: block.New(), Users: users.New(), Attrs: attrs.New()}
+	if err := r.build(t, c, nil); err != nil { return nil, err }
+	for _, g := range r.Graphs {
+		if _, err := r.createGraph(t, g, nil); err != nil { return nil, fmt.Errorf("graph %s: %w", g, err) }
+	}
+	return t, nil
+}
+
+// CreateEphemeral creates a named graph, given by its Key, that Drop
+// removes after ttl. Unlike Create it fails with ErrExists if the graph
+// exists; its tenant must exist too.
+func (r *Registry) CreateEphemeral(key string, cfg *pymk.PYMKConfig, ttl time.Duration) (*Tenant, error) {
+	tn, g := Split(key)
+	if g == "" || !ValidName(g) { return nil, ErrBadName }
+	r.mu.Lock(); defer r.mu.Unlock()
+	p, ok := r.tenants[tn]
+	if !ok { return nil, ErrUnknown }
+	if _, ok := r.tenants[key]; ok { return nil, ErrExists }
+	t, err := r.createGraph(p, g, cfg)
+	if err != nil { return nil, err }
+	t.Expires = time.Now().Add(ttl)
+	t.expiry = time.AfterFunc(ttl, func() {
+		if err := r.drop(t); err != nil { return }
+		slog.Info("ephemeral graph expired", "tenant", tn, "graph", g)
+	})
+	return t, nil
+}
+
+// Ephemeral reports whether t is dropped at Expires.
+func (t *Tenant) Ephemeral() bool { return !t.Expires.IsZero() }
+
+// Drop removes a named graph, given by its Key, and runs the OnDrop hooks
+// on it. Requests already holding it finish against it.
+func (r *Registry) Drop(key string) error {
+	if _, g := Split(key); g == "" { return ErrMain }
+	r.mu.RLock()
+	t, ok := r.tenants[key]
+	r.mu.RUnlock()
+	if !ok { return ErrUnknown }
+	return r.drop(t)
+}
+
+// drop removes t if it is still registered.
+func (r *Registry) drop(t *Tenant) error {
+	r.mu.Lock()
+	if r.tenants[t.Name] != t { r.mu.Unlock(); return ErrUnknown }
+	delete(r.tenants, t.Name)
+	hooks := r.drops
+	r.mu.Unlock()
+	if t.expiry != nil { t.expiry.Stop() }
+	t.AbortLoad()
+	for _, f := range hooks { f(t) }
+	metrics.DeleteTenant(t.Name)
+	return nil
+}
+
+// createGraph creates p's named graph g.
+func (r *Registry) createGraph(p *Tenant, g string, cfg *pymk.PYMKConfig) (*Tenant, error) {
+	key := Key(p.Name, g)
+	if t, ok := r.tenants[key]; ok { return t, nil }
+	c := p.Svc.Config()
+	if cfg != nil { c = *cfg }
+	t := &Tenant{Name: key, Graph: g, Blocks: p.Blocks, Users: p.Users, Attrs: p.Attrs}
+	if err := r.build(t, c, p); err != nil { return nil, err }
+	return t, nil
+}
+
+// build gives t its own graph and per-graph state, runs the wrappers and
+// registers it. A named graph takes its tenant's (main's) embeddings.
+func (r *Registry) build(t *Tenant, c pymk.PYMKConfig, main *Tenant) error {
+	c.Tenant = t.Name
+	local := graph.NewMemGraph()
+	if r.Shards > 0 { local = graph.NewMemGraphShards(r.Shards) }
+	t.Local, t.G, t.Top = local, local, graph.NewTop(local, 10*time.Second)
+	t.E = embeds.NewMemEmbeds()
+	t.Sources, t.Weights, t.Times, t.Refresh = graph.NewSources(), graph.NewWeights(), graph.NewFollowTimes(), pymk.NewNotifier()
+	tn, _ := Split(t.Name)
+	t.Topics = r.Topics.In(tn)
+	t.frozen = r.FrozenReads
+	t.loadWorkers = r.LoadWorkers
+	if t.loadWorkers <= 0 { t.loadWorkers = runtime.GOMAXPROCS(0) }
+	t.Top.Partition = func(u uint64) string { a, _ := t.Attrs.Get(u); return a.Locale() }
+	for _, w := range r.wraps { w(t) }
+	if main != nil { t.E = main.E } // after the wrappers, which may have wrapped the graph's own
+	t.G = graph.TrackSources(t.G, t.Sources)
+	t.G = graph.TrackTimes(t.G, t.Times)
+	t.Svc = t.newService(c, r.Flags)
+	if err := t.SetProfiles(c, r.profiles); err != nil { return err }
+	r.tenants[t.Name] = t
+	return nil
+}
+
+func (t *Tenant) newService(c pymk.PYMKConfig, fs *flags.Set) *pymk.Service {
+	svc := pymk.NewService(t.G, t.E, c)
+	svc.Eligible = t.Users.Visible
+	svc.Flags = fs
+	svc.Community = func(u uint64) (uint64, bool) { return t.Communities().Of(u) }
+	svc.Subject = t.Subject
+	svc.Topics = t.Topics
+	svc.Weights = t.Weights
+	svc.Times = t.Times
+	svc.Notify = t.Refresh
+	if t.frozen { svc.Read = graph.FrozenReads(t.G, t.Local) }
+	if c := t.Churn; c != nil && c.TTL > 0 {
+		svc.TTL = func(u uint64) time.Duration {
+			if c.Hot(u) { return c.TTL }
+			return 0
+		}
+	}
+	return svc
+}
+
+// Subject returns what attribute filters see of u.
+func (t *Tenant) Subject(u uint64) attrs.Subject {
+	a, _ := t.Attrs.Get(u)
+	return attrs.Subject{Attrs: a, Status: string(t.Users.Get(u))}
+}
+
+// Communities returns the latest community detection, or nil.
+func (t *Tenant) Communities() *community.Labels { return t.communities.Load() }
+
+// DetectCommunities runs community detection (see community.Detect) on
+// the tenant's local graph and publishes the result to its PYMK services.
+// It needs the whole graph on this node, so not in cluster mode.
+func (t *Tenant) DetectCommunities(ctx context.Context, rounds int) (*community.Labels, error) {
+	l, err := community.Detect(ctx, t.Local, rounds)
+	if err != nil { return nil, err }
+	t.communities.Store(l)
+	metrics.Communities.WithLabelValues(t.Name).Set(float64(l.Count()))
+	slog.Info("communities detected", "tenant", t.Name, "communities", l.Count(), "rounds", l.Rounds, "took", l.Took)
+	return l, nil
+}
+
+// SetProfiles derives the tenant's PYMK profiles from base, its own
+// config. Each profile is a separate service with its own cache; a
+// profile that already exists keeps its service and only drops its
+// cache. Nothing changes if any profile's config is invalid.
+func (t *Tenant) SetProfiles(base pymk.PYMKConfig, ps map[string]Profile) error {
+	base.Tenant = t.Name
+	cfgs := make(map[string]pymk.PYMKConfig, len(ps))
+	for n, p := range ps {
+		c, err := p(base)
+		if err != nil { return fmt.Errorf("pymk profile %s: %w", n, err) }
+		cfgs[n] = c
+	}
+	t.pmu.Lock(); defer t.pmu.Unlock()
+	next := make(map[string]*pymk.Service, len(cfgs))
+	for n, c := range cfgs {
+		if svc, ok := t.profiles[n]; ok {
+			svc.SetConfig(c)
+			next[n] = svc
+		} else {
+			next[n] = t.newService(c, t.Svc.Flags)
+		}
+	}
+	t.profiles = next
+	return nil
+}
+
+// Profile returns the service of PYMK profile name.
+func (t *Tenant) Profile(name string) (*pymk.Service, bool) {
+	t.pmu.RLock(); defer t.pmu.RUnlock()
+	svc, ok := t.profiles[name]
+	return svc, ok
+}
+
+// Services returns the tenant's default PYMK service and every profile's.
+func (t *Tenant) Services() []*pymk.Service {
+	t.pmu.RLock(); defer t.pmu.RUnlock()
+	out := []*pymk.Service{t.Svc}
+	for _, svc := range t.profiles { out = append(out, svc) }
+	return out
+}
+
+// InvalidateFollowers drops the cached PYMK results, in every profile, of
+// users and of up to fanout followers of each (0 = all of them): the
+// viewers whose two-hop candidates run through a user whose following
+// changed. It returns how many entries were dropped.
+func (t *Tenant) InvalidateFollowers(ctx context.Context, users []uint64, fanout int) (int, error) {
+	affected := append([]uint64(nil), users...)
+	for _, u := range users {
+		n := 0
+		err := t.G.ForEachFollowers(ctx, u, func(f uint64) bool {
+			affected = append(affected, f)
+			n++
+			return fanout == 0 || n < fanout
+		})
+		if err != nil { return 0, err }
+	}
+	dropped := 0
+	for _, svc := range t.Services() { dropped += svc.Invalidate(affected...) }
+	return dropped, nil
+}
+
+// CheckIntegrity runs an integrity check (see graph.CheckIntegrity) on the
+// tenant's local graph and records the result in the metrics. It needs
+// the whole graph on this node, so not in cluster mode. A check cut
+// short by an error records nothing.
+func (t *Tenant) CheckIntegrity(repair bool) (graph.IntegrityReport, error) {
+	rep, err := t.Local.CheckIntegrity(repair)
+	if err != nil { return rep, err }
+	metrics.GraphAsymmetries.WithLabelValues(t.Name, "in").Set(float64(rep.MissingIn))
+	metrics.GraphAsymmetries.WithLabelValues(t.Name, "out").Set(float64(rep.MissingOut))
+	metrics.IntegrityRepairs.WithLabelValues(t.Name).Add(float64(rep.Repaired))
+	metrics.IntegrityLastCheck.WithLabelValues(t.Name).SetToCurrentTime()
+	if n := rep.MissingIn + rep.MissingOut; n > 0 {
+		slog.Warn("graph integrity check found asymmetric edges", "tenant", t.Name,
+			"missing_in", rep.MissingIn, "missing_out", rep.MissingOut, "repaired", rep.Repaired)
+	}
+	return rep, nil
+}
+
+// Get returns the named tenant, creating it if AutoCreate is set, or the
+// graph a Key names.
+func (r *Registry) Get(name string) (*Tenant, error) {
+	r.mu.RLock()
+	t, ok := r.tenants[name]
+	r.mu.RUnlock()
+	if ok { return t, nil }
+	if _, g := Split(name); !r.AutoCreate || g != "" { return nil, ErrUnknown } // graphs are created explicitly
+	return r.Create(name, nil)
+}
+
+// Has reports whether the graph key name exists, without creating it.
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock(); defer r.mu.RUnlock()
+	_, ok := r.tenants[name]
+	return ok
+}
+
+// Names returns the key of every graph of every tenant.
+func (r *Registry) Names() []string {
+	r.mu.RLock(); defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.tenants))
+	for n := range r.tenants { out = append(out, n) }
+	sort.Strings(out)
+	return out
+}
+
+// GraphsOf returns the named graphs of tenant name.
+func (r *Registry) GraphsOf(name string) []string {
+	var out []string
+	for _, k := range r.Names() {
+		if tn, g := Split(k); tn == name && g != "" { out = append(out, g) }
+	}
+	return out
+}
+
+// Middleware resolves the tenant from a /t/<name>/ path prefix or the
+// X-Tenant header, and the graph from a /g/<name>/ prefix after it or the
+// X-Graph header (prefixes are stripped). It normalizes the graph's Key
+// into X-Tenant, so downstream handlers and metrics see a single source.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, g := Split(strings.ToLower(strings.TrimSpace(r.Header.Get(Header))))
+		hg := strings.ToLower(strings.TrimSpace(r.Header.Get(GraphHeader)))
+		if hg != "" { g = hg }
+		if seg, ok := cutSegment(&r, prefix); ok { name, g = seg, hg }
+		if seg, ok := cutSegment(&r, graphPrefix); ok { g = seg }
+		if name == "" { name = Default }
+		if !ValidName(name) || (g != "" && !ValidName(g)) { http.Error(w, ErrBadName.Error(), 400); return }
+		r.Header.Set(Header, Key(name, g))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cutSegment strips a /<p>/<name>/ prefix from *r's path, replacing *r
+// with a clone, and returns the name.
+func cutSegment(r **http.Request, p string) (string, bool) {
+	rest, ok := strings.CutPrefix((*r).URL.Path, p)
+	if !ok { return "", false }
+	seg, tail, _ := strings.Cut(rest, "/")
+	r2 := (*r).Clone((*r).Context())
+	r2.URL.Path = "/" + tail
+	r2.URL.RawPath = ""
+	*r = r2
+	return strings.ToLower(seg), true
+}
+
+// FromRequest returns the tenant name set by Middleware.
+func FromRequest(r *http.Request) string {
+	if n := r.Header.Get(Header); n != "" { return n }
+	return Default
+}
@@ -0,0 +1,214 @@
+// Package topics keeps the bipartite user→topic follow graph, beside the
+// user graph: which topics each user follows and who follows each topic.
+// PYMK reads it as a candidate source, and topic suggestions are built on
+// it.
+package topics
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrTooMany is returned by a follow that would take a user past the
+	// store's limit.
+	ErrTooMany = errors.New("too many topics followed")
+	ErrBadName = errors.New("bad topic name")
+
+	validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// Normalize case-folds a topic name and checks it.
+func Normalize(t string) (string, error) {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if !validName.MatchString(t) { return "", fmt.Errorf("%w %q", ErrBadName, t) }
+	return t, nil
+}
+
+type userKey struct {
+	tenant string
+	user   uint64
+}
+
+type topicKey struct {
+	tenant, topic string
+}
+
+// change is one line of the file.
+type change struct {
+	Tenant string `json:"tenant"`
+	User   uint64 `json:"user_id"`
+	Topic  string `json:"topic"`
+	Follow bool   `json:"follow"`
+}
+
+// Store holds every tenant's topic follows, indexed both ways. With a
+// path every change is appended to a JSON-lines file and replayed by Open.
+type Store struct {
+	mu      sync.RWMutex
+	follows map[userKey]map[string]struct{}
+	members map[topicKey]map[uint64]struct{}
+	max     int      // topics per user; 0 = unbounded
+	f       *os.File // nil when not persisted
+}
+
+// New returns a Store kept only in memory, allowing max topics per user
+// (0 = unbounded).
+func New(max int) *Store {
+	return &Store{follows: make(map[userKey]map[string]struct{}), members: make(map[topicKey]map[uint64]struct{}), max: max}
+}
+
+// Open replays the topics file at path, creating it if needed, and
+// appends later changes to it. The limit applies to new follows only.
+func Open(path string, max int) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil { return nil, err }
+	s := New(max)
+	br := bufio.NewReaderSize(f, 64<<10)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 { slog.Warn("topics: dropping partial last line", "path", path) }
+			break
+		}
+		if err != nil { f.Close(); return nil, err }
+		var c change
+		if err := json.Unmarshal(line, &c); err != nil { f.Close(); return nil, fmt.Errorf("topics: %s:%d: %w", path, n, err) }
+		s.apply(c)
+	}
+	s.f = f
+	return s, nil
+}
+
+// apply makes c and reports whether anything changed. s.mu must be held.
+func (s *Store) apply(c change) bool {
+	uk, tk := userKey{c.Tenant, c.User}, topicKey{c.Tenant, c.Topic}
+	ts, us := s.follows[uk], s.members[tk]
+	_, had := ts[c.Topic]
+	if had == c.Follow { return false }
+	if c.Follow {
+		if ts == nil { ts = make(map[string]struct{}); s.follows[uk] = ts }
+		if us == nil { us = make(map[uint64]struct{}); s.members[tk] = us }
+		ts[c.Topic], us[c.User] = struct{}{}, struct{}{}
+		return true
+	}
+	delete(ts, c.Topic)
+	delete(us, c.User)
+	if len(ts) == 0 { delete(s.follows, uk) }
+	if len(us) == 0 { delete(s.members, tk) }
+	return true
+}
+
+func (s *Store) commit(c change) (bool, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	ts := s.follows[userKey{c.Tenant, c.User}]
+	if _, had := ts[c.Topic]; had == c.Follow { return false, nil }
+	if c.Follow && s.max > 0 && len(ts) >= s.max { return false, fmt.Errorf("%w: limit %d", ErrTooMany, s.max) }
+	if s.f != nil {
+		b, err := json.Marshal(c)
+		if err != nil { return false, err }
+		if _, err := s.f.Write(append(b, '\n')); err != nil { return false, err }
+	}
+	return s.apply(c), nil
+}
+
+// Follow makes user follow topic and reports whether it did not already.
+func (s *Store) Follow(tenant string, user uint64, topic string) (bool, error) {
+	t, err := Normalize(topic)
+	if err != nil { return false, err }
+	return s.commit(change{Tenant: tenant, User: user, Topic: t, Follow: true})
+}
+
+// Unfollow is the reverse of Follow.
+func (s *Store) Unfollow(tenant string, user uint64, topic string) (bool, error) {
+	t, err := Normalize(topic)
+	if err != nil { return false, err }
+	return s.commit(change{Tenant: tenant, User: user, Topic: t})
+}
+
+// Of returns the topics user follows, sorted.
+func (s *Store) Of(tenant string, user uint64) []string {
+	s.mu.RLock()
+	ts := s.follows[userKey{tenant, user}]
+	out := make([]string, 0, len(ts))
+	for t := range ts { out = append(out, t) }
+	s.mu.RUnlock()
+	slices.Sort(out)
+	return out
+}
+
+// Followers returns up to limit (0 = all) of topic's followers, in no
+// particular order.
+func (s *Store) Followers(tenant, topic string, limit int) []uint64 {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	us := s.members[topicKey{tenant, topic}]
+	n := len(us)
+	if limit > 0 && limit < n { n = limit }
+	out := make([]uint64, 0, n)
+	for u := range us {
+		if len(out) == n { break }
+		out = append(out, u)
+	}
+	return out
+}
+
+// Count returns how many users follow topic.
+func (s *Store) Count(tenant, topic string) int {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return len(s.members[topicKey{tenant, topic}])
+}
+
+func (s *Store) Close() error {
+	if s == nil || s.f == nil { return nil }
+	s.mu.Lock(); defer s.mu.Unlock()
+	if err := s.f.Sync(); err != nil { s.f.Close(); return err }
+	return s.f.Close()
+}
+
+// View is one tenant's part of a Store. The zero View, of no store, has
+// no follows.
+type View struct {
+	s      *Store
+	tenant string
+}
+
+func (s *Store) In(tenant string) View { return View{s, tenant} }
+
+// errNoStore fails changes through the zero View.
+var errNoStore = errors.New("topics: no store")
+
+func (v View) Follow(user uint64, topic string) (bool, error) {
+	if v.s == nil { return false, errNoStore }
+	return v.s.Follow(v.tenant, user, topic)
+}
+
+func (v View) Unfollow(user uint64, topic string) (bool, error) {
+	if v.s == nil { return false, errNoStore }
+	return v.s.Unfollow(v.tenant, user, topic)
+}
+
+func (v View) Of(user uint64) []string {
+	if v.s == nil { return nil }
+	return v.s.Of(v.tenant, user)
+}
+
+func (v View) Followers(topic string, limit int) []uint64 {
+	if v.s == nil { return nil }
+	return v.s.Followers(v.tenant, topic, limit)
+}
+
+func (v View) Count(topic string) int {
+	if v.s == nil { return 0 }
+	return v.s.Count(v.tenant, topic)
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pandharkardeep/social-graph/internal/graph"
+)
+
+// Store wraps g so its calls produce child spans of the context they are
+// given. Methods not overridden here pass straight through untraced.
+func Store(g graph.Store) graph.Store {
+	if !Enabled { return g }
+	return &tracedStore{Store: g}
+}
+
+type tracedStore struct {
+	graph.Store
+}
+
+func (t *tracedStore) Follow(ctx context.Context, u, v uint64) (ok bool, err error) {
+	ctx, sp := Start(ctx, "store.Follow", attribute.Int64("src", int64(u)), attribute.Int64("dst", int64(v)))
+	defer func() { End(sp, err) }()
+	return t.Store.Follow(ctx, u, v)
+}
+
+func (t *tracedStore) Unfollow(ctx context.Context, u, v uint64) (ok bool, err error) {
+	ctx, sp := Start(ctx, "store.Unfollow", attribute.Int64("src", int64(u)), attribute.Int64("dst", int64(v)))
+	defer func() { End(sp, err) }()
+	return t.Store.Unfollow(ctx, u, v)
+}
+
+func (t *tracedStore) FollowIf(ctx context.Context, u, v, epoch uint64) (ok bool, err error) {
+	ctx, sp := Start(ctx, "store.FollowIf", attribute.Int64("src", int64(u)), attribute.Int64("dst", int64(v)), attribute.Int64("epoch", int64(epoch)))
+	defer func() { End(sp, err) }()
+	return t.Store.FollowIf(ctx, u, v, epoch)
+}
+
+func (t *tracedStore) UnfollowIf(ctx context.Context, u, v, epoch uint64) (ok bool, err error) {
+	ctx, sp := Start(ctx, "store.UnfollowIf", attribute.Int64("src", int64(u)), attribute.Int64("dst", int64(v)), attribute.Int64("epoch", int64(epoch)))
+	defer func() { End(sp, err) }()
+	return t.Store.UnfollowIf(ctx, u, v, epoch)
+}
+
+func (t *tracedStore) Apply(ctx context.Context, ops []graph.EdgeOp) (changed []bool, err error) {
+	ctx, sp := Start(ctx, "store.Apply", attribute.Int("ops", len(ops)))
+	defer func() { End(sp, err) }()
+	return t.Store.Apply(ctx, ops)
+}
+
+func (t *tracedStore) Following(ctx context.Context, u uint64) (out []uint64, err error) {
+	ctx, sp := Start(ctx, "store.Following", attribute.Int64("user", int64(u)))
+	defer func() { End(sp, err) }()
+	out, err = t.Store.Following(ctx, u)
+	sp.SetAttributes(attribute.Int("count", len(out)))
+	return out, err
+}
+
+func (t *tracedStore) Followers(ctx context.Context, u uint64) (out []uint64, err error) {
+	ctx, sp := Start(ctx, "store.Followers", attribute.Int64("user", int64(u)))
+	defer func() { End(sp, err) }()
+	out, err = t.Store.Followers(ctx, u)
+	sp.SetAttributes(attribute.Int("count", len(out)))
+	return out, err
+}
+
+func (t *tracedStore) Degrees(ctx context.Context, users []uint64) (out []graph.DegreeUser, err error) {
+	ctx, sp := Start(ctx, "store.Degrees", attribute.Int("users", len(users)))
+	defer func() { End(sp, err) }()
+	return t.Store.Degrees(ctx, users)
+}
@@ -0,0 +1,52 @@
+package users
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDs vends new user IDs snowflake-style: milliseconds since idEpoch in
+// the top 41 bits (under the sign bit), then a 10-bit node number and a
+// 12-bit sequence within the millisecond. Nodes with distinct numbers
+// never hand out the same ID, with nothing to coordinate or persist, and
+// IDs sort by creation time. All of them are below 2^63, clear of string
+// user IDs (see package identity), until about 2093.
+type IDs struct {
+	mu   sync.Mutex
+	node uint64
+	last int64 // milliseconds since idEpoch of the last ID
+	seq  uint64
+}
+
+const (
+	nodeBits = 10
+	seqBits  = 12
+	MaxNode  = 1<<nodeBits - 1
+)
+
+var idEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func NewIDs(node int) (*IDs, error) {
+	if node < 0 || node > MaxNode { return nil, fmt.Errorf("users: node %d not in 0..%d", node, MaxNode) }
+	return &IDs{node: uint64(node)}, nil
+}
+
+// Next returns a new ID. If the clock steps back, IDs keep counting from
+// the latest millisecond seen rather than repeating one.
+func (g *IDs) Next() uint64 {
+	g.mu.Lock(); defer g.mu.Unlock()
+	now := time.Since(idEpoch).Milliseconds()
+	if now > g.last {
+		g.last, g.seq = now, 0
+	} else if g.seq++; g.seq > 1<<seqBits-1 {
+		// 4096 IDs this millisecond: borrow the next one.
+		g.last, g.seq = g.last+1, 0
+	}
+	return uint64(g.last)<<(nodeBits+seqBits) | g.node<<seqBits | g.seq
+}
+
+// Time returns when id was vended, for IDs made by Next.
+func Time(id uint64) time.Time {
+	return idEpoch.Add(time.Duration(id>>(nodeBits+seqBits)) * time.Millisecond)
+}
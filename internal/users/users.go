@@ -0,0 +1,128 @@
+// Package users tracks per-user account state. Users the graph has never
+// heard of are active.
+package users
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrAliasCycle = errors.New("alias would form a cycle")
+
+type Status string
+
+const (
+	Active      Status = "active"
+	Deactivated Status = "deactivated" // by the user; edges kept, hidden from suggestions
+	Suspended   Status = "suspended"   // by moderation; same visibility as deactivated
+)
+
+func ParseStatus(s string) (Status, error) {
+	switch st := Status(s); st {
+	case Active, Deactivated, Suspended:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown status %q", s)
+}
+
+// Privacy is who may see a user's following and followers lists.
+type Privacy string
+
+const (
+	Public    Privacy = "public"
+	Followers Privacy = "followers" // the user and their followers
+	Private   Privacy = "private"   // the user alone
+)
+
+func ParsePrivacy(s string) (Privacy, error) {
+	switch p := Privacy(s); p {
+	case Public, Followers, Private:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown privacy %q", s)
+}
+
+// Store only records non-active users, non-public lists and aliases, so
+// it stays small.
+type Store struct {
+	mu      sync.RWMutex
+	m       map[uint64]Status
+	privacy map[uint64]Privacy
+	aliases map[uint64]uint64 // merged-away ID -> ID it was merged into
+}
+
+func New() *Store {
+	return &Store{m: make(map[uint64]Status), privacy: make(map[uint64]Privacy), aliases: make(map[uint64]uint64)}
+}
+
+// Set changes u's status and reports whether it changed.
+func (s *Store) Set(u uint64, st Status) bool {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.m[u] == st || (st == Active && s.m[u] == "") { return false }
+	if st == Active { delete(s.m, u) } else { s.m[u] = st }
+	return true
+}
+
+func (s *Store) Get(u uint64) Status {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	if st, ok := s.m[u]; ok { return st }
+	return Active
+}
+
+// Visible reports whether u may appear in suggestions, mutuals and
+// connection explanations.
+func (s *Store) Visible(u uint64) bool {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	_, inactive := s.m[u]
+	return !inactive
+}
+
+// -------- List privacy --------
+
+// SetPrivacy changes who may see u's lists and reports whether it changed.
+func (s *Store) SetPrivacy(u uint64, p Privacy) bool {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.privacy[u] == p || (p == Public && s.privacy[u] == "") { return false }
+	if p == Public { delete(s.privacy, u) } else { s.privacy[u] = p }
+	return true
+}
+
+func (s *Store) Privacy(u uint64) Privacy {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	if p, ok := s.privacy[u]; ok { return p }
+	return Public
+}
+
+// -------- Aliases --------
+
+// Alias makes from resolve to to, after an upstream account merge.
+func (s *Store) Alias(from, to uint64) error {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.resolve(to) == from { return ErrAliasCycle }
+	s.aliases[from] = to
+	return nil
+}
+
+// Resolve follows aliases from u to the live ID; unaliased IDs map to
+// themselves.
+func (s *Store) Resolve(u uint64) uint64 {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	return s.resolve(u)
+}
+
+func (s *Store) resolve(u uint64) uint64 {
+	for {
+		to, ok := s.aliases[u]
+		if !ok { return u }
+		u = to
+	}
+}
+
+// Aliases returns a copy of every alias.
+func (s *Store) Aliases() map[uint64]uint64 {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	out := make(map[uint64]uint64, len(s.aliases))
+	for k, v := range s.aliases { out[k] = v }
+	return out
+}